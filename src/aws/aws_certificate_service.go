@@ -6,63 +6,120 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/acm"
 	"github.com/aws/aws-sdk-go-v2/service/acm/types"
+	"io"
+	"strings"
 	"time"
 )
 
-func initCertificateClient(region *string) (*acm.Client, error) {
-	config, err := initConfig(region)
-	if err != nil {
-		return nil, err
+func initCertificateClient(region *string) (ACMAPI, error) {
+	return clients.ACM(region)
+}
+
+// certificateDomains are the names of the one certificate cloudGun requests in a region, the domain and any subdomain of it.
+func certificateDomains(domain *string) []string {
+	return []string{*domain, "*." + *domain}
+}
+
+// coversDomain tells if a certificate of names is valid for domain. a wildcard only covers a single label.
+func coversDomain(names []string, domain string) bool {
+	domain = strings.ToLower(domain)
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if name == domain {
+			return true
+		}
+		if strings.HasPrefix(name, "*.") {
+			label, parent, found := strings.Cut(domain, ".")
+			if found && label != "" && parent == name[2:] {
+				return true
+			}
+		}
 	}
-	return acm.NewFromConfig(config), nil
+	return false
 }
 
-func requestCertificate(domain *string, domains *[]string, region *string, retry int) (*string, error) {
+func coversDomains(names []string, domains []string) bool {
+	for _, domain := range domains {
+		if !coversDomain(names, domain) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestCertificate returns a certificate covering domains. it reuses the certificate of the stack or an issued one of
+// the account, and only requests a wildcard certificate of domain when there is neither.
+func requestCertificate(progress io.Writer, domain *string, domains *[]string, region *string) (*string, error) {
 	client, err := initCertificateClient(region)
 	if err != nil {
 		return nil, err
 	}
-	requestCertInput := acm.RequestCertificateInput{
-		DomainName:              aws.String(*domain),
-		ValidationMethod:        types.ValidationMethodDns,
-		SubjectAlternativeNames: *domains,
-		Tags: []types.Tag{
-			{
-				Key:   aws.String(baseTagName),
-				Value: aws.String(baseTagValue),
-			},
-			{
-				Key:   aws.String(baseUUIDTagName),
-				Value: aws.String(BaseUUIDTagValue),
-			},
-		},
-	}
-	certificate, err := client.RequestCertificate(ctx, &requestCertInput)
+	certificateArn, err := findStateCertificate(domains, region)
 	if err != nil {
 		return nil, err
 	}
+	if certificateArn != nil {
+		fmt.Fprintln(progress, fmt.Sprintf("adopting existing certificate %s", *certificateArn))
+	} else {
+		certificateArn, err = findIssuedCertificate(domains, region)
+		if err != nil {
+			return nil, err
+		}
+		if certificateArn != nil {
+			// not a resource of the stack, delete keeps it
+			fmt.Fprintln(progress, fmt.Sprintf("reusing issued certificate %s", *certificateArn))
+			return certificateArn, nil
+		}
+
+		requestDomains := certificateDomains(domain)
+		requestCertInput := acm.RequestCertificateInput{
+			DomainName:              aws.String(*domain),
+			ValidationMethod:        types.ValidationMethodDns,
+			SubjectAlternativeNames: requestDomains,
+			Tags: []types.Tag{
+				{
+					Key:   aws.String(baseTagName),
+					Value: aws.String(baseTagValue),
+				},
+				{
+					Key:   aws.String(baseUUIDTagName),
+					Value: aws.String(BaseUUIDTagValue),
+				},
+			},
+		}
+		certificate, err := client.RequestCertificate(ctx, &requestCertInput)
+		if err != nil {
+			return nil, err
+		}
+		certificateArn = certificate.CertificateArn
+		err = recordResource(CertificateManagerCertificate, certificateArn, region,
+			map[string]string{"domain": *domain, "domains": strings.Join(requestDomains, ",")})
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// wait for aws to give records to be set
 	var describeCertOutput *acm.DescribeCertificateOutput
-	describeCertInput := acm.DescribeCertificateInput{CertificateArn: certificate.CertificateArn}
-	for i := 0; i < retry; i++ {
+	describeCertInput := acm.DescribeCertificateInput{CertificateArn: certificateArn}
+	err = waitUntil("certificate validation records", Timeouts.CertificateRecords, func() (bool, error) {
 		describeCertOutput, err = client.DescribeCertificate(ctx, &describeCertInput)
 		if err != nil {
-			return nil, err
+			return false, err
 		}
-		isResourceRecordSet := true
 		for _, options := range describeCertOutput.Certificate.DomainValidationOptions {
 			if options.ResourceRecord == nil {
-				time.Sleep(time.Second)
-				isResourceRecordSet = false
+				return false, nil
 			}
 		}
-		if isResourceRecordSet == true {
-			break
-		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// setup records
+	// setup records, a wildcard is validated by the same record as its domain
+	created := make(map[string]bool)
 	for _, options := range describeCertOutput.Certificate.DomainValidationOptions {
 		if options.ValidationStatus == types.DomainStatusSuccess {
 			continue
@@ -70,40 +127,131 @@ func requestCertificate(domain *string, domains *[]string, region *string, retry
 		if options.ResourceRecord == nil {
 			return nil, errors.New("DomainValidationOptions[].ResourceRecord is not set from aws after retry")
 		}
-		fmt.Println("createCertificateRecord")
-		err = createCertificateRecord(region, domain, options.ResourceRecord.Name, options.ResourceRecord.Value)
+		if created[*options.ResourceRecord.Name] {
+			continue
+		}
+		created[*options.ResourceRecord.Name] = true
+		fmt.Fprintln(progress, "createCertificateRecord")
+		err = createCertificateRecord(region, options.ResourceRecord.Name, options.ResourceRecord.Value)
 		if err != nil {
 			return nil, err
 		}
 	}
-	return certificate.CertificateArn, nil
+	return certificateArn, nil
 }
 
-func waitCertificateIssued(region *string, certificateArn *string, retry int) error {
+// findStateCertificate returns a certificate of the stack covering domains that can still be issued.
+func findStateCertificate(domains *[]string, region *string) (*string, error) {
 	client, err := initCertificateClient(region)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	var describeCertOutput *acm.DescribeCertificateOutput
-	describeCertInput := acm.DescribeCertificateInput{CertificateArn: certificateArn}
-	for i := 0; i < retry; i++ {
-		fmt.Println(fmt.Sprintf("checking if acm certificate is issued retry %d", i))
-		describeCertOutput, err = client.DescribeCertificate(ctx, &describeCertInput)
+	for _, resource := range GetStateResources(CertificateManagerCertificate) {
+		if resource.Region != *region || !coversDomains(strings.Split(resource.Attributes["domains"], ","), *domains) {
+			continue
+		}
+		output, err := client.DescribeCertificate(ctx, &acm.DescribeCertificateInput{CertificateArn: aws.String(resource.Id)})
 		if err != nil {
-			return nil
+			if isNotFound(err) {
+				continue
+			}
+			return nil, err
 		}
-		if describeCertOutput.Certificate.Status != types.CertificateStatusIssued {
-			time.Sleep(time.Second)
-			continue
+		status := output.Certificate.Status
+		if status == types.CertificateStatusIssued || status == types.CertificateStatusPendingValidation {
+			return output.Certificate.CertificateArn, nil
 		}
-		break
 	}
-	if describeCertOutput.Certificate.Status != types.CertificateStatusIssued {
-		return errors.New(fmt.Sprintf("certificate %s is not yet issued by aws", *certificateArn))
+	return nil, nil
+}
+
+// findIssuedCertificate returns an issued certificate of the account covering domains. certificates of other stacks
+// are skipped, deleting their stack would delete them.
+func findIssuedCertificate(domains *[]string, region *string) (*string, error) {
+	client, err := initCertificateClient(region)
+	if err != nil {
+		return nil, err
+	}
+	paginator := acm.NewListCertificatesPaginator(client, &acm.ListCertificatesInput{
+		CertificateStatuses: []types.CertificateStatus{types.CertificateStatusIssued},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, summary := range page.CertificateSummaryList {
+			output, err := client.DescribeCertificate(ctx, &acm.DescribeCertificateInput{CertificateArn: summary.CertificateArn})
+			if err != nil {
+				if isNotFound(err) {
+					continue
+				}
+				return nil, err
+			}
+			certificate := output.Certificate
+			names := append([]string{aws.ToString(certificate.DomainName)}, certificate.SubjectAlternativeNames...)
+			if certificate.Status != types.CertificateStatusIssued || !coversDomains(names, *domains) {
+				continue
+			}
+			// imported certificates are not renewed by acm
+			if certificate.Type == types.CertificateTypeImported && certificate.NotAfter != nil && time.Until(*certificate.NotAfter) < 30*24*time.Hour {
+				continue
+			}
+			tags, err := client.ListTagsForCertificate(ctx, &acm.ListTagsForCertificateInput{CertificateArn: summary.CertificateArn})
+			if err != nil {
+				return nil, err
+			}
+			owner := ""
+			for _, tag := range tags.Tags {
+				if aws.ToString(tag.Key) == baseUUIDTagName {
+					owner = aws.ToString(tag.Value)
+				}
+			}
+			if owner != "" && owner != BaseUUIDTagValue {
+				continue
+			}
+			return summary.CertificateArn, nil
+		}
+	}
+	return nil, nil
+}
+
+func waitCertificateIssued(progress io.Writer, region *string, certificateArn *string) error {
+	client, err := initCertificateClient(region)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(progress, fmt.Sprintf("waiting for acm certificate %s to be issued", *certificateArn))
+	waiter := acm.NewCertificateValidatedWaiter(client)
+	err = waiter.Wait(ctx, &acm.DescribeCertificateInput{CertificateArn: certificateArn}, Timeouts.CertificateValidated)
+	if err != nil {
+		return errors.New(fmt.Sprintf("certificate %s is not issued by aws : %s", *certificateArn, err.Error()))
 	}
 	return nil
 }
 
+// getCertificateValidationRecords returns the dns validation records of a certificate, name to value.
+func getCertificateValidationRecords(region *string, arn *string) (map[string]string, error) {
+	client, err := initCertificateClient(region)
+	if err != nil {
+		return nil, err
+	}
+	records := make(map[string]string)
+	output, err := client.DescribeCertificate(ctx, &acm.DescribeCertificateInput{CertificateArn: arn})
+	if err != nil {
+		if isNotFound(err) {
+			return records, nil
+		}
+		return nil, err
+	}
+	for _, options := range output.Certificate.DomainValidationOptions {
+		if options.ResourceRecord != nil {
+			records[*options.ResourceRecord.Name] = *options.ResourceRecord.Value
+		}
+	}
+	return records, nil
+}
+
 func deleteCertificate(region *string, arn *string) error {
 	client, err := initCertificateClient(region)
 	if err != nil {
@@ -7,20 +7,17 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"io"
 	"strings"
 )
 
-func initCloudfrontClient(region *string) (*cloudfront.Client, error) {
-	config, err := initConfig(region)
-	if err != nil {
-		return nil, err
-	}
-	return cloudfront.NewFromConfig(config), nil
+func initCloudfrontClient(region *string) (CloudFrontAPI, error) {
+	return clients.CloudFront(region)
 }
 
-func createCloudfront(region *string, bucketName *string, domain *string, certArn *string) (*string, *string, error) {
-	cloudfrontRegion := aws.String("us-east-1")
-	err := waitCertificateIssued(cloudfrontRegion, certArn, 360)
+func createCloudfront(progress io.Writer, region *string, bucketName *string, domain *string, certArn *string) (*string, *string, error) {
+	cloudfrontRegion := aws.String(globalRegion)
+	err := waitCertificateIssued(progress, cloudfrontRegion, certArn)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -30,6 +27,24 @@ func createCloudfront(region *string, bucketName *string, domain *string, certAr
 		return nil, nil, err
 	}
 
+	for _, resource := range GetStateResources(CloudFrontDistribution) {
+		if resource.Attributes["alias"] != *domain {
+			continue
+		}
+		existing, err := client.GetDistribution(ctx, &cloudfront.GetDistributionInput{Id: aws.String(resource.Attributes["id"])})
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return nil, nil, err
+		}
+		if !*existing.Distribution.DistributionConfig.Enabled {
+			continue
+		}
+		fmt.Fprintln(progress, fmt.Sprintf("adopting existing cloudfront distribution %s", *existing.Distribution.Id))
+		return existing.Distribution.DomainName, existing.Distribution.Id, nil
+	}
+
 	originId, err := uuid.CreateUUID()
 	if err != nil {
 		return nil, nil, err
@@ -88,6 +103,11 @@ func createCloudfront(region *string, bucketName *string, domain *string, certAr
 	if err != nil {
 		return nil, nil, err
 	}
+	err = recordResource(CloudFrontDistribution, res.Distribution.ARN, cloudfrontRegion,
+		map[string]string{"id": *res.Distribution.Id, "domainName": *res.Distribution.DomainName, "alias": *domain})
+	if err != nil {
+		return nil, nil, err
+	}
 	return res.Distribution.DomainName, res.Distribution.Id, nil
 }
 
@@ -117,6 +137,40 @@ func disableCloudfront(region *string, arn *string) error {
 	return nil
 }
 
+// getCloudfrontDomainName returns the cloudfront.net domain of a distribution or nil when it does not exist.
+func getCloudfrontDomainName(region *string, arn *string) (*string, error) {
+	res := strings.Split(*arn, "distribution/")
+	if len(res) != 2 {
+		return nil, errors.New(fmt.Sprintf("arn %s is not a valid cloudfron arn", *arn))
+	}
+	client, err := initCloudfrontClient(region)
+	if err != nil {
+		return nil, err
+	}
+	distribution, err := client.GetDistribution(ctx, &cloudfront.GetDistributionInput{Id: &res[1]})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return distribution.Distribution.DomainName, nil
+}
+
+// waitCloudfrontDeployed waits until a change to a distribution, like disabling it, is deployed to every edge location.
+func waitCloudfrontDeployed(region *string, arn *string) error {
+	res := strings.Split(*arn, "distribution/")
+	if len(res) != 2 {
+		return errors.New(fmt.Sprintf("arn %s is not a valid cloudfron arn", *arn))
+	}
+	client, err := initCloudfrontClient(region)
+	if err != nil {
+		return err
+	}
+	waiter := cloudfront.NewDistributionDeployedWaiter(client)
+	return waiter.Wait(ctx, &cloudfront.GetDistributionInput{Id: &res[1]}, Timeouts.DistributionDeployed)
+}
+
 func deleteCloudfront(region *string, arn *string) error {
 	res := strings.Split(*arn, "distribution/")
 	if len(res) != 2 {
@@ -128,7 +182,7 @@ func deleteCloudfront(region *string, arn *string) error {
 	}
 
 	config, err := client.GetDistributionConfig(ctx, &cloudfront.GetDistributionConfigInput{Id: &res[1]})
-	if err != nil && strings.Contains(err.Error(), "The specified distribution does not exist") {
+	if err != nil && isNotFound(err) {
 		return nil
 	} else if err != nil {
 		return err
@@ -0,0 +1,326 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"slices"
+	"sync"
+)
+
+// deleteDependencies lists the types that have to be gone before a resource of a type can be deleted.
+// a resource group is deleted after everything else.
+var deleteDependencies = map[ResourceIdentifier][]ResourceIdentifier{
+	CertificateManagerCertificate:    {ElasticLoadBalancingListener, ElasticLoadBalancingLoadBalancer, CloudFrontDistribution},
+	ElasticLoadBalancingLoadBalancer: {ElasticLoadBalancingListener},
+	ElasticLoadBalancingTargetGroup:  {ElasticLoadBalancingListener, ElasticLoadBalancingLoadBalancer, ECSService},
+	ECSTaskDefinition:                {ECSService},
+	ECSCluster:                       {ECSService},
+	ECSCapacityProvider:              {ECSCluster},
+	AutoScalingGroup:                 {ECSCapacityProvider},
+	EC2LaunchTemplate:                {AutoScalingGroup},
+	EC2Instance:                      {AutoScalingGroup}, // the group would launch a replacement
+	EC2SecurityGroup:                 {EC2Instance, AutoScalingGroup, ElasticLoadBalancingLoadBalancer, ECSService},
+	S3Bucket:                         {CloudFrontDistribution},
+	IAMUser:                          {IAMAccessKey},
+	IAMRole:                          {AutoScalingGroup, EC2LaunchTemplate, ECSService, ECSTaskDefinition},
+	LogsLogGroup:                     {ECSService}, // the last lines of the tasks are kept until they stop
+}
+
+type deleteNode struct {
+	resource  StackResource
+	dependsOn []*deleteNode
+	done      chan struct{}
+	err       error
+}
+
+func isDeleteDependency(identifier ResourceIdentifier, dependency ResourceIdentifier) bool {
+	if identifier == ResourceGroupsGroup {
+		return dependency != ResourceGroupsGroup
+	}
+	return slices.Contains(deleteDependencies[identifier], dependency)
+}
+
+// deleteGraph deletes resources concurrently. each resource is deleted as soon as the resources it depends on are gone,
+// and a resource whose dependency could not be deleted is left alone. the resources left behind are returned.
+func deleteGraph(resources []StackResource) []StackResource {
+	nodes := make([]*deleteNode, 0, len(resources))
+	for _, resource := range resources {
+		nodes = append(nodes, &deleteNode{resource: resource, done: make(chan struct{})})
+	}
+	for _, node := range nodes {
+		for _, other := range nodes {
+			if node != other && isDeleteDependency(node.resource.Type, other.resource.Type) {
+				node.dependsOn = append(node.dependsOn, other)
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(node.done)
+			for _, dependency := range node.dependsOn {
+				<-dependency.done
+				if dependency.err != nil {
+					node.err = errors.New(fmt.Sprintf("%s %s was not deleted", dependency.resource.Type, dependency.resource.Id))
+					return
+				}
+			}
+			fmt.Println(fmt.Sprintf("deleting %s %s", node.resource.Type, node.resource.Id))
+			node.err = deleteStackResource(&node.resource)
+			if node.err != nil {
+				return
+			}
+			fmt.Println(fmt.Sprintf("deleted %s %s", node.resource.Type, node.resource.Id))
+			node.err = forgetResource(node.resource.Type, node.resource.Id)
+		}()
+	}
+	wg.Wait()
+
+	leftovers := make([]StackResource, 0)
+	for _, node := range nodes {
+		if node.err != nil {
+			fmt.Println(fmt.Sprintf("could not delete %s %s : %s", node.resource.Type, node.resource.Id, node.err.Error()))
+			leftovers = append(leftovers, node.resource)
+		}
+	}
+	return leftovers
+}
+
+// resourceKey identifies a resource found both in the state and in aws. resources deleted by name are keyed by name.
+func resourceKey(resource *StackResource) string {
+	switch resource.Type {
+	case ResourceGroupsGroup, AutoScalingGroup, EC2LaunchTemplate:
+		return fmt.Sprintf("%s/%s/%s", resource.Type, resource.Region, resource.Attributes["name"])
+	case IAMUser, IAMRole:
+		return fmt.Sprintf("%s/%s", resource.Type, resource.Attributes["name"])
+	}
+	return fmt.Sprintf("%s/%s", resource.Type, resource.Id)
+}
+
+// collectStackResources merges the resources of the state with the ones found in aws by tags and names.
+func collectStackResources(region *string, name *string) ([]StackResource, error) {
+	found, err := findStackResources(region, name)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]StackResource, 0, len(found))
+	for _, item := range found {
+		resources = append(resources, item.resource)
+	}
+	return resources, nil
+}
+
+// where findStackResources found a resource first
+const (
+	foundInState         = "state"
+	foundInResourceGroup = "resource group"
+	foundByLookup        = "lookup" // not in the resource group, found by its name or tags
+)
+
+type foundResource struct {
+	resource StackResource
+	source   string
+}
+
+// findStackResources is collectStackResources telling where each resource was found.
+func findStackResources(region *string, name *string) ([]foundResource, error) {
+	resources := make([]foundResource, 0)
+	keys := make(map[string]bool)
+	add := func(resource StackResource, source string) {
+		key := resourceKey(&resource)
+		if !keys[key] {
+			keys[key] = true
+			resources = append(resources, foundResource{resource: resource, source: source})
+		}
+	}
+
+	for _, resource := range GetStateResources("") {
+		if resource.Type == IAMOIDCProvider { // 모든 stack 이 같이 사용한다
+			continue
+		}
+		add(resource, foundInState)
+	}
+
+	for _, groupRegion := range stackRegions(region) {
+		items, err := listGroupResources(name, &groupRegion)
+		if err != nil {
+			return nil, err
+		}
+		if items == nil {
+			continue
+		}
+		add(StackResource{Type: ResourceGroupsGroup, Id: *name, Region: groupRegion, Attributes: map[string]string{"name": *name}}, foundInResourceGroup)
+		for _, item := range items {
+			add(item, foundInResourceGroup)
+			if item.Type == ECSCapacityProvider {
+				// 이상하게 asg 는 조회가 되지 않아 capacity provider 에서 찾는다.
+				asgName, err := getCapacityProviderASGName(&groupRegion, &item.Id)
+				if err != nil {
+					return nil, err
+				}
+				if asgName != nil {
+					add(StackResource{Type: AutoScalingGroup, Id: *asgName, Region: groupRegion, Attributes: map[string]string{"name": *asgName}}, foundInResourceGroup)
+				}
+			}
+		}
+	}
+
+	// iam, launch template 또한 resource group 안에 없음
+	users, err := listStackIAMUsers(region)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		add(StackResource{Type: IAMUser, Id: user, Region: *region, Attributes: map[string]string{"name": user}}, foundByLookup)
+	}
+	roles, err := listStackIAMRoles(region)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		add(StackResource{Type: IAMRole, Id: role, Region: *region, Attributes: map[string]string{"name": role}}, foundByLookup)
+	}
+	templateId, err := findLaunchTemplate(region, name)
+	if err != nil {
+		return nil, err
+	}
+	if templateId != nil {
+		add(StackResource{Type: EC2LaunchTemplate, Id: *templateId, Region: *region, Attributes: map[string]string{"name": *name}}, foundByLookup)
+	}
+	securityGroups, err := findStackSecurityGroups(region, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range securityGroups {
+		add(StackResource{Type: EC2SecurityGroup, Id: *group.GroupId, Region: *region, Attributes: map[string]string{"name": *group.GroupName}}, foundByLookup)
+	}
+	return resources, nil
+}
+
+func deleteStackResource(resource *StackResource) error {
+	region := &resource.Region
+	id := &resource.Id
+	switch resource.Type {
+	case ResourceGroupsGroup:
+		return deleteResourceGroup(aws.String(resource.Attributes["name"]), region)
+	case S3Bucket:
+		err := deleteBucket(region, id)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		return nil
+	case CertificateManagerCertificate:
+		// load balancers and distributions are already gone, but acm takes a moment to notice
+		return retryOn("deleteCertificate", Timeouts.ResourceDeleted, func() error {
+			err := deleteCertificate(region, id)
+			if err != nil && isNotFound(err) {
+				return nil
+			}
+			return err
+		}, ErrorInUse)
+	case CloudFrontDistribution:
+		err := disableCloudfront(region, id)
+		if err != nil {
+			if isNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		fmt.Println("deleting cloudfront distributions will take some time.")
+		fmt.Println("this is because aws is removing their cache from cdn servers all over the world!")
+		err = waitCloudfrontDeployed(region, id)
+		if err != nil {
+			return err
+		}
+		return deleteCloudfront(region, id)
+	case Route53RecordSet:
+		return deleteRecordSet(region, aws.String(resource.Attributes["hostedZoneId"]),
+			aws.String(resource.Attributes["name"]), types.RRType(resource.Attributes["type"]), aws.String(resource.Attributes["value"]))
+	case EC2Instance:
+		err := terminateEC2Instance(region, id)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		return nil
+	case ECSService:
+		return deleteECSService(region, id)
+	case ECSTaskDefinition:
+		return deregisterTaskDefinition(region, id)
+	case ECSCluster:
+		err := deregisterContainerInstances(region, id)
+		if err != nil {
+			return err
+		}
+		err = deleteECSCluster(region, id)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		return nil
+	case ECSCapacityProvider:
+		return deleteCapacityProvider(region, id)
+	case AutoScalingGroup:
+		return deleteAutoScalingGroup(region, aws.String(resource.Attributes["name"]))
+	case EC2LaunchTemplate:
+		err := deleteLaunchTemplate(region, aws.String(resource.Attributes["name"]))
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		return nil
+	case EC2SecurityGroup:
+		// network interfaces of terminated instances, load balancers and fargate tasks are released a little later.
+		// the group of the load balancer is in use until the group of the tasks referring to it is gone
+		return retryOn("deleteSecurityGroup", Timeouts.ResourceDeleted, func() error {
+			err := deleteSecurityGroupById(region, id)
+			if err != nil && isNotFound(err) {
+				return nil
+			}
+			return err
+		}, ErrorInUse)
+	case ElasticLoadBalancingLoadBalancer:
+		return deleteALB(region, id)
+	case ElasticLoadBalancingListener:
+		return deleteListener(region, id)
+	case ElasticLoadBalancingTargetGroup:
+		return retryOn("deleteTargetGroup", Timeouts.ResourceDeleted, func() error {
+			err := deleteTargetGroup(region, id)
+			if err != nil && isNotFound(err) {
+				return nil
+			}
+			return err
+		}, ErrorInUse)
+	case ECRRepository:
+		err := deleteECRRepository(region, id)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		return nil
+	case LogsLogGroup:
+		return deleteLogGroup(region, id)
+	case SSMParameter:
+		return deleteParameter(region, id)
+	case IAMAccessKey:
+		return deleteAccessKey(region, aws.String(resource.Attributes["user"]), id)
+	case IAMUser:
+		err := deleteIAMUser(region, aws.String(resource.Attributes["name"]))
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		return nil
+	case IAMRole:
+		err := deleteIAMRole(region, aws.String(resource.Attributes["name"]))
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		return nil
+	case IAMOIDCProvider:
+		return errors.New(fmt.Sprintf("github oidc provider %s is shared by every stack of the account and is kept", *id))
+	case RDSDBInstance:
+		return deleteRDS(region, id)
+	}
+	return errors.New(fmt.Sprintf("cloudGun does not know how to delete %s %s", resource.Type, *id))
+}
@@ -1,27 +1,91 @@
 package aws
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
 	ecrTypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
 	"strings"
 )
 
-func initECRClient(region *string) (*ecr.Client, error) {
-	config, err := initConfig(region)
-	if err != nil {
-		return nil, err
-	}
-	return ecr.NewFromConfig(config), nil
+// the repository is seeded with a placeholder until the first push of the backend repository deploys the application.
+// it is copied with the registry api, so creating a stack needs no docker
+var placeholderRegistry = "https://public.ecr.aws"
+
+const (
+	placeholderRepository = "nginx/nginx"
+	placeholderTag        = "stable-alpine"
+	// the tag of the placeholder the first task definition runs. github actions push the commit sha and register
+	// a task definition with it
+	applicationTag = "latest"
+)
+
+// the manifests of an image, a list of the platforms first
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+type registryDescriptor struct {
+	MediaType string            `json:"mediaType"`
+	Digest    string            `json:"digest"`
+	Size      int64             `json:"size"`
+	Platform  *registryPlatform `json:"platform,omitempty"`
+}
+
+type registryPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// registryManifest is an image manifest, or a list of manifests by platform when Manifests is set.
+type registryManifest struct {
+	MediaType string               `json:"mediaType"`
+	Config    registryDescriptor   `json:"config"`
+	Layers    []registryDescriptor `json:"layers"`
+	Manifests []registryDescriptor `json:"manifests"`
+}
+
+// publicRegistry pulls from a registry answering with anonymous bearer tokens, like public.ecr.aws and docker hub.
+type publicRegistry struct {
+	url        string
+	repository string
+	token      string
 }
 
-func createECRRepository(region *string, name *string) error {
+var challengeParameter = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+func initECRClient(region *string) (ECRAPI, error) {
+	return clients.ECR(region)
+}
+
+// ECRImageURI is the image of the application in the repository name.
+func ECRImageURI(accountId string, region string, name string) string {
+	return fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s:%s", accountId, region, name, applicationTag)
+}
+
+func createECRRepository(progress io.Writer, region *string, name *string) error {
 	client, err := initECRClient(region)
 	if err != nil {
 		return err
 	}
+	existing, err := client.DescribeRepositories(ctx, &ecr.DescribeRepositoriesInput{RepositoryNames: []string{*name}})
+	if err == nil && len(existing.Repositories) > 0 {
+		fmt.Fprintln(progress, fmt.Sprintf("adopting existing ecr repository %s", *name))
+		return adoptResource(ECRRepository, existing.Repositories[0].RepositoryArn, region, nil)
+	} else if err != nil && !isNotFound(err) {
+		return err
+	}
 	input := ecr.CreateRepositoryInput{
 		RepositoryName: name,
 		Tags: []ecrTypes.Tag{
@@ -35,11 +99,11 @@ func createECRRepository(region *string, name *string) error {
 			},
 		},
 	}
-	_, err = client.CreateRepository(ctx, &input)
+	repository, err := client.CreateRepository(ctx, &input)
 	if err != nil {
 		return err
 	}
-	return nil
+	return recordResource(ECRRepository, repository.Repository.RepositoryArn, region, nil)
 }
 
 func deleteECRRepository(region *string, arn *string) error {
@@ -61,3 +125,234 @@ func deleteECRRepository(region *string, arn *string) error {
 	}
 	return nil
 }
+
+// seedECRRepository pushes the placeholder image as the latest image, unless the repository has one already.
+func seedECRRepository(progress io.Writer, region *string, name *string) error {
+	client, err := initECRClient(region)
+	if err != nil {
+		return err
+	}
+	existing, err := client.DescribeImages(ctx, &ecr.DescribeImagesInput{
+		RepositoryName: name,
+		ImageIds:       []ecrTypes.ImageIdentifier{{ImageTag: aws.String(applicationTag)}},
+	})
+	if err == nil && len(existing.ImageDetails) > 0 {
+		fmt.Fprintln(progress, fmt.Sprintf("ecr repository %s already has a %s image", *name, applicationTag))
+		return nil
+	} else if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	registry := publicRegistry{url: placeholderRegistry, repository: placeholderRepository}
+	manifest, mediaType, err := registry.imageManifest(placeholderTag)
+	if err != nil {
+		return err
+	}
+	var image registryManifest
+	err = json.Unmarshal(manifest, &image)
+	if err != nil {
+		return err
+	}
+	for _, blob := range append([]registryDescriptor{image.Config}, image.Layers...) {
+		err = pushECRLayer(client, name, &registry, &blob)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = client.PutImage(ctx, &ecr.PutImageInput{
+		RepositoryName:         name,
+		ImageManifest:          aws.String(string(manifest)),
+		ImageManifestMediaType: &mediaType,
+		ImageTag:               aws.String(applicationTag),
+	})
+	if err != nil && !isAlreadyExists(err) {
+		return err
+	}
+	fmt.Fprintln(progress, fmt.Sprintf("seeded ecr repository %s with %s/%s:%s", *name, placeholderRegistry, placeholderRepository, placeholderTag))
+	return nil
+}
+
+// pushECRLayer uploads a blob of the registry to the repository, in the parts ecr asks for.
+func pushECRLayer(client ECRAPI, name *string, registry *publicRegistry, blob *registryDescriptor) error {
+	availability, err := client.BatchCheckLayerAvailability(ctx, &ecr.BatchCheckLayerAvailabilityInput{
+		RepositoryName: name,
+		LayerDigests:   []string{blob.Digest},
+	})
+	if err != nil {
+		return err
+	}
+	if len(availability.Layers) > 0 && availability.Layers[0].LayerAvailability == ecrTypes.LayerAvailabilityAvailable {
+		return nil
+	}
+	content, err := registry.blob(blob.Digest)
+	if err != nil {
+		return err
+	}
+	upload, err := client.InitiateLayerUpload(ctx, &ecr.InitiateLayerUploadInput{RepositoryName: name})
+	if err != nil {
+		return err
+	}
+	size := int64(len(content))
+	partSize := aws.ToInt64(upload.PartSize)
+	if partSize <= 0 {
+		partSize = size
+	}
+	for first := int64(0); first < size; first += partSize {
+		last := min(first+partSize, size) - 1
+		_, err = client.UploadLayerPart(ctx, &ecr.UploadLayerPartInput{
+			RepositoryName: name,
+			UploadId:       upload.UploadId,
+			PartFirstByte:  aws.Int64(first),
+			PartLastByte:   aws.Int64(last),
+			LayerPartBlob:  content[first : last+1],
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err = client.CompleteLayerUpload(ctx, &ecr.CompleteLayerUploadInput{
+		RepositoryName: name,
+		UploadId:       upload.UploadId,
+		LayerDigests:   []string{blob.Digest},
+	})
+	if err != nil && !isAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// imageManifest returns the manifest of reference and its media type, the one of linux/amd64 when reference is a list.
+func (registry *publicRegistry) imageManifest(reference string) ([]byte, string, error) {
+	content, mediaType, err := registry.manifest(reference)
+	if err != nil {
+		return nil, "", err
+	}
+	var manifest registryManifest
+	err = json.Unmarshal(content, &manifest)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(manifest.Manifests) == 0 {
+		return content, mediaType, nil
+	}
+	for _, platform := range manifest.Manifests {
+		if platform.Platform != nil && platform.Platform.OS == "linux" && platform.Platform.Architecture == "amd64" {
+			return registry.manifest(platform.Digest)
+		}
+	}
+	return nil, "", errors.New(fmt.Sprintf("%s:%s has no linux/amd64 image", registry.repository, reference))
+}
+
+func (registry *publicRegistry) manifest(reference string) ([]byte, string, error) {
+	response, err := registry.get("/manifests/"+reference, strings.Join(manifestMediaTypes, ", "))
+	if err != nil {
+		return nil, "", err
+	}
+	defer response.Body.Close()
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	mediaType, _, _ := strings.Cut(response.Header.Get("Content-Type"), ";")
+	return content, mediaType, nil
+}
+
+// blob downloads a blob and checks it against its digest.
+func (registry *publicRegistry) blob(digest string) ([]byte, error) {
+	response, err := registry.get("/blobs/"+digest, "")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+	if "sha256:"+hex.EncodeToString(sum[:]) != digest {
+		return nil, errors.New(fmt.Sprintf("blob %s of %s does not match its digest", digest, registry.repository))
+	}
+	return content, nil
+}
+
+// get requests a path of the repository, and asks the realm of the challenge for a token when it is unauthorized.
+func (registry *publicRegistry) get(path string, accept string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, registry.url+"/v2/"+registry.repository+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			request.Header.Set("Accept", accept)
+		}
+		if registry.token != "" {
+			request.Header.Set("Authorization", "Bearer "+registry.token)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := response.Header.Get("WWW-Authenticate")
+			response.Body.Close()
+			err = registry.authorize(challenge)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if response.StatusCode != http.StatusOK {
+			response.Body.Close()
+			return nil, errors.New(fmt.Sprintf("%s answered %s for %s%s", registry.url, response.Status, registry.repository, path))
+		}
+		return response, nil
+	}
+}
+
+// authorize gets a pull token of the repository for a challenge like Bearer realm="https://public.ecr.aws/token/",service="public.ecr.aws".
+func (registry *publicRegistry) authorize(challenge string) error {
+	scheme, parameters, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return errors.New(fmt.Sprintf("%s asks for %s authentication, only anonymous bearer tokens are supported", registry.url, scheme))
+	}
+	values := map[string]string{}
+	for _, match := range challengeParameter.FindAllStringSubmatch(parameters, -1) {
+		values[match[1]] = match[2]
+	}
+	realm, err := url.Parse(values["realm"])
+	if err != nil || realm.Host == "" {
+		return errors.New(fmt.Sprintf("%s answered a challenge without a realm : %s", registry.url, challenge))
+	}
+	query := realm.Query()
+	if service, ok := values["service"]; ok {
+		query.Set("service", service)
+	}
+	query.Set("scope", "repository:"+registry.repository+":pull")
+	realm.RawQuery = query.Encode()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("%s answered %s for a token", realm.Host, response.Status))
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&token)
+	if err != nil {
+		return err
+	}
+	registry.token = token.Token
+	if registry.token == "" {
+		registry.token = token.AccessToken
+	}
+	return nil
+}
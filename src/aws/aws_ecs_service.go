@@ -12,43 +12,79 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	elb "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"io"
 	"strconv"
 	"strings"
 )
 
-func initECSClient(region *string) (*ecs.Client, error) {
-	config, err := initConfig(region)
-	if err != nil {
-		return nil, err
-	}
-	return ecs.NewFromConfig(config), nil
+func initECSClient(region *string) (ECSAPI, error) {
+	return clients.ECS(region)
 }
 
-func initEC2Client(region *string) (*ec2.Client, error) {
-	config, err := initConfig(region)
-	if err != nil {
-		return nil, err
-	}
-	return ec2.NewFromConfig(config), nil
+func initEC2Client(region *string) (EC2API, error) {
+	return clients.EC2(region)
 }
 
-func initAutoScalingClient(region *string) (*autoscaling.Client, error) {
-	config, err := initConfig(region)
-	if err != nil {
-		return nil, err
-	}
-	return autoscaling.NewFromConfig(config), nil
+func initAutoScalingClient(region *string) (AutoScalingAPI, error) {
+	return clients.AutoScaling(region)
+}
+
+// fargateCapacityProvider is the capacity provider aws gives every cluster for fargate tasks.
+const fargateCapacityProvider = "FARGATE"
+
+// fargateSizes are the task sizes fargate runs, a cpu in units and the memory in MiB it can have.
+// the memory goes up by 1024 MiB, from 512 MiB to 1024 MiB with the smallest cpu.
+var fargateSizes = []struct {
+	cpu       int32
+	minMemory int32
+	maxMemory int32
+}{
+	{cpu: 256, minMemory: 512, maxMemory: 2048},
+	{cpu: 512, minMemory: 1024, maxMemory: 4096},
+	{cpu: 1024, minMemory: 2048, maxMemory: 8192},
+	{cpu: 2048, minMemory: 4096, maxMemory: 16384},
+	{cpu: 4096, minMemory: 8192, maxMemory: 30720},
+}
+
+// FargateTaskSize returns the smallest fargate task size the container fits in, its cpu in units and memory in MiB.
+func FargateTaskSize(container *ContainerSpec) (int32, int32, error) {
+	for _, size := range fargateSizes {
+		if size.cpu < container.CPU || size.maxMemory < container.MemoryMiB {
+			continue
+		}
+		memory := size.minMemory
+		for memory < container.MemoryMiB {
+			if memory < 1024 {
+				memory = 1024
+			} else {
+				memory += 1024
+			}
+		}
+		return size.cpu, memory, nil
+	}
+	return 0, 0, errors.New(fmt.Sprintf("a container of %d cpu units and %d MiB is larger than the fargate tasks cloudGun runs", container.CPU, container.MemoryMiB))
 }
 
-func createECSCluster(region *string, name *string, capacityProviderName *string) (*string, error) {
+func createECSCluster(progress io.Writer, region *string, name *string, capacityProviderName *string) (*string, error) {
 	client, err := initECSClient(region)
 	if err != nil {
 		return nil, err
 	}
 
+	clusters, err := client.DescribeClusters(ctx, &ecs.DescribeClustersInput{Clusters: []string{*name}})
 	if err != nil {
 		return nil, err
 	}
+	for _, cluster := range clusters.Clusters {
+		if *cluster.Status == "ACTIVE" {
+			fmt.Fprintln(progress, fmt.Sprintf("adopting existing ecs cluster %s", *name))
+			err = adoptResource(ECSCluster, cluster.ClusterArn, region, nil)
+			if err != nil {
+				return nil, err
+			}
+			return cluster.ClusterArn, nil
+		}
+	}
 	input := ecs.CreateClusterInput{
 		ClusterName:       name,
 		CapacityProviders: []string{*capacityProviderName},
@@ -71,6 +107,10 @@ func createECSCluster(region *string, name *string, capacityProviderName *string
 	if err != nil {
 		return nil, err
 	}
+	err = recordResource(ECSCluster, cluster.Cluster.ClusterArn, region, nil)
+	if err != nil {
+		return nil, err
+	}
 	return cluster.Cluster.ClusterArn, nil
 }
 
@@ -86,6 +126,32 @@ func deleteECSCluster(region *string, arn *string) error {
 	return nil
 }
 
+// deregisterContainerInstances lets a cluster be deleted while its instances are still terminating.
+func deregisterContainerInstances(region *string, clusterArn *string) error {
+	client, err := initECSClient(region)
+	if err != nil {
+		return err
+	}
+	instances, err := client.ListContainerInstances(ctx, &ecs.ListContainerInstancesInput{Cluster: clusterArn})
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	for _, instance := range instances.ContainerInstanceArns {
+		_, err = client.DeregisterContainerInstance(ctx, &ecs.DeregisterContainerInstanceInput{
+			Cluster:           clusterArn,
+			ContainerInstance: aws.String(instance),
+			Force:             aws.Bool(true),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func terminateEC2Instance(region *string, arn *string) error {
 	splitArn := strings.Split(*arn, "instance/")
 	client, err := initEC2Client(region)
@@ -96,39 +162,41 @@ func terminateEC2Instance(region *string, arn *string) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	waiter := ec2.NewInstanceTerminatedWaiter(client)
+	return waiter.Wait(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{splitArn[1]}}, Timeouts.ResourceDeleted)
 }
 
-func deleteCapacityProviderASG(region *string, arn *string) error {
+// getCapacityProviderASGName returns the name of the auto scaling group of a capacity provider or nil when there is none.
+func getCapacityProviderASGName(region *string, arn *string) (*string, error) {
 	client, err := initECSClient(region)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
 	output, err := client.DescribeCapacityProviders(ctx, &ecs.DescribeCapacityProvidersInput{CapacityProviders: []string{*arn}})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if len(output.CapacityProviders) == 0 {
-		return errors.New(fmt.Sprintf("no capacity provider was found of arn %s in region %s", *arn, *region))
+	if len(output.CapacityProviders) == 0 || output.CapacityProviders[0].AutoScalingGroupProvider == nil {
+		return nil, nil
 	}
-	_, err = client.DeleteCapacityProvider(ctx, &ecs.DeleteCapacityProviderInput{CapacityProvider: arn})
-	if err != nil {
-		return err
+	asgName := strings.Split(*output.CapacityProviders[0].AutoScalingGroupProvider.AutoScalingGroupArn, "autoScalingGroupName/")
+	if len(asgName) != 2 {
+		return nil, nil
 	}
+	return &asgName[1], nil
+}
 
-	asgName := strings.Split(*output.CapacityProviders[0].AutoScalingGroupProvider.AutoScalingGroupArn, "autoScalingGroupName/")
-	asgClient, err := initAutoScalingClient(region)
-	input := autoscaling.DeleteAutoScalingGroupInput{AutoScalingGroupName: &asgName[1], ForceDelete: aws.Bool(true)}
-	_, err = asgClient.DeleteAutoScalingGroup(ctx, &input)
-	if err != nil && !strings.Contains(err.Error(), " AutoScalingGroup name not found") {
-		return err
+func ecsLaunchTypeOf(launchType LaunchType) ecsTypes.LaunchType {
+	if launchType == LaunchTypeFargate {
+		return ecsTypes.LaunchTypeFargate
 	}
-	return nil
+	return ecsTypes.LaunchTypeEc2
 }
 
-func createECSService(region *string, serviceName *string, clusterArn *string, taskDefinition *string,
-	albName *string, containerName *string, targetGroupName *string) error {
+// createECSService runs the task definition behind the target group. fargate tasks need a network configuration.
+func createECSService(progress io.Writer, region *string, serviceName *string, clusterArn *string, taskDefinition *string,
+	albName *string, containerName *string, containerPort *int32, targetGroupName *string,
+	launchType LaunchType, network *ecsTypes.NetworkConfiguration) error {
 	elbClient, err := initELBClient(region)
 	if err != nil {
 		return err
@@ -145,17 +213,28 @@ func createECSService(region *string, serviceName *string, clusterArn *string, t
 	if err != nil {
 		return err
 	}
+	services, err := client.DescribeServices(ctx, &ecs.DescribeServicesInput{Cluster: clusterArn, Services: []string{*serviceName}})
+	if err != nil {
+		return err
+	}
+	for _, service := range services.Services {
+		if *service.Status == "ACTIVE" {
+			fmt.Fprintln(progress, fmt.Sprintf("adopting existing ecs service %s", *serviceName))
+			return adoptResource(ECSService, service.ServiceArn, region, nil)
+		}
+	}
 	input := ecs.CreateServiceInput{
-		ServiceName:    serviceName,
-		Cluster:        clusterArn,
-		DesiredCount:   aws.Int32(1),
-		TaskDefinition: taskDefinition,
-		LaunchType:     ecsTypes.LaunchTypeEc2,
+		ServiceName:          serviceName,
+		Cluster:              clusterArn,
+		DesiredCount:         aws.Int32(1),
+		TaskDefinition:       taskDefinition,
+		LaunchType:           ecsLaunchTypeOf(launchType),
+		NetworkConfiguration: network,
 		LoadBalancers: []ecsTypes.LoadBalancer{
 			{
 				//LoadBalancerName: albName,
 				ContainerName:  containerName,
-				ContainerPort:  aws.Int32(80),
+				ContainerPort:  containerPort,
 				TargetGroupArn: groups.TargetGroups[0].TargetGroupArn,
 			},
 		},
@@ -170,11 +249,11 @@ func createECSService(region *string, serviceName *string, clusterArn *string, t
 			},
 		},
 	}
-	_, err = client.CreateService(ctx, &input)
+	service, err := client.CreateService(ctx, &input)
 	if err != nil {
 		return err
 	}
-	return nil
+	return recordResource(ECSService, service.Service.ServiceArn, region, nil)
 }
 
 func deleteECSService(region *string, arn *string) error {
@@ -187,40 +266,100 @@ func deleteECSService(region *string, arn *string) error {
 	}
 
 	_, err = client.UpdateService(ctx, &ecs.UpdateServiceInput{Service: &clusterService[1], Cluster: &clusterService[0], DesiredCount: aws.Int32(0)})
-	if err != nil && !strings.Contains(err.Error(), "Service was not ACTIVE") {
+	if err != nil && !isNotFound(err) {
 		return err
 	}
 
-	_, err = client.DeleteService(ctx, &ecs.DeleteServiceInput{Service: &clusterService[1], Cluster: &clusterService[0]})
+	_, err = client.DeleteService(ctx, &ecs.DeleteServiceInput{Service: &clusterService[1], Cluster: &clusterService[0], Force: aws.Bool(true)})
 	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
 		return err
 	}
-	return nil
+	waiter := ecs.NewServicesInactiveWaiter(client)
+	return waiter.Wait(ctx, &ecs.DescribeServicesInput{Cluster: &clusterService[0], Services: []string{clusterService[1]}}, Timeouts.ResourceDeleted)
 }
 
-func createECSTaskDefinition(region *string, taskFamilyName *string, containerName *string, containerCpu *int32,
-	containerMemory *int32, containerPort *int32, hostPort *int32) (*string, error) {
+// redeployECSService starts a new deployment of the service, which pulls the image of its task definition again.
+func redeployECSService(region *string, clusterName *string, serviceName *string) error {
+	client, err := initECSClient(region)
+	if err != nil {
+		return err
+	}
+	_, err = client.UpdateService(ctx, &ecs.UpdateServiceInput{Cluster: clusterName, Service: serviceName, ForceNewDeployment: true})
+	return err
+}
+
+// rollECSService starts a deployment of the service on another revision of its task definition.
+func rollECSService(region *string, clusterName *string, serviceName *string, taskDefinitionArn *string) error {
+	client, err := initECSClient(region)
+	if err != nil {
+		return err
+	}
+	_, err = client.UpdateService(ctx, &ecs.UpdateServiceInput{
+		Cluster:            clusterName,
+		Service:            serviceName,
+		TaskDefinition:     taskDefinitionArn,
+		ForceNewDeployment: true,
+	})
+	return err
+}
+
+func waitECSServiceStable(region *string, clusterArn *string, serviceName *string) error {
+	client, err := initECSClient(region)
+	if err != nil {
+		return err
+	}
+	waiter := ecs.NewServicesStableWaiter(client)
+	return waiter.Wait(ctx, &ecs.DescribeServicesInput{Cluster: clusterArn, Services: []string{*serviceName}}, Timeouts.ServicesStable)
+}
+
+func createECSTaskDefinition(progress io.Writer, region *string, taskFamilyName *string, containerName *string, containerImage *string,
+	containerCpu *int32, containerMemory *int32, containerPort *int32, hostPort *int32, launchType LaunchType, roles *ECSRoles) (*string, error) {
 	client, err := initECSClient(region)
 	if err != nil {
 		return nil, err
 	}
 
+	existing, err := client.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{TaskDefinition: taskFamilyName})
+	if err == nil && existing.TaskDefinition.Status == ecsTypes.TaskDefinitionStatusActive {
+		fmt.Fprintln(progress, fmt.Sprintf("adopting existing task definition %s", *existing.TaskDefinition.TaskDefinitionArn))
+		err = adoptResource(ECSTaskDefinition, existing.TaskDefinition.TaskDefinitionArn, region, nil)
+		if err != nil {
+			return nil, err
+		}
+		return existing.TaskDefinition.TaskDefinitionArn, nil
+	} else if err != nil && !hasErrorCode(err, "ClientException") { // ecs has no not found code for task definitions
+		return nil, err
+	}
+
 	input := ecs.RegisterTaskDefinitionInput{
-		Family: taskFamilyName,
-		//Cpu:    aws.String(strconv.Itoa(int(*containerCpu))),
-		Memory: aws.String(strconv.Itoa(int(*containerMemory))),
+		Family:           taskFamilyName,
+		Memory:           aws.String(strconv.Itoa(int(*containerMemory))),
+		ExecutionRoleArn: aws.String(roles.ExecutionRoleArn),
+		TaskRoleArn:      aws.String(roles.TaskRoleArn),
 		ContainerDefinitions: []ecsTypes.ContainerDefinition{
 			{
 				Name:  containerName,
-				Image: aws.String("nginx"), // TODO : https://docs.aws.amazon.com/ko_kr/AmazonECR/latest/userguide/docker-pull-ecr-image.html
+				Image: containerImage,
 				//Memory:            containerMemory,
 				//MemoryReservation: containerMemory,
-				//Cpu:               *containerCpu,
+				Cpu: *containerCpu, // cpu units the container reserves on the instance
 				PortMappings: []ecsTypes.PortMapping{
 					{
 						AppProtocol:   ecsTypes.ApplicationProtocolHttp,
 						ContainerPort: containerPort,
-						HostPort:      aws.Int32(0), // dynamic port hosting
+						HostPort:      hostPort, // 0 is dynamic port hosting, a fixed port runs one task per instance
+					},
+				},
+				// the log group is created by CreateLogGroup, the driver does not create it
+				LogConfiguration: &ecsTypes.LogConfiguration{
+					LogDriver: ecsTypes.LogDriverAwslogs,
+					Options: map[string]string{
+						"awslogs-group":         LogGroupName(*taskFamilyName),
+						"awslogs-region":        *region,
+						"awslogs-stream-prefix": logStreamPrefix,
 					},
 				},
 			},
@@ -236,10 +375,78 @@ func createECSTaskDefinition(region *string, taskFamilyName *string, containerNa
 			},
 		},
 	}
+	if launchType == LaunchTypeFargate {
+		// fargate sizes the task instead of the instance, and a task of its own network interface takes the container port
+		cpu, memory, err := FargateTaskSize(&ContainerSpec{CPU: *containerCpu, MemoryMiB: *containerMemory})
+		if err != nil {
+			return nil, err
+		}
+		input.Cpu = aws.String(strconv.Itoa(int(cpu)))
+		input.Memory = aws.String(strconv.Itoa(int(memory)))
+		input.NetworkMode = ecsTypes.NetworkModeAwsvpc
+		input.RequiresCompatibilities = []ecsTypes.Compatibility{ecsTypes.CompatibilityFargate}
+		input.ContainerDefinitions[0].PortMappings[0].HostPort = containerPort
+	}
 	taskDefinition, err := client.RegisterTaskDefinition(ctx, &input)
 	if err != nil {
 		return nil, err
 	}
+	err = recordResource(ECSTaskDefinition, taskDefinition.TaskDefinition.TaskDefinitionArn, region, nil)
+	if err != nil {
+		return nil, err
+	}
+	return taskDefinition.TaskDefinition.TaskDefinitionArn, nil
+}
+
+// registerEnvironmentRevision registers a revision of the latest task definition of a family with the environment
+// of the container replaced, and returns its arn. the image stays the one the last deploy pushed.
+func registerEnvironmentRevision(region *string, taskFamilyName *string, environment []ecsTypes.KeyValuePair,
+	secrets []ecsTypes.Secret) (*string, error) {
+	client, err := initECSClient(region)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := client.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{TaskDefinition: taskFamilyName})
+	if err != nil {
+		return nil, err
+	}
+	latest := existing.TaskDefinition
+	containers := append([]ecsTypes.ContainerDefinition{}, latest.ContainerDefinitions...)
+	if len(containers) == 0 {
+		return nil, errors.New(fmt.Sprintf("task definition %s has no container", *latest.TaskDefinitionArn))
+	}
+	containers[0].Environment = environment
+	containers[0].Secrets = secrets
+	input := ecs.RegisterTaskDefinitionInput{
+		Family:                  latest.Family,
+		ContainerDefinitions:    containers,
+		Cpu:                     latest.Cpu,
+		Memory:                  latest.Memory,
+		NetworkMode:             latest.NetworkMode,
+		RequiresCompatibilities: latest.RequiresCompatibilities,
+		ExecutionRoleArn:        latest.ExecutionRoleArn,
+		TaskRoleArn:             latest.TaskRoleArn,
+		Volumes:                 latest.Volumes,
+		PlacementConstraints:    latest.PlacementConstraints,
+		Tags: []ecsTypes.Tag{
+			{
+				Key:   aws.String(baseTagName),
+				Value: aws.String(baseTagValue),
+			},
+			{
+				Key:   aws.String(baseUUIDTagName),
+				Value: aws.String(BaseUUIDTagValue),
+			},
+		},
+	}
+	taskDefinition, err := client.RegisterTaskDefinition(ctx, &input)
+	if err != nil {
+		return nil, err
+	}
+	err = recordResource(ECSTaskDefinition, taskDefinition.TaskDefinition.TaskDefinitionArn, region, nil)
+	if err != nil {
+		return nil, err
+	}
 	return taskDefinition.TaskDefinition.TaskDefinitionArn, nil
 }
 
@@ -248,10 +455,22 @@ func deregisterTaskDefinition(region *string, arn *string) error {
 	if err != nil {
 		return err
 	}
-	_, err = client.DeregisterTaskDefinition(ctx, &ecs.DeregisterTaskDefinitionInput{TaskDefinition: arn})
+	existing, err := client.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{TaskDefinition: arn})
 	if err != nil {
+		if hasErrorCode(err, "ClientException") { // ecs has no not found code for task definitions
+			return nil
+		}
 		return err
 	}
+	status := existing.TaskDefinition.Status
+	if status == ecsTypes.TaskDefinitionStatusActive {
+		_, err = client.DeregisterTaskDefinition(ctx, &ecs.DeregisterTaskDefinitionInput{TaskDefinition: arn})
+		if err != nil {
+			return err
+		}
+	} else if status == ecsTypes.TaskDefinitionStatusDeleteInProgress {
+		return nil
+	}
 	_, err = client.DeleteTaskDefinitions(ctx, &ecs.DeleteTaskDefinitionsInput{TaskDefinitions: []string{*arn}})
 	if err != nil {
 		return err
@@ -259,12 +478,27 @@ func deregisterTaskDefinition(region *string, arn *string) error {
 	return nil
 }
 
-func createCapacityProvider(region *string, name *string, asgArn *string) (*string, error) {
+func createCapacityProvider(progress io.Writer, region *string, name *string, asgArn *string) (*string, error) {
 	client, err := initECSClient(region)
 	if err != nil {
 		return nil, err
 	}
 
+	providers, err := client.DescribeCapacityProviders(ctx, &ecs.DescribeCapacityProvidersInput{CapacityProviders: []string{*name}})
+	if err != nil {
+		return nil, err
+	}
+	for _, provider := range providers.CapacityProviders {
+		if provider.Status == ecsTypes.CapacityProviderStatusActive {
+			fmt.Fprintln(progress, fmt.Sprintf("adopting existing capacity provider %s", *name))
+			err = adoptResource(ECSCapacityProvider, provider.CapacityProviderArn, region, nil)
+			if err != nil {
+				return nil, err
+			}
+			return provider.Name, nil
+		}
+	}
+
 	input := ecs.CreateCapacityProviderInput{
 		Name: name,
 		AutoScalingGroupProvider: &ecsTypes.AutoScalingGroupProvider{
@@ -285,6 +519,10 @@ func createCapacityProvider(region *string, name *string, asgArn *string) (*stri
 	if err != nil {
 		return nil, err
 	}
+	err = recordResource(ECSCapacityProvider, capacityProvider.CapacityProvider.CapacityProviderArn, region, nil)
+	if err != nil {
+		return nil, err
+	}
 	return capacityProvider.CapacityProvider.Name, nil
 }
 
@@ -293,29 +531,98 @@ func deleteCapacityProvider(region *string, name *string) error {
 	if err != nil {
 		return err
 	}
+	existing, err := client.DescribeCapacityProviders(ctx, &ecs.DescribeCapacityProvidersInput{CapacityProviders: []string{*name}})
+	if err != nil {
+		return err
+	}
+	if len(existing.CapacityProviders) == 0 || existing.CapacityProviders[0].Status == ecsTypes.CapacityProviderStatusInactive {
+		return nil
+	}
 	input := ecs.DeleteCapacityProviderInput{CapacityProvider: name}
 	_, err = client.DeleteCapacityProvider(ctx, &input)
 	if err != nil {
 		return err
 	}
-	return nil
+	// there is no waiter for capacity providers. the auto scaling group can not be deleted until it is inactive
+	return waitUntil(fmt.Sprintf("deleting capacity provider %s", *name), Timeouts.ResourceDeleted, func() (bool, error) {
+		output, err := client.DescribeCapacityProviders(ctx, &ecs.DescribeCapacityProvidersInput{CapacityProviders: []string{*name}})
+		if err != nil {
+			return false, err
+		}
+		return len(output.CapacityProviders) == 0 || output.CapacityProviders[0].Status == ecsTypes.CapacityProviderStatusInactive, nil
+	})
 }
 
-func createAutoScalingGroup(region *string, name *string, max *int32, min *int32, desired *int32,
-	instanceType ec2Types.InstanceType, image Image) (*string, error) {
+func deleteAutoScalingGroup(region *string, name *string) error {
+	client, err := initAutoScalingClient(region)
+	if err != nil {
+		return err
+	}
+	// a missing group is only a ValidationError, so look first
+	existing, err := client.DescribeAutoScalingGroups(ctx, &autoscaling.DescribeAutoScalingGroupsInput{AutoScalingGroupNames: []string{*name}})
+	if err != nil {
+		return err
+	}
+	if len(existing.AutoScalingGroups) == 0 {
+		return nil
+	}
+	input := autoscaling.DeleteAutoScalingGroupInput{AutoScalingGroupName: name, ForceDelete: aws.Bool(true)}
+	_, err = client.DeleteAutoScalingGroup(ctx, &input)
+	if err != nil && !isInUse(err) { // ScalingActivityInProgress, the group is deleted anyway
+		return err
+	}
+	waiter := autoscaling.NewGroupNotExistsWaiter(client)
+	return waiter.Wait(ctx, &autoscaling.DescribeAutoScalingGroupsInput{AutoScalingGroupNames: []string{*name}}, Timeouts.ResourceDeleted)
+}
+
+func createAutoScalingGroup(progress io.Writer, region *string, name *string, max *int32, min *int32, desired *int32,
+	instanceType ec2Types.InstanceType, image Image, instanceProfile *string, hostPort *int32) (*string, error) {
 	client, err := initAutoScalingClient(region)
 	if err != nil {
 		return nil, err
 	}
-	_ = deleteLaunchTemplate(region, name)
-	securityGroupId, err := createSecurityGroup(region, name)
+	existingArn, err := getAutoScalingGroupArn(region, name)
+	if err == nil {
+		fmt.Fprintln(progress, fmt.Sprintf("adopting existing auto scaling group %s", *name))
+		err = adoptResource(AutoScalingGroup, existingArn, region, map[string]string{"name": *name})
+		if err != nil {
+			return nil, err
+		}
+		return existingArn, nil
+	}
+
+	securityGroupId, err := findStackSecurityGroup(region)
 	if err != nil {
 		return nil, err
 	}
-	templateId, err := createLaunchTemplate(region, name, securityGroupId, instanceType, image)
+	if securityGroupId != nil {
+		fmt.Fprintln(progress, fmt.Sprintf("adopting existing security group %s", *securityGroupId))
+		err = adoptResource(EC2SecurityGroup, securityGroupId, region, map[string]string{"name": *name})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		securityGroupId, err = createSecurityGroup(region, name, clusterIngress(hostPort))
+		if err != nil {
+			return nil, err
+		}
+	}
+	templateId, err := findLaunchTemplate(region, name)
 	if err != nil {
 		return nil, err
 	}
+	if templateId != nil {
+		fmt.Fprintln(progress, fmt.Sprintf("adopting existing launch template %s", *templateId))
+		err = adoptResource(EC2LaunchTemplate, templateId, region, map[string]string{"name": *name})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		templateId, err = createLaunchTemplate(region, name, securityGroupId, instanceType, image, instanceProfile)
+		if err != nil {
+			return nil, err
+		}
+	}
 	zones, err := describeAvailabilityZones(region)
 	if err != nil {
 		return nil, err
@@ -347,6 +654,10 @@ func createAutoScalingGroup(region *string, name *string, max *int32, min *int32
 	if err != nil {
 		return nil, err
 	}
+	err = recordResource(AutoScalingGroup, arn, region, map[string]string{"name": *name})
+	if err != nil {
+		return nil, err
+	}
 	return arn, nil
 }
 
@@ -393,7 +704,69 @@ func getAutoScalingGroupArn(region *string, name *string) (*string, error) {
 	return groups.AutoScalingGroups[0].AutoScalingGroupARN, nil
 }
 
-func createSecurityGroup(region *string, name *string) (*string, error) {
+// clusterIngress admits https to the load balancer and the dynamic host ports of the instances of the ec2 cluster,
+// which share the security group. a fixed host port below the dynamic range is admitted as well.
+func clusterIngress(hostPort *int32) []ec2Types.IpPermission {
+	ingress := []ec2Types.IpPermission{
+		{
+			FromPort:   aws.Int32(32768), // dynamic port mapping range for ALB
+			ToPort:     aws.Int32(65535), // https://repost.aws/knowledge-center/dynamic-port-mapping-ecs
+			IpProtocol: aws.String("tcp"),
+			IpRanges: []ec2Types.IpRange{
+				{CidrIp: aws.String("0.0.0.0/0")},
+			},
+			Ipv6Ranges: []ec2Types.Ipv6Range{
+				{CidrIpv6: aws.String("::/0")},
+			},
+		},
+		loadBalancerIngress()[0],
+	}
+	if *hostPort != 0 && *hostPort < 32768 {
+		ingress = append(ingress, ec2Types.IpPermission{
+			FromPort:   hostPort,
+			ToPort:     hostPort,
+			IpProtocol: aws.String("tcp"),
+			IpRanges: []ec2Types.IpRange{
+				{CidrIp: aws.String("0.0.0.0/0")},
+			},
+			Ipv6Ranges: []ec2Types.Ipv6Range{
+				{CidrIpv6: aws.String("::/0")},
+			},
+		})
+	}
+	return ingress
+}
+
+// loadBalancerIngress admits https from anywhere.
+func loadBalancerIngress() []ec2Types.IpPermission {
+	return []ec2Types.IpPermission{
+		{
+			FromPort:   aws.Int32(443), // port ingress for alb
+			ToPort:     aws.Int32(443),
+			IpProtocol: aws.String("tcp"),
+			IpRanges: []ec2Types.IpRange{
+				{CidrIp: aws.String("0.0.0.0/0")},
+			},
+			Ipv6Ranges: []ec2Types.Ipv6Range{
+				{CidrIpv6: aws.String("::/0")},
+			},
+		},
+	}
+}
+
+// taskIngress admits the container port of fargate tasks only from the security group of the load balancer.
+func taskIngress(loadBalancerGroupId *string, containerPort *int32) []ec2Types.IpPermission {
+	return []ec2Types.IpPermission{
+		{
+			FromPort:         containerPort,
+			ToPort:           containerPort,
+			IpProtocol:       aws.String("tcp"),
+			UserIdGroupPairs: []ec2Types.UserIdGroupPair{{GroupId: loadBalancerGroupId}},
+		},
+	}
+}
+
+func createSecurityGroup(region *string, name *string, ingress []ec2Types.IpPermission) (*string, error) {
 	client, err := initEC2Client(region)
 	if err != nil {
 		return nil, err
@@ -422,33 +795,14 @@ func createSecurityGroup(region *string, name *string) (*string, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = recordResource(EC2SecurityGroup, group.GroupId, region, map[string]string{"name": *name})
+	if err != nil {
+		return nil, err
+	}
 
 	ingressInput := ec2.AuthorizeSecurityGroupIngressInput{
-		GroupId: group.GroupId,
-		IpPermissions: []ec2Types.IpPermission{
-			{
-				FromPort:   aws.Int32(32768), // dynamic port mapping range for ALB
-				ToPort:     aws.Int32(65535), // https://repost.aws/knowledge-center/dynamic-port-mapping-ecs
-				IpProtocol: aws.String("tcp"),
-				IpRanges: []ec2Types.IpRange{
-					{CidrIp: aws.String("0.0.0.0/0")},
-				},
-				Ipv6Ranges: []ec2Types.Ipv6Range{
-					{CidrIpv6: aws.String("::/0")},
-				},
-			},
-			{
-				FromPort:   aws.Int32(443), // port ingress for alb
-				ToPort:     aws.Int32(443),
-				IpProtocol: aws.String("tcp"),
-				IpRanges: []ec2Types.IpRange{
-					{CidrIp: aws.String("0.0.0.0/0")},
-				},
-				Ipv6Ranges: []ec2Types.Ipv6Range{
-					{CidrIpv6: aws.String("::/0")},
-				},
-			},
-		},
+		GroupId:       group.GroupId,
+		IpPermissions: ingress,
 	}
 
 	_, err = client.AuthorizeSecurityGroupIngress(ctx, &ingressInput)
@@ -458,7 +812,51 @@ func createSecurityGroup(region *string, name *string) (*string, error) {
 	return group.GroupId, nil
 }
 
+// ensureSecurityGroup returns the security group of name of the stack, creating it with ingress when there is none.
+func ensureSecurityGroup(progress io.Writer, region *string, name *string, ingress []ec2Types.IpPermission) (*string, error) {
+	groups, err := findStackSecurityGroups(region, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) != 0 {
+		fmt.Fprintln(progress, fmt.Sprintf("adopting existing security group %s", *groups[0].GroupId))
+		err = adoptResource(EC2SecurityGroup, groups[0].GroupId, region, map[string]string{"name": *name})
+		if err != nil {
+			return nil, err
+		}
+		return groups[0].GroupId, nil
+	}
+	return createSecurityGroup(region, name, ingress)
+}
+
 func getSecurityGroupId(region *string) (*string, error) {
+	groupId, err := findStackSecurityGroup(region)
+	if err != nil {
+		return nil, err
+	}
+	if groupId == nil {
+		return nil, errors.New(fmt.Sprintf("no security group was found with tag %s:%s", baseUUIDTagName, BaseUUIDTagValue))
+	}
+	return groupId, nil
+}
+
+// findStackSecurityGroup returns the security group tagged for this stack or nil when there is none.
+// only an ec2 cluster has a single one, the load balancer and the tasks of fargate have one each.
+func findStackSecurityGroup(region *string) (*string, error) {
+	groups, err := findStackSecurityGroups(region, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	} else if len(groups) > 1 {
+		return nil, errors.New(fmt.Sprintf("more than one security group was found with tag %s:%s", baseUUIDTagName, BaseUUIDTagValue))
+	}
+	return groups[0].GroupId, nil
+}
+
+// findStackSecurityGroups returns the security groups tagged for this stack, only the one of name when it is given.
+func findStackSecurityGroups(region *string, name *string) ([]ec2Types.SecurityGroup, error) {
 	client, err := initEC2Client(region)
 	if err != nil {
 		return nil, err
@@ -475,26 +873,31 @@ func getSecurityGroupId(region *string) (*string, error) {
 			},
 		},
 	}
+	if name != nil {
+		input.Filters = append(input.Filters, ec2Types.Filter{Name: aws.String("group-name"), Values: []string{*name}})
+	}
 	groups, err := client.DescribeSecurityGroups(ctx, &input)
 	if err != nil {
 		return nil, err
 	}
-	if len(groups.SecurityGroups) != 1 {
-		return nil, errors.New(fmt.Sprintf("no security group was found with tag %s:%s", baseUUIDTagName, BaseUUIDTagValue))
-	}
-	return groups.SecurityGroups[0].GroupId, nil
+	return groups.SecurityGroups, nil
 }
+
 func deleteSecurityGroup(region *string, arn *string) error {
 	split := strings.Split(*arn, "security-group/")
 	if len(split) != 2 {
 		return errors.New(fmt.Sprintf("arn %s could not be split with security-group/", *arn))
 	}
+	return deleteSecurityGroupById(region, &split[1])
+}
+
+func deleteSecurityGroupById(region *string, groupId *string) error {
 	client, err := initEC2Client(region)
 	if err != nil {
 		return err
 	}
 	input := ec2.DeleteSecurityGroupInput{
-		GroupId: &split[1],
+		GroupId: groupId,
 	}
 	_, err = client.DeleteSecurityGroup(ctx, &input)
 	if err != nil {
@@ -518,7 +921,27 @@ func deleteLaunchTemplate(region *string, name *string) error {
 	return nil
 }
 
-func createLaunchTemplate(region *string, name *string, securityGroupId *string, instanceType ec2Types.InstanceType, image Image) (*string, error) {
+// findLaunchTemplate returns the id of a launch template of name or nil when there is none.
+func findLaunchTemplate(region *string, name *string) (*string, error) {
+	client, err := initEC2Client(region)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := client.DescribeLaunchTemplates(ctx, &ec2.DescribeLaunchTemplatesInput{LaunchTemplateNames: []string{*name}})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(templates.LaunchTemplates) == 0 {
+		return nil, nil
+	}
+	return templates.LaunchTemplates[0].LaunchTemplateId, nil
+}
+
+func createLaunchTemplate(region *string, name *string, securityGroupId *string, instanceType ec2Types.InstanceType, image Image,
+	instanceProfile *string) (*string, error) {
 	client, err := initEC2Client(region)
 	if err != nil {
 		return nil, err
@@ -535,7 +958,7 @@ func createLaunchTemplate(region *string, name *string, securityGroupId *string,
 			ImageId:          imageId,
 			InstanceType:     instanceType,
 			IamInstanceProfile: &ec2Types.LaunchTemplateIamInstanceProfileSpecificationRequest{
-				Name: aws.String("ecsInstanceRole"),
+				Name: instanceProfile,
 			},
 			UserData: aws.String(userData),
 			TagSpecifications: []ec2Types.LaunchTemplateTagSpecificationRequest{
@@ -560,6 +983,10 @@ func createLaunchTemplate(region *string, name *string, securityGroupId *string,
 	if err != nil {
 		return nil, err
 	}
+	err = recordResource(EC2LaunchTemplate, template.LaunchTemplate.LaunchTemplateId, region, map[string]string{"name": *name})
+	if err != nil {
+		return nil, err
+	}
 	return template.LaunchTemplate.LaunchTemplateId, nil
 }
 
@@ -8,22 +8,30 @@ import (
 	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	elb "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
 	elbTypes "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
-	"time"
+	"io"
 )
 
-func initELBClient(region *string) (*elb.Client, error) {
-	config, err := initConfig(region)
-	if err != nil {
-		return nil, err
-	}
-	return elb.NewFromConfig(config), nil
+func initELBClient(region *string) (ELBAPI, error) {
+	return clients.ELB(region)
 }
 
-func createALB(region *string, name *string, securityGroupId *string) (*string, error) {
+func createALB(progress io.Writer, region *string, name *string, securityGroupId *string) (*string, error) {
 	client, err := initELBClient(region)
 	if err != nil {
 		return nil, err
 	}
+	existing, err := client.DescribeLoadBalancers(ctx, &elb.DescribeLoadBalancersInput{Names: []string{*name}})
+	if err == nil && len(existing.LoadBalancers) > 0 {
+		fmt.Fprintln(progress, fmt.Sprintf("adopting existing load balancer %s", *name))
+		err = adoptResource(ElasticLoadBalancingLoadBalancer, existing.LoadBalancers[0].LoadBalancerArn, region,
+			map[string]string{"dnsName": *existing.LoadBalancers[0].DNSName})
+		if err != nil {
+			return nil, err
+		}
+		return existing.LoadBalancers[0].LoadBalancerArn, nil
+	} else if err != nil && !isNotFound(err) {
+		return nil, err
+	}
 	subnetIds, err := describeSubnetIds(region)
 	if err != nil {
 		return nil, err
@@ -51,6 +59,11 @@ func createALB(region *string, name *string, securityGroupId *string) (*string,
 	if err != nil {
 		return nil, err
 	}
+	err = recordResource(ElasticLoadBalancingLoadBalancer, balancer.LoadBalancers[0].LoadBalancerArn, region,
+		map[string]string{"dnsName": *balancer.LoadBalancers[0].DNSName})
+	if err != nil {
+		return nil, err
+	}
 	return balancer.LoadBalancers[0].LoadBalancerArn, nil
 }
 
@@ -63,6 +76,20 @@ func deleteALB(region *string, arn *string) error {
 	if err != nil {
 		return err
 	}
+	// listeners and certificates of the load balancer are released only after it is gone
+	waiter := elb.NewLoadBalancersDeletedWaiter(client)
+	return waiter.Wait(ctx, &elb.DescribeLoadBalancersInput{LoadBalancerArns: []string{*arn}}, Timeouts.ResourceDeleted)
+}
+
+func deleteListener(region *string, arn *string) error {
+	client, err := initELBClient(region)
+	if err != nil {
+		return err
+	}
+	_, err = client.DeleteListener(ctx, &elb.DeleteListenerInput{ListenerArn: arn})
+	if err != nil && !isNotFound(err) {
+		return err
+	}
 	return nil
 }
 
@@ -108,7 +135,7 @@ func describeSubnetIds(region *string) ([]string, error) {
 	return subnetIds, nil
 }
 
-func describeBootingEC2s(region *string, retry int) ([]string, error) {
+func describeBootingEC2s(region *string) ([]string, error) {
 	client, err := initEC2Client(region)
 	if err != nil {
 		return nil, err
@@ -130,18 +157,15 @@ func describeBootingEC2s(region *string, retry int) ([]string, error) {
 		},
 	}
 	var output *ec2.DescribeInstancesOutput
-	for i := 0; i < retry; i++ {
+	err = waitUntil(fmt.Sprintf("instances tagged %s", baseTagName), Timeouts.InstancesRunning, func() (bool, error) {
 		output, err = client.DescribeInstances(ctx, &input)
-		if err != nil || len(output.Reservations) == 0 {
-			time.Sleep(time.Second)
-			continue
+		if err != nil {
+			return false, err
 		}
-		break
-	}
+		return len(output.Reservations) != 0, nil
+	})
 	if err != nil {
 		return nil, err
-	} else if len(output.Reservations) == 0 {
-		return nil, errors.New(fmt.Sprintf("no instances was found in region %s with tag %s", *region, baseTagName))
 	}
 
 	var instanceIds []string
@@ -153,41 +177,13 @@ func describeBootingEC2s(region *string, retry int) ([]string, error) {
 	return instanceIds, nil
 }
 
-func waitEc2s(region *string, instanceIds *[]string, retry int) error {
+func waitEc2s(region *string, instanceIds *[]string) error {
 	client, err := initEC2Client(region)
 	if err != nil {
 		return err
 	}
-	input := ec2.DescribeInstancesInput{
-		InstanceIds: *instanceIds,
-	}
-
-	var output *ec2.DescribeInstancesOutput
-	for i := 0; i < retry; i++ {
-		output, err = client.DescribeInstances(ctx, &input)
-		if err != nil {
-			return err
-		}
-		if isInstancesRunning(output.Reservations) {
-			break
-		}
-		time.Sleep(time.Second)
-	}
-	if !isInstancesRunning(output.Reservations) {
-		return errors.New("there is no running instance, retry failed")
-	}
-	return nil
-}
-
-func isInstancesRunning(reservations []ec2Types.Reservation) bool {
-	for _, reservation := range reservations {
-		for _, instance := range reservation.Instances {
-			if *instance.State.Code != 16 {
-				return false
-			}
-		}
-	}
-	return true
+	waiter := ec2.NewInstanceRunningWaiter(client)
+	return waiter.Wait(ctx, &ec2.DescribeInstancesInput{InstanceIds: *instanceIds}, Timeouts.InstancesRunning)
 }
 
 func describeVPCs(region *string) (*string, error) {
@@ -213,11 +209,21 @@ func describeVPCs(region *string) (*string, error) {
 	return vpcs.Vpcs[0].VpcId, nil
 }
 
-func addELBListener(region *string, elbArn *string, targetGroupArn *string, certificateArn *string) error {
+func addELBListener(progress io.Writer, region *string, elbArn *string, targetGroupArn *string, certificateArn *string) error {
 	client, err := initELBClient(region)
 	if err != nil {
 		return err
 	}
+	listeners, err := client.DescribeListeners(ctx, &elb.DescribeListenersInput{LoadBalancerArn: elbArn})
+	if err != nil {
+		return err
+	}
+	for _, listener := range listeners.Listeners {
+		if *listener.Port == 443 {
+			fmt.Fprintln(progress, fmt.Sprintf("adopting existing listener %s", *listener.ListenerArn))
+			return adoptResource(ElasticLoadBalancingListener, listener.ListenerArn, region, nil)
+		}
+	}
 	input := elb.CreateListenerInput{
 		LoadBalancerArn: elbArn,
 		DefaultActions: []elbTypes.Action{
@@ -242,22 +248,38 @@ func addELBListener(region *string, elbArn *string, targetGroupArn *string, cert
 			},
 		},
 	}
-	_, err = client.CreateListener(ctx, &input)
+	listener, err := client.CreateListener(ctx, &input)
 	if err != nil {
 		return err
 	}
-	return nil
+	return recordResource(ElasticLoadBalancingListener, listener.Listeners[0].ListenerArn, region, nil)
 }
 
-func createTargetGroup(region *string, name *string) (*string, error) {
+// createTargetGroup creates the target group of the service. fargate tasks register by ip, ec2 tasks by instance.
+func createTargetGroup(progress io.Writer, region *string, name *string, launchType LaunchType) (*string, error) {
 	client, err := initELBClient(region)
 	if err != nil {
 		return nil, err
 	}
+	existing, err := client.DescribeTargetGroups(ctx, &elb.DescribeTargetGroupsInput{Names: []string{*name}})
+	if err == nil && len(existing.TargetGroups) > 0 {
+		fmt.Fprintln(progress, fmt.Sprintf("adopting existing target group %s", *name))
+		err = adoptResource(ElasticLoadBalancingTargetGroup, existing.TargetGroups[0].TargetGroupArn, region, nil)
+		if err != nil {
+			return nil, err
+		}
+		return existing.TargetGroups[0].TargetGroupArn, nil
+	} else if err != nil && !isNotFound(err) {
+		return nil, err
+	}
 	vpcId, err := describeVPCs(region)
 	if err != nil {
 		return nil, err
 	}
+	targetType := elbTypes.TargetTypeEnumInstance
+	if launchType == LaunchTypeFargate {
+		targetType = elbTypes.TargetTypeEnumIp
+	}
 	input := elb.CreateTargetGroupInput{
 		Name:                name,
 		HealthCheckEnabled:  aws.Bool(true),
@@ -265,7 +287,7 @@ func createTargetGroup(region *string, name *string) (*string, error) {
 		IpAddressType:       elbTypes.TargetGroupIpAddressTypeEnumIpv4,
 		Port:                aws.Int32(80),
 		Protocol:            elbTypes.ProtocolEnumHttp,
-		TargetType:          elbTypes.TargetTypeEnumInstance,
+		TargetType:          targetType,
 		VpcId:               vpcId,
 		Tags: []elbTypes.Tag{
 			{
@@ -282,6 +304,10 @@ func createTargetGroup(region *string, name *string) (*string, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = recordResource(ElasticLoadBalancingTargetGroup, group.TargetGroups[0].TargetGroupArn, region, nil)
+	if err != nil {
+		return nil, err
+	}
 	return group.TargetGroups[0].TargetGroupArn, nil
 }
 
@@ -302,11 +328,11 @@ func registerTargetInGroup(region *string, targetGroupArn *string) error {
 	if err != nil {
 		return err
 	}
-	ec2Ids, err := describeBootingEC2s(region, 120)
+	ec2Ids, err := describeBootingEC2s(region)
 	if err != nil {
 		return err
 	}
-	err = waitEc2s(region, &ec2Ids, 120)
+	err = waitEc2s(region, &ec2Ids)
 	if err != nil {
 		return err
 	}
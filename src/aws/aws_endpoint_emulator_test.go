@@ -0,0 +1,931 @@
+package aws
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// endpointEmulator answers the calls of a whole stack create and delete cycle on a recordingServer.
+// it keeps what was created like aws does, by kind and name, and refuses deletes aws would refuse.
+type endpointEmulator struct {
+	mutex    sync.Mutex
+	lastId   int
+	live     map[string]string // kind/name to what the resource holds
+	inactive map[string]bool   // deleted ecs services, described as INACTIVE
+}
+
+const (
+	autoscalingNamespace = "http://autoscaling.amazonaws.com/doc/2011-01-01/"
+	ec2Namespace         = "http://ec2.amazonaws.com/doc/2016-11-15/"
+	elbNamespace         = "http://elasticloadbalancing.amazonaws.com/doc/2015-12-01/"
+	iamNamespace         = "https://iam.amazonaws.com/doc/2010-05-08/"
+	route53Namespace     = "https://route53.amazonaws.com/doc/2013-04-01/"
+	s3Namespace          = "http://s3.amazonaws.com/doc/2006-03-01/"
+	cloudfrontNamespace  = "http://cloudfront.amazonaws.com/doc/2020-05-31/"
+	testHostedZoneId     = "ZTEST"
+	testELBHostedZoneId  = "ZELBTEST"
+)
+
+// emulateEndpoint answers every call of the services cloudGun creates a stack with.
+func emulateEndpoint(server *recordingServer) *endpointEmulator {
+	emulator := &endpointEmulator{live: map[string]string{}, inactive: map[string]bool{}}
+	for service, answer := range map[string]awsAnswer{
+		"acm":                  emulator.acm,
+		"autoscaling":          emulator.autoscaling,
+		"cloudfront":           emulator.cloudfront,
+		"ec2":                  emulator.ec2,
+		"ecr":                  emulator.ecr,
+		"ecs":                  emulator.ecs,
+		"elasticloadbalancing": emulator.elb,
+		"iam":                  emulator.iam,
+		"logs":                 emulator.logs,
+		"resource-groups":      emulator.resourceGroups,
+		"route53":              emulator.route53,
+		"s3":                   emulator.s3,
+		"sts":                  emulator.sts,
+	} {
+		server.answer(service+" *", func(call awsCall, body []byte) (int, string) {
+			emulator.mutex.Lock()
+			defer emulator.mutex.Unlock()
+			return answer(call, body)
+		})
+	}
+	return emulator
+}
+
+// left lists what is still live on the endpoint.
+func (emulator *endpointEmulator) left() []string {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+	keys := make([]string, 0, len(emulator.live))
+	for key := range emulator.live {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// count is the number of live resources of a kind.
+func (emulator *endpointEmulator) count(kind string) int {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+	return len(emulator.names(kind))
+}
+
+func (emulator *endpointEmulator) id() int {
+	emulator.lastId++
+	return emulator.lastId
+}
+
+// names lists the live resources of a kind in order.
+func (emulator *endpointEmulator) names(kind string) []string {
+	names := make([]string, 0)
+	for key := range emulator.live {
+		if name, found := strings.CutPrefix(key, kind+"/"); found {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// jsonString reads a string from a json body, following the path of nested objects.
+func jsonString(body []byte, path ...string) string {
+	var value interface{}
+	_ = json.Unmarshal(body, &value)
+	for _, name := range path {
+		object, _ := value.(map[string]interface{})
+		value = object[name]
+	}
+	text, _ := value.(string)
+	return text
+}
+
+// jsonStrings reads a list of strings from a json body.
+func jsonStrings(body []byte, name string) []string {
+	values := map[string][]string{}
+	_ = json.Unmarshal(body, &values)
+	return values[name]
+}
+
+func jsonReply(body string) (int, string) {
+	return http.StatusOK, body
+}
+
+func jsonFault(code string) (int, string) {
+	return http.StatusBadRequest, fmt.Sprintf("{\"__type\":\"%s\",\"message\":\"%s\"}", code, code)
+}
+
+func formOf(body []byte) url.Values {
+	form, _ := url.ParseQuery(string(body))
+	return form
+}
+
+// formList reads name.member.1, name.member.2 ... of the query protocols.
+func formList(form url.Values, name string) []string {
+	values := make([]string, 0)
+	for i := 1; form.Has(fmt.Sprintf("%s.%d", name, i)); i++ {
+		values = append(values, form.Get(fmt.Sprintf("%s.%d", name, i)))
+	}
+	return values
+}
+
+// ec2Filter reads the first value of a filter of ec2.
+func ec2Filter(form url.Values, name string) string {
+	for i := 1; form.Has(fmt.Sprintf("Filter.%d.Name", i)); i++ {
+		if form.Get(fmt.Sprintf("Filter.%d.Name", i)) == name {
+			return form.Get(fmt.Sprintf("Filter.%d.Value.1", i))
+		}
+	}
+	return ""
+}
+
+func queryReply(call awsCall, namespace string, result string) (int, string) {
+	return http.StatusOK, fmt.Sprintf("<%sResponse xmlns=\"%s\"><%sResult>%s</%sResult><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></%sResponse>",
+		call.Operation, namespace, call.Operation, result, call.Operation, call.Operation)
+}
+
+func queryFault(status int, code string) (int, string) {
+	return status, fmt.Sprintf("<ErrorResponse><Error><Type>Sender</Type><Code>%s</Code><Message>%s</Message></Error><RequestId>1</RequestId></ErrorResponse>", code, code)
+}
+
+func ec2Reply(call awsCall, result string) (int, string) {
+	return http.StatusOK, fmt.Sprintf("<%sResponse xmlns=\"%s\"><requestId>1</requestId>%s</%sResponse>", call.Operation, ec2Namespace, result, call.Operation)
+}
+
+func ec2Fault(code string) (int, string) {
+	return http.StatusBadRequest, fmt.Sprintf("<Response><Errors><Error><Code>%s</Code><Message>%s</Message></Error></Errors><RequestID>1</RequestID></Response>", code, code)
+}
+
+// restFault is an error of route53 and cloudfront.
+func restFault(status int, code string) (int, string) {
+	return status, fmt.Sprintf("<ErrorResponse><Error><Type>Sender</Type><Code>%s</Code><Message>%s</Message></Error><RequestId>1</RequestId></ErrorResponse>", code, code)
+}
+
+func s3Fault(status int, code string) (int, string) {
+	return status, fmt.Sprintf("<Error><Code>%s</Code><Message>%s</Message><RequestId>1</RequestId></Error>", code, code)
+}
+
+// xmlElement cuts the first element called name out of a body, tags included.
+func xmlElement(body []byte, name string) string {
+	text := string(body)
+	start := strings.Index(text, "<"+name+">")
+	if tag := strings.Index(text, "<"+name+" "); start < 0 || (tag >= 0 && tag < start) {
+		start = tag
+	}
+	end := strings.Index(text, "</"+name+">")
+	if start < 0 || end < 0 {
+		return ""
+	}
+	return text[start : end+len(name)+3]
+}
+
+func (emulator *endpointEmulator) sts(call awsCall, body []byte) (int, string) {
+	if call.Operation != "GetCallerIdentity" {
+		return ec2Fault("InvalidAction")
+	}
+	return queryReply(call, "https://sts.amazonaws.com/doc/2011-06-15/", fmt.Sprintf("<Account>%s</Account>", fakeAccountId))
+}
+
+func (emulator *endpointEmulator) resourceGroups(call awsCall, body []byte) (int, string) {
+	name := jsonString(body, "Group")
+	group := func(name string) string {
+		return fmt.Sprintf("{\"Group\":{\"GroupArn\":\"arn:aws:resource-groups:%s:%s:group/%s\",\"Name\":\"%s\"}}", call.Region, fakeAccountId, name, name)
+	}
+	key := "group/" + call.Region + "/" + name
+	if call.Operation == "POST /groups" {
+		name = jsonString(body, "Name")
+		emulator.live["group/"+call.Region+"/"+name] = ""
+		return jsonReply(group(name))
+	}
+	if _, found := emulator.live[key]; !found {
+		return http.StatusNotFound, "{\"__type\":\"NotFoundException\",\"Message\":\"group not found\"}"
+	}
+	switch call.Operation {
+	case "POST /get-group":
+		return jsonReply(group(name))
+	case "POST /list-group-resources":
+		return jsonReply("{\"Resources\":[]}")
+	case "POST /delete-group":
+		delete(emulator.live, key)
+		return jsonReply(group(name))
+	}
+	return jsonFault("UnknownOperationException")
+}
+
+func (emulator *endpointEmulator) s3(call awsCall, body []byte) (int, string) {
+	method, _, _ := strings.Cut(call.Operation, " ")
+	_, subresource, _ := strings.Cut(call.Operation, "?")
+	bucket := strings.Trim(call.Path, "/")
+	key := "bucket/" + bucket
+	tags, found := emulator.live[key]
+	if !found && call.Operation != "PUT "+call.Path {
+		return s3Fault(http.StatusNotFound, "NoSuchBucket")
+	}
+	switch method + " " + subresource {
+	case "PUT ":
+		emulator.live[key] = ""
+		return http.StatusOK, ""
+	case "PUT tagging":
+		emulator.live[key] = xmlElement(body, "TagSet")
+		return http.StatusNoContent, ""
+	case "GET tagging":
+		if tags == "" {
+			return s3Fault(http.StatusNotFound, "NoSuchTagSet")
+		}
+		return http.StatusOK, fmt.Sprintf("<Tagging xmlns=\"%s\">%s</Tagging>", s3Namespace, tags)
+	case "DELETE publicAccessBlock", "PUT policy":
+		return http.StatusNoContent, ""
+	case "PUT website":
+		return http.StatusOK, ""
+	case "GET ":
+		return http.StatusOK, fmt.Sprintf("<ListBucketResult xmlns=\"%s\"><Name>%s</Name><KeyCount>0</KeyCount><MaxKeys>1000</MaxKeys><IsTruncated>false</IsTruncated></ListBucketResult>", s3Namespace, bucket)
+	case "GET versions":
+		return http.StatusOK, fmt.Sprintf("<ListVersionsResult xmlns=\"%s\"><Name>%s</Name><MaxKeys>1000</MaxKeys><IsTruncated>false</IsTruncated></ListVersionsResult>", s3Namespace, bucket)
+	case "DELETE ":
+		delete(emulator.live, key)
+		return http.StatusNoContent, ""
+	}
+	return s3Fault(http.StatusBadRequest, "NotImplemented")
+}
+
+// certificateRecord is the validation record acm asks for a domain.
+func certificateRecord(domain string) string {
+	return "_cloudgun." + strings.TrimPrefix(domain, "*.") + "."
+}
+
+func (emulator *endpointEmulator) acm(call awsCall, body []byte) (int, string) {
+	arn := jsonString(body, "CertificateArn")
+	switch call.Operation {
+	case "ListCertificates":
+		return jsonReply("{\"CertificateSummaryList\":[]}")
+	case "RequestCertificate":
+		arn = fmt.Sprintf("arn:aws:acm:%s:%s:certificate/%d", call.Region, fakeAccountId, emulator.id())
+		emulator.live["certificate/"+arn] = jsonString(body, "DomainName")
+		return jsonReply(fmt.Sprintf("{\"CertificateArn\":\"%s\"}", arn))
+	}
+	domain, found := emulator.live["certificate/"+arn]
+	if !found {
+		return jsonFault("ResourceNotFoundException")
+	}
+	switch call.Operation {
+	case "DescribeCertificate":
+		// validated once its record is there
+		status, options := "ISSUED", make([]string, 0)
+		for _, name := range []string{domain, "*." + domain} {
+			validation := "SUCCESS"
+			if _, found := emulator.live["record/"+certificateRecord(name)+"/CNAME"]; !found {
+				status, validation = "PENDING_VALIDATION", "PENDING_VALIDATION"
+			}
+			options = append(options, fmt.Sprintf("{\"DomainName\":\"%s\",\"ValidationStatus\":\"%s\",\"ValidationMethod\":\"DNS\",\"ResourceRecord\":{\"Name\":\"%s\",\"Type\":\"CNAME\",\"Value\":\"_validation.acm.aws.\"}}",
+				name, validation, certificateRecord(name)))
+		}
+		return jsonReply(fmt.Sprintf("{\"Certificate\":{\"CertificateArn\":\"%s\",\"DomainName\":\"%s\",\"Status\":\"%s\",\"DomainValidationOptions\":[%s]}}",
+			arn, domain, status, strings.Join(options, ",")))
+	case "DeleteCertificate":
+		for key, value := range emulator.live {
+			if (strings.HasPrefix(key, "distribution/") || strings.HasPrefix(key, "listener/")) && strings.Contains(value, arn) {
+				return jsonFault("ResourceInUseException")
+			}
+		}
+		delete(emulator.live, "certificate/"+arn)
+		return jsonReply("{}")
+	}
+	return jsonFault("UnknownOperationException")
+}
+
+// recordSet is a ResourceRecordSet of route53, kept as it was sent.
+type recordSet struct {
+	Name  string `xml:"Name"`
+	Type  string `xml:"Type"`
+	Inner string `xml:",innerxml"`
+}
+
+func (emulator *endpointEmulator) route53(call awsCall, body []byte) (int, string) {
+	const zones = "/2013-04-01/hostedzone"
+	switch call.Operation {
+	case "GET " + zones:
+		return http.StatusOK, fmt.Sprintf("<ListHostedZonesResponse xmlns=\"%s\"><HostedZones><HostedZone><Id>/hostedzone/%s</Id><Name>%s.</Name><CallerReference>test</CallerReference></HostedZone></HostedZones><IsTruncated>false</IsTruncated><MaxItems>100</MaxItems></ListHostedZonesResponse>",
+			route53Namespace, testHostedZoneId, testDomain)
+	case "GET " + zones + "/" + testHostedZoneId + "/rrset":
+		sets := ""
+		for _, name := range emulator.names("record") {
+			sets += "<ResourceRecordSet>" + emulator.live["record/"+name] + "</ResourceRecordSet>"
+		}
+		return http.StatusOK, fmt.Sprintf("<ListResourceRecordSetsResponse xmlns=\"%s\"><ResourceRecordSets>%s</ResourceRecordSets><IsTruncated>false</IsTruncated><MaxItems>300</MaxItems></ListResourceRecordSetsResponse>",
+			route53Namespace, sets)
+	case "POST " + zones + "/" + testHostedZoneId + "/rrset":
+		var request struct {
+			Changes []struct {
+				Action string    `xml:"Action"`
+				Set    recordSet `xml:"ResourceRecordSet"`
+			} `xml:"ChangeBatch>Changes>Change"`
+		}
+		err := xml.Unmarshal(body, &request)
+		if err != nil {
+			return restFault(http.StatusBadRequest, "InvalidInput")
+		}
+		// a batch is applied whole or not at all
+		for _, change := range request.Changes {
+			key := "record/" + strings.ToLower(change.Set.Name) + "/" + change.Set.Type
+			if _, found := emulator.live[key]; change.Action == "DELETE" && !found {
+				return restFault(http.StatusBadRequest, "InvalidChangeBatch")
+			}
+		}
+		for _, change := range request.Changes {
+			key := "record/" + strings.ToLower(change.Set.Name) + "/" + change.Set.Type
+			if change.Action == "DELETE" {
+				delete(emulator.live, key)
+			} else {
+				emulator.live[key] = change.Set.Inner
+			}
+		}
+		return http.StatusOK, fmt.Sprintf("<ChangeResourceRecordSetsResponse xmlns=\"%s\"><ChangeInfo><Id>/change/C%d</Id><Status>INSYNC</Status><SubmittedAt>2024-01-01T00:00:00Z</SubmittedAt></ChangeInfo></ChangeResourceRecordSetsResponse>",
+			route53Namespace, emulator.id())
+	}
+	return restFault(http.StatusBadRequest, "InvalidInput")
+}
+
+func (emulator *endpointEmulator) distribution(id string) string {
+	return fmt.Sprintf("<Distribution xmlns=\"%s\"><Id>%s</Id><ARN>arn:aws:cloudfront::%s:distribution/%s</ARN><Status>Deployed</Status><LastModifiedTime>2024-01-01T00:00:00Z</LastModifiedTime><InProgressInvalidationBatches>0</InProgressInvalidationBatches><DomainName>%s.cloudfront.net</DomainName>%s</Distribution>",
+		cloudfrontNamespace, id, fakeAccountId, id, strings.ToLower(id), emulator.live["distribution/"+id])
+}
+
+func (emulator *endpointEmulator) cloudfront(call awsCall, body []byte) (int, string) {
+	const distributions = "/2020-05-31/distribution"
+	if call.Operation == "POST "+distributions+"?WithTags" {
+		id := fmt.Sprintf("E%dTEST", emulator.id())
+		emulator.live["distribution/"+id] = xmlElement(body, "DistributionConfig")
+		return http.StatusCreated, emulator.distribution(id)
+	}
+	method, _, _ := strings.Cut(call.Operation, " ")
+	id, config, _ := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(call.Path, distributions), "/"), "/")
+	stored, found := emulator.live["distribution/"+id]
+	if !found {
+		return restFault(http.StatusNotFound, "NoSuchDistribution")
+	}
+	switch method + " " + config {
+	case "GET ":
+		return http.StatusOK, emulator.distribution(id)
+	case "GET config":
+		return http.StatusOK, stored
+	case "PUT config":
+		emulator.live["distribution/"+id] = xmlElement(body, "DistributionConfig")
+		return http.StatusOK, emulator.distribution(id)
+	case "DELETE ":
+		if !strings.Contains(stored, "<Enabled>false</Enabled>") {
+			return restFault(http.StatusConflict, "DistributionNotDisabled")
+		}
+		delete(emulator.live, "distribution/"+id)
+		return http.StatusNoContent, ""
+	}
+	return restFault(http.StatusBadRequest, "InvalidArgument")
+}
+
+func (emulator *endpointEmulator) ecr(call awsCall, body []byte) (int, string) {
+	name := jsonString(body, "repositoryName")
+	if names := jsonStrings(body, "repositoryNames"); len(names) != 0 {
+		name = names[0]
+	}
+	repository := fmt.Sprintf("{\"repositoryArn\":\"arn:aws:ecr:%s:%s:repository/%s\",\"repositoryName\":\"%s\",\"repositoryUri\":\"%s.dkr.ecr.%s.amazonaws.com/%s\"}",
+		call.Region, fakeAccountId, name, name, fakeAccountId, call.Region, name)
+	if call.Operation == "CreateRepository" {
+		emulator.live["repository/"+name] = ""
+		return jsonReply("{\"repository\":" + repository + "}")
+	}
+	if _, found := emulator.live["repository/"+name]; !found {
+		return jsonFault("RepositoryNotFoundException")
+	}
+	switch call.Operation {
+	case "DescribeRepositories":
+		return jsonReply("{\"repositories\":[" + repository + "]}")
+	case "DescribeImages":
+		// the repository has an image already, so it is not seeded
+		return jsonReply(fmt.Sprintf("{\"imageDetails\":[{\"repositoryName\":\"%s\",\"imageTags\":[\"latest\"]}]}", name))
+	case "DeleteRepository":
+		delete(emulator.live, "repository/"+name)
+		return jsonReply("{\"repository\":" + repository + "}")
+	}
+	return jsonFault("UnknownOperationException")
+}
+
+func (emulator *endpointEmulator) logs(call awsCall, body []byte) (int, string) {
+	name := jsonString(body, "logGroupName")
+	_, found := emulator.live["log-group/"+name]
+	switch call.Operation {
+	case "DescribeLogGroups":
+		groups := make([]string, 0)
+		for _, group := range emulator.names("log-group") {
+			if strings.HasPrefix(group, jsonString(body, "logGroupNamePrefix")) {
+				groups = append(groups, fmt.Sprintf("{\"logGroupName\":\"%s\",\"arn\":\"arn:aws:logs:%s:%s:log-group:%s:*\",\"logGroupArn\":\"arn:aws:logs:%s:%s:log-group:%s\"}",
+					group, call.Region, fakeAccountId, group, call.Region, fakeAccountId, group))
+			}
+		}
+		return jsonReply("{\"logGroups\":[" + strings.Join(groups, ",") + "]}")
+	case "CreateLogGroup":
+		if found {
+			return jsonFault("ResourceAlreadyExistsException")
+		}
+		emulator.live["log-group/"+name] = ""
+		return jsonReply("{}")
+	}
+	if !found {
+		return jsonFault("ResourceNotFoundException")
+	}
+	switch call.Operation {
+	case "PutRetentionPolicy":
+		return jsonReply("{}")
+	case "DeleteLogGroup":
+		delete(emulator.live, "log-group/"+name)
+		return jsonReply("{}")
+	}
+	return jsonFault("UnknownOperationException")
+}
+
+func roleXML(name string) string {
+	return fmt.Sprintf("<Path>%s</Path><RoleName>%s</RoleName><RoleId>AROA%s</RoleId><Arn>arn:aws:iam::%s:role%s%s</Arn><CreateDate>2024-01-01T00:00:00Z</CreateDate>",
+		iamPath, name, strings.ToUpper(name), fakeAccountId, iamPath, name)
+}
+
+func (emulator *endpointEmulator) instanceProfileXML(name string) string {
+	roles := ""
+	if role := emulator.live["instance-profile/"+name]; role != "" {
+		roles = "<member>" + roleXML(role) + "</member>"
+	}
+	return fmt.Sprintf("<Path>%s</Path><InstanceProfileName>%s</InstanceProfileName><InstanceProfileId>AIPA%s</InstanceProfileId><Arn>arn:aws:iam::%s:instance-profile%s%s</Arn><CreateDate>2024-01-01T00:00:00Z</CreateDate><Roles>%s</Roles>",
+		iamPath, name, strings.ToUpper(name), fakeAccountId, iamPath, name, roles)
+}
+
+func (emulator *endpointEmulator) iam(call awsCall, body []byte) (int, string) {
+	form := formOf(body)
+	role := form.Get("RoleName")
+	profile := form.Get("InstanceProfileName")
+	members := func(kind string, element string) string {
+		items := ""
+		for _, name := range emulator.names(kind) {
+			if prefix, found := strings.CutPrefix(name, role+"/"); found {
+				items += fmt.Sprintf("<member>%s</member>", strings.ReplaceAll(element, "%s", prefix))
+			}
+		}
+		return items
+	}
+	switch call.Operation {
+	case "ListUsers":
+		return queryReply(call, iamNamespace, "<Users/><IsTruncated>false</IsTruncated>")
+	case "ListRoles":
+		roles := ""
+		for _, name := range emulator.names("role") {
+			roles += "<member>" + roleXML(name) + "</member>"
+		}
+		return queryReply(call, iamNamespace, "<Roles>"+roles+"</Roles><IsTruncated>false</IsTruncated>")
+	case "CreateRole":
+		if _, found := emulator.live["role/"+role]; found {
+			return queryFault(http.StatusConflict, "EntityAlreadyExists")
+		}
+		tags := ""
+		for i := 1; form.Has(fmt.Sprintf("Tags.member.%d.Key", i)); i++ {
+			tags += fmt.Sprintf("<member><Key>%s</Key><Value>%s</Value></member>", form.Get(fmt.Sprintf("Tags.member.%d.Key", i)), form.Get(fmt.Sprintf("Tags.member.%d.Value", i)))
+		}
+		emulator.live["role/"+role] = tags
+		return queryReply(call, iamNamespace, "<Role>"+roleXML(role)+"</Role>")
+	case "GetInstanceProfile":
+		if _, found := emulator.live["instance-profile/"+profile]; !found {
+			return queryFault(http.StatusNotFound, "NoSuchEntity")
+		}
+		return queryReply(call, iamNamespace, "<InstanceProfile>"+emulator.instanceProfileXML(profile)+"</InstanceProfile>")
+	case "CreateInstanceProfile":
+		if _, found := emulator.live["instance-profile/"+profile]; found {
+			return queryFault(http.StatusConflict, "EntityAlreadyExists")
+		}
+		emulator.live["instance-profile/"+profile] = ""
+		return queryReply(call, iamNamespace, "<InstanceProfile>"+emulator.instanceProfileXML(profile)+"</InstanceProfile>")
+	case "DeleteInstanceProfile":
+		if emulator.live["instance-profile/"+profile] != "" {
+			return queryFault(http.StatusConflict, "DeleteConflict")
+		}
+		delete(emulator.live, "instance-profile/"+profile)
+		return queryReply(call, iamNamespace, "")
+	}
+
+	tags, found := emulator.live["role/"+role]
+	if !found {
+		return queryFault(http.StatusNotFound, "NoSuchEntity")
+	}
+	switch call.Operation {
+	case "GetRole":
+		return queryReply(call, iamNamespace, "<Role>"+roleXML(role)+"</Role>")
+	case "ListRoleTags":
+		return queryReply(call, iamNamespace, "<Tags>"+tags+"</Tags><IsTruncated>false</IsTruncated>")
+	case "AttachRolePolicy":
+		emulator.live["attached-policy/"+role+"/"+form.Get("PolicyArn")] = ""
+		return queryReply(call, iamNamespace, "")
+	case "PutRolePolicy":
+		emulator.live["role-policy/"+role+"/"+form.Get("PolicyName")] = form.Get("PolicyDocument")
+		return queryReply(call, iamNamespace, "")
+	case "ListRolePolicies":
+		return queryReply(call, iamNamespace, "<PolicyNames>"+members("role-policy", "%s")+"</PolicyNames><IsTruncated>false</IsTruncated>")
+	case "ListAttachedRolePolicies":
+		return queryReply(call, iamNamespace, "<AttachedPolicies>"+members("attached-policy", "<PolicyArn>%s</PolicyArn>")+"</AttachedPolicies><IsTruncated>false</IsTruncated>")
+	case "DeleteRolePolicy", "DetachRolePolicy":
+		key := "role-policy/" + role + "/" + form.Get("PolicyName")
+		if call.Operation == "DetachRolePolicy" {
+			key = "attached-policy/" + role + "/" + form.Get("PolicyArn")
+		}
+		if _, found := emulator.live[key]; !found {
+			return queryFault(http.StatusNotFound, "NoSuchEntity")
+		}
+		delete(emulator.live, key)
+		return queryReply(call, iamNamespace, "")
+	case "AddRoleToInstanceProfile", "RemoveRoleFromInstanceProfile":
+		if _, found := emulator.live["instance-profile/"+profile]; !found {
+			return queryFault(http.StatusNotFound, "NoSuchEntity")
+		}
+		if call.Operation == "RemoveRoleFromInstanceProfile" {
+			role = ""
+		}
+		emulator.live["instance-profile/"+profile] = role
+		return queryReply(call, iamNamespace, "")
+	case "ListInstanceProfilesForRole":
+		profiles := ""
+		for _, name := range emulator.names("instance-profile") {
+			if emulator.live["instance-profile/"+name] == role {
+				profiles += "<member>" + emulator.instanceProfileXML(name) + "</member>"
+			}
+		}
+		return queryReply(call, iamNamespace, "<InstanceProfiles>"+profiles+"</InstanceProfiles><IsTruncated>false</IsTruncated>")
+	case "DeleteRole":
+		for key, value := range emulator.live {
+			if strings.HasPrefix(key, "role-policy/"+role+"/") || strings.HasPrefix(key, "attached-policy/"+role+"/") ||
+				(strings.HasPrefix(key, "instance-profile/") && value == role) {
+				return queryFault(http.StatusConflict, "DeleteConflict")
+			}
+		}
+		delete(emulator.live, "role/"+role)
+		return queryReply(call, iamNamespace, "")
+	}
+	return queryFault(http.StatusBadRequest, "InvalidAction")
+}
+
+func (emulator *endpointEmulator) ec2(call awsCall, body []byte) (int, string) {
+	form := formOf(body)
+	switch call.Operation {
+	case "DescribeAvailabilityZones":
+		zones := ""
+		for i, zone := range []string{"a", "c"} {
+			zones += fmt.Sprintf("<item><zoneName>%s%s</zoneName><zoneId>%s-az%d</zoneId><regionName>%s</regionName><zoneState>available</zoneState></item>",
+				call.Region, zone, call.Region, i+1, call.Region)
+		}
+		return ec2Reply(call, "<availabilityZoneInfo>"+zones+"</availabilityZoneInfo>")
+	case "DescribeSubnets":
+		subnets := ""
+		for i, zone := range []string{"a", "c"} {
+			subnets += fmt.Sprintf("<item><subnetId>subnet-%d</subnetId><vpcId>vpc-1</vpcId><availabilityZone>%s%s</availabilityZone><availabilityZoneId>%s-az%d</availabilityZoneId><defaultForAz>true</defaultForAz></item>",
+				i+1, call.Region, zone, call.Region, i+1)
+		}
+		return ec2Reply(call, "<subnetSet>"+subnets+"</subnetSet>")
+	case "DescribeVpcs":
+		return ec2Reply(call, "<vpcSet><item><vpcId>vpc-1</vpcId><isDefault>true</isDefault></item></vpcSet>")
+	case "DescribeImages":
+		return ec2Reply(call, fmt.Sprintf("<imagesSet><item><imageId>ami-1</imageId><name>%s</name><creationDate>2024-01-01T00:00:00.000Z</creationDate></item></imagesSet>", ec2Filter(form, "name")))
+	case "DescribeSecurityGroups":
+		groupName := ec2Filter(form, "group-name")
+		groups := ""
+		for _, id := range emulator.names("security-group") {
+			name := emulator.live["security-group/"+id]
+			if groupName == "" || name == groupName {
+				groups += fmt.Sprintf("<item><groupId>%s</groupId><groupName>%s</groupName><vpcId>vpc-1</vpcId></item>", id, name)
+			}
+		}
+		return ec2Reply(call, "<securityGroupInfo>"+groups+"</securityGroupInfo>")
+	case "CreateSecurityGroup":
+		id := fmt.Sprintf("sg-%d", emulator.id())
+		emulator.live["security-group/"+id] = form.Get("GroupName")
+		return ec2Reply(call, "<return>true</return><groupId>"+id+"</groupId>")
+	case "AuthorizeSecurityGroupIngress":
+		if _, found := emulator.live["security-group/"+form.Get("GroupId")]; !found {
+			return ec2Fault("InvalidGroup.NotFound")
+		}
+		return ec2Reply(call, "<return>true</return>")
+	case "DeleteSecurityGroup":
+		id := form.Get("GroupId")
+		if _, found := emulator.live["security-group/"+id]; !found {
+			return ec2Fault("InvalidGroup.NotFound")
+		}
+		// the load balancer and the instances of the auto scaling group hold the groups
+		if len(emulator.names("load-balancer")) != 0 || len(emulator.names("auto-scaling-group")) != 0 {
+			return ec2Fault("DependencyViolation")
+		}
+		delete(emulator.live, "security-group/"+id)
+		return ec2Reply(call, "<return>true</return>")
+	}
+
+	name := form.Get("LaunchTemplateName")
+	if call.Operation == "DescribeLaunchTemplates" {
+		name = form.Get("LaunchTemplateName.1")
+	}
+	id, found := emulator.live["launch-template/"+name]
+	template := func(id string) string {
+		return fmt.Sprintf("<launchTemplateId>%s</launchTemplateId><launchTemplateName>%s</launchTemplateName><latestVersionNumber>1</latestVersionNumber>", id, name)
+	}
+	switch call.Operation {
+	case "CreateLaunchTemplate":
+		if found {
+			return ec2Fault("InvalidLaunchTemplateName.AlreadyExistsException")
+		}
+		id = fmt.Sprintf("lt-%d", emulator.id())
+		emulator.live["launch-template/"+name] = id
+		return ec2Reply(call, "<launchTemplate>"+template(id)+"</launchTemplate>")
+	}
+	if !found {
+		return ec2Fault("InvalidLaunchTemplateName.NotFoundException")
+	}
+	switch call.Operation {
+	case "DescribeLaunchTemplates":
+		return ec2Reply(call, "<launchTemplates><item>"+template(id)+"</item></launchTemplates>")
+	case "DeleteLaunchTemplate":
+		delete(emulator.live, "launch-template/"+name)
+		return ec2Reply(call, "<launchTemplate>"+template(id)+"</launchTemplate>")
+	}
+	return ec2Fault("InvalidAction")
+}
+
+func (emulator *endpointEmulator) autoscaling(call awsCall, body []byte) (int, string) {
+	form := formOf(body)
+	name := form.Get("AutoScalingGroupName")
+	switch call.Operation {
+	case "DescribeAutoScalingGroups":
+		groups := ""
+		for _, name := range formList(form, "AutoScalingGroupNames.member") {
+			if arn, found := emulator.live["auto-scaling-group/"+name]; found {
+				groups += fmt.Sprintf("<member><AutoScalingGroupName>%s</AutoScalingGroupName><AutoScalingGroupARN>%s</AutoScalingGroupARN><MinSize>1</MinSize><MaxSize>3</MaxSize><DesiredCapacity>1</DesiredCapacity><CreatedTime>2024-01-01T00:00:00Z</CreatedTime></member>",
+					name, arn)
+			}
+		}
+		return queryReply(call, autoscalingNamespace, "<AutoScalingGroups>"+groups+"</AutoScalingGroups>")
+	case "CreateAutoScalingGroup":
+		if _, found := emulator.live["auto-scaling-group/"+name]; found {
+			return queryFault(http.StatusBadRequest, "AlreadyExists")
+		}
+		emulator.live["auto-scaling-group/"+name] = fmt.Sprintf("arn:aws:autoscaling:%s:%s:autoScalingGroup:%d:autoScalingGroupName/%s", call.Region, fakeAccountId, emulator.id(), name)
+		return queryReply(call, autoscalingNamespace, "")
+	case "DeleteAutoScalingGroup":
+		if _, found := emulator.live["auto-scaling-group/"+name]; !found {
+			return queryFault(http.StatusBadRequest, "ValidationError")
+		}
+		delete(emulator.live, "auto-scaling-group/"+name)
+		return queryReply(call, autoscalingNamespace, "")
+	}
+	return queryFault(http.StatusBadRequest, "InvalidAction")
+}
+
+func (emulator *endpointEmulator) elb(call awsCall, body []byte) (int, string) {
+	form := formOf(body)
+	loadBalancer := func(name string) string {
+		return fmt.Sprintf("<member><LoadBalancerArn>%s</LoadBalancerArn><LoadBalancerName>%s</LoadBalancerName><DNSName>%s-1.%s.elb.amazonaws.com</DNSName><CanonicalHostedZoneId>%s</CanonicalHostedZoneId><VpcId>vpc-1</VpcId><State><Code>active</Code></State><Type>application</Type><Scheme>internet-facing</Scheme></member>",
+			emulator.live["load-balancer/"+name], name, strings.ToLower(name), call.Region, testELBHostedZoneId)
+	}
+	targetGroup := func(name string) string {
+		return fmt.Sprintf("<member><TargetGroupArn>%s</TargetGroupArn><TargetGroupName>%s</TargetGroupName><Protocol>HTTP</Protocol><VpcId>vpc-1</VpcId></member>",
+			emulator.live["target-group/"+name], name)
+	}
+	listener := func(arn string) string {
+		return fmt.Sprintf("<member><ListenerArn>%s</ListenerArn><LoadBalancerArn>%s</LoadBalancerArn></member>",
+			arn, strings.Fields(emulator.live["listener/"+arn])[0])
+	}
+	// finds the name of a live resource of a kind by its arn
+	byArn := func(kind string, arn string) (string, bool) {
+		for _, name := range emulator.names(kind) {
+			if emulator.live[kind+"/"+name] == arn {
+				return name, true
+			}
+		}
+		return "", false
+	}
+	switch call.Operation {
+	case "DescribeLoadBalancers":
+		names := formList(form, "Names.member")
+		for _, arn := range formList(form, "LoadBalancerArns.member") {
+			name, _ := byArn("load-balancer", arn)
+			names = append(names, name)
+		}
+		loadBalancers := ""
+		for _, name := range names {
+			if _, found := emulator.live["load-balancer/"+name]; !found {
+				return queryFault(http.StatusBadRequest, "LoadBalancerNotFound")
+			}
+			loadBalancers += loadBalancer(name)
+		}
+		return queryReply(call, elbNamespace, "<LoadBalancers>"+loadBalancers+"</LoadBalancers>")
+	case "CreateLoadBalancer":
+		name := form.Get("Name")
+		emulator.live["load-balancer/"+name] = fmt.Sprintf("arn:aws:elasticloadbalancing:%s:%s:loadbalancer/app/%s/%d", call.Region, fakeAccountId, name, emulator.id())
+		return queryReply(call, elbNamespace, "<LoadBalancers>"+loadBalancer(name)+"</LoadBalancers>")
+	case "DeleteLoadBalancer":
+		name, found := byArn("load-balancer", form.Get("LoadBalancerArn"))
+		if found {
+			// the listeners go with their load balancer
+			for _, arn := range emulator.names("listener") {
+				if strings.HasPrefix(emulator.live["listener/"+arn], emulator.live["load-balancer/"+name]+" ") {
+					delete(emulator.live, "listener/"+arn)
+				}
+			}
+			delete(emulator.live, "load-balancer/"+name)
+		}
+		return queryReply(call, elbNamespace, "")
+	case "DescribeTargetGroups":
+		targetGroups := ""
+		for _, name := range formList(form, "Names.member") {
+			if _, found := emulator.live["target-group/"+name]; !found {
+				return queryFault(http.StatusBadRequest, "TargetGroupNotFound")
+			}
+			targetGroups += targetGroup(name)
+		}
+		return queryReply(call, elbNamespace, "<TargetGroups>"+targetGroups+"</TargetGroups>")
+	case "CreateTargetGroup":
+		name := form.Get("Name")
+		emulator.live["target-group/"+name] = fmt.Sprintf("arn:aws:elasticloadbalancing:%s:%s:targetgroup/%s/%d", call.Region, fakeAccountId, name, emulator.id())
+		return queryReply(call, elbNamespace, "<TargetGroups>"+targetGroup(name)+"</TargetGroups>")
+	case "DeleteTargetGroup":
+		arn := form.Get("TargetGroupArn")
+		name, found := byArn("target-group", arn)
+		if !found {
+			return queryFault(http.StatusBadRequest, "TargetGroupNotFound")
+		}
+		for key, value := range emulator.live {
+			if (strings.HasPrefix(key, "listener/") || strings.HasPrefix(key, "service/")) && strings.Contains(value, arn) {
+				return queryFault(http.StatusBadRequest, "ResourceInUse")
+			}
+		}
+		delete(emulator.live, "target-group/"+name)
+		return queryReply(call, elbNamespace, "")
+	case "DescribeListeners":
+		listeners := ""
+		for _, arn := range emulator.names("listener") {
+			if strings.HasPrefix(emulator.live["listener/"+arn], form.Get("LoadBalancerArn")+" ") {
+				listeners += listener(arn)
+			}
+		}
+		return queryReply(call, elbNamespace, "<Listeners>"+listeners+"</Listeners>")
+	case "CreateListener":
+		loadBalancerArn := form.Get("LoadBalancerArn")
+		if _, found := byArn("load-balancer", loadBalancerArn); !found {
+			return queryFault(http.StatusBadRequest, "LoadBalancerNotFound")
+		}
+		arn := strings.Replace(loadBalancerArn, ":loadbalancer/", ":listener/", 1) + fmt.Sprintf("/%d", emulator.id())
+		emulator.live["listener/"+arn] = strings.Join([]string{loadBalancerArn, form.Get("Certificates.member.1.CertificateArn"),
+			form.Get("DefaultActions.member.1.TargetGroupArn")}, " ")
+		return queryReply(call, elbNamespace, "<Listeners>"+listener(arn)+"</Listeners>")
+	case "DeleteListener":
+		arn := form.Get("ListenerArn")
+		if _, found := emulator.live["listener/"+arn]; !found {
+			return queryFault(http.StatusBadRequest, "ListenerNotFound")
+		}
+		delete(emulator.live, "listener/"+arn)
+		return queryReply(call, elbNamespace, "")
+	}
+	return queryFault(http.StatusBadRequest, "InvalidAction")
+}
+
+func lastSegment(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
+
+func (emulator *endpointEmulator) ecsService(region string, cluster string, name string, status string) string {
+	return fmt.Sprintf("{\"serviceArn\":\"arn:aws:ecs:%s:%s:service/%s/%s\",\"serviceName\":\"%s\",\"clusterArn\":\"arn:aws:ecs:%s:%s:cluster/%s\",\"status\":\"%s\",\"desiredCount\":1,\"runningCount\":1,\"deployments\":[{\"id\":\"ecs-svc/1\",\"status\":\"PRIMARY\",\"desiredCount\":1,\"runningCount\":1}]}",
+		region, fakeAccountId, cluster, name, name, region, fakeAccountId, cluster, status)
+}
+
+func (emulator *endpointEmulator) ecs(call awsCall, body []byte) (int, string) {
+	cluster := lastSegment(jsonString(body, "cluster"))
+	clusterJSON := func(name string, status string) string {
+		return fmt.Sprintf("{\"clusterArn\":\"arn:aws:ecs:%s:%s:cluster/%s\",\"clusterName\":\"%s\",\"status\":\"%s\"}", call.Region, fakeAccountId, name, name, status)
+	}
+	capacityProvider := func(name string) string {
+		return fmt.Sprintf("{\"capacityProviderArn\":\"arn:aws:ecs:%s:%s:capacity-provider/%s\",\"name\":\"%s\",\"status\":\"ACTIVE\",\"autoScalingGroupProvider\":{\"autoScalingGroupArn\":\"%s\"}}",
+			call.Region, fakeAccountId, name, name, emulator.live["capacity-provider/"+name])
+	}
+	taskDefinition := func(arn string) string {
+		return fmt.Sprintf("{\"taskDefinitionArn\":\"%s\",\"family\":\"%s\",\"status\":\"%s\"}", arn, strings.Split(lastSegment(arn), ":")[0], emulator.live["task-definition/"+arn])
+	}
+	switch call.Operation {
+	case "DescribeClusters":
+		clusters := make([]string, 0)
+		for _, name := range jsonStrings(body, "clusters") {
+			if _, found := emulator.live["cluster/"+lastSegment(name)]; found {
+				clusters = append(clusters, clusterJSON(lastSegment(name), "ACTIVE"))
+			}
+		}
+		return jsonReply("{\"clusters\":[" + strings.Join(clusters, ",") + "],\"failures\":[]}")
+	case "CreateCluster":
+		name := jsonString(body, "clusterName")
+		emulator.live["cluster/"+name] = ""
+		return jsonReply("{\"cluster\":" + clusterJSON(name, "ACTIVE") + "}")
+	case "DeleteCluster":
+		if _, found := emulator.live["cluster/"+cluster]; !found {
+			return jsonFault("ClusterNotFoundException")
+		}
+		if len(emulator.names("service/"+cluster)) != 0 {
+			return jsonFault("ClusterContainsServicesException")
+		}
+		delete(emulator.live, "cluster/"+cluster)
+		return jsonReply("{\"cluster\":" + clusterJSON(cluster, "INACTIVE") + "}")
+	case "ListContainerInstances":
+		return jsonReply("{\"containerInstanceArns\":[]}")
+	case "DescribeCapacityProviders":
+		providers := make([]string, 0)
+		for _, name := range jsonStrings(body, "capacityProviders") {
+			if _, found := emulator.live["capacity-provider/"+lastSegment(name)]; found {
+				providers = append(providers, capacityProvider(lastSegment(name)))
+			}
+		}
+		return jsonReply("{\"capacityProviders\":[" + strings.Join(providers, ",") + "],\"failures\":[]}")
+	case "CreateCapacityProvider":
+		name := jsonString(body, "name")
+		emulator.live["capacity-provider/"+name] = jsonString(body, "autoScalingGroupProvider", "autoScalingGroupArn")
+		return jsonReply("{\"capacityProvider\":" + capacityProvider(name) + "}")
+	case "DeleteCapacityProvider":
+		name := lastSegment(jsonString(body, "capacityProvider"))
+		if _, found := emulator.live["capacity-provider/"+name]; !found {
+			return jsonFault("ClientException")
+		}
+		reply := capacityProvider(name)
+		delete(emulator.live, "capacity-provider/"+name)
+		return jsonReply("{\"capacityProvider\":" + reply + "}")
+	case "RegisterTaskDefinition":
+		family := jsonString(body, "family")
+		revision := 1
+		for _, arn := range emulator.names("task-definition") {
+			if strings.HasPrefix(lastSegment(arn), family+":") {
+				revision++
+			}
+		}
+		arn := fmt.Sprintf("arn:aws:ecs:%s:%s:task-definition/%s:%d", call.Region, fakeAccountId, family, revision)
+		emulator.live["task-definition/"+arn] = "ACTIVE"
+		return jsonReply("{\"taskDefinition\":" + taskDefinition(arn) + "}")
+	case "DescribeTaskDefinition", "DeregisterTaskDefinition":
+		// by arn, or by family for its latest active revision
+		requested := jsonString(body, "taskDefinition")
+		arn := ""
+		for _, name := range emulator.names("task-definition") {
+			if name == requested || (strings.HasPrefix(lastSegment(name), requested+":") && emulator.live["task-definition/"+name] == "ACTIVE") {
+				arn = name
+			}
+		}
+		if arn == "" {
+			return jsonFault("ClientException")
+		}
+		if call.Operation == "DeregisterTaskDefinition" {
+			emulator.live["task-definition/"+arn] = "INACTIVE"
+		}
+		return jsonReply("{\"taskDefinition\":" + taskDefinition(arn) + "}")
+	case "DeleteTaskDefinitions":
+		deleted := make([]string, 0)
+		for _, arn := range jsonStrings(body, "taskDefinitions") {
+			if emulator.live["task-definition/"+arn] == "INACTIVE" {
+				delete(emulator.live, "task-definition/"+arn)
+				deleted = append(deleted, fmt.Sprintf("{\"taskDefinitionArn\":\"%s\",\"status\":\"DELETE_IN_PROGRESS\"}", arn))
+			}
+		}
+		return jsonReply("{\"taskDefinitions\":[" + strings.Join(deleted, ",") + "],\"failures\":[]}")
+	case "DescribeServices":
+		services, failures := make([]string, 0), make([]string, 0)
+		for _, name := range jsonStrings(body, "services") {
+			key := "service/" + cluster + "/" + lastSegment(name)
+			if _, found := emulator.live[key]; found {
+				services = append(services, emulator.ecsService(call.Region, cluster, lastSegment(name), "ACTIVE"))
+			} else if emulator.inactive[key] {
+				services = append(services, emulator.ecsService(call.Region, cluster, lastSegment(name), "INACTIVE"))
+			} else {
+				failures = append(failures, fmt.Sprintf("{\"arn\":\"%s\",\"reason\":\"MISSING\"}", name))
+			}
+		}
+		return jsonReply("{\"services\":[" + strings.Join(services, ",") + "],\"failures\":[" + strings.Join(failures, ",") + "]}")
+	case "CreateService":
+		name := jsonString(body, "serviceName")
+		if _, found := emulator.live["cluster/"+cluster]; !found {
+			return jsonFault("ClusterNotFoundException")
+		}
+		emulator.live["service/"+cluster+"/"+name] = string(body)
+		delete(emulator.inactive, "service/"+cluster+"/"+name)
+		return jsonReply("{\"service\":" + emulator.ecsService(call.Region, cluster, name, "ACTIVE") + "}")
+	case "UpdateService", "DeleteService":
+		name := lastSegment(jsonString(body, "service"))
+		key := "service/" + cluster + "/" + name
+		if _, found := emulator.live[key]; !found {
+			return jsonFault("ServiceNotFoundException")
+		}
+		if call.Operation == "UpdateService" {
+			return jsonReply("{\"service\":" + emulator.ecsService(call.Region, cluster, name, "ACTIVE") + "}")
+		}
+		delete(emulator.live, key)
+		emulator.inactive[key] = true
+		return jsonReply("{\"service\":" + emulator.ecsService(call.Region, cluster, name, "DRAINING") + "}")
+	}
+	return jsonFault("UnknownOperationException")
+}
@@ -0,0 +1,385 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	elb "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	resource "github.com/aws/aws-sdk-go-v2/service/resourcegroups"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// awsCall is a request a recordingServer received.
+type awsCall struct {
+	Service   string // signing name of the credential scope
+	Region    string
+	Operation string // X-Amz-Target or Action of the query protocols, method and path of the rest protocols
+	Path      string
+}
+
+func (call awsCall) String() string {
+	return call.Service + " " + call.Operation
+}
+
+// awsAnswer answers a recorded call with a status and a body.
+type awsAnswer func(call awsCall, body []byte) (int, string)
+
+// recordingServer is a local aws endpoint that records every call and answers the ones it knows.
+type recordingServer struct {
+	*httptest.Server
+	mutex      sync.Mutex
+	calls      []awsCall
+	unanswered []awsCall
+	answers    map[string]awsAnswer // by service and operation, or by service and * for every call of a service
+}
+
+func newRecordingServer(t *testing.T) *recordingServer {
+	t.Helper()
+	server := &recordingServer{answers: map[string]awsAnswer{}}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (server *recordingServer) serve(writer http.ResponseWriter, request *http.Request) {
+	call := awsCall{Operation: request.Method + " " + request.URL.Path, Path: request.URL.Path}
+	// subresources like ?tagging of s3 tell the operations on the same path apart
+	subresources := make([]string, 0)
+	for key, values := range request.URL.Query() {
+		if len(values) == 1 && values[0] == "" {
+			subresources = append(subresources, key)
+		}
+	}
+	if len(subresources) != 0 {
+		slices.Sort(subresources)
+		call.Operation += "?" + strings.Join(subresources, "&")
+	}
+	// Credential=AKID/20240101/ap-northeast-2/ecs/aws4_request
+	_, scope, _ := strings.Cut(request.Header.Get("Authorization"), "Credential=")
+	scope, _, _ = strings.Cut(scope, ",")
+	if parts := strings.Split(scope, "/"); len(parts) == 5 {
+		call.Region = parts[2]
+		call.Service = parts[3]
+	}
+	var body []byte
+	if strings.HasPrefix(request.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		err := request.ParseForm()
+		if err == nil && request.PostForm.Get("Action") != "" {
+			call.Operation = request.PostForm.Get("Action")
+		}
+		body = []byte(request.PostForm.Encode())
+	} else {
+		body, _ = io.ReadAll(request.Body)
+		if target := request.Header.Get("X-Amz-Target"); target != "" {
+			call.Operation = target[strings.LastIndex(target, ".")+1:]
+		}
+	}
+
+	server.mutex.Lock()
+	server.calls = append(server.calls, call)
+	answer, found := server.answers[call.String()]
+	if !found {
+		answer, found = server.answers[call.Service+" *"]
+	}
+	if !found {
+		server.unanswered = append(server.unanswered, call)
+	}
+	server.mutex.Unlock()
+	if !found {
+		// 400 is not retried, so a call the test did not expect fails right away
+		writer.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(writer, "{\"__type\":\"ValidationException\",\"message\":\"%s is not answered\"}", call)
+		return
+	}
+	status, response := answer(call, body)
+	writer.WriteHeader(status)
+	fmt.Fprint(writer, response)
+}
+
+func (server *recordingServer) answer(call string, answer awsAnswer) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.answers[call] = answer
+}
+
+func (server *recordingServer) recorded() []awsCall {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return slices.Clone(server.calls)
+}
+
+// notAnswered lists the calls no answer was registered for.
+func (server *recordingServer) notAnswered() []awsCall {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return slices.Clone(server.unanswered)
+}
+
+// useEndpoint sends every client of the package to url with static credentials, away from the local aws config.
+func useEndpoint(t *testing.T, url string) {
+	t.Helper()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	profile := Profile
+	provider := credentialsProvider
+	Profile = ""
+	credentialsProvider = credentials.NewStaticCredentialsProvider("AKIDTEST", "SECRETTEST", "")
+	EndpointURL = url
+	t.Cleanup(func() {
+		Profile = profile
+		credentialsProvider = provider
+		EndpointURL = ""
+		serviceEndpointURLs = map[string]string{}
+	})
+}
+
+// clientCalls makes one call with every client of sdkClientProvider, keyed by the signing name it is expected with.
+var clientCalls = map[string]func(region *string) error{
+	"acm": func(region *string) error {
+		client, err := sdkClientProvider{}.ACM(region)
+		if err == nil {
+			_, err = client.DescribeCertificate(ctx, &acm.DescribeCertificateInput{CertificateArn: aws.String("arn:aws:acm:test")})
+		}
+		return err
+	},
+	"autoscaling": func(region *string) error {
+		client, err := sdkClientProvider{}.AutoScaling(region)
+		if err == nil {
+			_, err = client.DescribeAutoScalingGroups(ctx, &autoscaling.DescribeAutoScalingGroupsInput{})
+		}
+		return err
+	},
+	"cloudfront": func(region *string) error {
+		client, err := sdkClientProvider{}.CloudFront(region)
+		if err == nil {
+			_, err = client.GetDistribution(ctx, &cloudfront.GetDistributionInput{Id: aws.String("E1TEST")})
+		}
+		return err
+	},
+	"ec2": func(region *string) error {
+		client, err := sdkClientProvider{}.EC2(region)
+		if err == nil {
+			_, err = client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{})
+		}
+		return err
+	},
+	"ecr": func(region *string) error {
+		client, err := sdkClientProvider{}.ECR(region)
+		if err == nil {
+			_, err = client.DescribeRepositories(ctx, &ecr.DescribeRepositoriesInput{})
+		}
+		return err
+	},
+	"ecs": func(region *string) error {
+		client, err := sdkClientProvider{}.ECS(region)
+		if err == nil {
+			_, err = client.DescribeClusters(ctx, &ecs.DescribeClustersInput{})
+		}
+		return err
+	},
+	"elasticloadbalancing": func(region *string) error {
+		client, err := sdkClientProvider{}.ELB(region)
+		if err == nil {
+			_, err = client.DescribeLoadBalancers(ctx, &elb.DescribeLoadBalancersInput{})
+		}
+		return err
+	},
+	"iam": func(region *string) error {
+		client, err := sdkClientProvider{}.IAM(region)
+		if err == nil {
+			_, err = client.ListUsers(ctx, &iam.ListUsersInput{})
+		}
+		return err
+	},
+	"logs": func(region *string) error {
+		client, err := sdkClientProvider{}.Logs(region)
+		if err == nil {
+			_, err = client.DescribeLogGroups(ctx, &cloudwatchlogs.DescribeLogGroupsInput{})
+		}
+		return err
+	},
+	"rds": func(region *string) error {
+		client, err := sdkClientProvider{}.RDS(region)
+		if err == nil {
+			_, err = client.DescribeDBInstances(ctx, &rds.DescribeDBInstancesInput{})
+		}
+		return err
+	},
+	"resource-groups": func(region *string) error {
+		client, err := sdkClientProvider{}.ResourceGroups(region)
+		if err == nil {
+			_, err = client.GetGroup(ctx, &resource.GetGroupInput{Group: aws.String("cloudGun-test")})
+		}
+		return err
+	},
+	"route53": func(region *string) error {
+		client, err := sdkClientProvider{}.Route53(region)
+		if err == nil {
+			_, err = client.ListHostedZones(ctx, &route53.ListHostedZonesInput{})
+		}
+		return err
+	},
+	"s3": func(region *string) error {
+		client, err := sdkClientProvider{}.S3(region)
+		if err == nil {
+			_, err = client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String("cloudgun-test")})
+		}
+		return err
+	},
+	"ssm": func(region *string) error {
+		client, err := sdkClientProvider{}.SSM(region)
+		if err == nil {
+			_, err = client.GetParametersByPath(ctx, &ssm.GetParametersByPathInput{Path: aws.String("/cloudGun-test/env/")})
+		}
+		return err
+	},
+	"sts": func(region *string) error {
+		client, err := sdkClientProvider{}.STS(region, nil)
+		if err == nil {
+			_, err = client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		}
+		return err
+	},
+}
+
+func TestEndpointURL(t *testing.T) {
+	server := newRecordingServer(t)
+	useEndpoint(t, server.URL)
+
+	for service, call := range clientCalls {
+		t.Run(service, func(t *testing.T) {
+			before := len(server.recorded())
+			err := call(aws.String(testRegion))
+			if err == nil {
+				t.Fatal("expected the call the server does not answer to fail")
+			}
+			calls := server.recorded()[before:]
+			if len(calls) != 1 {
+				t.Fatalf("expected 1 call on the endpoint, got %v", calls)
+			}
+			if calls[0].Service != service {
+				t.Errorf("expected a call signed for %s, got %s", service, calls[0].Service)
+			}
+			if service == "s3" && !strings.HasPrefix(calls[0].Path, "/cloudgun-test") {
+				t.Errorf("expected a path style bucket, got %s", calls[0].Path)
+			}
+		})
+	}
+}
+
+func TestServiceEndpointURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		service  string
+		override string
+		moved    []string // signing names sent to the override
+	}{
+		{name: "s3", service: "s3", override: "s3", moved: []string{"s3"}},
+		{name: "iam", service: "iam", override: "iam", moved: []string{"iam"}},
+		{name: "elbv2", service: "elasticloadbalancing", override: "elbv2", moved: []string{"elasticloadbalancing"}},
+		{name: "resource groups", service: "resource-groups", override: "resourcegroups", moved: []string{"resource-groups"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newRecordingServer(t)
+			override := newRecordingServer(t)
+			useEndpoint(t, server.URL)
+			err := SetServiceEndpointURL(test.override, override.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, call := range clientCalls {
+				_ = call(aws.String(testRegion))
+			}
+			for _, call := range override.recorded() {
+				if !slices.Contains(test.moved, call.Service) {
+					t.Errorf("%s went to the override of %s", call, test.override)
+				}
+			}
+			for _, call := range server.recorded() {
+				if slices.Contains(test.moved, call.Service) {
+					t.Errorf("%s did not go to the override of %s", call, test.override)
+				}
+			}
+			if len(override.recorded()) != 1 {
+				t.Errorf("expected 1 call on the override, got %v", override.recorded())
+			}
+		})
+	}
+
+	err := SetServiceEndpointURL("lambda", "http://localhost:4566")
+	if err == nil {
+		t.Error("expected an unknown service to be refused")
+	}
+}
+
+func TestCreateDeleteAgainstEndpoint(t *testing.T) {
+	newTestCloud(t)
+	// the state and timeouts of a test cloud, the clients of the sdk
+	SetClientProvider(sdkClientProvider{})
+	server := newRecordingServer(t)
+	useEndpoint(t, server.URL)
+	emulator := emulateEndpoint(server)
+	_, name := stackNames()
+
+	createTestStack(t)
+	created := server.recorded()
+	for _, service := range []string{"acm", "autoscaling", "cloudfront", "ec2", "ecr", "ecs", "elasticloadbalancing", "iam",
+		"logs", "resource-groups", "route53", "s3", "sts"} {
+		if !slices.ContainsFunc(created, func(call awsCall) bool { return call.Service == service }) {
+			t.Errorf("expected create to call %s", service)
+		}
+	}
+	for kind, count := range map[string]int{"group": 2, "bucket": 2, "distribution": 2, "certificate": 2, "repository": 1,
+		"log-group": 1, "role": 3, "instance-profile": 1, "auto-scaling-group": 1, "launch-template": 1, "capacity-provider": 1,
+		"cluster": 1, "service/" + name: 1, "load-balancer": 1, "target-group": 1, "listener": 1, "security-group": 1} {
+		if emulator.count(kind) != count {
+			t.Errorf("expected %d %s after create, got %v", count, kind, emulator.left())
+		}
+	}
+
+	err := DeleteResources(aws.String(testRegion), &name, aws.String(testDomain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left := emulator.left(); len(left) != 0 {
+		t.Errorf("expected nothing left on the endpoint, got %v", left)
+	}
+	if len(GetStateResources("")) != 0 {
+		t.Errorf("expected an empty state, got %v", GetStateResources(""))
+	}
+	if unanswered := server.notAnswered(); len(unanswered) != 0 {
+		t.Errorf("expected every call to be answered, got %v", unanswered)
+	}
+	deleted := make([]string, 0)
+	for _, call := range server.recorded()[len(created):] {
+		deleted = append(deleted, call.String())
+	}
+	// the group goes last, after everything it holds
+	if slices.Index(deleted, "resource-groups POST /delete-group") < slices.Index(deleted, "ecr DeleteRepository") {
+		t.Errorf("expected the repository to be deleted before the resource groups, got %v", deleted)
+	}
+}
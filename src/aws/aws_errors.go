@@ -0,0 +1,106 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/smithy-go"
+	"slices"
+)
+
+// ErrorKind is what an aws error means for cloudGun, decided by the error code and never by the message.
+type ErrorKind int
+
+const (
+	ErrorUnknown ErrorKind = iota
+	ErrorNotFound
+	ErrorAlreadyExists
+	ErrorInUse
+	ErrorThrottling
+	ErrorAccessDenied
+)
+
+var errorCodes = map[ErrorKind][]string{
+	ErrorNotFound: {
+		"NotFound", "NotFoundException", "ResourceNotFoundException", "NoSuchEntity", "NoSuchBucket", "NoSuchTagSet",
+		"NoSuchDistribution", "NoSuchHostedZone", "InvalidInstanceID.NotFound", "InvalidGroup.NotFound",
+		"InvalidLaunchTemplateName.NotFoundException", "InvalidLaunchTemplateId.NotFound", "LoadBalancerNotFound",
+		"TargetGroupNotFound", "ListenerNotFound", "RepositoryNotFoundException", "ClusterNotFoundException",
+		"ServiceNotFoundException", "ServiceNotActiveException", "DBInstanceNotFound", "DBInstanceNotFoundFault",
+		"ParameterNotFound", "ImageNotFoundException",
+	},
+	ErrorAlreadyExists: {
+		"AlreadyExists", "AlreadyExistsException", "ResourceAlreadyExistsException", "EntityAlreadyExists",
+		"BucketAlreadyOwnedByYou", "RepositoryAlreadyExistsException", "InvalidGroup.Duplicate",
+		"InvalidLaunchTemplateName.AlreadyExistsException", "DuplicateLoadBalancerName", "DuplicateTargetGroupName",
+		"DuplicateListener", "DBInstanceAlreadyExists", "DBInstanceAlreadyExistsFault", "HostedZoneAlreadyExists",
+		"DistributionAlreadyExists", "CNAMEAlreadyExists", "ParameterAlreadyExists", "ResourceExistsException",
+		"ImageAlreadyExistsException", "LayerAlreadyExistsException",
+	},
+	ErrorInUse: {
+		"ResourceInUse", "ResourceInUseException", "DependencyViolation", "DeleteConflict", "DistributionNotDisabled",
+		"ClusterContainsServicesException", "ClusterContainsContainerInstancesException", "ClusterContainsTasksException",
+		"ScalingActivityInProgress", "ResourceInUseFault", "InvalidDBInstanceState",
+	},
+	ErrorThrottling: {
+		"Throttling", "ThrottlingException", "ThrottledException", "TooManyRequestsException",
+		"RequestLimitExceeded", "RequestThrottled", "SlowDown", "PriorRequestNotComplete",
+	},
+	ErrorAccessDenied: {
+		"AccessDenied", "AccessDeniedException", "UnauthorizedOperation", "UnauthorizedAccess", "AuthFailure",
+		"InvalidClientTokenId", "SignatureDoesNotMatch", "ExpiredToken", "ExpiredTokenException",
+	},
+}
+
+func errorCode(err error) string {
+	var apiError smithy.APIError
+	if errors.As(err, &apiError) {
+		return apiError.ErrorCode()
+	}
+	return ""
+}
+
+func hasErrorCode(err error, codes ...string) bool {
+	code := errorCode(err)
+	return code != "" && slices.Contains(codes, code)
+}
+
+// ClassifyError tells what kind of failure an aws error is. errors that are not from aws are ErrorUnknown.
+func ClassifyError(err error) ErrorKind {
+	code := errorCode(err)
+	if code == "" {
+		return ErrorUnknown
+	}
+	for kind, codes := range errorCodes {
+		if slices.Contains(codes, code) {
+			return kind
+		}
+	}
+	return ErrorUnknown
+}
+
+func isNotFound(err error) bool {
+	return ClassifyError(err) == ErrorNotFound
+}
+
+func isAlreadyExists(err error) bool {
+	return ClassifyError(err) == ErrorAlreadyExists
+}
+
+func isInUse(err error) bool {
+	return ClassifyError(err) == ErrorInUse
+}
+
+func isThrottling(err error) bool {
+	return ClassifyError(err) == ErrorThrottling
+}
+
+// DescribeError adds what to do about the error when cloudGun knows it.
+func DescribeError(err error) string {
+	switch ClassifyError(err) {
+	case ErrorAccessDenied:
+		return fmt.Sprintf("%s\nthe aws credentials of profile %s are not allowed to do this. check their iam policies", err.Error(), getProfileName())
+	case ErrorThrottling:
+		return fmt.Sprintf("%s\naws kept throttling the requests. please try again in a few minutes", err.Error())
+	}
+	return err.Error()
+}
@@ -0,0 +1,1722 @@
+package aws
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	asgTypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	logsTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrTypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	elb "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbTypes "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	resource "github.com/aws/aws-sdk-go-v2/service/resourcegroups"
+	resourceTypes "github.com/aws/aws-sdk-go-v2/service/resourcegroups/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmTypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ec2
+
+func ec2TagsOf(specifications []ec2Types.TagSpecification, resourceType ec2Types.ResourceType) []ec2Types.Tag {
+	for _, specification := range specifications {
+		if specification.ResourceType == resourceType {
+			return specification.Tags
+		}
+	}
+	return nil
+}
+
+// matchesEC2Filters supports the tag:<key> and group-name filters cloudGun uses.
+func matchesEC2Filters(filters []ec2Types.Filter, name string, tags []ec2Types.Tag) bool {
+	for _, filter := range filters {
+		value := ""
+		if strings.HasPrefix(*filter.Name, "tag:") {
+			key := strings.TrimPrefix(*filter.Name, "tag:")
+			index := slices.IndexFunc(tags, func(tag ec2Types.Tag) bool { return *tag.Key == key })
+			if index == -1 {
+				return false
+			}
+			value = *tags[index].Value
+		} else if *filter.Name == "group-name" {
+			value = name
+		}
+		if !slices.Contains(filter.Values, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeRegion) DescribeAvailabilityZones(_ context.Context, _ *ec2.DescribeAvailabilityZonesInput, _ ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error) {
+	err := f.begin("EC2.DescribeAvailabilityZones")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	zones := make([]ec2Types.AvailabilityZone, 0)
+	for i, suffix := range []string{"a", "b", "c"} {
+		zones = append(zones, ec2Types.AvailabilityZone{
+			ZoneName:   aws.String(f.region + suffix),
+			ZoneId:     aws.String(fmt.Sprintf("%s-az%d", f.region, i+1)),
+			RegionName: aws.String(f.region),
+			GroupName:  aws.String(f.region),
+		})
+	}
+	return &ec2.DescribeAvailabilityZonesOutput{AvailabilityZones: zones}, nil
+}
+
+func (f *fakeRegion) DescribeSubnets(_ context.Context, params *ec2.DescribeSubnetsInput, _ ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error) {
+	err := f.begin("EC2.DescribeSubnets")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	subnets := make([]ec2Types.Subnet, 0)
+	for _, filter := range params.Filters {
+		if *filter.Name != "availability-zone-id" {
+			continue
+		}
+		for _, zoneId := range filter.Values {
+			subnets = append(subnets, ec2Types.Subnet{SubnetId: aws.String("subnet-" + zoneId), AvailabilityZoneId: aws.String(zoneId), VpcId: aws.String("vpc-default")})
+		}
+	}
+	return &ec2.DescribeSubnetsOutput{Subnets: subnets}, nil
+}
+
+func (f *fakeRegion) DescribeVpcs(_ context.Context, _ *ec2.DescribeVpcsInput, _ ...func(*ec2.Options)) (*ec2.DescribeVpcsOutput, error) {
+	err := f.begin("EC2.DescribeVpcs")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	return &ec2.DescribeVpcsOutput{Vpcs: []ec2Types.Vpc{{VpcId: aws.String("vpc-default"), IsDefault: aws.Bool(true)}}}, nil
+}
+
+func (f *fakeRegion) DescribeImages(_ context.Context, params *ec2.DescribeImagesInput, _ ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	err := f.begin("EC2.DescribeImages")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	images := make([]ec2Types.Image, 0)
+	for _, image := range f.cloud.images {
+		for _, filter := range params.Filters {
+			if *filter.Name == "name" && slices.Contains(filter.Values, *image.Name) {
+				images = append(images, image)
+			}
+		}
+	}
+	return &ec2.DescribeImagesOutput{Images: images}, nil
+}
+
+func (f *fakeRegion) DescribeInstances(_ context.Context, params *ec2.DescribeInstancesInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	err := f.begin("EC2.DescribeInstances")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	// auto scaling groups of the fake never launch instances
+	if len(params.InstanceIds) != 0 {
+		return nil, fakeError("InvalidInstanceID.NotFound", "The instance IDs '%s' do not exist", strings.Join(params.InstanceIds, ", "))
+	}
+	return &ec2.DescribeInstancesOutput{Reservations: []ec2Types.Reservation{}}, nil
+}
+
+func (f *fakeRegion) TerminateInstances(_ context.Context, params *ec2.TerminateInstancesInput, _ ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
+	err := f.begin("EC2.TerminateInstances")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	return nil, fakeError("InvalidInstanceID.NotFound", "The instance IDs '%s' do not exist", strings.Join(params.InstanceIds, ", "))
+}
+
+func (f *fakeRegion) securityGroup(id *string) (*fakeSecurityGroup, error) {
+	group, ok := f.cloud.securityGroups[*id]
+	if !ok || group.region != f.region {
+		return nil, fakeError("InvalidGroup.NotFound", "The security group '%s' does not exist", *id)
+	}
+	return group, nil
+}
+
+func (f *fakeRegion) CreateSecurityGroup(_ context.Context, params *ec2.CreateSecurityGroupInput, _ ...func(*ec2.Options)) (*ec2.CreateSecurityGroupOutput, error) {
+	err := f.begin("EC2.CreateSecurityGroup")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range f.cloud.securityGroups {
+		if group.region == f.region && *group.group.GroupName == *params.GroupName {
+			return nil, fakeError("InvalidGroup.Duplicate", "The security group '%s' already exists for VPC 'vpc-default'", *params.GroupName)
+		}
+	}
+	id := fmt.Sprintf("sg-%08d", f.nextId())
+	tags := ec2TagsOf(params.TagSpecifications, ec2Types.ResourceTypeSecurityGroup)
+	f.cloud.securityGroups[id] = &fakeSecurityGroup{region: f.region, group: ec2Types.SecurityGroup{
+		GroupId:     aws.String(id),
+		GroupName:   params.GroupName,
+		Description: params.Description,
+		VpcId:       aws.String("vpc-default"),
+		Tags:        tags,
+	}}
+	f.cloud.stackTags[f.arn("ec2", "security-group/"+id)] = stackUUID(tags, func(tag ec2Types.Tag) (*string, *string) { return tag.Key, tag.Value })
+	return &ec2.CreateSecurityGroupOutput{GroupId: aws.String(id)}, nil
+}
+
+func (f *fakeRegion) AuthorizeSecurityGroupIngress(_ context.Context, params *ec2.AuthorizeSecurityGroupIngressInput, _ ...func(*ec2.Options)) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
+	err := f.begin("EC2.AuthorizeSecurityGroupIngress")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	group, err := f.securityGroup(params.GroupId)
+	if err != nil {
+		return nil, err
+	}
+	group.group.IpPermissions = append(group.group.IpPermissions, params.IpPermissions...)
+	return &ec2.AuthorizeSecurityGroupIngressOutput{Return: aws.Bool(true)}, nil
+}
+
+func (f *fakeRegion) DescribeSecurityGroups(_ context.Context, params *ec2.DescribeSecurityGroupsInput, _ ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupsOutput, error) {
+	err := f.begin("EC2.DescribeSecurityGroups")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]ec2Types.SecurityGroup, 0)
+	for _, id := range params.GroupIds {
+		group, err := f.securityGroup(aws.String(id))
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group.group)
+	}
+	if len(params.GroupIds) == 0 {
+		for _, group := range f.cloud.securityGroups {
+			if group.region == f.region && matchesEC2Filters(params.Filters, *group.group.GroupName, group.group.Tags) {
+				groups = append(groups, group.group)
+			}
+		}
+	}
+	return &ec2.DescribeSecurityGroupsOutput{SecurityGroups: groups}, nil
+}
+
+func (f *fakeRegion) DeleteSecurityGroup(_ context.Context, params *ec2.DeleteSecurityGroupInput, _ ...func(*ec2.Options)) (*ec2.DeleteSecurityGroupOutput, error) {
+	err := f.begin("EC2.DeleteSecurityGroup")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.securityGroup(params.GroupId)
+	if err != nil {
+		return nil, err
+	}
+	for _, loadBalancer := range f.cloud.loadBalancers {
+		if slices.Contains(loadBalancer.value.SecurityGroups, *params.GroupId) {
+			return nil, fakeError("DependencyViolation", "resource %s has a dependent object", *params.GroupId)
+		}
+	}
+	// the ingress of another group and the network interfaces of running tasks keep a group in use
+	for id, group := range f.cloud.securityGroups {
+		for _, permission := range group.group.IpPermissions {
+			for _, pair := range permission.UserIdGroupPairs {
+				if id != *params.GroupId && aws.ToString(pair.GroupId) == *params.GroupId {
+					return nil, fakeError("DependencyViolation", "resource %s has a dependent object", *params.GroupId)
+				}
+			}
+		}
+	}
+	for _, service := range f.cloud.services {
+		if *service.value.Status != "INACTIVE" && service.value.NetworkConfiguration != nil &&
+			slices.Contains(service.value.NetworkConfiguration.AwsvpcConfiguration.SecurityGroups, *params.GroupId) {
+			return nil, fakeError("DependencyViolation", "resource %s has a dependent object", *params.GroupId)
+		}
+	}
+	delete(f.cloud.securityGroups, *params.GroupId)
+	delete(f.cloud.stackTags, f.arn("ec2", "security-group/"+*params.GroupId))
+	return &ec2.DeleteSecurityGroupOutput{}, nil
+}
+
+func (f *fakeRegion) launchTemplate(name *string) (*fakeLaunchTemplate, error) {
+	template, ok := f.cloud.launchTemplates[f.region+"/"+*name]
+	if !ok {
+		return nil, fakeError("InvalidLaunchTemplateName.NotFoundException", "At least one of the launch templates specified in the request does not exist.")
+	}
+	return template, nil
+}
+
+func (f *fakeRegion) CreateLaunchTemplate(_ context.Context, params *ec2.CreateLaunchTemplateInput, _ ...func(*ec2.Options)) (*ec2.CreateLaunchTemplateOutput, error) {
+	err := f.begin("EC2.CreateLaunchTemplate")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := f.cloud.launchTemplates[f.region+"/"+*params.LaunchTemplateName]; ok {
+		return nil, fakeError("InvalidLaunchTemplateName.AlreadyExistsException", "Launch template name already in use.")
+	}
+	template := ec2Types.LaunchTemplate{
+		LaunchTemplateId:   aws.String(fmt.Sprintf("lt-%08d", f.nextId())),
+		LaunchTemplateName: params.LaunchTemplateName,
+	}
+	f.cloud.launchTemplates[f.region+"/"+*params.LaunchTemplateName] = &fakeLaunchTemplate{region: f.region, template: template, data: params.LaunchTemplateData}
+	return &ec2.CreateLaunchTemplateOutput{LaunchTemplate: &template}, nil
+}
+
+func (f *fakeRegion) DescribeLaunchTemplates(_ context.Context, params *ec2.DescribeLaunchTemplatesInput, _ ...func(*ec2.Options)) (*ec2.DescribeLaunchTemplatesOutput, error) {
+	err := f.begin("EC2.DescribeLaunchTemplates")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	templates := make([]ec2Types.LaunchTemplate, 0)
+	for _, name := range params.LaunchTemplateNames {
+		template, err := f.launchTemplate(aws.String(name))
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template.template)
+	}
+	return &ec2.DescribeLaunchTemplatesOutput{LaunchTemplates: templates}, nil
+}
+
+func (f *fakeRegion) DeleteLaunchTemplate(_ context.Context, params *ec2.DeleteLaunchTemplateInput, _ ...func(*ec2.Options)) (*ec2.DeleteLaunchTemplateOutput, error) {
+	err := f.begin("EC2.DeleteLaunchTemplate")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	template, err := f.launchTemplate(params.LaunchTemplateName)
+	if err != nil {
+		return nil, err
+	}
+	delete(f.cloud.launchTemplates, f.region+"/"+*params.LaunchTemplateName)
+	return &ec2.DeleteLaunchTemplateOutput{LaunchTemplate: &template.template}, nil
+}
+
+// auto scaling
+
+func (f *fakeRegion) CreateAutoScalingGroup(_ context.Context, params *autoscaling.CreateAutoScalingGroupInput, _ ...func(*autoscaling.Options)) (*autoscaling.CreateAutoScalingGroupOutput, error) {
+	err := f.begin("AutoScaling.CreateAutoScalingGroup")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := f.cloud.autoScalingGroups[f.region+"/"+*params.AutoScalingGroupName]; ok {
+		return nil, fakeError("AlreadyExists", "AutoScalingGroup by this name already exists - A group with the name %s already exists", *params.AutoScalingGroupName)
+	}
+	found := false
+	for _, template := range f.cloud.launchTemplates {
+		found = found || (template.region == f.region && *template.template.LaunchTemplateId == aws.ToString(params.LaunchTemplate.LaunchTemplateId))
+	}
+	if !found {
+		return nil, fakeError("ValidationError", "You must use a valid fully-formed launch template. The specified launch template does not exist.")
+	}
+	f.cloud.autoScalingGroups[f.region+"/"+*params.AutoScalingGroupName] = &fakeAutoScalingGroup{region: f.region, group: asgTypes.AutoScalingGroup{
+		AutoScalingGroupARN:  aws.String(f.arn("autoscaling", fmt.Sprintf("autoScalingGroup:%d:autoScalingGroupName/%s", f.nextId(), *params.AutoScalingGroupName))),
+		AutoScalingGroupName: params.AutoScalingGroupName,
+		MinSize:              params.MinSize,
+		MaxSize:              params.MaxSize,
+		DesiredCapacity:      params.DesiredCapacity,
+		LaunchTemplate:       params.LaunchTemplate,
+		AvailabilityZones:    params.AvailabilityZones,
+	}}
+	return &autoscaling.CreateAutoScalingGroupOutput{}, nil
+}
+
+func (f *fakeRegion) DescribeAutoScalingGroups(_ context.Context, params *autoscaling.DescribeAutoScalingGroupsInput, _ ...func(*autoscaling.Options)) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	err := f.begin("AutoScaling.DescribeAutoScalingGroups")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]asgTypes.AutoScalingGroup, 0)
+	for _, name := range params.AutoScalingGroupNames {
+		if group, ok := f.cloud.autoScalingGroups[f.region+"/"+name]; ok {
+			groups = append(groups, group.group)
+		}
+	}
+	return &autoscaling.DescribeAutoScalingGroupsOutput{AutoScalingGroups: groups}, nil
+}
+
+func (f *fakeRegion) DeleteAutoScalingGroup(_ context.Context, params *autoscaling.DeleteAutoScalingGroupInput, _ ...func(*autoscaling.Options)) (*autoscaling.DeleteAutoScalingGroupOutput, error) {
+	err := f.begin("AutoScaling.DeleteAutoScalingGroup")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	group, ok := f.cloud.autoScalingGroups[f.region+"/"+*params.AutoScalingGroupName]
+	if !ok {
+		return nil, fakeError("ValidationError", "AutoScalingGroup name not found - AutoScalingGroup %s not found", *params.AutoScalingGroupName)
+	}
+	for _, provider := range f.cloud.capacityProviders {
+		if provider.value.Status == ecsTypes.CapacityProviderStatusActive &&
+			*provider.value.AutoScalingGroupProvider.AutoScalingGroupArn == *group.group.AutoScalingGroupARN {
+			return nil, fakeError("ResourceInUse", "The auto scaling group is used by capacity provider %s", *provider.value.Name)
+		}
+	}
+	delete(f.cloud.autoScalingGroups, f.region+"/"+*params.AutoScalingGroupName)
+	return &autoscaling.DeleteAutoScalingGroupOutput{}, nil
+}
+
+// ecs
+
+func (f *fakeRegion) ecsArn(resourceType string, nameOrArn string) string {
+	if strings.HasPrefix(nameOrArn, "arn:") {
+		return nameOrArn
+	}
+	return f.arn("ecs", resourceType+"/"+nameOrArn)
+}
+
+func (f *fakeRegion) activeCluster(nameOrArn *string) (*fakeRegional[ecsTypes.Cluster], error) {
+	cluster, ok := f.cloud.clusters[f.ecsArn("cluster", aws.ToString(nameOrArn))]
+	if !ok || *cluster.value.Status != "ACTIVE" {
+		return nil, fakeError("ClusterNotFoundException", "Cluster not found.")
+	}
+	return cluster, nil
+}
+
+func (f *fakeRegion) CreateCluster(_ context.Context, params *ecs.CreateClusterInput, _ ...func(*ecs.Options)) (*ecs.CreateClusterOutput, error) {
+	err := f.begin("ECS.CreateCluster")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	arn := f.ecsArn("cluster", *params.ClusterName)
+	if existing, ok := f.cloud.clusters[arn]; ok && *existing.value.Status == "ACTIVE" {
+		return &ecs.CreateClusterOutput{Cluster: &existing.value}, nil
+	}
+	for _, name := range params.CapacityProviders {
+		if name == "FARGATE" || name == "FARGATE_SPOT" {
+			continue
+		}
+		provider, ok := f.cloud.capacityProviders[f.ecsArn("capacity-provider", name)]
+		if !ok || provider.value.Status != ecsTypes.CapacityProviderStatusActive {
+			return nil, fakeError("InvalidParameterException", "The specified capacity provider %s is not in an ACTIVE state.", name)
+		}
+	}
+	cluster := ecsTypes.Cluster{
+		ClusterArn:                      aws.String(arn),
+		ClusterName:                     params.ClusterName,
+		Status:                          aws.String("ACTIVE"),
+		CapacityProviders:               params.CapacityProviders,
+		DefaultCapacityProviderStrategy: params.DefaultCapacityProviderStrategy,
+		Tags:                            params.Tags,
+	}
+	f.cloud.clusters[arn] = &fakeRegional[ecsTypes.Cluster]{region: f.region, value: cluster}
+	f.cloud.stackTags[arn] = stackUUID(params.Tags, func(tag ecsTypes.Tag) (*string, *string) { return tag.Key, tag.Value })
+	return &ecs.CreateClusterOutput{Cluster: &cluster}, nil
+}
+
+func (f *fakeRegion) DescribeClusters(_ context.Context, params *ecs.DescribeClustersInput, _ ...func(*ecs.Options)) (*ecs.DescribeClustersOutput, error) {
+	err := f.begin("ECS.DescribeClusters")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	output := &ecs.DescribeClustersOutput{}
+	for _, name := range params.Clusters {
+		arn := f.ecsArn("cluster", name)
+		if cluster, ok := f.cloud.clusters[arn]; ok {
+			output.Clusters = append(output.Clusters, cluster.value)
+		} else {
+			output.Failures = append(output.Failures, ecsTypes.Failure{Arn: aws.String(arn), Reason: aws.String("MISSING")})
+		}
+	}
+	return output, nil
+}
+
+func (f *fakeRegion) DeleteCluster(_ context.Context, params *ecs.DeleteClusterInput, _ ...func(*ecs.Options)) (*ecs.DeleteClusterOutput, error) {
+	err := f.begin("ECS.DeleteCluster")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	cluster, err := f.activeCluster(params.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	for _, service := range f.cloud.services {
+		if *service.value.ClusterArn == *cluster.value.ClusterArn && *service.value.Status != "INACTIVE" {
+			return nil, fakeError("ClusterContainsServicesException", "The Cluster cannot be deleted while Services are active.")
+		}
+	}
+	cluster.value.Status = aws.String("INACTIVE")
+	cluster.value.CapacityProviders = nil
+	delete(f.cloud.stackTags, *cluster.value.ClusterArn)
+	return &ecs.DeleteClusterOutput{Cluster: &cluster.value}, nil
+}
+
+func (f *fakeRegion) ListContainerInstances(_ context.Context, params *ecs.ListContainerInstancesInput, _ ...func(*ecs.Options)) (*ecs.ListContainerInstancesOutput, error) {
+	err := f.begin("ECS.ListContainerInstances")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.activeCluster(params.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	return &ecs.ListContainerInstancesOutput{ContainerInstanceArns: []string{}}, nil
+}
+
+func (f *fakeRegion) DeregisterContainerInstance(_ context.Context, params *ecs.DeregisterContainerInstanceInput, _ ...func(*ecs.Options)) (*ecs.DeregisterContainerInstanceOutput, error) {
+	err := f.begin("ECS.DeregisterContainerInstance")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	return nil, fakeError("InvalidParameterException", "Container instance %s not found.", *params.ContainerInstance)
+}
+
+func (f *fakeRegion) CreateCapacityProvider(_ context.Context, params *ecs.CreateCapacityProviderInput, _ ...func(*ecs.Options)) (*ecs.CreateCapacityProviderOutput, error) {
+	err := f.begin("ECS.CreateCapacityProvider")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	arn := f.ecsArn("capacity-provider", *params.Name)
+	if existing, ok := f.cloud.capacityProviders[arn]; ok && existing.value.Status == ecsTypes.CapacityProviderStatusActive {
+		return nil, fakeError("ClientException", "The specified capacity provider already exists.")
+	}
+	found := false
+	for _, group := range f.cloud.autoScalingGroups {
+		found = found || *group.group.AutoScalingGroupARN == *params.AutoScalingGroupProvider.AutoScalingGroupArn
+	}
+	if !found {
+		return nil, fakeError("ClientException", "The specified Auto Scaling group ARN is not valid.")
+	}
+	provider := ecsTypes.CapacityProvider{
+		CapacityProviderArn:      aws.String(arn),
+		Name:                     params.Name,
+		Status:                   ecsTypes.CapacityProviderStatusActive,
+		AutoScalingGroupProvider: params.AutoScalingGroupProvider,
+		Tags:                     params.Tags,
+	}
+	f.cloud.capacityProviders[arn] = &fakeRegional[ecsTypes.CapacityProvider]{region: f.region, value: provider}
+	f.cloud.stackTags[arn] = stackUUID(params.Tags, func(tag ecsTypes.Tag) (*string, *string) { return tag.Key, tag.Value })
+	return &ecs.CreateCapacityProviderOutput{CapacityProvider: &provider}, nil
+}
+
+func (f *fakeRegion) DescribeCapacityProviders(_ context.Context, params *ecs.DescribeCapacityProvidersInput, _ ...func(*ecs.Options)) (*ecs.DescribeCapacityProvidersOutput, error) {
+	err := f.begin("ECS.DescribeCapacityProviders")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	output := &ecs.DescribeCapacityProvidersOutput{}
+	for _, name := range params.CapacityProviders {
+		arn := f.ecsArn("capacity-provider", name)
+		if provider, ok := f.cloud.capacityProviders[arn]; ok {
+			output.CapacityProviders = append(output.CapacityProviders, provider.value)
+		} else {
+			output.Failures = append(output.Failures, ecsTypes.Failure{Arn: aws.String(arn), Reason: aws.String("MISSING")})
+		}
+	}
+	return output, nil
+}
+
+func (f *fakeRegion) DeleteCapacityProvider(_ context.Context, params *ecs.DeleteCapacityProviderInput, _ ...func(*ecs.Options)) (*ecs.DeleteCapacityProviderOutput, error) {
+	err := f.begin("ECS.DeleteCapacityProvider")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	arn := f.ecsArn("capacity-provider", *params.CapacityProvider)
+	provider, ok := f.cloud.capacityProviders[arn]
+	if !ok || provider.value.Status != ecsTypes.CapacityProviderStatusActive {
+		return nil, fakeError("ClientException", "The specified capacity provider does not exist.")
+	}
+	for _, cluster := range f.cloud.clusters {
+		if slices.Contains(cluster.value.CapacityProviders, *provider.value.Name) {
+			return nil, fakeError("ResourceInUseException", "The specified capacity provider is in use and cannot be removed.")
+		}
+	}
+	provider.value.Status = ecsTypes.CapacityProviderStatusInactive
+	delete(f.cloud.stackTags, arn)
+	return &ecs.DeleteCapacityProviderOutput{CapacityProvider: &provider.value}, nil
+}
+
+// fakeFargateMemories are the memory values fargate accepts for each cpu value.
+var fakeFargateMemories = map[string][]string{
+	"256":  {"512", "1024", "2048"},
+	"512":  {"1024", "2048", "3072", "4096"},
+	"1024": {"2048", "3072", "4096", "5120", "6144", "7168", "8192"},
+}
+
+func (f *fakeRegion) RegisterTaskDefinition(_ context.Context, params *ecs.RegisterTaskDefinitionInput, _ ...func(*ecs.Options)) (*ecs.RegisterTaskDefinitionOutput, error) {
+	err := f.begin("ECS.RegisterTaskDefinition")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(params.RequiresCompatibilities, ecsTypes.CompatibilityFargate) {
+		if params.NetworkMode != ecsTypes.NetworkModeAwsvpc {
+			return nil, fakeError("ClientException", "Fargate only supports network mode 'awsvpc'.")
+		}
+		cpu, memory := aws.ToString(params.Cpu), aws.ToString(params.Memory)
+		if !slices.Contains(fakeFargateMemories[cpu], memory) {
+			return nil, fakeError("ClientException", "No Fargate configuration exists for given values: %s CPU, %s memory.", cpu, memory)
+		}
+		for _, container := range params.ContainerDefinitions {
+			if container.LogConfiguration != nil && container.LogConfiguration.LogDriver == ecsTypes.LogDriverAwslogs &&
+				aws.ToString(params.ExecutionRoleArn) == "" {
+				return nil, fakeError("ClientException", "Fargate requires task definition to have execution role ARN to support log driver awslogs.")
+			}
+		}
+	}
+	revision := int32(1)
+	for _, definition := range f.cloud.taskDefinitions {
+		if *definition.value.Family == *params.Family && definition.region == f.region {
+			revision = max(revision, definition.value.Revision+1)
+		}
+	}
+	arn := f.arn("ecs", fmt.Sprintf("task-definition/%s:%d", *params.Family, revision))
+	definition := ecsTypes.TaskDefinition{
+		TaskDefinitionArn:    aws.String(arn),
+		Family:               params.Family,
+		Revision:             revision,
+		Status:               ecsTypes.TaskDefinitionStatusActive,
+		ContainerDefinitions: params.ContainerDefinitions,
+		Memory:               params.Memory,
+		Cpu:                  params.Cpu,
+		NetworkMode:          params.NetworkMode,
+		ExecutionRoleArn:     params.ExecutionRoleArn,
+		TaskRoleArn:          params.TaskRoleArn,
+
+		RequiresCompatibilities: params.RequiresCompatibilities,
+	}
+	f.cloud.taskDefinitions[arn] = &fakeRegional[ecsTypes.TaskDefinition]{region: f.region, value: definition}
+	f.cloud.stackTags[arn] = stackUUID(params.Tags, func(tag ecsTypes.Tag) (*string, *string) { return tag.Key, tag.Value })
+	return &ecs.RegisterTaskDefinitionOutput{TaskDefinition: &definition, Tags: params.Tags}, nil
+}
+
+// taskDefinition finds a task definition by arn, family:revision or the latest active revision of a family.
+func (f *fakeRegion) taskDefinition(name string) (*fakeRegional[ecsTypes.TaskDefinition], error) {
+	if strings.Contains(name, ":") {
+		if !strings.HasPrefix(name, "arn:") {
+			name = f.arn("ecs", "task-definition/"+name)
+		}
+		if definition, ok := f.cloud.taskDefinitions[name]; ok {
+			return definition, nil
+		}
+	} else {
+		var latest *fakeRegional[ecsTypes.TaskDefinition]
+		for _, definition := range f.cloud.taskDefinitions {
+			if definition.region == f.region && *definition.value.Family == name && definition.value.Status == ecsTypes.TaskDefinitionStatusActive &&
+				(latest == nil || definition.value.Revision > latest.value.Revision) {
+				latest = definition
+			}
+		}
+		if latest != nil {
+			return latest, nil
+		}
+	}
+	// ecs answers a missing task definition with a ClientException
+	return nil, fakeError("ClientException", "Unable to describe task definition.")
+}
+
+func (f *fakeRegion) DescribeTaskDefinition(_ context.Context, params *ecs.DescribeTaskDefinitionInput, _ ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error) {
+	err := f.begin("ECS.DescribeTaskDefinition")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	definition, err := f.taskDefinition(*params.TaskDefinition)
+	if err != nil {
+		return nil, err
+	}
+	return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: &definition.value}, nil
+}
+
+func (f *fakeRegion) DeregisterTaskDefinition(_ context.Context, params *ecs.DeregisterTaskDefinitionInput, _ ...func(*ecs.Options)) (*ecs.DeregisterTaskDefinitionOutput, error) {
+	err := f.begin("ECS.DeregisterTaskDefinition")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	definition, err := f.taskDefinition(*params.TaskDefinition)
+	if err != nil {
+		return nil, err
+	}
+	if definition.value.Status != ecsTypes.TaskDefinitionStatusActive {
+		return nil, fakeError("ClientException", "The specified task definition is not ACTIVE.")
+	}
+	definition.value.Status = ecsTypes.TaskDefinitionStatusInactive
+	return &ecs.DeregisterTaskDefinitionOutput{TaskDefinition: &definition.value}, nil
+}
+
+func (f *fakeRegion) DeleteTaskDefinitions(_ context.Context, params *ecs.DeleteTaskDefinitionsInput, _ ...func(*ecs.Options)) (*ecs.DeleteTaskDefinitionsOutput, error) {
+	err := f.begin("ECS.DeleteTaskDefinitions")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	output := &ecs.DeleteTaskDefinitionsOutput{}
+	for _, name := range params.TaskDefinitions {
+		definition, err := f.taskDefinition(name)
+		if err != nil || definition.value.Status != ecsTypes.TaskDefinitionStatusInactive {
+			output.Failures = append(output.Failures, ecsTypes.Failure{Arn: aws.String(name), Reason: aws.String("The specified task definition is not INACTIVE")})
+			continue
+		}
+		definition.value.Status = ecsTypes.TaskDefinitionStatusDeleteInProgress
+		delete(f.cloud.stackTags, *definition.value.TaskDefinitionArn)
+		output.TaskDefinitions = append(output.TaskDefinitions, definition.value)
+	}
+	return output, nil
+}
+
+func (f *fakeRegion) service(cluster *string, name string) (*fakeRegional[ecsTypes.Service], error) {
+	clusterArn := f.ecsArn("cluster", aws.ToString(cluster))
+	clusterName := clusterArn[strings.LastIndex(clusterArn, "/")+1:]
+	service, ok := f.cloud.services[f.ecsArn("service", clusterName+"/"+name)]
+	if !ok {
+		return nil, fakeError("ServiceNotFoundException", "Service not found.")
+	}
+	return service, nil
+}
+
+func (f *fakeRegion) CreateService(_ context.Context, params *ecs.CreateServiceInput, _ ...func(*ecs.Options)) (*ecs.CreateServiceOutput, error) {
+	err := f.begin("ECS.CreateService")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	cluster, err := f.activeCluster(params.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	if existing, err := f.service(params.Cluster, *params.ServiceName); err == nil && *existing.value.Status != "INACTIVE" {
+		return nil, fakeError("InvalidParameterException", "Creation of service was not idempotent.")
+	}
+	definition, err := f.taskDefinition(*params.TaskDefinition)
+	if err != nil || definition.value.Status != ecsTypes.TaskDefinitionStatusActive {
+		return nil, fakeError("ClientException", "TaskDefinition not found.")
+	}
+	awsvpc := definition.value.NetworkMode == ecsTypes.NetworkModeAwsvpc
+	if params.LaunchType == ecsTypes.LaunchTypeFargate && !slices.Contains(definition.value.RequiresCompatibilities, ecsTypes.CompatibilityFargate) {
+		return nil, fakeError("InvalidParameterException", "Task definition does not support launch_type FARGATE.")
+	}
+	if awsvpc {
+		if params.NetworkConfiguration == nil || params.NetworkConfiguration.AwsvpcConfiguration == nil {
+			return nil, fakeError("InvalidParameterException", "Network Configuration must be provided when networkMode 'awsvpc' is specified.")
+		}
+		for _, id := range params.NetworkConfiguration.AwsvpcConfiguration.SecurityGroups {
+			if _, err := f.securityGroup(aws.String(id)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, loadBalancer := range params.LoadBalancers {
+		group, ok := f.cloud.targetGroups[aws.ToString(loadBalancer.TargetGroupArn)]
+		if !ok {
+			return nil, fakeError("InvalidParameterException", "Unable to assume role and validate the specified targetGroupArn.")
+		} else if len(group.value.LoadBalancerArns) == 0 {
+			return nil, fakeError("InvalidParameterException", "The target group with targetGroupArn %s does not have an associated load balancer.", *group.value.TargetGroupArn)
+		} else if awsvpc && group.value.TargetType != elbTypes.TargetTypeEnumIp {
+			return nil, fakeError("InvalidParameterException", "The provided target group %s has target type instance, which is incompatible with the awsvpc network mode specified in the task definition.", *group.value.TargetGroupArn)
+		}
+	}
+	service := ecsTypes.Service{
+		ServiceArn:     aws.String(f.ecsArn("service", *cluster.value.ClusterName+"/"+*params.ServiceName)),
+		ServiceName:    params.ServiceName,
+		ClusterArn:     cluster.value.ClusterArn,
+		Status:         aws.String("ACTIVE"),
+		TaskDefinition: definition.value.TaskDefinitionArn,
+		DesiredCount:   aws.ToInt32(params.DesiredCount),
+		RunningCount:   aws.ToInt32(params.DesiredCount),
+		LaunchType:     params.LaunchType,
+		LoadBalancers:  params.LoadBalancers,
+		Deployments:    []ecsTypes.Deployment{{Status: aws.String("PRIMARY"), TaskDefinition: definition.value.TaskDefinitionArn}},
+		Tags:           params.Tags,
+
+		NetworkConfiguration: params.NetworkConfiguration,
+	}
+	f.cloud.services[*service.ServiceArn] = &fakeRegional[ecsTypes.Service]{region: f.region, value: service}
+	f.cloud.stackTags[*service.ServiceArn] = stackUUID(params.Tags, func(tag ecsTypes.Tag) (*string, *string) { return tag.Key, tag.Value })
+	return &ecs.CreateServiceOutput{Service: &service}, nil
+}
+
+func (f *fakeRegion) DescribeServices(_ context.Context, params *ecs.DescribeServicesInput, _ ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error) {
+	err := f.begin("ECS.DescribeServices")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	output := &ecs.DescribeServicesOutput{}
+	for _, name := range params.Services {
+		if service, err := f.service(params.Cluster, name); err == nil {
+			output.Services = append(output.Services, service.value)
+		} else {
+			output.Failures = append(output.Failures, ecsTypes.Failure{Arn: aws.String(name), Reason: aws.String("MISSING")})
+		}
+	}
+	return output, nil
+}
+
+func (f *fakeRegion) UpdateService(_ context.Context, params *ecs.UpdateServiceInput, _ ...func(*ecs.Options)) (*ecs.UpdateServiceOutput, error) {
+	err := f.begin("ECS.UpdateService")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	service, err := f.service(params.Cluster, *params.Service)
+	if err != nil {
+		return nil, err
+	} else if *service.value.Status != "ACTIVE" {
+		return nil, fakeError("ServiceNotActiveException", "Service was not ACTIVE.")
+	}
+	if params.DesiredCount != nil {
+		service.value.DesiredCount = *params.DesiredCount
+		service.value.RunningCount = *params.DesiredCount
+	}
+	if params.TaskDefinition != nil {
+		definition, err := f.taskDefinition(*params.TaskDefinition)
+		if err != nil {
+			return nil, err
+		}
+		service.value.TaskDefinition = definition.value.TaskDefinitionArn
+		service.value.Deployments = []ecsTypes.Deployment{{Status: aws.String("PRIMARY"), TaskDefinition: definition.value.TaskDefinitionArn}}
+	}
+	return &ecs.UpdateServiceOutput{Service: &service.value}, nil
+}
+
+func (f *fakeRegion) DeleteService(_ context.Context, params *ecs.DeleteServiceInput, _ ...func(*ecs.Options)) (*ecs.DeleteServiceOutput, error) {
+	err := f.begin("ECS.DeleteService")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	service, err := f.service(params.Cluster, *params.Service)
+	if err != nil {
+		return nil, err
+	} else if *service.value.Status == "INACTIVE" {
+		return nil, fakeError("ServiceNotActiveException", "Service was not ACTIVE.")
+	}
+	if service.value.DesiredCount > 0 && !aws.ToBool(params.Force) {
+		return nil, fakeError("InvalidParameterException", "The service cannot be stopped while it is scaled above 0.")
+	}
+	service.value.Status = aws.String("INACTIVE")
+	service.value.RunningCount = 0
+	delete(f.cloud.stackTags, *service.value.ServiceArn)
+	return &ecs.DeleteServiceOutput{Service: &service.value}, nil
+}
+
+// elb
+
+func (f *fakeRegion) loadBalancer(arn string) (*fakeRegional[elbTypes.LoadBalancer], error) {
+	loadBalancer, ok := f.cloud.loadBalancers[arn]
+	if !ok {
+		return nil, fakeError("LoadBalancerNotFound", "Load balancer '%s' not found", arn)
+	}
+	return loadBalancer, nil
+}
+
+func (f *fakeRegion) targetGroup(arn string) (*fakeRegional[elbTypes.TargetGroup], error) {
+	group, ok := f.cloud.targetGroups[arn]
+	if !ok {
+		return nil, fakeError("TargetGroupNotFound", "Target groups '%s' not found", arn)
+	}
+	return group, nil
+}
+
+func (f *fakeRegion) CreateLoadBalancer(_ context.Context, params *elb.CreateLoadBalancerInput, _ ...func(*elb.Options)) (*elb.CreateLoadBalancerOutput, error) {
+	err := f.begin("ELB.CreateLoadBalancer")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range f.cloud.loadBalancers {
+		if existing.region == f.region && *existing.value.LoadBalancerName == *params.Name {
+			return nil, fakeError("DuplicateLoadBalancerName", "A load balancer with the same name '%s' exists", *params.Name)
+		}
+	}
+	for _, id := range params.SecurityGroups {
+		if _, err := f.securityGroup(aws.String(id)); err != nil {
+			return nil, fakeError("InvalidConfigurationRequest", "One or more security groups are invalid")
+		}
+	}
+	id := f.nextId()
+	loadBalancer := elbTypes.LoadBalancer{
+		LoadBalancerArn:       aws.String(f.arn("elasticloadbalancing", fmt.Sprintf("loadbalancer/app/%s/%d", *params.Name, id))),
+		LoadBalancerName:      params.Name,
+		DNSName:               aws.String(fmt.Sprintf("%s-%d.%s.elb.amazonaws.com", *params.Name, id, f.region)),
+		CanonicalHostedZoneId: aws.String("ZFAKEELB"),
+		SecurityGroups:        params.SecurityGroups,
+		Scheme:                params.Scheme,
+		Type:                  params.Type,
+		VpcId:                 aws.String("vpc-default"),
+		State:                 &elbTypes.LoadBalancerState{Code: elbTypes.LoadBalancerStateEnumActive},
+	}
+	f.cloud.loadBalancers[*loadBalancer.LoadBalancerArn] = &fakeRegional[elbTypes.LoadBalancer]{region: f.region, value: loadBalancer}
+	f.cloud.stackTags[*loadBalancer.LoadBalancerArn] = stackUUID(params.Tags, func(tag elbTypes.Tag) (*string, *string) { return tag.Key, tag.Value })
+	return &elb.CreateLoadBalancerOutput{LoadBalancers: []elbTypes.LoadBalancer{loadBalancer}}, nil
+}
+
+func (f *fakeRegion) DescribeLoadBalancers(_ context.Context, params *elb.DescribeLoadBalancersInput, _ ...func(*elb.Options)) (*elb.DescribeLoadBalancersOutput, error) {
+	err := f.begin("ELB.DescribeLoadBalancers")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	loadBalancers := make([]elbTypes.LoadBalancer, 0)
+	for _, arn := range params.LoadBalancerArns {
+		loadBalancer, err := f.loadBalancer(arn)
+		if err != nil {
+			return nil, err
+		}
+		loadBalancers = append(loadBalancers, loadBalancer.value)
+	}
+	for _, name := range params.Names {
+		index := len(loadBalancers)
+		for _, loadBalancer := range f.cloud.loadBalancers {
+			if loadBalancer.region == f.region && *loadBalancer.value.LoadBalancerName == name {
+				loadBalancers = append(loadBalancers, loadBalancer.value)
+			}
+		}
+		if len(loadBalancers) == index {
+			return nil, fakeError("LoadBalancerNotFound", "Load balancers '[%s]' not found", name)
+		}
+	}
+	return &elb.DescribeLoadBalancersOutput{LoadBalancers: loadBalancers}, nil
+}
+
+// DeleteLoadBalancer deletes the listeners of the load balancer too. deleting a missing load balancer succeeds, like in aws.
+func (f *fakeRegion) DeleteLoadBalancer(_ context.Context, params *elb.DeleteLoadBalancerInput, _ ...func(*elb.Options)) (*elb.DeleteLoadBalancerOutput, error) {
+	err := f.begin("ELB.DeleteLoadBalancer")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	for arn, listener := range f.cloud.listeners {
+		if *listener.value.LoadBalancerArn == *params.LoadBalancerArn {
+			f.removeListener(arn)
+		}
+	}
+	delete(f.cloud.loadBalancers, *params.LoadBalancerArn)
+	delete(f.cloud.stackTags, *params.LoadBalancerArn)
+	return &elb.DeleteLoadBalancerOutput{}, nil
+}
+
+func (f *fakeRegion) removeListener(arn string) {
+	listener := f.cloud.listeners[arn]
+	for _, action := range listener.value.DefaultActions {
+		if group, ok := f.cloud.targetGroups[aws.ToString(action.TargetGroupArn)]; ok {
+			group.value.LoadBalancerArns = slices.DeleteFunc(group.value.LoadBalancerArns, func(loadBalancerArn string) bool {
+				return loadBalancerArn == *listener.value.LoadBalancerArn
+			})
+		}
+	}
+	delete(f.cloud.listeners, arn)
+	delete(f.cloud.stackTags, arn)
+}
+
+func (f *fakeRegion) CreateListener(_ context.Context, params *elb.CreateListenerInput, _ ...func(*elb.Options)) (*elb.CreateListenerOutput, error) {
+	err := f.begin("ELB.CreateListener")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	loadBalancer, err := f.loadBalancer(*params.LoadBalancerArn)
+	if err != nil {
+		return nil, err
+	}
+	for _, listener := range f.cloud.listeners {
+		if *listener.value.LoadBalancerArn == *params.LoadBalancerArn && *listener.value.Port == *params.Port {
+			return nil, fakeError("DuplicateListener", "A listener already exists on this port for this load balancer")
+		}
+	}
+	for _, certificate := range params.Certificates {
+		found, ok := f.cloud.certificates[*certificate.CertificateArn]
+		if !ok || found.region != f.region {
+			return nil, fakeError("CertificateNotFound", "Certificate '%s' not found", *certificate.CertificateArn)
+		} else if found.certificate.Status != "ISSUED" {
+			return nil, fakeError("UnsupportedCertificate", "The certificate '%s' must have a fully-qualified domain name, a supported signature, and a supported key size.", *certificate.CertificateArn)
+		}
+	}
+	groups := make([]*fakeRegional[elbTypes.TargetGroup], 0)
+	for _, action := range params.DefaultActions {
+		group, err := f.targetGroup(aws.ToString(action.TargetGroupArn))
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	for _, group := range groups {
+		group.value.LoadBalancerArns = append(group.value.LoadBalancerArns, *loadBalancer.value.LoadBalancerArn)
+	}
+	listener := elbTypes.Listener{
+		ListenerArn:     aws.String(strings.Replace(*loadBalancer.value.LoadBalancerArn, ":loadbalancer/", ":listener/", 1) + fmt.Sprintf("/%d", f.nextId())),
+		LoadBalancerArn: loadBalancer.value.LoadBalancerArn,
+		Port:            params.Port,
+		Protocol:        params.Protocol,
+		Certificates:    params.Certificates,
+		DefaultActions:  params.DefaultActions,
+	}
+	f.cloud.listeners[*listener.ListenerArn] = &fakeRegional[elbTypes.Listener]{region: f.region, value: listener}
+	f.cloud.stackTags[*listener.ListenerArn] = stackUUID(params.Tags, func(tag elbTypes.Tag) (*string, *string) { return tag.Key, tag.Value })
+	return &elb.CreateListenerOutput{Listeners: []elbTypes.Listener{listener}}, nil
+}
+
+func (f *fakeRegion) DescribeListeners(_ context.Context, params *elb.DescribeListenersInput, _ ...func(*elb.Options)) (*elb.DescribeListenersOutput, error) {
+	err := f.begin("ELB.DescribeListeners")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	listeners := make([]elbTypes.Listener, 0)
+	if params.LoadBalancerArn != nil {
+		if _, err := f.loadBalancer(*params.LoadBalancerArn); err != nil {
+			return nil, err
+		}
+		for _, listener := range f.cloud.listeners {
+			if *listener.value.LoadBalancerArn == *params.LoadBalancerArn {
+				listeners = append(listeners, listener.value)
+			}
+		}
+	}
+	for _, arn := range params.ListenerArns {
+		listener, ok := f.cloud.listeners[arn]
+		if !ok {
+			return nil, fakeError("ListenerNotFound", "One or more listeners not found")
+		}
+		listeners = append(listeners, listener.value)
+	}
+	return &elb.DescribeListenersOutput{Listeners: listeners}, nil
+}
+
+func (f *fakeRegion) DeleteListener(_ context.Context, params *elb.DeleteListenerInput, _ ...func(*elb.Options)) (*elb.DeleteListenerOutput, error) {
+	err := f.begin("ELB.DeleteListener")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := f.cloud.listeners[*params.ListenerArn]; !ok {
+		return nil, fakeError("ListenerNotFound", "Listener '%s' not found", *params.ListenerArn)
+	}
+	f.removeListener(*params.ListenerArn)
+	return &elb.DeleteListenerOutput{}, nil
+}
+
+func (f *fakeRegion) CreateTargetGroup(_ context.Context, params *elb.CreateTargetGroupInput, _ ...func(*elb.Options)) (*elb.CreateTargetGroupOutput, error) {
+	err := f.begin("ELB.CreateTargetGroup")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range f.cloud.targetGroups {
+		if existing.region == f.region && *existing.value.TargetGroupName == *params.Name {
+			return nil, fakeError("DuplicateTargetGroupName", "A target group with the same name '%s' exists, but with different settings", *params.Name)
+		}
+	}
+	group := elbTypes.TargetGroup{
+		TargetGroupArn:  aws.String(f.arn("elasticloadbalancing", fmt.Sprintf("targetgroup/%s/%d", *params.Name, f.nextId()))),
+		TargetGroupName: params.Name,
+		Port:            params.Port,
+		Protocol:        params.Protocol,
+		TargetType:      params.TargetType,
+		VpcId:           params.VpcId,
+	}
+	f.cloud.targetGroups[*group.TargetGroupArn] = &fakeRegional[elbTypes.TargetGroup]{region: f.region, value: group}
+	f.cloud.stackTags[*group.TargetGroupArn] = stackUUID(params.Tags, func(tag elbTypes.Tag) (*string, *string) { return tag.Key, tag.Value })
+	return &elb.CreateTargetGroupOutput{TargetGroups: []elbTypes.TargetGroup{group}}, nil
+}
+
+func (f *fakeRegion) DescribeTargetGroups(_ context.Context, params *elb.DescribeTargetGroupsInput, _ ...func(*elb.Options)) (*elb.DescribeTargetGroupsOutput, error) {
+	err := f.begin("ELB.DescribeTargetGroups")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]elbTypes.TargetGroup, 0)
+	for _, arn := range params.TargetGroupArns {
+		group, err := f.targetGroup(arn)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group.value)
+	}
+	for _, name := range params.Names {
+		index := len(groups)
+		for _, group := range f.cloud.targetGroups {
+			if group.region == f.region && *group.value.TargetGroupName == name {
+				groups = append(groups, group.value)
+			}
+		}
+		if len(groups) == index {
+			return nil, fakeError("TargetGroupNotFound", "One or more target groups not found")
+		}
+	}
+	return &elb.DescribeTargetGroupsOutput{TargetGroups: groups}, nil
+}
+
+func (f *fakeRegion) DeleteTargetGroup(_ context.Context, params *elb.DeleteTargetGroupInput, _ ...func(*elb.Options)) (*elb.DeleteTargetGroupOutput, error) {
+	err := f.begin("ELB.DeleteTargetGroup")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	group, err := f.targetGroup(*params.TargetGroupArn)
+	if err != nil {
+		return nil, err
+	}
+	if len(group.value.LoadBalancerArns) != 0 {
+		return nil, fakeError("ResourceInUse", "Target group '%s' is currently in use by a listener or a rule", *params.TargetGroupArn)
+	}
+	for _, service := range f.cloud.services {
+		for _, loadBalancer := range service.value.LoadBalancers {
+			if *service.value.Status != "INACTIVE" && aws.ToString(loadBalancer.TargetGroupArn) == *params.TargetGroupArn {
+				return nil, fakeError("ResourceInUse", "Target group '%s' is currently in use by service %s", *params.TargetGroupArn, *service.value.ServiceName)
+			}
+		}
+	}
+	delete(f.cloud.targetGroups, *params.TargetGroupArn)
+	delete(f.cloud.stackTags, *params.TargetGroupArn)
+	return &elb.DeleteTargetGroupOutput{}, nil
+}
+
+func (f *fakeRegion) RegisterTargets(_ context.Context, params *elb.RegisterTargetsInput, _ ...func(*elb.Options)) (*elb.RegisterTargetsOutput, error) {
+	err := f.begin("ELB.RegisterTargets")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.targetGroup(*params.TargetGroupArn); err != nil {
+		return nil, err
+	}
+	return &elb.RegisterTargetsOutput{}, nil
+}
+
+// ecr
+
+func (f *fakeRegion) CreateRepository(_ context.Context, params *ecr.CreateRepositoryInput, _ ...func(*ecr.Options)) (*ecr.CreateRepositoryOutput, error) {
+	err := f.begin("ECR.CreateRepository")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	arn := f.arn("ecr", "repository/"+*params.RepositoryName)
+	if _, ok := f.cloud.repositories[arn]; ok {
+		return nil, fakeError("RepositoryAlreadyExistsException", "The repository with name '%s' already exists", *params.RepositoryName)
+	}
+	repository := ecrTypes.Repository{
+		RepositoryArn:  aws.String(arn),
+		RepositoryName: params.RepositoryName,
+		RegistryId:     aws.String(fakeAccountId),
+		RepositoryUri:  aws.String(fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s", fakeAccountId, f.region, *params.RepositoryName)),
+	}
+	f.cloud.repositories[arn] = &fakeRepository{region: f.region, repository: repository, layers: map[string][]byte{},
+		uploads: map[string][]byte{}, images: map[string]string{}}
+	f.cloud.stackTags[arn] = stackUUID(params.Tags, func(tag ecrTypes.Tag) (*string, *string) { return tag.Key, tag.Value })
+	return &ecr.CreateRepositoryOutput{Repository: &repository}, nil
+}
+
+func (f *fakeRegion) DescribeRepositories(_ context.Context, params *ecr.DescribeRepositoriesInput, _ ...func(*ecr.Options)) (*ecr.DescribeRepositoriesOutput, error) {
+	err := f.begin("ECR.DescribeRepositories")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	repositories := make([]ecrTypes.Repository, 0)
+	for _, name := range params.RepositoryNames {
+		repository, ok := f.cloud.repositories[f.arn("ecr", "repository/"+name)]
+		if !ok {
+			return nil, fakeError("RepositoryNotFoundException", "The repository with name '%s' does not exist", name)
+		}
+		repositories = append(repositories, repository.repository)
+	}
+	return &ecr.DescribeRepositoriesOutput{Repositories: repositories}, nil
+}
+
+func (f *fakeRegion) DeleteRepository(_ context.Context, params *ecr.DeleteRepositoryInput, _ ...func(*ecr.Options)) (*ecr.DeleteRepositoryOutput, error) {
+	err := f.begin("ECR.DeleteRepository")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	arn := f.arn("ecr", "repository/"+*params.RepositoryName)
+	repository, ok := f.cloud.repositories[arn]
+	if !ok {
+		return nil, fakeError("RepositoryNotFoundException", "The repository with name '%s' does not exist", *params.RepositoryName)
+	}
+	delete(f.cloud.repositories, arn)
+	delete(f.cloud.stackTags, arn)
+	return &ecr.DeleteRepositoryOutput{Repository: &repository.repository}, nil
+}
+
+func (f *fakeRegion) repository(name *string) (*fakeRepository, error) {
+	repository, ok := f.cloud.repositories[f.arn("ecr", "repository/"+*name)]
+	if !ok {
+		return nil, fakeError("RepositoryNotFoundException", "The repository with name '%s' does not exist", *name)
+	}
+	return repository, nil
+}
+
+func (f *fakeECRRegion) DescribeImages(_ context.Context, params *ecr.DescribeImagesInput, _ ...func(*ecr.Options)) (*ecr.DescribeImagesOutput, error) {
+	err := f.begin("ECR.DescribeImages")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	repository, err := f.repository(params.RepositoryName)
+	if err != nil {
+		return nil, err
+	}
+	output := &ecr.DescribeImagesOutput{}
+	for _, id := range params.ImageIds {
+		manifest, ok := repository.images[aws.ToString(id.ImageTag)]
+		if !ok {
+			return nil, fakeError("ImageNotFoundException", "The image with imageId {imageTag:'%s'} does not exist within the repository", aws.ToString(id.ImageTag))
+		}
+		output.ImageDetails = append(output.ImageDetails, ecrTypes.ImageDetail{
+			RepositoryName: params.RepositoryName,
+			ImageDigest:    aws.String(fakeDigest([]byte(manifest))),
+			ImageTags:      []string{*id.ImageTag},
+		})
+	}
+	return output, nil
+}
+
+func (f *fakeRegion) BatchCheckLayerAvailability(_ context.Context, params *ecr.BatchCheckLayerAvailabilityInput, _ ...func(*ecr.Options)) (*ecr.BatchCheckLayerAvailabilityOutput, error) {
+	err := f.begin("ECR.BatchCheckLayerAvailability")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	repository, err := f.repository(params.RepositoryName)
+	if err != nil {
+		return nil, err
+	}
+	output := &ecr.BatchCheckLayerAvailabilityOutput{}
+	for _, digest := range params.LayerDigests {
+		if _, ok := repository.layers[digest]; ok {
+			output.Layers = append(output.Layers, ecrTypes.Layer{LayerDigest: aws.String(digest), LayerAvailability: ecrTypes.LayerAvailabilityAvailable})
+		} else {
+			output.Failures = append(output.Failures, ecrTypes.LayerFailure{LayerDigest: aws.String(digest), FailureCode: ecrTypes.LayerFailureCodeMissingLayerDigest})
+		}
+	}
+	return output, nil
+}
+
+// fakeLayerPartSize is small so a layer of a test takes a few parts.
+const fakeLayerPartSize = 16
+
+func (f *fakeRegion) InitiateLayerUpload(_ context.Context, params *ecr.InitiateLayerUploadInput, _ ...func(*ecr.Options)) (*ecr.InitiateLayerUploadOutput, error) {
+	err := f.begin("ECR.InitiateLayerUpload")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	repository, err := f.repository(params.RepositoryName)
+	if err != nil {
+		return nil, err
+	}
+	id := fmt.Sprintf("upload-%d", f.nextId())
+	repository.uploads[id] = []byte{}
+	return &ecr.InitiateLayerUploadOutput{UploadId: aws.String(id), PartSize: aws.Int64(fakeLayerPartSize)}, nil
+}
+
+func (f *fakeRegion) UploadLayerPart(_ context.Context, params *ecr.UploadLayerPartInput, _ ...func(*ecr.Options)) (*ecr.UploadLayerPartOutput, error) {
+	err := f.begin("ECR.UploadLayerPart")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	repository, err := f.repository(params.RepositoryName)
+	if err != nil {
+		return nil, err
+	}
+	received, ok := repository.uploads[*params.UploadId]
+	if !ok {
+		return nil, fakeError("UploadNotFoundException", "The upload %s could not be found", *params.UploadId)
+	}
+	// parts come in order and the last byte is inclusive
+	if *params.PartFirstByte != int64(len(received)) || *params.PartLastByte-*params.PartFirstByte+1 != int64(len(params.LayerPartBlob)) {
+		return nil, fakeError("InvalidLayerPartException", "The part of bytes %d to %d does not follow the %d bytes received", *params.PartFirstByte, *params.PartLastByte, len(received))
+	}
+	if int64(len(params.LayerPartBlob)) > fakeLayerPartSize {
+		return nil, fakeError("InvalidLayerPartException", "The part is larger than %d bytes", fakeLayerPartSize)
+	}
+	repository.uploads[*params.UploadId] = append(received, params.LayerPartBlob...)
+	return &ecr.UploadLayerPartOutput{UploadId: params.UploadId, LastByteReceived: params.PartLastByte}, nil
+}
+
+func (f *fakeRegion) CompleteLayerUpload(_ context.Context, params *ecr.CompleteLayerUploadInput, _ ...func(*ecr.Options)) (*ecr.CompleteLayerUploadOutput, error) {
+	err := f.begin("ECR.CompleteLayerUpload")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	repository, err := f.repository(params.RepositoryName)
+	if err != nil {
+		return nil, err
+	}
+	received, ok := repository.uploads[*params.UploadId]
+	if !ok {
+		return nil, fakeError("UploadNotFoundException", "The upload %s could not be found", *params.UploadId)
+	}
+	delete(repository.uploads, *params.UploadId)
+	if len(params.LayerDigests) != 1 || fakeDigest(received) != params.LayerDigests[0] {
+		return nil, fakeError("InvalidLayerException", "The calculated digest %s does not match %v", fakeDigest(received), params.LayerDigests)
+	}
+	if _, ok := repository.layers[params.LayerDigests[0]]; ok {
+		return nil, fakeError("LayerAlreadyExistsException", "The layer %s already exists", params.LayerDigests[0])
+	}
+	repository.layers[params.LayerDigests[0]] = received
+	return &ecr.CompleteLayerUploadOutput{LayerDigest: aws.String(params.LayerDigests[0]), UploadId: params.UploadId}, nil
+}
+
+func (f *fakeRegion) PutImage(_ context.Context, params *ecr.PutImageInput, _ ...func(*ecr.Options)) (*ecr.PutImageOutput, error) {
+	err := f.begin("ECR.PutImage")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	repository, err := f.repository(params.RepositoryName)
+	if err != nil {
+		return nil, err
+	}
+	var manifest registryManifest
+	if err := json.Unmarshal([]byte(*params.ImageManifest), &manifest); err != nil || manifest.Config.Digest == "" {
+		return nil, fakeError("InvalidParameterException", "Invalid parameter at 'ImageManifest' failed to satisfy constraint: 'Invalid JSON syntax'")
+	}
+	for _, blob := range append([]registryDescriptor{manifest.Config}, manifest.Layers...) {
+		if _, ok := repository.layers[blob.Digest]; !ok {
+			return nil, fakeError("LayersNotFoundException", "Layers with digests '[%s]' required for pushing image into repository with name '%s' do not exist", blob.Digest, *params.RepositoryName)
+		}
+	}
+	if existing, ok := repository.images[aws.ToString(params.ImageTag)]; ok && existing == *params.ImageManifest {
+		return nil, fakeError("ImageAlreadyExistsException", "Image with digest '%s' and tag '%s' already exists", fakeDigest([]byte(existing)), *params.ImageTag)
+	}
+	repository.images[aws.ToString(params.ImageTag)] = *params.ImageManifest
+	return &ecr.PutImageOutput{Image: &ecrTypes.Image{
+		RepositoryName: params.RepositoryName,
+		ImageManifest:  params.ImageManifest,
+		ImageId:        &ecrTypes.ImageIdentifier{ImageTag: params.ImageTag, ImageDigest: aws.String(fakeDigest([]byte(*params.ImageManifest)))},
+	}}, nil
+}
+
+func fakeDigest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// logs
+
+// fakeLogEventPageSize is small so the events of a test take a few pages.
+const fakeLogEventPageSize = 2
+
+func (f *fakeRegion) logGroup(name *string) (*fakeLogGroup, error) {
+	group, ok := f.cloud.logGroups[f.arn("logs", "log-group:"+*name)]
+	if !ok {
+		return nil, fakeError("ResourceNotFoundException", "The specified log group does not exist.")
+	}
+	return group, nil
+}
+
+func (f *fakeRegion) CreateLogGroup(_ context.Context, params *cloudwatchlogs.CreateLogGroupInput, _ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	err := f.begin("Logs.CreateLogGroup")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	arn := f.arn("logs", "log-group:"+*params.LogGroupName)
+	if _, ok := f.cloud.logGroups[arn]; ok {
+		return nil, fakeError("ResourceAlreadyExistsException", "The specified log group already exists")
+	}
+	f.cloud.logGroups[arn] = &fakeLogGroup{region: f.region, group: logsTypes.LogGroup{
+		Arn:          aws.String(arn + ":*"),
+		LogGroupArn:  aws.String(arn),
+		LogGroupName: params.LogGroupName,
+	}}
+	f.cloud.stackTags[arn] = params.Tags[baseUUIDTagName]
+	return &cloudwatchlogs.CreateLogGroupOutput{}, nil
+}
+
+func (f *fakeRegion) DescribeLogGroups(_ context.Context, params *cloudwatchlogs.DescribeLogGroupsInput, _ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	err := f.begin("Logs.DescribeLogGroups")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]logsTypes.LogGroup, 0)
+	for _, group := range f.cloud.logGroups {
+		if group.region == f.region && strings.HasPrefix(*group.group.LogGroupName, aws.ToString(params.LogGroupNamePrefix)) {
+			groups = append(groups, group.group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return *groups[i].LogGroupName < *groups[j].LogGroupName })
+	return &cloudwatchlogs.DescribeLogGroupsOutput{LogGroups: groups}, nil
+}
+
+func (f *fakeRegion) PutRetentionPolicy(_ context.Context, params *cloudwatchlogs.PutRetentionPolicyInput, _ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutRetentionPolicyOutput, error) {
+	err := f.begin("Logs.PutRetentionPolicy")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	group, err := f.logGroup(params.LogGroupName)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(LogRetentionDays, aws.ToInt32(params.RetentionInDays)) {
+		return nil, fakeError("InvalidParameterException", "1 validation error detected: Value '%d' at 'retentionInDays' failed to satisfy constraint", aws.ToInt32(params.RetentionInDays))
+	}
+	group.group.RetentionInDays = params.RetentionInDays
+	return &cloudwatchlogs.PutRetentionPolicyOutput{}, nil
+}
+
+func (f *fakeRegion) DeleteLogGroup(_ context.Context, params *cloudwatchlogs.DeleteLogGroupInput, _ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DeleteLogGroupOutput, error) {
+	err := f.begin("Logs.DeleteLogGroup")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	group, err := f.logGroup(params.LogGroupName)
+	if err != nil {
+		return nil, err
+	}
+	delete(f.cloud.logGroups, *group.group.LogGroupArn)
+	delete(f.cloud.stackTags, *group.group.LogGroupArn)
+	return &cloudwatchlogs.DeleteLogGroupOutput{}, nil
+}
+
+// FilterLogEvents takes a filter pattern of terms, every term has to be in the message. a quoted term is a phrase.
+func (f *fakeRegion) FilterLogEvents(_ context.Context, params *cloudwatchlogs.FilterLogEventsInput, _ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	err := f.begin("Logs.FilterLogEvents")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	group, err := f.logGroup(params.LogGroupName)
+	if err != nil {
+		return nil, err
+	}
+	terms := make([]string, 0)
+	for _, term := range fakeFilterTerm.FindAllString(aws.ToString(params.FilterPattern), -1) {
+		terms = append(terms, strings.Trim(term, "\""))
+	}
+	events := make([]logsTypes.FilteredLogEvent, 0)
+	for _, event := range group.events {
+		if *event.Timestamp < aws.ToInt64(params.StartTime) {
+			continue
+		}
+		if !slices.ContainsFunc(terms, func(term string) bool { return !strings.Contains(*event.Message, term) }) {
+			events = append(events, event)
+		}
+	}
+	start := 0
+	if params.NextToken != nil {
+		start, err = strconv.Atoi(*params.NextToken)
+		if err != nil || start > len(events) {
+			return nil, fakeError("InvalidParameterException", "The specified nextToken is invalid.")
+		}
+	}
+	end := min(start+fakeLogEventPageSize, len(events))
+	output := &cloudwatchlogs.FilterLogEventsOutput{Events: events[start:end]}
+	if end < len(events) {
+		output.NextToken = aws.String(strconv.Itoa(end))
+	}
+	return output, nil
+}
+
+var fakeFilterTerm = regexp.MustCompile(`"[^"]*"|\S+`)
+
+// addLogEvent writes a line to a log group like a container would.
+func (c *fakeCloud) addLogEvent(region string, name string, stream string, timestamp time.Time, message string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	group := c.logGroups[(&fakeRegion{c, region}).arn("logs", "log-group:"+name)]
+	c.next++
+	group.events = append(group.events, logsTypes.FilteredLogEvent{
+		EventId:       aws.String(fmt.Sprintf("event-%d", c.next)),
+		LogStreamName: aws.String(stream),
+		Message:       aws.String(message),
+		Timestamp:     aws.Int64(timestamp.UnixMilli()),
+	})
+	sort.SliceStable(group.events, func(i, j int) bool { return *group.events[i].Timestamp < *group.events[j].Timestamp })
+}
+
+// ssm
+
+// fakeParameterPageSize is small so the parameters of a test take a few pages.
+const fakeParameterPageSize = 2
+
+func (f *fakeRegion) parameter(name *string) (*fakeRegional[ssmTypes.Parameter], error) {
+	parameter, ok := f.cloud.parameters[f.arn("ssm", "parameter"+*name)]
+	if !ok {
+		return nil, fakeError("ParameterNotFound", "Parameter %s not found.", *name)
+	}
+	return parameter, nil
+}
+
+func (f *fakeRegion) PutParameter(_ context.Context, params *ssm.PutParameterInput, _ ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+	err := f.begin("SSM.PutParameter")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	if aws.ToBool(params.Overwrite) && len(params.Tags) != 0 {
+		return nil, fakeError("ValidationException", "Invalid request: tags and overwrite can't be used together.")
+	}
+	arn := f.arn("ssm", "parameter"+*params.Name)
+	existing, ok := f.cloud.parameters[arn]
+	if ok && !aws.ToBool(params.Overwrite) {
+		return nil, fakeError("ParameterAlreadyExists", "The parameter already exists. To overwrite this value, set the overwrite option in the request to true.")
+	}
+	if ok && existing.value.Type != params.Type {
+		return nil, fakeError("ValidationException", "You can't change the type of the parameter %s.", *params.Name)
+	}
+	version := int64(1)
+	if ok {
+		version = existing.value.Version + 1
+	} else {
+		f.cloud.stackTags[arn] = stackUUID(params.Tags, func(tag ssmTypes.Tag) (*string, *string) { return tag.Key, tag.Value })
+	}
+	f.cloud.parameters[arn] = &fakeRegional[ssmTypes.Parameter]{region: f.region, value: ssmTypes.Parameter{
+		ARN:     aws.String(arn),
+		Name:    params.Name,
+		Type:    params.Type,
+		Value:   params.Value,
+		Version: version,
+	}}
+	return &ssm.PutParameterOutput{Version: version}, nil
+}
+
+// fakeEncrypted is what ssm answers for the value of a SecureString read without decryption.
+func fakeEncrypted(parameter ssmTypes.Parameter, decrypt bool) ssmTypes.Parameter {
+	if parameter.Type == ssmTypes.ParameterTypeSecureString && !decrypt {
+		parameter.Value = aws.String("AQICAHh" + hex.EncodeToString([]byte(*parameter.Name)))
+	}
+	return parameter
+}
+
+func (f *fakeRegion) GetParameter(_ context.Context, params *ssm.GetParameterInput, _ ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	err := f.begin("SSM.GetParameter")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	parameter, err := f.parameter(params.Name)
+	if err != nil {
+		return nil, err
+	}
+	value := fakeEncrypted(parameter.value, aws.ToBool(params.WithDecryption))
+	return &ssm.GetParameterOutput{Parameter: &value}, nil
+}
+
+// GetParametersByPath lists the parameters right under the path, the recursive listing cloudGun does not use.
+func (f *fakeRegion) GetParametersByPath(_ context.Context, params *ssm.GetParametersByPathInput, _ ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error) {
+	err := f.begin("SSM.GetParametersByPath")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	path := strings.TrimSuffix(*params.Path, "/") + "/"
+	parameters := make([]ssmTypes.Parameter, 0)
+	for _, parameter := range f.cloud.parameters {
+		rest, ok := strings.CutPrefix(*parameter.value.Name, path)
+		if parameter.region == f.region && ok && !strings.Contains(rest, "/") {
+			parameters = append(parameters, fakeEncrypted(parameter.value, aws.ToBool(params.WithDecryption)))
+		}
+	}
+	sort.Slice(parameters, func(i, j int) bool { return *parameters[i].Name < *parameters[j].Name })
+	start := 0
+	if params.NextToken != nil {
+		start, err = strconv.Atoi(*params.NextToken)
+		if err != nil || start > len(parameters) {
+			return nil, fakeError("InvalidNextToken", "The specified token is not valid.")
+		}
+	}
+	end := min(start+fakeParameterPageSize, len(parameters))
+	output := &ssm.GetParametersByPathOutput{Parameters: parameters[start:end]}
+	if end < len(parameters) {
+		output.NextToken = aws.String(strconv.Itoa(end))
+	}
+	return output, nil
+}
+
+func (f *fakeRegion) DeleteParameter(_ context.Context, params *ssm.DeleteParameterInput, _ ...func(*ssm.Options)) (*ssm.DeleteParameterOutput, error) {
+	err := f.begin("SSM.DeleteParameter")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	parameter, err := f.parameter(params.Name)
+	if err != nil {
+		return nil, err
+	}
+	delete(f.cloud.parameters, *parameter.value.ARN)
+	delete(f.cloud.stackTags, *parameter.value.ARN)
+	return &ssm.DeleteParameterOutput{}, nil
+}
+
+// resource groups
+
+type fakeTagged struct {
+	identifier ResourceIdentifier
+	arn        string
+	region     string
+}
+
+// taggedResources lists the resources a resource group can find, the way it lists them. the cloud has to be locked.
+func (c *fakeCloud) taggedResources() []fakeTagged {
+	tagged := make([]fakeTagged, 0)
+	for arn, certificate := range c.certificates {
+		tagged = append(tagged, fakeTagged{CertificateManagerCertificate, arn, certificate.region})
+	}
+	for name, bucket := range c.buckets {
+		tagged = append(tagged, fakeTagged{S3Bucket, "arn:aws:s3:::" + name, bucket.region})
+	}
+	for _, distribution := range c.distributions {
+		tagged = append(tagged, fakeTagged{CloudFrontDistribution, *distribution.distribution.ARN, "us-east-1"})
+	}
+	for id, group := range c.securityGroups {
+		tagged = append(tagged, fakeTagged{EC2SecurityGroup, fmt.Sprintf("arn:aws:ec2:%s:%s:security-group/%s", group.region, fakeAccountId, id), group.region})
+	}
+	for arn, provider := range c.capacityProviders {
+		if provider.value.Status == ecsTypes.CapacityProviderStatusActive {
+			tagged = append(tagged, fakeTagged{ECSCapacityProvider, arn, provider.region})
+		}
+	}
+	for arn, cluster := range c.clusters {
+		if *cluster.value.Status == "ACTIVE" {
+			tagged = append(tagged, fakeTagged{ECSCluster, arn, cluster.region})
+		}
+	}
+	for arn, definition := range c.taskDefinitions {
+		if definition.value.Status == ecsTypes.TaskDefinitionStatusActive {
+			tagged = append(tagged, fakeTagged{ECSTaskDefinition, arn, definition.region})
+		}
+	}
+	for arn, service := range c.services {
+		if *service.value.Status == "ACTIVE" {
+			tagged = append(tagged, fakeTagged{ECSService, arn, service.region})
+		}
+	}
+	for arn, loadBalancer := range c.loadBalancers {
+		tagged = append(tagged, fakeTagged{ElasticLoadBalancingLoadBalancer, arn, loadBalancer.region})
+	}
+	for arn, listener := range c.listeners {
+		tagged = append(tagged, fakeTagged{ElasticLoadBalancingListener, arn, listener.region})
+	}
+	for arn, group := range c.targetGroups {
+		tagged = append(tagged, fakeTagged{ElasticLoadBalancingTargetGroup, arn, group.region})
+	}
+	for arn, repository := range c.repositories {
+		tagged = append(tagged, fakeTagged{ECRRepository, arn, repository.region})
+	}
+	for arn, group := range c.logGroups {
+		tagged = append(tagged, fakeTagged{LogsLogGroup, arn, group.region})
+	}
+	for arn, parameter := range c.parameters {
+		tagged = append(tagged, fakeTagged{SSMParameter, arn, parameter.region})
+	}
+	sort.Slice(tagged, func(i, j int) bool { return tagged[i].arn < tagged[j].arn })
+	return tagged
+}
+
+func (f *fakeRegion) group(name *string) (*fakeGroup, error) {
+	group, ok := f.cloud.groups[f.region+"/"+*name]
+	if !ok {
+		return nil, fakeError("NotFoundException", "Cannot find group %s.", *name)
+	}
+	return group, nil
+}
+
+func (f *fakeRegion) CreateGroup(_ context.Context, params *resource.CreateGroupInput, _ ...func(*resource.Options)) (*resource.CreateGroupOutput, error) {
+	err := f.begin("ResourceGroups.CreateGroup")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := f.cloud.groups[f.region+"/"+*params.Name]; ok {
+		return nil, fakeError("BadRequestException", "Cannot create group: group already exists")
+	}
+	var query struct {
+		TagFilters []struct {
+			Key    string
+			Values []string
+		}
+	}
+	err = json.Unmarshal([]byte(*params.ResourceQuery.Query), &query)
+	if err != nil {
+		return nil, fakeError("BadRequestException", "Query not valid: %s", err.Error())
+	}
+	uuid := ""
+	for _, filter := range query.TagFilters {
+		if filter.Key == baseUUIDTagName && len(filter.Values) == 1 {
+			uuid = filter.Values[0]
+		}
+	}
+	group := resourceTypes.Group{
+		GroupArn: aws.String(f.arn("resource-groups", "group/"+*params.Name)),
+		Name:     params.Name,
+	}
+	f.cloud.groups[f.region+"/"+*params.Name] = &fakeGroup{region: f.region, group: group, uuid: uuid}
+	return &resource.CreateGroupOutput{Group: &group, ResourceQuery: params.ResourceQuery}, nil
+}
+
+func (f *fakeRegion) GetGroup(_ context.Context, params *resource.GetGroupInput, _ ...func(*resource.Options)) (*resource.GetGroupOutput, error) {
+	err := f.begin("ResourceGroups.GetGroup")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	group, err := f.group(params.Group)
+	if err != nil {
+		return nil, err
+	}
+	return &resource.GetGroupOutput{Group: &group.group}, nil
+}
+
+func (f *fakeRegion) ListGroupResources(_ context.Context, params *resource.ListGroupResourcesInput, _ ...func(*resource.Options)) (*resource.ListGroupResourcesOutput, error) {
+	err := f.begin("ResourceGroups.ListGroupResources")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	group, err := f.group(params.Group)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]resourceTypes.ListGroupResourcesItem, 0)
+	for _, tagged := range f.cloud.taggedResources() {
+		if tagged.region == f.region && group.uuid != "" && f.cloud.stackTags[tagged.arn] == group.uuid {
+			items = append(items, resourceTypes.ListGroupResourcesItem{Identifier: &resourceTypes.ResourceIdentifier{
+				ResourceArn:  aws.String(tagged.arn),
+				ResourceType: aws.String(string(tagged.identifier)),
+			}})
+		}
+	}
+	return &resource.ListGroupResourcesOutput{Resources: items}, nil
+}
+
+func (f *fakeRegion) DeleteGroup(_ context.Context, params *resource.DeleteGroupInput, _ ...func(*resource.Options)) (*resource.DeleteGroupOutput, error) {
+	err := f.begin("ResourceGroups.DeleteGroup")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	group, err := f.group(params.Group)
+	if err != nil {
+		return nil, err
+	}
+	delete(f.cloud.groups, f.region+"/"+*params.Group)
+	return &resource.DeleteGroupOutput{Group: &group.group}, nil
+}
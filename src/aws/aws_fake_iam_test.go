@@ -0,0 +1,671 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"sort"
+	"strings"
+)
+
+// iam is global, so the region of the client is ignored
+
+func (f *fakeRegion) user(name *string) (*fakeUser, error) {
+	user, ok := f.cloud.users[*name]
+	if !ok {
+		return nil, fakeError("NoSuchEntity", "The user with name %s cannot be found.", *name)
+	}
+	return user, nil
+}
+
+func (f *fakeRegion) role(name *string) (*fakeRole, error) {
+	role, ok := f.cloud.roles[*name]
+	if !ok {
+		return nil, fakeError("NoSuchEntity", "The role with name %s cannot be found.", *name)
+	}
+	return role, nil
+}
+
+func sortedKeys(policies map[string]string) []string {
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (f *fakeRegion) CreateUser(_ context.Context, params *iam.CreateUserInput, _ ...func(*iam.Options)) (*iam.CreateUserOutput, error) {
+	err := f.begin("IAM.CreateUser")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := f.cloud.users[*params.UserName]; ok {
+		return nil, fakeError("EntityAlreadyExists", "User with name %s already exists.", *params.UserName)
+	}
+	path := aws.ToString(params.Path)
+	if path == "" {
+		path = "/"
+	}
+	user := iamTypes.User{
+		UserName: params.UserName,
+		UserId:   aws.String(fmt.Sprintf("AIDA%08d", f.nextId())),
+		Path:     aws.String(path),
+		Arn:      aws.String(fmt.Sprintf("arn:aws:iam::%s:user%s%s", fakeAccountId, path, *params.UserName)),
+		Tags:     params.Tags,
+	}
+	f.cloud.users[*params.UserName] = &fakeUser{user: user, tags: params.Tags, policies: make(map[string]string)}
+	return &iam.CreateUserOutput{User: &user}, nil
+}
+
+func (f *fakeRegion) GetUser(_ context.Context, params *iam.GetUserInput, _ ...func(*iam.Options)) (*iam.GetUserOutput, error) {
+	err := f.begin("IAM.GetUser")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	user, err := f.user(params.UserName)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetUserOutput{User: &user.user}, nil
+}
+
+func (f *fakeRegion) ListUsers(_ context.Context, params *iam.ListUsersInput, _ ...func(*iam.Options)) (*iam.ListUsersOutput, error) {
+	err := f.begin("IAM.ListUsers")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	users := make([]iamTypes.User, 0)
+	for _, user := range f.cloud.users {
+		if strings.HasPrefix(*user.user.Path, aws.ToString(params.PathPrefix)) {
+			users = append(users, user.user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return *users[i].UserName < *users[j].UserName })
+	return &iam.ListUsersOutput{Users: users}, nil
+}
+
+func (f *fakeRegion) ListUserTags(_ context.Context, params *iam.ListUserTagsInput, _ ...func(*iam.Options)) (*iam.ListUserTagsOutput, error) {
+	err := f.begin("IAM.ListUserTags")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	user, err := f.user(params.UserName)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListUserTagsOutput{Tags: user.tags}, nil
+}
+
+func (f *fakeRegion) DeleteUser(_ context.Context, params *iam.DeleteUserInput, _ ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
+	err := f.begin("IAM.DeleteUser")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	user, err := f.user(params.UserName)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.policies) != 0 || len(user.keys) != 0 {
+		return nil, fakeError("DeleteConflict", "Cannot delete entity, must delete policies and access keys first.")
+	}
+	delete(f.cloud.users, *params.UserName)
+	return &iam.DeleteUserOutput{}, nil
+}
+
+func (f *fakeRegion) PutUserPolicy(_ context.Context, params *iam.PutUserPolicyInput, _ ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error) {
+	err := f.begin("IAM.PutUserPolicy")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	user, err := f.user(params.UserName)
+	if err != nil {
+		return nil, err
+	}
+	user.policies[*params.PolicyName] = *params.PolicyDocument
+	return &iam.PutUserPolicyOutput{}, nil
+}
+
+func (f *fakeRegion) ListUserPolicies(_ context.Context, params *iam.ListUserPoliciesInput, _ ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+	err := f.begin("IAM.ListUserPolicies")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	user, err := f.user(params.UserName)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListUserPoliciesOutput{PolicyNames: sortedKeys(user.policies)}, nil
+}
+
+func (f *fakeRegion) DeleteUserPolicy(_ context.Context, params *iam.DeleteUserPolicyInput, _ ...func(*iam.Options)) (*iam.DeleteUserPolicyOutput, error) {
+	err := f.begin("IAM.DeleteUserPolicy")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	user, err := f.user(params.UserName)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := user.policies[*params.PolicyName]; !ok {
+		return nil, fakeError("NoSuchEntity", "The user policy with name %s cannot be found.", *params.PolicyName)
+	}
+	delete(user.policies, *params.PolicyName)
+	return &iam.DeleteUserPolicyOutput{}, nil
+}
+
+func (f *fakeRegion) CreateAccessKey(_ context.Context, params *iam.CreateAccessKeyInput, _ ...func(*iam.Options)) (*iam.CreateAccessKeyOutput, error) {
+	err := f.begin("IAM.CreateAccessKey")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	user, err := f.user(params.UserName)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.keys) == 2 {
+		return nil, fakeError("LimitExceeded", "Cannot exceed quota for AccessKeysPerUser: 2")
+	}
+	id := fmt.Sprintf("AKIA%016d", f.nextId())
+	user.keys = append(user.keys, iamTypes.AccessKeyMetadata{AccessKeyId: aws.String(id), UserName: params.UserName, Status: iamTypes.StatusTypeActive})
+	return &iam.CreateAccessKeyOutput{AccessKey: &iamTypes.AccessKey{
+		AccessKeyId:     aws.String(id),
+		SecretAccessKey: aws.String("secret-" + id),
+		UserName:        params.UserName,
+		Status:          iamTypes.StatusTypeActive,
+	}}, nil
+}
+
+func (f *fakeRegion) ListAccessKeys(_ context.Context, params *iam.ListAccessKeysInput, _ ...func(*iam.Options)) (*iam.ListAccessKeysOutput, error) {
+	err := f.begin("IAM.ListAccessKeys")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	user, err := f.user(params.UserName)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListAccessKeysOutput{AccessKeyMetadata: append([]iamTypes.AccessKeyMetadata{}, user.keys...)}, nil
+}
+
+func (f *fakeRegion) DeleteAccessKey(_ context.Context, params *iam.DeleteAccessKeyInput, _ ...func(*iam.Options)) (*iam.DeleteAccessKeyOutput, error) {
+	err := f.begin("IAM.DeleteAccessKey")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	user, err := f.user(params.UserName)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range user.keys {
+		if *key.AccessKeyId == *params.AccessKeyId {
+			user.keys = append(user.keys[:i], user.keys[i+1:]...)
+			return &iam.DeleteAccessKeyOutput{}, nil
+		}
+	}
+	return nil, fakeError("NoSuchEntity", "The Access Key with id %s cannot be found.", *params.AccessKeyId)
+}
+
+func (f *fakeRegion) CreateOpenIDConnectProvider(_ context.Context, params *iam.CreateOpenIDConnectProviderInput, _ ...func(*iam.Options)) (*iam.CreateOpenIDConnectProviderOutput, error) {
+	err := f.begin("IAM.CreateOpenIDConnectProvider")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	arn := fmt.Sprintf("arn:aws:iam::%s:oidc-provider/%s", fakeAccountId, strings.TrimPrefix(*params.Url, "https://"))
+	for _, existing := range f.cloud.oidcProviders {
+		if existing == arn {
+			return nil, fakeError("EntityAlreadyExists", "Provider with url %s already exists.", *params.Url)
+		}
+	}
+	f.cloud.oidcProviders = append(f.cloud.oidcProviders, arn)
+	return &iam.CreateOpenIDConnectProviderOutput{OpenIDConnectProviderArn: aws.String(arn)}, nil
+}
+
+func (f *fakeRegion) ListOpenIDConnectProviders(_ context.Context, _ *iam.ListOpenIDConnectProvidersInput, _ ...func(*iam.Options)) (*iam.ListOpenIDConnectProvidersOutput, error) {
+	err := f.begin("IAM.ListOpenIDConnectProviders")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	providers := make([]iamTypes.OpenIDConnectProviderListEntry, 0)
+	for _, arn := range f.cloud.oidcProviders {
+		providers = append(providers, iamTypes.OpenIDConnectProviderListEntry{Arn: aws.String(arn)})
+	}
+	return &iam.ListOpenIDConnectProvidersOutput{OpenIDConnectProviderList: providers}, nil
+}
+
+func (f *fakeRegion) CreateRole(_ context.Context, params *iam.CreateRoleInput, _ ...func(*iam.Options)) (*iam.CreateRoleOutput, error) {
+	err := f.begin("IAM.CreateRole")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := f.cloud.roles[*params.RoleName]; ok {
+		return nil, fakeError("EntityAlreadyExists", "Role with name %s already exists.", *params.RoleName)
+	}
+	path := aws.ToString(params.Path)
+	if path == "" {
+		path = "/"
+	}
+	role := iamTypes.Role{
+		RoleName:                 params.RoleName,
+		RoleId:                   aws.String(fmt.Sprintf("AROA%08d", f.nextId())),
+		Path:                     aws.String(path),
+		Arn:                      aws.String(fmt.Sprintf("arn:aws:iam::%s:role%s%s", fakeAccountId, path, *params.RoleName)),
+		AssumeRolePolicyDocument: params.AssumeRolePolicyDocument,
+		Tags:                     params.Tags,
+	}
+	f.cloud.roles[*params.RoleName] = &fakeRole{role: role, tags: params.Tags, policies: make(map[string]string)}
+	return &iam.CreateRoleOutput{Role: &role}, nil
+}
+
+func (f *fakeRegion) GetRole(_ context.Context, params *iam.GetRoleInput, _ ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	err := f.begin("IAM.GetRole")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	role, err := f.role(params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetRoleOutput{Role: &role.role}, nil
+}
+
+func (f *fakeRegion) ListRoles(_ context.Context, params *iam.ListRolesInput, _ ...func(*iam.Options)) (*iam.ListRolesOutput, error) {
+	err := f.begin("IAM.ListRoles")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	roles := make([]iamTypes.Role, 0)
+	for _, role := range f.cloud.roles {
+		if strings.HasPrefix(*role.role.Path, aws.ToString(params.PathPrefix)) {
+			roles = append(roles, role.role)
+		}
+	}
+	sort.Slice(roles, func(i, j int) bool { return *roles[i].RoleName < *roles[j].RoleName })
+	return &iam.ListRolesOutput{Roles: roles}, nil
+}
+
+func (f *fakeRegion) ListRoleTags(_ context.Context, params *iam.ListRoleTagsInput, _ ...func(*iam.Options)) (*iam.ListRoleTagsOutput, error) {
+	err := f.begin("IAM.ListRoleTags")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	role, err := f.role(params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListRoleTagsOutput{Tags: role.tags}, nil
+}
+
+func (f *fakeRegion) UpdateAssumeRolePolicy(_ context.Context, params *iam.UpdateAssumeRolePolicyInput, _ ...func(*iam.Options)) (*iam.UpdateAssumeRolePolicyOutput, error) {
+	err := f.begin("IAM.UpdateAssumeRolePolicy")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	role, err := f.role(params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	role.role.AssumeRolePolicyDocument = params.PolicyDocument
+	return &iam.UpdateAssumeRolePolicyOutput{}, nil
+}
+
+func (f *fakeRegion) DeleteRole(_ context.Context, params *iam.DeleteRoleInput, _ ...func(*iam.Options)) (*iam.DeleteRoleOutput, error) {
+	err := f.begin("IAM.DeleteRole")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	role, err := f.role(params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	if len(role.policies) != 0 || len(role.attached) != 0 {
+		return nil, fakeError("DeleteConflict", "Cannot delete entity, must delete policies first.")
+	}
+	for _, profile := range f.cloud.instanceProfiles {
+		for _, profileRole := range profile.Roles {
+			if *profileRole.RoleName == *params.RoleName {
+				return nil, fakeError("DeleteConflict", "Cannot delete entity, must remove roles from instance profile first.")
+			}
+		}
+	}
+	delete(f.cloud.roles, *params.RoleName)
+	return &iam.DeleteRoleOutput{}, nil
+}
+
+func (f *fakeRegion) PutRolePolicy(_ context.Context, params *iam.PutRolePolicyInput, _ ...func(*iam.Options)) (*iam.PutRolePolicyOutput, error) {
+	err := f.begin("IAM.PutRolePolicy")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	role, err := f.role(params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	role.policies[*params.PolicyName] = *params.PolicyDocument
+	return &iam.PutRolePolicyOutput{}, nil
+}
+
+func (f *fakeRegion) ListRolePolicies(_ context.Context, params *iam.ListRolePoliciesInput, _ ...func(*iam.Options)) (*iam.ListRolePoliciesOutput, error) {
+	err := f.begin("IAM.ListRolePolicies")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	role, err := f.role(params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListRolePoliciesOutput{PolicyNames: sortedKeys(role.policies)}, nil
+}
+
+func (f *fakeRegion) DeleteRolePolicy(_ context.Context, params *iam.DeleteRolePolicyInput, _ ...func(*iam.Options)) (*iam.DeleteRolePolicyOutput, error) {
+	err := f.begin("IAM.DeleteRolePolicy")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	role, err := f.role(params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := role.policies[*params.PolicyName]; !ok {
+		return nil, fakeError("NoSuchEntity", "The role policy with name %s cannot be found.", *params.PolicyName)
+	}
+	delete(role.policies, *params.PolicyName)
+	return &iam.DeleteRolePolicyOutput{}, nil
+}
+
+func (f *fakeRegion) ListAttachedRolePolicies(_ context.Context, params *iam.ListAttachedRolePoliciesInput, _ ...func(*iam.Options)) (*iam.ListAttachedRolePoliciesOutput, error) {
+	err := f.begin("IAM.ListAttachedRolePolicies")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	role, err := f.role(params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListAttachedRolePoliciesOutput{AttachedPolicies: append([]iamTypes.AttachedPolicy{}, role.attached...)}, nil
+}
+
+func (f *fakeRegion) DetachRolePolicy(_ context.Context, params *iam.DetachRolePolicyInput, _ ...func(*iam.Options)) (*iam.DetachRolePolicyOutput, error) {
+	err := f.begin("IAM.DetachRolePolicy")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	role, err := f.role(params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	for i, policy := range role.attached {
+		if *policy.PolicyArn == *params.PolicyArn {
+			role.attached = append(role.attached[:i], role.attached[i+1:]...)
+			return &iam.DetachRolePolicyOutput{}, nil
+		}
+	}
+	return nil, fakeError("NoSuchEntity", "Policy %s was not found.", *params.PolicyArn)
+}
+
+func (f *fakeRegion) AttachRolePolicy(_ context.Context, params *iam.AttachRolePolicyInput, _ ...func(*iam.Options)) (*iam.AttachRolePolicyOutput, error) {
+	err := f.begin("IAM.AttachRolePolicy")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	role, err := f.role(params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	for _, policy := range role.attached {
+		if *policy.PolicyArn == *params.PolicyArn {
+			return &iam.AttachRolePolicyOutput{}, nil
+		}
+	}
+	name := (*params.PolicyArn)[strings.LastIndex(*params.PolicyArn, "/")+1:]
+	role.attached = append(role.attached, iamTypes.AttachedPolicy{PolicyArn: params.PolicyArn, PolicyName: aws.String(name)})
+	return &iam.AttachRolePolicyOutput{}, nil
+}
+
+// addInstanceProfile puts an instance profile of a role that cloudGun did not create, like the ecsInstanceRole of the
+// console, in the cloud.
+func (c *fakeCloud) addInstanceProfile(name string, roleName string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.instanceProfiles[name] = &iamTypes.InstanceProfile{
+		InstanceProfileName: aws.String(name),
+		Path:                aws.String("/"),
+		Roles:               []iamTypes.Role{{RoleName: aws.String(roleName), Path: aws.String("/")}},
+	}
+}
+
+func (f *fakeRegion) instanceProfile(name *string) (*iamTypes.InstanceProfile, error) {
+	profile, ok := f.cloud.instanceProfiles[*name]
+	if !ok {
+		return nil, fakeError("NoSuchEntity", "Instance Profile %s cannot be found.", *name)
+	}
+	return profile, nil
+}
+
+func (f *fakeRegion) CreateInstanceProfile(_ context.Context, params *iam.CreateInstanceProfileInput, _ ...func(*iam.Options)) (*iam.CreateInstanceProfileOutput, error) {
+	err := f.begin("IAM.CreateInstanceProfile")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := f.cloud.instanceProfiles[*params.InstanceProfileName]; ok {
+		return nil, fakeError("EntityAlreadyExists", "Instance Profile %s already exists.", *params.InstanceProfileName)
+	}
+	path := aws.ToString(params.Path)
+	if path == "" {
+		path = "/"
+	}
+	profile := iamTypes.InstanceProfile{
+		InstanceProfileName: params.InstanceProfileName,
+		Path:                aws.String(path),
+		Arn:                 aws.String(fmt.Sprintf("arn:aws:iam::%s:instance-profile%s%s", fakeAccountId, path, *params.InstanceProfileName)),
+		Tags:                params.Tags,
+	}
+	f.cloud.instanceProfiles[*params.InstanceProfileName] = &profile
+	return &iam.CreateInstanceProfileOutput{InstanceProfile: &profile}, nil
+}
+
+func (f *fakeRegion) GetInstanceProfile(_ context.Context, params *iam.GetInstanceProfileInput, _ ...func(*iam.Options)) (*iam.GetInstanceProfileOutput, error) {
+	err := f.begin("IAM.GetInstanceProfile")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	profile, err := f.instanceProfile(params.InstanceProfileName)
+	if err != nil {
+		return nil, err
+	}
+	copied := *profile
+	copied.Roles = append([]iamTypes.Role{}, profile.Roles...)
+	return &iam.GetInstanceProfileOutput{InstanceProfile: &copied}, nil
+}
+
+func (f *fakeRegion) AddRoleToInstanceProfile(_ context.Context, params *iam.AddRoleToInstanceProfileInput, _ ...func(*iam.Options)) (*iam.AddRoleToInstanceProfileOutput, error) {
+	err := f.begin("IAM.AddRoleToInstanceProfile")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	profile, err := f.instanceProfile(params.InstanceProfileName)
+	if err != nil {
+		return nil, err
+	}
+	role, err := f.role(params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	if len(profile.Roles) != 0 {
+		return nil, fakeError("LimitExceeded", "Cannot exceed quota for InstanceSessionsPerInstanceProfile: 1")
+	}
+	profile.Roles = append(profile.Roles, role.role)
+	return &iam.AddRoleToInstanceProfileOutput{}, nil
+}
+
+func (f *fakeRegion) RemoveRoleFromInstanceProfile(_ context.Context, params *iam.RemoveRoleFromInstanceProfileInput, _ ...func(*iam.Options)) (*iam.RemoveRoleFromInstanceProfileOutput, error) {
+	err := f.begin("IAM.RemoveRoleFromInstanceProfile")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	profile, err := f.instanceProfile(params.InstanceProfileName)
+	if err != nil {
+		return nil, err
+	}
+	for i, role := range profile.Roles {
+		if *role.RoleName == *params.RoleName {
+			profile.Roles = append(profile.Roles[:i], profile.Roles[i+1:]...)
+			return &iam.RemoveRoleFromInstanceProfileOutput{}, nil
+		}
+	}
+	return nil, fakeError("NoSuchEntity", "The role with name %s cannot be found.", *params.RoleName)
+}
+
+func (f *fakeRegion) ListInstanceProfilesForRole(_ context.Context, params *iam.ListInstanceProfilesForRoleInput, _ ...func(*iam.Options)) (*iam.ListInstanceProfilesForRoleOutput, error) {
+	err := f.begin("IAM.ListInstanceProfilesForRole")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.role(params.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]iamTypes.InstanceProfile, 0)
+	for _, profile := range f.cloud.instanceProfiles {
+		for _, role := range profile.Roles {
+			if *role.RoleName == *params.RoleName {
+				profiles = append(profiles, *profile)
+			}
+		}
+	}
+	sort.Slice(profiles, func(i, j int) bool { return *profiles[i].InstanceProfileName < *profiles[j].InstanceProfileName })
+	return &iam.ListInstanceProfilesForRoleOutput{InstanceProfiles: profiles}, nil
+}
+
+func (f *fakeRegion) DeleteInstanceProfile(_ context.Context, params *iam.DeleteInstanceProfileInput, _ ...func(*iam.Options)) (*iam.DeleteInstanceProfileOutput, error) {
+	err := f.begin("IAM.DeleteInstanceProfile")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	profile, err := f.instanceProfile(params.InstanceProfileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(profile.Roles) != 0 {
+		return nil, fakeError("DeleteConflict", "Cannot delete entity, must remove roles from instance profile first.")
+	}
+	delete(f.cloud.instanceProfiles, *params.InstanceProfileName)
+	return &iam.DeleteInstanceProfileOutput{}, nil
+}
+
+// rds
+
+func (f *fakeRegion) CreateDBInstance(_ context.Context, params *rds.CreateDBInstanceInput, _ ...func(*rds.Options)) (*rds.CreateDBInstanceOutput, error) {
+	err := f.begin("RDS.CreateDBInstance")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	arn := f.arn("rds", "db:"+*params.DBInstanceIdentifier)
+	if _, ok := f.cloud.dbInstances[arn]; ok {
+		return nil, fakeError("DBInstanceAlreadyExists", "DB instance already exists")
+	}
+	instance := rdsTypes.DBInstance{
+		DBInstanceArn:        aws.String(arn),
+		DBInstanceIdentifier: params.DBInstanceIdentifier,
+		DBInstanceClass:      params.DBInstanceClass,
+		Engine:               params.Engine,
+		DBInstanceStatus:     aws.String("available"),
+	}
+	f.cloud.dbInstances[arn] = &fakeRegional[rdsTypes.DBInstance]{region: f.region, value: instance}
+	return &rds.CreateDBInstanceOutput{DBInstance: &instance}, nil
+}
+
+func (f *fakeRegion) dbInstance(identifier *string) (*fakeRegional[rdsTypes.DBInstance], error) {
+	arn := *identifier
+	if !strings.HasPrefix(arn, "arn:") {
+		arn = f.arn("rds", "db:"+arn)
+	}
+	instance, ok := f.cloud.dbInstances[arn]
+	if !ok {
+		return nil, fakeError("DBInstanceNotFound", "DBInstance %s not found.", *identifier)
+	}
+	return instance, nil
+}
+
+func (f *fakeRegion) DescribeDBInstances(_ context.Context, params *rds.DescribeDBInstancesInput, _ ...func(*rds.Options)) (*rds.DescribeDBInstancesOutput, error) {
+	err := f.begin("RDS.DescribeDBInstances")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]rdsTypes.DBInstance, 0)
+	if params.DBInstanceIdentifier != nil {
+		instance, err := f.dbInstance(params.DBInstanceIdentifier)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, instance.value)
+	}
+	return &rds.DescribeDBInstancesOutput{DBInstances: instances}, nil
+}
+
+func (f *fakeRegion) DeleteDBInstance(_ context.Context, params *rds.DeleteDBInstanceInput, _ ...func(*rds.Options)) (*rds.DeleteDBInstanceOutput, error) {
+	err := f.begin("RDS.DeleteDBInstance")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	instance, err := f.dbInstance(params.DBInstanceIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	delete(f.cloud.dbInstances, *instance.value.DBInstanceArn)
+	return &rds.DeleteDBInstanceOutput{DBInstance: &instance.value}, nil
+}
+
+// sts
+
+func (f *fakeRegion) GetCallerIdentity(_ context.Context, _ *sts.GetCallerIdentityInput, _ ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	err := f.begin("STS.GetCallerIdentity")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String(fakeAccountId),
+		Arn:     aws.String(fmt.Sprintf("arn:aws:iam::%s:user/cloudgun", fakeAccountId)),
+		UserId:  aws.String("AIDAFAKE"),
+	}, nil
+}
@@ -0,0 +1,1023 @@
+package aws
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	acmTypes "github.com/aws/aws-sdk-go-v2/service/acm/types"
+	asgTypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	cloudfrontTypes "github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	logsTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	ecrTypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	elbTypes "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	resourceTypes "github.com/aws/aws-sdk-go-v2/service/resourcegroups/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	route53Types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	ssmTypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/smithy-go"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const fakeAccountId = "123456789012"
+
+// fakeCloud is an in-memory aws account. it keeps just enough of every service for the create and delete flows
+// and answers like aws does, with the same error codes, so the flows can be tested without an account.
+type fakeCloud struct {
+	mutex sync.Mutex
+	next  int
+
+	// calls are the operations called so far, like "ECS.CreateCluster"
+	calls []string
+	// failures makes an operation fail with the error every time it is called
+	failures map[string]error
+	// stackTags is the CloudGunUUID tag of every tagged resource, by arn
+	stackTags map[string]string
+	// hostedZonePageSize is the MaxItems of ListHostedZones when the caller gives none, 100 like aws when 0
+	hostedZonePageSize int
+
+	hostedZones       map[string]*fakeHostedZone
+	certificates      map[string]*fakeCertificate
+	buckets           map[string]*fakeBucket
+	distributions     map[string]*fakeDistribution
+	images            []ec2Types.Image
+	securityGroups    map[string]*fakeSecurityGroup
+	launchTemplates   map[string]*fakeLaunchTemplate
+	autoScalingGroups map[string]*fakeAutoScalingGroup
+	capacityProviders map[string]*fakeRegional[ecsTypes.CapacityProvider]
+	clusters          map[string]*fakeRegional[ecsTypes.Cluster]
+	taskDefinitions   map[string]*fakeRegional[ecsTypes.TaskDefinition]
+	services          map[string]*fakeRegional[ecsTypes.Service]
+	loadBalancers     map[string]*fakeRegional[elbTypes.LoadBalancer]
+	listeners         map[string]*fakeRegional[elbTypes.Listener]
+	targetGroups      map[string]*fakeRegional[elbTypes.TargetGroup]
+	repositories      map[string]*fakeRepository
+	logGroups         map[string]*fakeLogGroup
+	parameters        map[string]*fakeRegional[ssmTypes.Parameter]
+	groups            map[string]*fakeGroup
+	users             map[string]*fakeUser
+	roles             map[string]*fakeRole
+	instanceProfiles  map[string]*iamTypes.InstanceProfile
+	oidcProviders     []string
+	dbInstances       map[string]*fakeRegional[rdsTypes.DBInstance]
+}
+
+type fakeRegional[T any] struct {
+	region string
+	value  T
+}
+
+type fakeHostedZone struct {
+	zone        route53Types.HostedZone
+	records     []route53Types.ResourceRecordSet
+	nameServers []string
+}
+
+type fakeCertificate struct {
+	region      string
+	certificate acmTypes.CertificateDetail
+}
+
+type fakeBucket struct {
+	region        string
+	tags          []s3Types.Tag
+	policy        string
+	website       *s3Types.WebsiteConfiguration
+	publicBlocked bool
+	objects       map[string][]byte
+}
+
+type fakeDistribution struct {
+	distribution cloudfrontTypes.Distribution
+	etag         string
+}
+
+type fakeSecurityGroup struct {
+	region string
+	group  ec2Types.SecurityGroup
+}
+
+type fakeLaunchTemplate struct {
+	region   string
+	template ec2Types.LaunchTemplate
+	data     *ec2Types.RequestLaunchTemplateData
+}
+
+type fakeAutoScalingGroup struct {
+	region string
+	group  asgTypes.AutoScalingGroup
+}
+
+type fakeGroup struct {
+	region string
+	group  resourceTypes.Group
+	uuid   string
+}
+
+type fakeUser struct {
+	user     iamTypes.User
+	tags     []iamTypes.Tag
+	policies map[string]string
+	keys     []iamTypes.AccessKeyMetadata
+}
+
+type fakeRepository struct {
+	region     string
+	repository ecrTypes.Repository
+	// layers are the uploaded blobs by digest, uploads the parts received so far by upload id
+	layers  map[string][]byte
+	uploads map[string][]byte
+	// images are the manifests by tag
+	images map[string]string
+}
+
+type fakeLogGroup struct {
+	region string
+	group  logsTypes.LogGroup
+	events []logsTypes.FilteredLogEvent
+}
+
+type fakeRole struct {
+	role     iamTypes.Role
+	tags     []iamTypes.Tag
+	policies map[string]string
+	attached []iamTypes.AttachedPolicy
+}
+
+func newFakeCloud() *fakeCloud {
+	return &fakeCloud{
+		failures:          make(map[string]error),
+		stackTags:         make(map[string]string),
+		hostedZones:       make(map[string]*fakeHostedZone),
+		certificates:      make(map[string]*fakeCertificate),
+		buckets:           make(map[string]*fakeBucket),
+		distributions:     make(map[string]*fakeDistribution),
+		images:            []ec2Types.Image{{ImageId: aws.String("ami-ecs"), Name: aws.String(AmazonLinux2.name)}},
+		securityGroups:    make(map[string]*fakeSecurityGroup),
+		launchTemplates:   make(map[string]*fakeLaunchTemplate),
+		autoScalingGroups: make(map[string]*fakeAutoScalingGroup),
+		capacityProviders: make(map[string]*fakeRegional[ecsTypes.CapacityProvider]),
+		clusters:          make(map[string]*fakeRegional[ecsTypes.Cluster]),
+		taskDefinitions:   make(map[string]*fakeRegional[ecsTypes.TaskDefinition]),
+		services:          make(map[string]*fakeRegional[ecsTypes.Service]),
+		loadBalancers:     make(map[string]*fakeRegional[elbTypes.LoadBalancer]),
+		listeners:         make(map[string]*fakeRegional[elbTypes.Listener]),
+		targetGroups:      make(map[string]*fakeRegional[elbTypes.TargetGroup]),
+		repositories:      make(map[string]*fakeRepository),
+		logGroups:         make(map[string]*fakeLogGroup),
+		parameters:        make(map[string]*fakeRegional[ssmTypes.Parameter]),
+		groups:            make(map[string]*fakeGroup),
+		users:             make(map[string]*fakeUser),
+		roles:             make(map[string]*fakeRole),
+		instanceProfiles:  make(map[string]*iamTypes.InstanceProfile),
+		dbInstances:       make(map[string]*fakeRegional[rdsTypes.DBInstance]),
+	}
+}
+
+// fakeRegion is the view of fakeCloud a client of a region has. it implements every client interface of the package.
+type fakeRegion struct {
+	cloud  *fakeCloud
+	region string
+}
+
+// fakeECRRegion is the view of the ecr client, whose DescribeImages is another operation than the one of ec2.
+type fakeECRRegion struct {
+	*fakeRegion
+}
+
+func (c *fakeCloud) ACM(region *string) (ACMAPI, error) { return &fakeRegion{c, *region}, nil }
+func (c *fakeCloud) AutoScaling(region *string) (AutoScalingAPI, error) {
+	return &fakeRegion{c, *region}, nil
+}
+func (c *fakeCloud) CloudFront(region *string) (CloudFrontAPI, error) {
+	return &fakeRegion{c, *region}, nil
+}
+func (c *fakeCloud) EC2(region *string) (EC2API, error) { return &fakeRegion{c, *region}, nil }
+func (c *fakeCloud) ECR(region *string) (ECRAPI, error) {
+	return &fakeECRRegion{&fakeRegion{c, *region}}, nil
+}
+func (c *fakeCloud) ECS(region *string) (ECSAPI, error)   { return &fakeRegion{c, *region}, nil }
+func (c *fakeCloud) ELB(region *string) (ELBAPI, error)   { return &fakeRegion{c, *region}, nil }
+func (c *fakeCloud) IAM(region *string) (IAMAPI, error)   { return &fakeRegion{c, *region}, nil }
+func (c *fakeCloud) Logs(region *string) (LogsAPI, error) { return &fakeRegion{c, *region}, nil }
+func (c *fakeCloud) RDS(region *string) (RDSAPI, error)   { return &fakeRegion{c, *region}, nil }
+func (c *fakeCloud) ResourceGroups(region *string) (ResourceGroupsAPI, error) {
+	return &fakeRegion{c, *region}, nil
+}
+func (c *fakeCloud) Route53(region *string) (Route53API, error) { return &fakeRegion{c, *region}, nil }
+func (c *fakeCloud) S3(region *string) (S3API, error)           { return &fakeRegion{c, *region}, nil }
+func (c *fakeCloud) SSM(region *string) (SSMAPI, error)         { return &fakeRegion{c, *region}, nil }
+func (c *fakeCloud) STS(region *string, _ *DefaultCredentials) (STSAPI, error) {
+	return &fakeRegion{c, *region}, nil
+}
+
+func fakeError(code string, format string, args ...any) error {
+	return &smithy.GenericAPIError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// begin locks the cloud for an operation and returns the failure set for it. end has to be deferred right after.
+func (f *fakeRegion) begin(operation string) error {
+	f.cloud.mutex.Lock()
+	f.cloud.calls = append(f.cloud.calls, operation)
+	return f.cloud.failures[operation]
+}
+
+func (f *fakeRegion) end() {
+	f.cloud.mutex.Unlock()
+}
+
+func (f *fakeRegion) nextId() int {
+	f.cloud.next++
+	return f.cloud.next
+}
+
+func (f *fakeRegion) arn(service string, resource string) string {
+	return fmt.Sprintf("arn:aws:%s:%s:%s:%s", service, f.region, fakeAccountId, resource)
+}
+
+func (c *fakeCloud) ecrRepository(region string, name string) *fakeRepository {
+	return c.repositories[(&fakeRegion{c, region}).arn("ecr", "repository/"+name)]
+}
+
+func (c *fakeCloud) fail(operation string, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.failures[operation] = err
+}
+
+func (c *fakeCloud) callCount(operation string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	count := 0
+	for _, call := range c.calls {
+		if call == operation {
+			count++
+		}
+	}
+	return count
+}
+
+func (c *fakeCloud) addHostedZone(domain string) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.newHostedZone(domain)
+}
+
+// newHostedZone adds a zone with name servers of its own like route53 gives. the cloud has to be locked.
+func (c *fakeCloud) newHostedZone(domain string) string {
+	c.next++
+	id := fmt.Sprintf("Z%d", c.next)
+	c.hostedZones[id] = &fakeHostedZone{
+		zone: route53Types.HostedZone{
+			Id:   aws.String("/hostedzone/" + id),
+			Name: aws.String(fqdn(domain)),
+		},
+		nameServers: []string{
+			fmt.Sprintf("ns-%d.awsdns-01.com", c.next),
+			fmt.Sprintf("ns-%d.awsdns-02.net", c.next),
+		},
+	}
+	return id
+}
+
+// addBucket adds a bucket tagged for the stack of uuid, as if another run had created it.
+func (c *fakeCloud) addBucket(name string, region string, uuid string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.buckets[name] = &fakeBucket{region: region, objects: make(map[string][]byte), tags: []s3Types.Tag{
+		{Key: aws.String(baseTagName), Value: aws.String(baseTagValue)},
+		{Key: aws.String(baseUUIDTagName), Value: aws.String(uuid)},
+	}}
+	c.stackTags["arn:aws:s3:::"+name] = uuid
+}
+
+func (c *fakeCloud) addRecord(zoneId string, record route53Types.ResourceRecordSet) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	record.Name = aws.String(fqdn(*record.Name))
+	c.hostedZones[zoneId].records = append(c.hostedZones[zoneId].records, record)
+}
+
+// liveResources counts the resources that still exist, the deleted ecs resources that aws keeps for a while excluded.
+func (c *fakeCloud) liveResources() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	count := len(c.certificates) + len(c.buckets) + len(c.distributions) + len(c.securityGroups) + len(c.launchTemplates) +
+		len(c.autoScalingGroups) + len(c.loadBalancers) + len(c.listeners) + len(c.targetGroups) + len(c.repositories) +
+		len(c.logGroups) + len(c.parameters) + len(c.groups) + len(c.users) + len(c.roles) + len(c.instanceProfiles) +
+		len(c.dbInstances)
+	for _, provider := range c.capacityProviders {
+		if provider.value.Status == ecsTypes.CapacityProviderStatusActive {
+			count++
+		}
+	}
+	for _, cluster := range c.clusters {
+		if *cluster.value.Status == "ACTIVE" {
+			count++
+		}
+	}
+	for _, definition := range c.taskDefinitions {
+		if definition.value.Status == ecsTypes.TaskDefinitionStatusActive {
+			count++
+		}
+	}
+	for _, service := range c.services {
+		if *service.value.Status == "ACTIVE" {
+			count++
+		}
+	}
+	return count
+}
+
+// records returns the records of a zone other than the ones every zone has.
+func (c *fakeCloud) records(zoneId string) []route53Types.ResourceRecordSet {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return slices.Clone(c.hostedZones[zoneId].records)
+}
+
+func stackUUID[T any](tags []T, pair func(T) (*string, *string)) string {
+	for _, tag := range tags {
+		key, value := pair(tag)
+		if aws.ToString(key) == baseUUIDTagName {
+			return aws.ToString(value)
+		}
+	}
+	return ""
+}
+
+func fqdn(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+}
+
+// acm
+
+// validationRecord is the record validating domain, the same one for a wildcard and its domain like acm.
+func validationRecord(domain string) *acmTypes.ResourceRecord {
+	domain = strings.TrimPrefix(domain, "*.")
+	hash := fmt.Sprintf("%x", sha1.Sum([]byte(domain)))
+	return &acmTypes.ResourceRecord{
+		Name:  aws.String(fmt.Sprintf("_%s.%s.", hash[:16], domain)),
+		Type:  acmTypes.RecordTypeCname,
+		Value: aws.String(fmt.Sprintf("_%s.acm-validations.aws.", hash[16:32])),
+	}
+}
+
+// addCertificate adds an issued certificate of names, tagged for the stack of uuid unless it is empty, as if it was
+// requested and validated outside of the run.
+func (c *fakeCloud) addCertificate(region string, names []string, uuid string) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.next++
+	arn := fmt.Sprintf("arn:aws:acm:%s:%s:certificate/%d", region, fakeAccountId, c.next)
+	options := make([]acmTypes.DomainValidation, 0)
+	for _, name := range names {
+		options = append(options, acmTypes.DomainValidation{
+			DomainName:       aws.String(name),
+			ValidationMethod: acmTypes.ValidationMethodDns,
+			ValidationStatus: acmTypes.DomainStatusSuccess,
+			ResourceRecord:   validationRecord(name),
+		})
+	}
+	c.certificates[arn] = &fakeCertificate{region: region, certificate: acmTypes.CertificateDetail{
+		CertificateArn:          aws.String(arn),
+		DomainName:              aws.String(names[0]),
+		SubjectAlternativeNames: names,
+		DomainValidationOptions: options,
+		Status:                  acmTypes.CertificateStatusIssued,
+		Type:                    acmTypes.CertificateTypeAmazonIssued,
+	}}
+	if uuid != "" {
+		c.stackTags[arn] = uuid
+	}
+	return arn
+}
+
+// findRecord returns the record of name and type in any zone. the cloud has to be locked.
+func (c *fakeCloud) findRecord(name string, recordType route53Types.RRType) *route53Types.ResourceRecordSet {
+	for _, zone := range c.hostedZones {
+		for i, record := range zone.records {
+			if fqdn(*record.Name) == fqdn(name) && record.Type == recordType {
+				return &zone.records[i]
+			}
+		}
+	}
+	return nil
+}
+
+// certificateInUse tells what uses a certificate. the cloud has to be locked.
+func (c *fakeCloud) certificateInUse(arn string) []string {
+	inUse := make([]string, 0)
+	for listenerArn, listener := range c.listeners {
+		for _, certificate := range listener.value.Certificates {
+			if aws.ToString(certificate.CertificateArn) == arn {
+				inUse = append(inUse, listenerArn)
+			}
+		}
+	}
+	for _, distribution := range c.distributions {
+		if aws.ToString(distribution.distribution.DistributionConfig.ViewerCertificate.ACMCertificateArn) == arn {
+			inUse = append(inUse, *distribution.distribution.ARN)
+		}
+	}
+	return inUse
+}
+
+func (f *fakeRegion) RequestCertificate(_ context.Context, params *acm.RequestCertificateInput, _ ...func(*acm.Options)) (*acm.RequestCertificateOutput, error) {
+	err := f.begin("ACM.RequestCertificate")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	arn := f.arn("acm", fmt.Sprintf("certificate/%d", f.nextId()))
+	domains := append([]string{*params.DomainName}, params.SubjectAlternativeNames...)
+	options := make([]acmTypes.DomainValidation, 0)
+	for _, domain := range domains {
+		if slices.ContainsFunc(options, func(option acmTypes.DomainValidation) bool { return *option.DomainName == domain }) {
+			continue
+		}
+		options = append(options, acmTypes.DomainValidation{
+			DomainName:       aws.String(domain),
+			ValidationMethod: acmTypes.ValidationMethodDns,
+			ValidationStatus: acmTypes.DomainStatusPendingValidation,
+			ResourceRecord:   validationRecord(domain),
+		})
+	}
+	f.cloud.certificates[arn] = &fakeCertificate{region: f.region, certificate: acmTypes.CertificateDetail{
+		CertificateArn:          aws.String(arn),
+		DomainName:              params.DomainName,
+		SubjectAlternativeNames: params.SubjectAlternativeNames,
+		DomainValidationOptions: options,
+		Status:                  acmTypes.CertificateStatusPendingValidation,
+	}}
+	f.cloud.stackTags[arn] = stackUUID(params.Tags, func(tag acmTypes.Tag) (*string, *string) { return tag.Key, tag.Value })
+	return &acm.RequestCertificateOutput{CertificateArn: aws.String(arn)}, nil
+}
+
+// DescribeCertificate validates the domains whose validation record is in route53, like acm does in the background.
+func (f *fakeRegion) DescribeCertificate(_ context.Context, params *acm.DescribeCertificateInput, _ ...func(*acm.Options)) (*acm.DescribeCertificateOutput, error) {
+	err := f.begin("ACM.DescribeCertificate")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	certificate, ok := f.cloud.certificates[*params.CertificateArn]
+	if !ok || certificate.region != f.region {
+		return nil, fakeError("ResourceNotFoundException", "Could not find certificate %s.", *params.CertificateArn)
+	}
+	issued := true
+	for i, option := range certificate.certificate.DomainValidationOptions {
+		record := f.cloud.findRecord(*option.ResourceRecord.Name, route53Types.RRTypeCname)
+		if record != nil && isRecordSetOf(record, *option.ResourceRecord.Value) {
+			certificate.certificate.DomainValidationOptions[i].ValidationStatus = acmTypes.DomainStatusSuccess
+		} else {
+			issued = false
+		}
+	}
+	if issued {
+		certificate.certificate.Status = acmTypes.CertificateStatusIssued
+	}
+	detail := certificate.certificate
+	detail.InUseBy = f.cloud.certificateInUse(*params.CertificateArn)
+	detail.DomainValidationOptions = slices.Clone(detail.DomainValidationOptions)
+	return &acm.DescribeCertificateOutput{Certificate: &detail}, nil
+}
+
+func (f *fakeRegion) ListCertificates(_ context.Context, params *acm.ListCertificatesInput, _ ...func(*acm.Options)) (*acm.ListCertificatesOutput, error) {
+	err := f.begin("ACM.ListCertificates")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]acmTypes.CertificateSummary, 0)
+	for _, certificate := range f.cloud.certificates {
+		if certificate.region != f.region {
+			continue
+		}
+		if len(params.CertificateStatuses) != 0 && !slices.Contains(params.CertificateStatuses, certificate.certificate.Status) {
+			continue
+		}
+		summaries = append(summaries, acmTypes.CertificateSummary{
+			CertificateArn: certificate.certificate.CertificateArn,
+			DomainName:     certificate.certificate.DomainName,
+			Status:         certificate.certificate.Status,
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool { return *summaries[i].CertificateArn < *summaries[j].CertificateArn })
+	return &acm.ListCertificatesOutput{CertificateSummaryList: summaries}, nil
+}
+
+func (f *fakeRegion) ListTagsForCertificate(_ context.Context, params *acm.ListTagsForCertificateInput, _ ...func(*acm.Options)) (*acm.ListTagsForCertificateOutput, error) {
+	err := f.begin("ACM.ListTagsForCertificate")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	certificate, ok := f.cloud.certificates[*params.CertificateArn]
+	if !ok || certificate.region != f.region {
+		return nil, fakeError("ResourceNotFoundException", "Could not find certificate %s.", *params.CertificateArn)
+	}
+	tags := make([]acmTypes.Tag, 0)
+	if uuid := f.cloud.stackTags[*params.CertificateArn]; uuid != "" {
+		tags = append(tags,
+			acmTypes.Tag{Key: aws.String(baseTagName), Value: aws.String(baseTagValue)},
+			acmTypes.Tag{Key: aws.String(baseUUIDTagName), Value: aws.String(uuid)},
+		)
+	}
+	return &acm.ListTagsForCertificateOutput{Tags: tags}, nil
+}
+
+func (f *fakeRegion) DeleteCertificate(_ context.Context, params *acm.DeleteCertificateInput, _ ...func(*acm.Options)) (*acm.DeleteCertificateOutput, error) {
+	err := f.begin("ACM.DeleteCertificate")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	certificate, ok := f.cloud.certificates[*params.CertificateArn]
+	if !ok || certificate.region != f.region {
+		return nil, fakeError("ResourceNotFoundException", "Could not find certificate %s.", *params.CertificateArn)
+	}
+	if inUse := f.cloud.certificateInUse(*params.CertificateArn); len(inUse) != 0 {
+		return nil, fakeError("ResourceInUseException", "Certificate %s in use by %s", *params.CertificateArn, strings.Join(inUse, ", "))
+	}
+	delete(f.cloud.certificates, *params.CertificateArn)
+	return &acm.DeleteCertificateOutput{}, nil
+}
+
+// route53
+
+func (f *fakeRegion) ListHostedZones(_ context.Context, params *route53.ListHostedZonesInput, _ ...func(*route53.Options)) (*route53.ListHostedZonesOutput, error) {
+	err := f.begin("Route53.ListHostedZones")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	zones := make([]route53Types.HostedZone, 0)
+	for _, zone := range f.cloud.hostedZones {
+		zones = append(zones, zone.zone)
+	}
+	sort.Slice(zones, func(i, j int) bool { return *zones[i].Id < *zones[j].Id })
+	// the marker is the id of the first zone of the page
+	start := 0
+	if params.Marker != nil {
+		start = slices.IndexFunc(zones, func(zone route53Types.HostedZone) bool { return *zone.Id == *params.Marker })
+		if start == -1 {
+			return nil, fakeError("InvalidInput", "Invalid marker %s", *params.Marker)
+		}
+	}
+	pageSize := 100
+	if params.MaxItems != nil {
+		pageSize = int(*params.MaxItems)
+	} else if f.cloud.hostedZonePageSize != 0 {
+		pageSize = f.cloud.hostedZonePageSize
+	}
+	output := &route53.ListHostedZonesOutput{HostedZones: zones[start:], MaxItems: aws.Int32(int32(pageSize))}
+	if len(zones)-start > pageSize {
+		output.HostedZones = zones[start : start+pageSize]
+		output.IsTruncated = true
+		output.NextMarker = zones[start+pageSize].Id
+	}
+	return output, nil
+}
+
+func (f *fakeRegion) CreateHostedZone(_ context.Context, params *route53.CreateHostedZoneInput, _ ...func(*route53.Options)) (*route53.CreateHostedZoneOutput, error) {
+	err := f.begin("Route53.CreateHostedZone")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	if params.CallerReference == nil || *params.CallerReference == "" {
+		return nil, fakeError("InvalidInput", "CallerReference is required")
+	}
+	id := f.cloud.newHostedZone(*params.Name)
+	zone := f.cloud.hostedZones[id]
+	return &route53.CreateHostedZoneOutput{
+		HostedZone:    &zone.zone,
+		DelegationSet: &route53Types.DelegationSet{NameServers: slices.Clone(zone.nameServers)},
+		Location:      aws.String("https://route53.amazonaws.com/2013-04-01/hostedzone/" + id),
+	}, nil
+}
+
+func (f *fakeRegion) GetHostedZone(_ context.Context, params *route53.GetHostedZoneInput, _ ...func(*route53.Options)) (*route53.GetHostedZoneOutput, error) {
+	err := f.begin("Route53.GetHostedZone")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	zone, err := f.hostedZone(params.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &route53.GetHostedZoneOutput{
+		HostedZone:    &zone.zone,
+		DelegationSet: &route53Types.DelegationSet{NameServers: slices.Clone(zone.nameServers)},
+	}, nil
+}
+
+func (f *fakeRegion) hostedZone(id *string) (*fakeHostedZone, error) {
+	zone, ok := f.cloud.hostedZones[strings.TrimPrefix(*id, "/hostedzone/")]
+	if !ok {
+		return nil, fakeError("NoSuchHostedZone", "No hosted zone found with ID: %s", *id)
+	}
+	return zone, nil
+}
+
+func (f *fakeRegion) ListResourceRecordSets(_ context.Context, params *route53.ListResourceRecordSetsInput, _ ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error) {
+	err := f.begin("Route53.ListResourceRecordSets")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	zone, err := f.hostedZone(params.HostedZoneId)
+	if err != nil {
+		return nil, err
+	}
+	records := slices.Clone(zone.records)
+	sort.Slice(records, func(i, j int) bool {
+		if *records[i].Name != *records[j].Name {
+			return *records[i].Name < *records[j].Name
+		}
+		return records[i].Type < records[j].Type
+	})
+	start := 0
+	if params.StartRecordName != nil {
+		start = len(records)
+		for i, record := range records {
+			if *record.Name > fqdn(*params.StartRecordName) ||
+				(*record.Name == fqdn(*params.StartRecordName) && (params.StartRecordType == "" || record.Type >= params.StartRecordType)) {
+				start = i
+				break
+			}
+		}
+	}
+	records = records[start:]
+	output := &route53.ListResourceRecordSetsOutput{}
+	if params.MaxItems != nil && int(*params.MaxItems) < len(records) {
+		output.IsTruncated = true
+		output.NextRecordName = records[*params.MaxItems].Name
+		output.NextRecordType = records[*params.MaxItems].Type
+		records = records[:*params.MaxItems]
+	}
+	output.ResourceRecordSets = records
+	return output, nil
+}
+
+func (f *fakeRegion) ChangeResourceRecordSets(_ context.Context, params *route53.ChangeResourceRecordSetsInput, _ ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error) {
+	err := f.begin("Route53.ChangeResourceRecordSets")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	zone, err := f.hostedZone(params.HostedZoneId)
+	if err != nil {
+		return nil, err
+	}
+	// a batch is applied completely or not at all
+	records := slices.Clone(zone.records)
+	for _, change := range params.ChangeBatch.Changes {
+		record := *change.ResourceRecordSet
+		record.Name = aws.String(fqdn(*record.Name))
+		if !strings.HasSuffix(*record.Name, *zone.zone.Name) {
+			return nil, fakeError("InvalidChangeBatch", "RRSet with DNS name %s is not permitted in zone %s", *record.Name, *zone.zone.Name)
+		}
+		index := slices.IndexFunc(records, func(existing route53Types.ResourceRecordSet) bool {
+			return *existing.Name == *record.Name && existing.Type == record.Type
+		})
+		switch change.Action {
+		case route53Types.ChangeActionCreate:
+			if index != -1 {
+				return nil, fakeError("InvalidChangeBatch", "Tried to create resource record set %s type %s but it already exists", *record.Name, record.Type)
+			}
+			records = append(records, record)
+		case route53Types.ChangeActionUpsert:
+			if index != -1 {
+				records[index] = record
+			} else {
+				records = append(records, record)
+			}
+		case route53Types.ChangeActionDelete:
+			if index == -1 {
+				return nil, fakeError("InvalidChangeBatch", "Tried to delete resource record set %s type %s but it was not found", *record.Name, record.Type)
+			}
+			records = slices.Delete(records, index, index+1)
+		}
+	}
+	zone.records = records
+	return &route53.ChangeResourceRecordSetsOutput{ChangeInfo: &route53Types.ChangeInfo{
+		Id:     aws.String(fmt.Sprintf("/change/C%d", f.nextId())),
+		Status: route53Types.ChangeStatusInsync,
+	}}, nil
+}
+
+// s3
+
+func (f *fakeRegion) bucket(name *string) (*fakeBucket, error) {
+	bucket, ok := f.cloud.buckets[*name]
+	if !ok {
+		return nil, fakeError("NoSuchBucket", "The specified bucket does not exist")
+	}
+	return bucket, nil
+}
+
+func (f *fakeRegion) CreateBucket(_ context.Context, params *s3.CreateBucketInput, _ ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	err := f.begin("S3.CreateBucket")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := f.cloud.buckets[*params.Bucket]; ok {
+		return nil, fakeError("BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it.")
+	}
+	constraint := ""
+	if params.CreateBucketConfiguration != nil {
+		constraint = string(params.CreateBucketConfiguration.LocationConstraint)
+	}
+	if f.region == "us-east-1" && constraint != "" {
+		return nil, fakeError("InvalidLocationConstraint", "The specified location-constraint is not valid")
+	} else if f.region != "us-east-1" && constraint != f.region {
+		return nil, fakeError("IllegalLocationConstraintException", "The %s location constraint is incompatible for the region specific endpoint this request was sent to.", constraint)
+	}
+	f.cloud.buckets[*params.Bucket] = &fakeBucket{region: f.region, publicBlocked: true, objects: make(map[string][]byte)}
+	return &s3.CreateBucketOutput{Location: aws.String("/" + *params.Bucket)}, nil
+}
+
+func (f *fakeRegion) DeleteBucket(_ context.Context, params *s3.DeleteBucketInput, _ ...func(*s3.Options)) (*s3.DeleteBucketOutput, error) {
+	err := f.begin("S3.DeleteBucket")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := f.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if len(bucket.objects) != 0 {
+		return nil, fakeError("BucketNotEmpty", "The bucket you tried to delete is not empty")
+	}
+	delete(f.cloud.buckets, *params.Bucket)
+	delete(f.cloud.stackTags, "arn:aws:s3:::"+*params.Bucket)
+	return &s3.DeleteBucketOutput{}, nil
+}
+
+func (f *fakeRegion) PutBucketTagging(_ context.Context, params *s3.PutBucketTaggingInput, _ ...func(*s3.Options)) (*s3.PutBucketTaggingOutput, error) {
+	err := f.begin("S3.PutBucketTagging")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := f.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	bucket.tags = params.Tagging.TagSet
+	f.cloud.stackTags["arn:aws:s3:::"+*params.Bucket] = stackUUID(bucket.tags, func(tag s3Types.Tag) (*string, *string) { return tag.Key, tag.Value })
+	return &s3.PutBucketTaggingOutput{}, nil
+}
+
+func (f *fakeRegion) GetBucketTagging(_ context.Context, params *s3.GetBucketTaggingInput, _ ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error) {
+	err := f.begin("S3.GetBucketTagging")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := f.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if len(bucket.tags) == 0 {
+		return nil, fakeError("NoSuchTagSet", "The TagSet does not exist")
+	}
+	return &s3.GetBucketTaggingOutput{TagSet: slices.Clone(bucket.tags)}, nil
+}
+
+func (f *fakeRegion) DeletePublicAccessBlock(_ context.Context, params *s3.DeletePublicAccessBlockInput, _ ...func(*s3.Options)) (*s3.DeletePublicAccessBlockOutput, error) {
+	err := f.begin("S3.DeletePublicAccessBlock")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := f.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	bucket.publicBlocked = false
+	return &s3.DeletePublicAccessBlockOutput{}, nil
+}
+
+func (f *fakeRegion) PutBucketPolicy(_ context.Context, params *s3.PutBucketPolicyInput, _ ...func(*s3.Options)) (*s3.PutBucketPolicyOutput, error) {
+	err := f.begin("S3.PutBucketPolicy")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := f.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if bucket.publicBlocked {
+		return nil, fakeError("AccessDenied", "public policies are blocked by the BlockPublicPolicy block public access setting")
+	}
+	bucket.policy = *params.Policy
+	return &s3.PutBucketPolicyOutput{}, nil
+}
+
+func (f *fakeRegion) PutBucketWebsite(_ context.Context, params *s3.PutBucketWebsiteInput, _ ...func(*s3.Options)) (*s3.PutBucketWebsiteOutput, error) {
+	err := f.begin("S3.PutBucketWebsite")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := f.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	bucket.website = params.WebsiteConfiguration
+	return &s3.PutBucketWebsiteOutput{}, nil
+}
+
+func (f *fakeRegion) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	err := f.begin("S3.PutObject")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := f.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	bucket.objects[*params.Key] = nil
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeRegion) ListObjectsV2(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	err := f.begin("S3.ListObjectsV2")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := f.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	contents := make([]s3Types.Object, 0)
+	for key := range bucket.objects {
+		contents = append(contents, s3Types.Object{Key: aws.String(key)})
+	}
+	return &s3.ListObjectsV2Output{Contents: contents, IsTruncated: aws.Bool(false)}, nil
+}
+
+func (f *fakeRegion) ListObjectVersions(_ context.Context, params *s3.ListObjectVersionsInput, _ ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	err := f.begin("S3.ListObjectVersions")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := f.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]s3Types.ObjectVersion, 0)
+	for key := range bucket.objects {
+		versions = append(versions, s3Types.ObjectVersion{Key: aws.String(key), VersionId: aws.String("null")})
+	}
+	return &s3.ListObjectVersionsOutput{Versions: versions, IsTruncated: aws.Bool(false)}, nil
+}
+
+func (f *fakeRegion) DeleteObject(_ context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	err := f.begin("S3.DeleteObject")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := f.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	delete(bucket.objects, *params.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// cloudfront
+
+func (f *fakeRegion) distribution(id *string) (*fakeDistribution, error) {
+	distribution, ok := f.cloud.distributions[*id]
+	if !ok {
+		return nil, fakeError("NoSuchDistribution", "The specified distribution does not exist.")
+	}
+	return distribution, nil
+}
+
+func (f *fakeRegion) CreateDistributionWithTags(_ context.Context, params *cloudfront.CreateDistributionWithTagsInput, _ ...func(*cloudfront.Options)) (*cloudfront.CreateDistributionWithTagsOutput, error) {
+	err := f.begin("CloudFront.CreateDistributionWithTags")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	config := *params.DistributionConfigWithTags.DistributionConfig
+	certificateArn := aws.ToString(config.ViewerCertificate.ACMCertificateArn)
+	certificate, ok := f.cloud.certificates[certificateArn]
+	if !ok || certificate.region != "us-east-1" || certificate.certificate.Status != acmTypes.CertificateStatusIssued {
+		return nil, fakeError("InvalidViewerCertificate", "The specified SSL certificate doesn't exist, isn't in us-east-1 region, isn't valid, or doesn't include a valid certificate chain.")
+	}
+	for _, existing := range f.cloud.distributions {
+		for _, alias := range existing.distribution.DistributionConfig.Aliases.Items {
+			if slices.Contains(config.Aliases.Items, alias) {
+				return nil, fakeError("CNAMEAlreadyExists", "One or more of the CNAMEs you provided are already associated with a different resource.")
+			}
+		}
+	}
+	id := fmt.Sprintf("E%dFAKE", f.nextId())
+	distribution := cloudfrontTypes.Distribution{
+		ARN:                aws.String(fmt.Sprintf("arn:aws:cloudfront::%s:distribution/%s", fakeAccountId, id)),
+		Id:                 aws.String(id),
+		DomainName:         aws.String(strings.ToLower(id) + ".cloudfront.net"),
+		Status:             aws.String("Deployed"),
+		DistributionConfig: &config,
+	}
+	f.cloud.distributions[id] = &fakeDistribution{distribution: distribution, etag: fmt.Sprintf("ETAG%d", f.nextId())}
+	f.cloud.stackTags[*distribution.ARN] = stackUUID(params.DistributionConfigWithTags.Tags.Items,
+		func(tag cloudfrontTypes.Tag) (*string, *string) { return tag.Key, tag.Value })
+	return &cloudfront.CreateDistributionWithTagsOutput{Distribution: &distribution, ETag: aws.String(f.cloud.distributions[id].etag)}, nil
+}
+
+func (f *fakeRegion) GetDistribution(_ context.Context, params *cloudfront.GetDistributionInput, _ ...func(*cloudfront.Options)) (*cloudfront.GetDistributionOutput, error) {
+	err := f.begin("CloudFront.GetDistribution")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	distribution, err := f.distribution(params.Id)
+	if err != nil {
+		return nil, err
+	}
+	copied := distribution.distribution
+	config := *copied.DistributionConfig
+	copied.DistributionConfig = &config
+	return &cloudfront.GetDistributionOutput{Distribution: &copied, ETag: aws.String(distribution.etag)}, nil
+}
+
+func (f *fakeRegion) GetDistributionConfig(_ context.Context, params *cloudfront.GetDistributionConfigInput, _ ...func(*cloudfront.Options)) (*cloudfront.GetDistributionConfigOutput, error) {
+	err := f.begin("CloudFront.GetDistributionConfig")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	distribution, err := f.distribution(params.Id)
+	if err != nil {
+		return nil, err
+	}
+	config := *distribution.distribution.DistributionConfig
+	return &cloudfront.GetDistributionConfigOutput{DistributionConfig: &config, ETag: aws.String(distribution.etag)}, nil
+}
+
+func (f *fakeRegion) UpdateDistribution(_ context.Context, params *cloudfront.UpdateDistributionInput, _ ...func(*cloudfront.Options)) (*cloudfront.UpdateDistributionOutput, error) {
+	err := f.begin("CloudFront.UpdateDistribution")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	distribution, err := f.distribution(params.Id)
+	if err != nil {
+		return nil, err
+	}
+	if aws.ToString(params.IfMatch) != distribution.etag {
+		return nil, fakeError("PreconditionFailed", "The If-Match version is missing or not valid for the resource.")
+	}
+	config := *params.DistributionConfig
+	distribution.distribution.DistributionConfig = &config
+	distribution.etag = fmt.Sprintf("ETAG%d", f.nextId())
+	copied := distribution.distribution
+	return &cloudfront.UpdateDistributionOutput{Distribution: &copied, ETag: aws.String(distribution.etag)}, nil
+}
+
+func (f *fakeRegion) DeleteDistribution(_ context.Context, params *cloudfront.DeleteDistributionInput, _ ...func(*cloudfront.Options)) (*cloudfront.DeleteDistributionOutput, error) {
+	err := f.begin("CloudFront.DeleteDistribution")
+	defer f.end()
+	if err != nil {
+		return nil, err
+	}
+	distribution, err := f.distribution(params.Id)
+	if err != nil {
+		return nil, err
+	}
+	if aws.ToString(params.IfMatch) != distribution.etag {
+		return nil, fakeError("PreconditionFailed", "The If-Match version is missing or not valid for the resource.")
+	}
+	if aws.ToBool(distribution.distribution.DistributionConfig.Enabled) {
+		return nil, fakeError("DistributionNotDisabled", "The distribution you are trying to delete has not been disabled.")
+	}
+	delete(f.cloud.distributions, *params.Id)
+	delete(f.cloud.stackTags, *distribution.distribution.ARN)
+	return &cloudfront.DeleteDistributionOutput{}, nil
+}
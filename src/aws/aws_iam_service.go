@@ -0,0 +1,636 @@
+package aws
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"io"
+	"strings"
+)
+
+//go:embed embed/deploy_policy
+var deployPolicy string
+
+//go:embed embed/github_oidc_trust_policy
+var githubOIDCTrustPolicy string
+
+//go:embed embed/ecs_tasks_trust_policy
+var ecsTasksTrustPolicy string
+
+//go:embed embed/ec2_trust_policy
+var ec2TrustPolicy string
+
+const iamPath string = "/cloudGun/"
+const deployPolicyName string = "cloudGun-deploy"
+const githubOIDCUrl string = "https://token.actions.githubusercontent.com"
+
+// the instance profile the ecs console creates. a cluster uses it when the account has it, and one of its own otherwise
+const ecsInstanceProfileName string = "ecsInstanceRole"
+
+// managed policies of the roles of a stack
+const (
+	ecsInstancePolicyArn      string = "arn:aws:iam::aws:policy/service-role/AmazonEC2ContainerServiceforEC2Role"
+	ecsTaskExecutionPolicyArn string = "arn:aws:iam::aws:policy/service-role/AmazonECSTaskExecutionRolePolicy"
+)
+
+// https://github.blog/changelog/2023-06-27-github-actions-update-on-oidc-integration-with-aws/
+var githubOIDCThumbprints = []string{"6938fd4d98bab03faadb97b34396831e3780aea1", "1c58a3a8518e8759bf075b76b750d4f2df264fcd"}
+
+func initIAMClient(region *string) (IAMAPI, error) {
+	return clients.IAM(region)
+}
+
+func initSTSClient(region *string) (STSAPI, error) {
+	return clients.STS(region, nil)
+}
+
+func getAccountId(region *string) (*string, error) {
+	client, err := initSTSClient(region)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, err
+	}
+	return identity.Account, nil
+}
+
+func getDeployPolicy(region *string, accountId *string, target *DeployTarget) string {
+	replacer := strings.NewReplacer(
+		"$REGION", *region,
+		"$ACCOUNT_ID", *accountId,
+		"$BUCKET_NAME", target.BucketName,
+		"$DISTRIBUTION_ID", target.DistributionId,
+		"$ECR_NAME", target.ECRName,
+		"$CLUSTER_NAME", target.ClusterName,
+		"$SERVICE_NAME", target.ServiceName,
+		"$EXECUTION_ROLE_NAME", ExecutionRoleName(target.ClusterName),
+		"$TASK_ROLE_NAME", TaskRoleName(target.ClusterName),
+	)
+	return replacer.Replace(deployPolicy)
+}
+
+func createIAMUser(progress io.Writer, region *string, name *string) error {
+	client, err := initIAMClient(region)
+	if err != nil {
+		return err
+	}
+	input := iam.CreateUserInput{
+		UserName: name,
+		Path:     aws.String(iamPath),
+		Tags: []iamTypes.Tag{
+			{
+				Key:   aws.String(baseTagName),
+				Value: aws.String(baseTagValue),
+			},
+			{
+				Key:   aws.String(baseUUIDTagName),
+				Value: aws.String(BaseUUIDTagValue),
+			},
+		},
+	}
+	output, err := client.CreateUser(ctx, &input)
+	if err != nil && isAlreadyExists(err) {
+		isStackUser, err := isStackIAMUser(region, name)
+		if err != nil {
+			return err
+		} else if !isStackUser {
+			return errors.New(fmt.Sprintf("iam user %s already exists and is not tagged with %s:%s", *name, baseUUIDTagName, BaseUUIDTagValue))
+		}
+		fmt.Fprintln(progress, fmt.Sprintf("adopting existing iam user %s", *name))
+		existing, err := client.GetUser(ctx, &iam.GetUserInput{UserName: name})
+		if err != nil {
+			return err
+		}
+		return adoptResource(IAMUser, existing.User.Arn, region, map[string]string{"name": *name})
+	} else if err != nil {
+		return err
+	}
+	return recordResource(IAMUser, output.User.Arn, region, map[string]string{"name": *name})
+}
+
+func putUserPolicy(region *string, name *string, policy *string) error {
+	client, err := initIAMClient(region)
+	if err != nil {
+		return err
+	}
+	input := iam.PutUserPolicyInput{
+		UserName:       name,
+		PolicyName:     aws.String(deployPolicyName),
+		PolicyDocument: policy,
+	}
+	_, err = client.PutUserPolicy(ctx, &input)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func createAccessKey(progress io.Writer, region *string, name *string) (*DefaultCredentials, error) {
+	client, err := initIAMClient(region)
+	if err != nil {
+		return nil, err
+	}
+	// secrets of older keys can not be read again, so keys left by a previous run are rotated.
+	// the caller saves the new key again in the repositories holding the old one
+	keys, err := client.ListAccessKeys(ctx, &iam.ListAccessKeysInput{UserName: name})
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys.AccessKeyMetadata {
+		fmt.Fprintln(progress, fmt.Sprintf("deleting previous access key of iam user %s", *name))
+		err = deleteAccessKey(region, name, key.AccessKeyId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	output, err := client.CreateAccessKey(ctx, &iam.CreateAccessKeyInput{UserName: name})
+	if err != nil {
+		return nil, err
+	}
+	err = recordResource(IAMAccessKey, output.AccessKey.AccessKeyId, region, map[string]string{"user": *name})
+	if err != nil {
+		return nil, err
+	}
+	return &DefaultCredentials{
+		Region:          *region,
+		AccessKey:       *output.AccessKey.AccessKeyId,
+		SecretAccessKey: *output.AccessKey.SecretAccessKey,
+		Source:          fmt.Sprintf("iam user %s", *name),
+	}, nil
+}
+
+func deleteAccessKey(region *string, userName *string, accessKeyId *string) error {
+	client, err := initIAMClient(region)
+	if err != nil {
+		return err
+	}
+	_, err = client.DeleteAccessKey(ctx, &iam.DeleteAccessKeyInput{UserName: userName, AccessKeyId: accessKeyId})
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	return forgetResource(IAMAccessKey, *accessKeyId)
+}
+
+// waitAccessKeyActive waits until a new access key is usable. iam is eventually consistent.
+func waitAccessKeyActive(region *string, key *DefaultCredentials) error {
+	client, err := clients.STS(region, key)
+	if err != nil {
+		return err
+	}
+	return retryOn("waiting for the new access key", Timeouts.AccessKeyActive, func() error {
+		_, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		return err
+	}, ErrorAccessDenied) // the new key is not known everywhere yet
+}
+
+func isStackIAMUser(region *string, name *string) (bool, error) {
+	client, err := initIAMClient(region)
+	if err != nil {
+		return false, err
+	}
+	tags, err := client.ListUserTags(ctx, &iam.ListUserTagsInput{UserName: name})
+	if err != nil {
+		return false, err
+	}
+	for _, tag := range tags.Tags {
+		if *tag.Key == baseUUIDTagName && *tag.Value == BaseUUIDTagValue {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func listStackIAMUsers(region *string) ([]string, error) {
+	client, err := initIAMClient(region)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	paginator := iam.NewListUsersPaginator(client, &iam.ListUsersInput{PathPrefix: aws.String(iamPath)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range page.Users {
+			isStackUser, err := isStackIAMUser(region, user.UserName)
+			if err != nil {
+				return nil, err
+			}
+			if isStackUser {
+				names = append(names, *user.UserName)
+			}
+		}
+	}
+	return names, nil
+}
+
+func deleteIAMUser(region *string, name *string) error {
+	isStackUser, err := isStackIAMUser(region, name)
+	if err != nil {
+		return err
+	} else if !isStackUser {
+		return errors.New(fmt.Sprintf("iam user %s is not tagged with %s:%s", *name, baseUUIDTagName, BaseUUIDTagValue))
+	}
+	client, err := initIAMClient(region)
+	if err != nil {
+		return err
+	}
+
+	keys, err := client.ListAccessKeys(ctx, &iam.ListAccessKeysInput{UserName: name})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys.AccessKeyMetadata {
+		_, err = client.DeleteAccessKey(ctx, &iam.DeleteAccessKeyInput{UserName: name, AccessKeyId: key.AccessKeyId})
+		if err != nil {
+			return err
+		}
+	}
+
+	policies, err := client.ListUserPolicies(ctx, &iam.ListUserPoliciesInput{UserName: name})
+	if err != nil {
+		return err
+	}
+	for _, policyName := range policies.PolicyNames {
+		_, err = client.DeleteUserPolicy(ctx, &iam.DeleteUserPolicyInput{UserName: name, PolicyName: aws.String(policyName)})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = client.DeleteUser(ctx, &iam.DeleteUserInput{UserName: name})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// getGithubOIDCProvider returns the github actions identity provider of the account, creating it when missing.
+// the provider is shared by every stack of the account so it is never deleted by cloudGun.
+func getGithubOIDCProvider(region *string) (*string, error) {
+	client, err := initIAMClient(region)
+	if err != nil {
+		return nil, err
+	}
+	providers, err := client.ListOpenIDConnectProviders(ctx, &iam.ListOpenIDConnectProvidersInput{})
+	if err != nil {
+		return nil, err
+	}
+	host := strings.TrimPrefix(githubOIDCUrl, "https://")
+	for _, provider := range providers.OpenIDConnectProviderList {
+		if strings.HasSuffix(*provider.Arn, "oidc-provider/"+host) {
+			return provider.Arn, nil
+		}
+	}
+	input := iam.CreateOpenIDConnectProviderInput{
+		Url:            aws.String(githubOIDCUrl),
+		ClientIDList:   []string{"sts.amazonaws.com"},
+		ThumbprintList: githubOIDCThumbprints,
+		Tags: []iamTypes.Tag{
+			{
+				Key:   aws.String(baseTagName),
+				Value: aws.String(baseTagValue),
+			},
+		},
+	}
+	provider, err := client.CreateOpenIDConnectProvider(ctx, &input)
+	if err != nil {
+		return nil, err
+	}
+	// every stack of the account uses it, so a rollback keeps it
+	err = adoptResource(IAMOIDCProvider, provider.OpenIDConnectProviderArn, region, map[string]string{"shared": "true"})
+	if err != nil {
+		return nil, err
+	}
+	return provider.OpenIDConnectProviderArn, nil
+}
+
+func getGithubOIDCTrustPolicy(providerArn *string, subjects *[]string) (string, error) {
+	subjectsJson, err := json.Marshal(*subjects)
+	if err != nil {
+		return "", err
+	}
+	replacer := strings.NewReplacer(
+		"$PROVIDER_ARN", *providerArn,
+		"$SUBJECTS", string(subjectsJson),
+	)
+	return replacer.Replace(githubOIDCTrustPolicy), nil
+}
+
+func createIAMRole(progress io.Writer, region *string, name *string, trustPolicy *string) (*string, error) {
+	client, err := initIAMClient(region)
+	if err != nil {
+		return nil, err
+	}
+	input := iam.CreateRoleInput{
+		RoleName:                 name,
+		Path:                     aws.String(iamPath),
+		AssumeRolePolicyDocument: trustPolicy,
+		Tags: []iamTypes.Tag{
+			{
+				Key:   aws.String(baseTagName),
+				Value: aws.String(baseTagValue),
+			},
+			{
+				Key:   aws.String(baseUUIDTagName),
+				Value: aws.String(BaseUUIDTagValue),
+			},
+		},
+	}
+	role, err := client.CreateRole(ctx, &input)
+	if err != nil && isAlreadyExists(err) {
+		isStackRole, err := isStackIAMRole(region, name)
+		if err != nil {
+			return nil, err
+		} else if !isStackRole {
+			return nil, errors.New(fmt.Sprintf("iam role %s already exists and is not tagged with %s:%s", *name, baseUUIDTagName, BaseUUIDTagValue))
+		}
+		fmt.Fprintln(progress, fmt.Sprintf("adopting existing iam role %s", *name))
+		_, err = client.UpdateAssumeRolePolicy(ctx, &iam.UpdateAssumeRolePolicyInput{RoleName: name, PolicyDocument: trustPolicy})
+		if err != nil {
+			return nil, err
+		}
+		existing, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: name})
+		if err != nil {
+			return nil, err
+		}
+		err = adoptResource(IAMRole, existing.Role.Arn, region, map[string]string{"name": *name})
+		if err != nil {
+			return nil, err
+		}
+		return existing.Role.Arn, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = recordResource(IAMRole, role.Role.Arn, region, map[string]string{"name": *name})
+	if err != nil {
+		return nil, err
+	}
+	return role.Role.Arn, nil
+}
+
+func putRolePolicy(region *string, name *string, policyName *string, policy *string) error {
+	client, err := initIAMClient(region)
+	if err != nil {
+		return err
+	}
+	input := iam.PutRolePolicyInput{
+		RoleName:       name,
+		PolicyName:     policyName,
+		PolicyDocument: policy,
+	}
+	_, err = client.PutRolePolicy(ctx, &input)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func attachRolePolicy(region *string, name *string, policyArn *string) error {
+	client, err := initIAMClient(region)
+	if err != nil {
+		return err
+	}
+	_, err = client.AttachRolePolicy(ctx, &iam.AttachRolePolicyInput{RoleName: name, PolicyArn: policyArn})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ExecutionRoleName is the role ecs pulls the image and writes the logs of the tasks of a cluster with.
+func ExecutionRoleName(clusterName string) string {
+	return clusterName + "-execution"
+}
+
+// TaskRoleName is the role the application of the tasks of a cluster calls aws with.
+func TaskRoleName(clusterName string) string {
+	return clusterName + "-task"
+}
+
+// InstanceRoleName is the role of the container instances of a cluster, when the account has no ecsInstanceRole.
+func InstanceRoleName(clusterName string) string {
+	return clusterName + "-instance"
+}
+
+// getInstanceProfile returns the instance profile of name, nil when there is none.
+func getInstanceProfile(region *string, name *string) (*iamTypes.InstanceProfile, error) {
+	client, err := initIAMClient(region)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := client.GetInstanceProfile(ctx, &iam.GetInstanceProfileInput{InstanceProfileName: name})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return profile.InstanceProfile, nil
+}
+
+// createInstanceProfile creates an instance profile of the role with the same name. it is deleted with the role.
+func createInstanceProfile(region *string, name *string) error {
+	client, err := initIAMClient(region)
+	if err != nil {
+		return err
+	}
+	profile, err := getInstanceProfile(region, name)
+	if err != nil {
+		return err
+	}
+	if profile == nil {
+		input := iam.CreateInstanceProfileInput{
+			InstanceProfileName: name,
+			Path:                aws.String(iamPath),
+			Tags: []iamTypes.Tag{
+				{
+					Key:   aws.String(baseTagName),
+					Value: aws.String(baseTagValue),
+				},
+				{
+					Key:   aws.String(baseUUIDTagName),
+					Value: aws.String(BaseUUIDTagValue),
+				},
+			},
+		}
+		output, err := client.CreateInstanceProfile(ctx, &input)
+		if err != nil {
+			return err
+		}
+		profile = output.InstanceProfile
+	} else if *profile.Path != iamPath {
+		return errors.New(fmt.Sprintf("instance profile %s already exists and is not one of cloudGun", *name))
+	}
+	for _, role := range profile.Roles {
+		if *role.RoleName == *name {
+			return nil
+		}
+	}
+	_, err = client.AddRoleToInstanceProfile(ctx, &iam.AddRoleToInstanceProfileInput{InstanceProfileName: name, RoleName: name})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ensureECSInstanceProfile returns the ecsInstanceRole of the account, or creates an instance profile of the stack
+// when the account has none.
+func ensureECSInstanceProfile(progress io.Writer, region *string, clusterName *string) (*string, error) {
+	profile, err := getInstanceProfile(region, aws.String(ecsInstanceProfileName))
+	if err != nil {
+		return nil, err
+	}
+	if profile != nil && len(profile.Roles) != 0 {
+		fmt.Fprintln(progress, fmt.Sprintf("using instance profile %s of the account", ecsInstanceProfileName))
+		return aws.String(ecsInstanceProfileName), nil
+	}
+	name := InstanceRoleName(*clusterName)
+	_, err = createIAMRole(progress, region, &name, &ec2TrustPolicy)
+	if err != nil {
+		return nil, err
+	}
+	err = attachRolePolicy(region, &name, aws.String(ecsInstancePolicyArn))
+	if err != nil {
+		return nil, err
+	}
+	err = createInstanceProfile(region, &name)
+	if err != nil {
+		return nil, err
+	}
+	// the launch template refuses a profile iam has not propagated yet
+	err = waitInstanceProfileExists(region, &name)
+	if err != nil {
+		return nil, err
+	}
+	return &name, nil
+}
+
+// waitInstanceProfileExists waits until a new instance profile can be read. iam is eventually consistent.
+func waitInstanceProfileExists(region *string, name *string) error {
+	client, err := initIAMClient(region)
+	if err != nil {
+		return err
+	}
+	waiter := iam.NewInstanceProfileExistsWaiter(client)
+	return waiter.Wait(ctx, &iam.GetInstanceProfileInput{InstanceProfileName: name}, Timeouts.RolesPropagated)
+}
+
+// waitRoleExists waits until a new role can be read, before a task definition or a service refers to it.
+func waitRoleExists(region *string, name *string) error {
+	client, err := initIAMClient(region)
+	if err != nil {
+		return err
+	}
+	waiter := iam.NewRoleExistsWaiter(client)
+	return waiter.Wait(ctx, &iam.GetRoleInput{RoleName: name}, Timeouts.RolesPropagated)
+}
+
+func isStackIAMRole(region *string, name *string) (bool, error) {
+	client, err := initIAMClient(region)
+	if err != nil {
+		return false, err
+	}
+	tags, err := client.ListRoleTags(ctx, &iam.ListRoleTagsInput{RoleName: name})
+	if err != nil {
+		return false, err
+	}
+	for _, tag := range tags.Tags {
+		if *tag.Key == baseUUIDTagName && *tag.Value == BaseUUIDTagValue {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func listStackIAMRoles(region *string) ([]string, error) {
+	client, err := initIAMClient(region)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	paginator := iam.NewListRolesPaginator(client, &iam.ListRolesInput{PathPrefix: aws.String(iamPath)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, role := range page.Roles {
+			isStackRole, err := isStackIAMRole(region, role.RoleName)
+			if err != nil {
+				return nil, err
+			}
+			if isStackRole {
+				names = append(names, *role.RoleName)
+			}
+		}
+	}
+	return names, nil
+}
+
+func deleteIAMRole(region *string, name *string) error {
+	isStackRole, err := isStackIAMRole(region, name)
+	if err != nil {
+		return err
+	} else if !isStackRole {
+		return errors.New(fmt.Sprintf("iam role %s is not tagged with %s:%s", *name, baseUUIDTagName, BaseUUIDTagValue))
+	}
+	client, err := initIAMClient(region)
+	if err != nil {
+		return err
+	}
+
+	policies, err := client.ListRolePolicies(ctx, &iam.ListRolePoliciesInput{RoleName: name})
+	if err != nil {
+		return err
+	}
+	for _, policyName := range policies.PolicyNames {
+		_, err = client.DeleteRolePolicy(ctx, &iam.DeleteRolePolicyInput{RoleName: name, PolicyName: aws.String(policyName)})
+		if err != nil {
+			return err
+		}
+	}
+
+	attached, err := client.ListAttachedRolePolicies(ctx, &iam.ListAttachedRolePoliciesInput{RoleName: name})
+	if err != nil {
+		return err
+	}
+	for _, policy := range attached.AttachedPolicies {
+		_, err = client.DetachRolePolicy(ctx, &iam.DetachRolePolicyInput{RoleName: name, PolicyArn: policy.PolicyArn})
+		if err != nil {
+			return err
+		}
+	}
+
+	// the instance profiles cloudGun created for the role go with it
+	profiles, err := client.ListInstanceProfilesForRole(ctx, &iam.ListInstanceProfilesForRoleInput{RoleName: name})
+	if err != nil {
+		return err
+	}
+	for _, profile := range profiles.InstanceProfiles {
+		_, err = client.RemoveRoleFromInstanceProfile(ctx, &iam.RemoveRoleFromInstanceProfileInput{InstanceProfileName: profile.InstanceProfileName, RoleName: name})
+		if err != nil {
+			return err
+		}
+		if *profile.Path == iamPath {
+			_, err = client.DeleteInstanceProfile(ctx, &iam.DeleteInstanceProfileInput{InstanceProfileName: profile.InstanceProfileName})
+			if err != nil && !isNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	_, err = client.DeleteRole(ctx, &iam.DeleteRoleInput{RoleName: name})
+	if err != nil {
+		return err
+	}
+	return nil
+}
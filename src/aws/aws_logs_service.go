@@ -0,0 +1,183 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	logsTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"io"
+	"strings"
+	"time"
+)
+
+// LogRetentionDays are the retentions cloudwatch logs accepts
+var LogRetentionDays = []int32{1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1096, 1827, 2192, 2557, 2922, 3288, 3653}
+
+// the stream prefix of the awslogs driver, streams are named ecs/<container>/<task id>
+const logStreamPrefix = "ecs"
+
+// logPollInterval is how often FollowLogs asks for new events
+var logPollInterval = 2 * time.Second
+
+// LogFilter selects the events FollowLogs prints.
+type LogFilter struct {
+	Since   time.Time
+	Pattern string // a cloudwatch filter pattern, every event when empty
+}
+
+func initLogsClient(region *string) (LogsAPI, error) {
+	return clients.Logs(region)
+}
+
+// LogGroupName is the log group the containers of a task family write to.
+func LogGroupName(taskFamilyName string) string {
+	return "/ecs/" + taskFamilyName
+}
+
+func createLogGroup(progress io.Writer, region *string, name *string, retentionDays *int32) error {
+	client, err := initLogsClient(region)
+	if err != nil {
+		return err
+	}
+	existing, err := findLogGroup(region, name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		fmt.Fprintln(progress, fmt.Sprintf("adopting existing log group %s", *name))
+		err = adoptResource(LogsLogGroup, existing.LogGroupArn, region, map[string]string{"name": *name})
+		if err != nil {
+			return err
+		}
+	} else {
+		_, err = client.CreateLogGroup(ctx, &cloudwatchlogs.CreateLogGroupInput{
+			LogGroupName: name,
+			Tags: map[string]string{
+				baseTagName:     baseTagValue,
+				baseUUIDTagName: BaseUUIDTagValue,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		existing, err = findLogGroup(region, name)
+		if err != nil {
+			return err
+		} else if existing == nil {
+			return errors.New(fmt.Sprintf("log group %s is not found after it is created", *name))
+		}
+		err = recordResource(LogsLogGroup, existing.LogGroupArn, region, map[string]string{"name": *name})
+		if err != nil {
+			return err
+		}
+	}
+	// log groups keep their events forever without a retention
+	_, err = client.PutRetentionPolicy(ctx, &cloudwatchlogs.PutRetentionPolicyInput{
+		LogGroupName:    name,
+		RetentionInDays: retentionDays,
+	})
+	return err
+}
+
+// findLogGroup returns the log group of the exact name, nil when there is none.
+func findLogGroup(region *string, name *string) (*logsTypes.LogGroup, error) {
+	client, err := initLogsClient(region)
+	if err != nil {
+		return nil, err
+	}
+	paginator := cloudwatchlogs.NewDescribeLogGroupsPaginator(client, &cloudwatchlogs.DescribeLogGroupsInput{LogGroupNamePrefix: name})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range page.LogGroups {
+			if *group.LogGroupName == *name {
+				return &group, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// logGroupNameOf is the name of a log group arn, with or without the :* of DescribeLogGroups.
+func logGroupNameOf(arn *string) (*string, error) {
+	arnSplit := strings.Split(*arn, ":log-group:")
+	if len(arnSplit) != 2 {
+		return nil, errors.New(fmt.Sprintf("arn %s could not be split with string :log-group:. arn is not valid", *arn))
+	}
+	name := strings.TrimSuffix(arnSplit[1], ":*")
+	return &name, nil
+}
+
+func deleteLogGroup(region *string, arn *string) error {
+	name, err := logGroupNameOf(arn)
+	if err != nil {
+		return err
+	}
+	client, err := initLogsClient(region)
+	if err != nil {
+		return err
+	}
+	_, err = client.DeleteLogGroup(ctx, &cloudwatchlogs.DeleteLogGroupInput{LogGroupName: name})
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// FollowLogs prints the events of a log group from filter.Since, then polls for new ones until the context is done.
+func FollowLogs(out io.Writer, region *string, name *string, filter LogFilter) error {
+	client, err := initLogsClient(region)
+	if err != nil {
+		return err
+	}
+	input := cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName: name,
+		StartTime:    aws.Int64(filter.Since.UnixMilli()),
+	}
+	if filter.Pattern != "" {
+		input.FilterPattern = aws.String(filter.Pattern)
+	}
+	// the events of the last millisecond show up again in the next poll, the ids keep them from being printed twice
+	seen := make(map[string]int64)
+	for {
+		lastTimestamp := *input.StartTime
+		paginator := cloudwatchlogs.NewFilterLogEventsPaginator(client, &input)
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+			for _, event := range page.Events {
+				if _, ok := seen[*event.EventId]; ok {
+					continue
+				}
+				seen[*event.EventId] = *event.Timestamp
+				lastTimestamp = max(lastTimestamp, *event.Timestamp)
+				fmt.Fprintln(out, formatLogEvent(&event))
+			}
+		}
+		input.StartTime = aws.Int64(lastTimestamp)
+		for id, timestamp := range seen {
+			if timestamp < lastTimestamp {
+				delete(seen, id)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(logPollInterval):
+		}
+	}
+}
+
+func formatLogEvent(event *logsTypes.FilteredLogEvent) string {
+	timestamp := time.UnixMilli(*event.Timestamp).UTC().Format(time.RFC3339)
+	return fmt.Sprintf("%s %s %s", timestamp, aws.ToString(event.LogStreamName), strings.TrimRight(aws.ToString(event.Message), "\n"))
+}
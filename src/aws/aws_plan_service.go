@@ -0,0 +1,275 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"slices"
+	"strings"
+)
+
+// the plans follow the Create functions of aws_service.go without calling aws. keep them in sync when a flow changes.
+
+func planned(resourceType ResourceIdentifier, name string, region *string, details map[string]string) PlannedResource {
+	return PlannedResource{Action: PlanCreate, Type: resourceType, Name: name, Region: *region, Details: details}
+}
+
+// planCertificate plans the wildcard certificate of domain and the dns record validating it. create reuses an issued
+// certificate covering domains instead when the account has one, the plan does not look for it.
+func planCertificate(domain *string, domains []string, region *string) []PlannedResource {
+	return []PlannedResource{
+		planned(CertificateManagerCertificate, *domain, region, map[string]string{
+			"domains":    strings.Join(certificateDomains(domain), ", "),
+			"covers":     strings.Join(domains, ", "),
+			"validation": "dns",
+		}),
+		// the record name is only known once acm answers, the wildcard shares the record of the domain
+		planned(Route53RecordSet, "_<acm token>."+*domain, region, map[string]string{
+			"type":  "CNAME",
+			"value": fmt.Sprintf("validation of the certificate of %s", *domain),
+		}),
+	}
+}
+
+// PlanResourceGroup lists what CreateResourceGroup creates.
+func PlanResourceGroup(name *string, region *string) []PlannedResource {
+	query := fmt.Sprintf("tags %s=%s, %s=%s", baseTagName, baseTagValue, baseUUIDTagName, BaseUUIDTagValue)
+	plan := make([]PlannedResource, 0)
+	for _, groupRegion := range stackRegions(region) {
+		plan = append(plan, planned(ResourceGroupsGroup, *name, &groupRegion, map[string]string{"query": query}))
+	}
+	return plan
+}
+
+// PlanS3Website lists what CreateS3Website creates.
+func PlanS3Website(name *string, domain *string, region *string, www bool) []PlannedResource {
+	// cloudfront only takes certificates of us-east-1
+	cloudfrontRegion := aws.String(globalRegion)
+	plan := planCertificate(domain, websiteDomains(domain, www), cloudfrontRegion)
+	plan = append(plan,
+		planned(S3Bucket, *name, region, map[string]string{
+			"website": getBucketWebsiteDomain(region, name),
+			"index":   "index.html",
+		}),
+		planned(CloudFrontDistribution, *domain, cloudfrontRegion, map[string]string{"origin": getBucketWebsiteDomain(region, name)}),
+		planned(Route53RecordSet, *domain, region, map[string]string{"type": "A", "value": "alias of the distribution of " + *domain}),
+	)
+	if !www {
+		return plan
+	}
+	wwwName := "www." + *name
+	wwwDomain := "www." + *domain
+	plan = append(plan,
+		planned(S3Bucket, wwwName, region, map[string]string{
+			"website":  getBucketWebsiteDomain(region, &wwwName),
+			"redirect": "https://" + *domain,
+		}),
+		planned(CloudFrontDistribution, wwwDomain, cloudfrontRegion, map[string]string{"origin": getBucketWebsiteDomain(region, &wwwName)}),
+		planned(Route53RecordSet, wwwDomain, region, map[string]string{"type": "A", "value": "alias of the distribution of " + wwwDomain}),
+	)
+	return plan
+}
+
+// PlanECSCluster lists what CreateECSCluster creates.
+// the task definition runs the image of ecrName, the account is only known once the stack is created.
+func PlanECSCluster(region *string, clusterName *string, taskFamilyName *string, containerName *string, ecrName *string,
+	min *int32, max *int32, desired *int32, instanceType ec2Types.InstanceType, image Image, container *ContainerSpec, launchType LaunchType) []PlannedResource {
+	containerImage := ECRImageURI("<account>", *region, *ecrName)
+	if launchType == LaunchTypeFargate {
+		taskDefinition := map[string]string{
+			"container": *containerName,
+			"image":     containerImage,
+			"network":   "awsvpc",
+			"logs":      LogGroupName(*taskFamilyName),
+			"ports":     fmt.Sprintf("%d:%d", container.ContainerPort, container.ContainerPort),
+		}
+		cpu, memory, err := FargateTaskSize(container)
+		if err == nil {
+			taskDefinition["cpu"] = fmt.Sprint(cpu)
+			taskDefinition["memory"] = fmt.Sprintf("%d MiB", memory)
+		}
+		return []PlannedResource{
+			planned(ECSCluster, *clusterName, region, map[string]string{"capacityProvider": fargateCapacityProvider}),
+			planned(ECSTaskDefinition, *taskFamilyName, region, taskDefinition),
+		}
+	}
+	ingress := "tcp 443 and 32768-65535 from anywhere"
+	if container.HostPort != 0 && container.HostPort < 32768 {
+		ingress = fmt.Sprintf("tcp 443, %d and 32768-65535 from anywhere", container.HostPort)
+	}
+	return []PlannedResource{
+		planned(EC2SecurityGroup, *clusterName, region, map[string]string{"ingress": ingress}),
+		planned(EC2LaunchTemplate, *clusterName, region, map[string]string{
+			"instanceType": string(instanceType),
+			"image":        image.name,
+		}),
+		planned(AutoScalingGroup, *clusterName, region, map[string]string{
+			"min":     fmt.Sprint(*min),
+			"max":     fmt.Sprint(*max),
+			"desired": fmt.Sprint(*desired),
+		}),
+		planned(ECSCapacityProvider, *clusterName, region, nil),
+		planned(ECSCluster, *clusterName, region, nil),
+		planned(ECSTaskDefinition, *taskFamilyName, region, map[string]string{
+			"container": *containerName,
+			"image":     containerImage,
+			"cpu":       fmt.Sprint(container.CPU),
+			"memory":    fmt.Sprintf("%d MiB", container.MemoryMiB),
+			"ports":     fmt.Sprintf("%d:%d", container.HostPort, container.ContainerPort),
+			"logs":      LogGroupName(*taskFamilyName),
+		}),
+	}
+}
+
+// PlanECSRoles lists what CreateECSRoles creates. whether the account has an ecsInstanceRole is only known once the
+// stack is created.
+func PlanECSRoles(region *string, clusterName *string, launchType LaunchType) []PlannedResource {
+	plan := make([]PlannedResource, 0)
+	if launchType != LaunchTypeFargate {
+		plan = append(plan, planned(IAMRole, InstanceRoleName(*clusterName), region, map[string]string{
+			"trust":  "ec2.amazonaws.com",
+			"policy": ecsInstancePolicyArn,
+			"when":   fmt.Sprintf("the account has no %s", ecsInstanceProfileName),
+		}))
+	}
+	plan = append(plan,
+		planned(IAMRole, ExecutionRoleName(*clusterName), region, map[string]string{
+			"trust":      "ecs-tasks.amazonaws.com",
+			"policy":     ecsTaskExecutionPolicyArn,
+			"parameters": EnvPath(*clusterName) + "*",
+		}),
+		planned(IAMRole, TaskRoleName(*clusterName), region, map[string]string{"trust": "ecs-tasks.amazonaws.com"}),
+	)
+	return plan
+}
+
+// PlanELB lists what CreateELB creates.
+func PlanELB(region *string, domain *string, targetDomain *string, albName *string, targetGroupName *string, www bool,
+	launchType LaunchType) []PlannedResource {
+	plan := planCertificate(domain, append(websiteDomains(domain, www), *targetDomain), region)
+	target := "instance HTTP 80"
+	if launchType == LaunchTypeFargate {
+		plan = append(plan, planned(EC2SecurityGroup, *albName, region, map[string]string{"ingress": "tcp 443 from anywhere"}))
+		target = "ip HTTP 80"
+	}
+	plan = append(plan,
+		planned(ElasticLoadBalancingLoadBalancer, *albName, region, map[string]string{"scheme": "internet-facing"}),
+		planned(ElasticLoadBalancingTargetGroup, *targetGroupName, region, map[string]string{"target": target}),
+		planned(ElasticLoadBalancingListener, *albName+" HTTPS 443", region, map[string]string{"forward": *targetGroupName}),
+		planned(Route53RecordSet, *targetDomain, region, map[string]string{"type": "A", "value": "alias of " + *albName}),
+	)
+	return plan
+}
+
+// PlanECSService lists what ConnectECSServiceToALB creates.
+func PlanECSService(region *string, serviceName *string, clusterName *string, taskFamilyName *string, targetGroupName *string,
+	albName *string, containerPort *int32, launchType LaunchType) []PlannedResource {
+	plan := make([]PlannedResource, 0)
+	service := map[string]string{
+		"cluster":        *clusterName,
+		"taskDefinition": *taskFamilyName,
+		"targetGroup":    *targetGroupName,
+		"desired":        "1",
+	}
+	if launchType == LaunchTypeFargate {
+		plan = append(plan, planned(EC2SecurityGroup, *serviceName+"-task", region, map[string]string{
+			"ingress": fmt.Sprintf("tcp %d from the security group of %s", *containerPort, *albName),
+		}))
+		service["launchType"] = string(ecsLaunchTypeOf(launchType))
+	}
+	return append(plan, planned(ECSService, *serviceName, region, service))
+}
+
+// PlanECR lists what CreateECR creates.
+func PlanECR(region *string, name *string) []PlannedResource {
+	return []PlannedResource{planned(ECRRepository, *name, region, map[string]string{
+		"seed": fmt.Sprintf("%s/%s:%s as %s", strings.TrimPrefix(placeholderRegistry, "https://"), placeholderRepository, placeholderTag, applicationTag),
+	})}
+}
+
+// PlanLogGroup lists what CreateLogGroup creates.
+func PlanLogGroup(region *string, name *string, retentionDays *int32) []PlannedResource {
+	return []PlannedResource{planned(LogsLogGroup, *name, region, map[string]string{
+		"retention": fmt.Sprintf("%d days", *retentionDays),
+	})}
+}
+
+// PlanDeployIdentity lists what CreateDeployRole creates with oidc and CreateDeployUser creates without.
+func PlanDeployIdentity(region *string, name *string, oidc bool) []PlannedResource {
+	if oidc {
+		return []PlannedResource{
+			planned(IAMOIDCProvider, strings.TrimPrefix(githubOIDCUrl, "https://"), region, map[string]string{
+				"note": "only when the account has none, shared by every stack",
+			}),
+			planned(IAMRole, *name, region, map[string]string{"path": iamPath, "policy": deployPolicyName}),
+		}
+	}
+	return []PlannedResource{
+		planned(IAMUser, *name, region, map[string]string{"path": iamPath, "policy": deployPolicyName}),
+		planned(IAMAccessKey, *name, region, nil),
+	}
+}
+
+// PlanDeleteResources lists what DeleteResources deletes, without deleting anything.
+func PlanDeleteResources(region *string, name *string, domain *string) ([]PlannedResource, error) {
+	found, err := findStackResources(region, name)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]StackResource, 0, len(found))
+	for _, item := range found {
+		resources = append(resources, item.resource)
+	}
+	zones, err := findStackRecordSets(region, domain, resources)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := make([]PlannedResource, 0, len(found))
+	for _, zone := range zones {
+		for _, record := range zone.records {
+			plan = append(plan, PlannedResource{
+				Action: PlanDelete,
+				Type:   Route53RecordSet,
+				Name:   strings.TrimSuffix(*record.Name, "."),
+				Region: *region,
+				Details: map[string]string{
+					"type":         string(record.Type),
+					"hostedZoneId": zone.hostedZoneId,
+				},
+			})
+		}
+	}
+	for _, item := range found {
+		if item.resource.Type == Route53RecordSet {
+			continue
+		}
+		resourceName := item.resource.Id
+		if attributeName, ok := item.resource.Attributes["name"]; ok {
+			resourceName = attributeName
+		}
+		details := map[string]string{"foundIn": item.source}
+		if resourceName != item.resource.Id {
+			details["id"] = item.resource.Id
+		}
+		plan = append(plan, PlannedResource{
+			Action:  PlanDelete,
+			Type:    item.resource.Type,
+			Name:    resourceName,
+			Region:  item.resource.Region,
+			Details: details,
+		})
+	}
+	// resource groups go last, like in deleteGraph
+	slices.SortStableFunc(plan, func(a PlannedResource, b PlannedResource) int {
+		return boolToInt(a.Type == ResourceGroupsGroup) - boolToInt(b.Type == ResourceGroupsGroup)
+	})
+	return plan, nil
+}
+
+func boolToInt(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,205 @@
+package aws
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPlanCoversCreate(t *testing.T) {
+	newTestCloud(t)
+	createTestStack(t)
+	bucketName, name := stackNames()
+	apiDomain := "main-api." + testDomain
+	var min, max, desired int32 = 1, 3, 1
+	var retentionDays int32 = 14
+	plan := PlanResourceGroup(&name, aws.String(testRegion))
+	plan = append(plan, PlanS3Website(&bucketName, aws.String(testDomain), aws.String(testRegion), true)...)
+	plan = append(plan, PlanECR(aws.String(testRegion), aws.String(testECRName()))...)
+	plan = append(plan, PlanLogGroup(aws.String(testRegion), aws.String(testLogGroupName()), &retentionDays)...)
+	plan = append(plan, PlanECSRoles(aws.String(testRegion), &name, LaunchTypeEC2)...)
+	plan = append(plan, PlanECSCluster(aws.String(testRegion), &name, &name, &name, aws.String(testECRName()), &min, &max, &desired, "t2.micro", AmazonLinux2,
+		&testContainer, LaunchTypeEC2)...)
+	plan = append(plan, PlanELB(aws.String(testRegion), aws.String(testDomain), &apiDomain, &name, &name, true, LaunchTypeEC2)...)
+	plan = append(plan, PlanECSService(aws.String(testRegion), &name, &name, &name, &name, &name, &testContainer.ContainerPort, LaunchTypeEC2)...)
+
+	for _, resource := range GetStateResources("") {
+		index := slices.IndexFunc(plan, func(planned PlannedResource) bool {
+			return planned.Type == resource.Type && planned.Region == resource.Region
+		})
+		if index == -1 {
+			t.Errorf("%s %s in %s was created but is not in the plan", resource.Type, resource.Id, resource.Region)
+		}
+	}
+	for _, planned := range plan {
+		if planned.Action != PlanCreate {
+			t.Errorf("expected %s %s to be created, got %s", planned.Type, planned.Name, planned.Action)
+		}
+	}
+}
+
+func TestPlanDeleteResources(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, cloud *fakeCloud, zoneId string)
+		check func(t *testing.T, cloud *fakeCloud, zoneId string, plan []PlannedResource)
+	}{
+		{
+			name: "lists the whole stack without deleting it",
+			setup: func(t *testing.T, cloud *fakeCloud, zoneId string) {
+				createTestStack(t)
+			},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, plan []PlannedResource) {
+				if count := cloud.liveResources(); count == 0 {
+					t.Fatal("the plan deleted resources")
+				}
+				records := 0
+				for _, planned := range plan {
+					if planned.Action != PlanDelete {
+						t.Errorf("expected %s %s to be deleted, got %s", planned.Type, planned.Name, planned.Action)
+					}
+					if planned.Type == Route53RecordSet {
+						records++
+					}
+				}
+				if records != len(cloud.records(zoneId)) {
+					t.Errorf("expected the %d records of the stack, got %d", len(cloud.records(zoneId)), records)
+				}
+				if last := plan[len(plan)-1]; last.Type != ResourceGroupsGroup {
+					t.Errorf("expected the resource groups last, got %s %s", last.Type, last.Name)
+				}
+			},
+		},
+		{
+			name: "lists untagged leftovers",
+			setup: func(t *testing.T, cloud *fakeCloud, zoneId string) {
+				_, name := stackNames()
+				_, err := createTestECSCluster(name, AmazonLinux2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// a state lost between two runs
+				state.Resources = nil
+			},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, plan []PlannedResource) {
+				index := slices.IndexFunc(plan, func(planned PlannedResource) bool {
+					return planned.Type == EC2LaunchTemplate
+				})
+				if index == -1 {
+					t.Fatalf("expected the launch template in %v", plan)
+				}
+				if plan[index].Details["foundIn"] != foundByLookup {
+					t.Errorf("expected the launch template to be found by lookup, got %s", plan[index].Details["foundIn"])
+				}
+			},
+		},
+		{
+			name:  "nothing to delete",
+			setup: func(t *testing.T, cloud *fakeCloud, zoneId string) {},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, plan []PlannedResource) {
+				if len(plan) != 0 {
+					t.Errorf("expected an empty plan, got %v", plan)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cloud, zoneId := newTestCloud(t)
+			test.setup(t, cloud, zoneId)
+			_, name := stackNames()
+			plan, err := PlanDeleteResources(aws.String(testRegion), &name, aws.String(testDomain))
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.check(t, cloud, zoneId, plan)
+		})
+	}
+}
+
+// listHome returns every file under home with its content.
+func listHome(t *testing.T, home string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(home, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		files[path] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestReadStateForPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string // by path under the home directory
+		wantUUID string
+	}{
+		{name: "no state"},
+		{
+			name:     "legacy uuid",
+			files:    map[string]string{"cloudGun-" + testRegion + ".id": "1ab1bced-4da6\n"},
+			wantUUID: "1ab1bced-4da6",
+		},
+		{
+			name:     "state file",
+			files:    map[string]string{".cloudGun/stack-" + testRegion + ".json": "{\"version\":1,\"uuid\":\"2bc2cdfe-5eb7\"}"},
+			wantUUID: "2bc2cdfe-5eb7",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			home := t.TempDir()
+			homeDir := getHomeDir
+			getHomeDir = func() (string, error) { return home, nil }
+			t.Cleanup(func() {
+				getHomeDir = homeDir
+				state = nil
+				statePath = ""
+			})
+			for path, content := range test.files {
+				err := os.MkdirAll(filepath.Dir(filepath.Join(home, path)), 0700)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.WriteFile(filepath.Join(home, path), []byte(content), 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			before := listHome(t, home)
+
+			read, err := ReadState(aws.String(testRegion))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.wantUUID != "" && read.UUID != test.wantUUID {
+				t.Errorf("expected uuid %s, got %s", test.wantUUID, read.UUID)
+			}
+			// recording a resource during the plan writes nothing either
+			err = recordResource(S3Bucket, aws.String("example.com"), aws.String(testRegion), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			createdResources = nil
+			after := listHome(t, home)
+			if len(after) != len(before) {
+				t.Errorf("expected the home directory to stay %v, got %v", before, after)
+			}
+			for path, content := range before {
+				if after[path] != content {
+					t.Errorf("expected %s to stay %q, got %q", path, content, after[path])
+				}
+			}
+		})
+	}
+}
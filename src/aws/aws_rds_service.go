@@ -6,12 +6,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/rds"
 )
 
-func initRDSClient(region *string) (*rds.Client, error) {
-	config, err := initConfig(region)
-	if err != nil {
-		return nil, err
-	}
-	return rds.NewFromConfig(config), nil
+func initRDSClient(region *string) (RDSAPI, error) {
+	return clients.RDS(region)
 }
 
 func createRDS(region *string, name *string, storage *int32, username *string) error {
@@ -37,5 +33,23 @@ func createRDS(region *string, name *string, storage *int32, username *string) e
 		return err
 	}
 	fmt.Println(instance)
-	return nil
+	return recordResource(RDSDBInstance, instance.DBInstance.DBInstanceArn, region, nil)
+}
+
+func deleteRDS(region *string, arn *string) error {
+	client, err := initRDSClient(region)
+	if err != nil {
+		return err
+	}
+	input := rds.DeleteDBInstanceInput{
+		DBInstanceIdentifier:   arn,
+		SkipFinalSnapshot:      aws.Bool(true),
+		DeleteAutomatedBackups: aws.Bool(true),
+	}
+	_, err = client.DeleteDBInstance(ctx, &input)
+	if err != nil {
+		return err
+	}
+	waiter := rds.NewDBInstanceDeletedWaiter(client)
+	return waiter.Wait(ctx, &rds.DescribeDBInstancesInput{DBInstanceIdentifier: arn}, Timeouts.ResourceDeleted)
 }
@@ -0,0 +1,41 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Rollback deletes the resources created by this process in reverse order of creation.
+// resources that already existed before are never touched. the resources that could not be deleted are returned.
+func Rollback(timeout time.Duration) []StackResource {
+	// the context of the failed run may already be cancelled
+	cancelCtx()
+	ctx, cancelCtx = context.WithTimeout(context.Background(), timeout)
+
+	stateMutex.Lock()
+	resources := make([]StackResource, len(createdResources))
+	copy(resources, createdResources)
+	stateMutex.Unlock()
+
+	leftovers := make([]StackResource, 0)
+	for i := len(resources) - 1; i >= 0; i-- {
+		resource := resources[i]
+		fmt.Println(fmt.Sprintf("rollback %s %s", resource.Type, resource.Id))
+		err := deleteStackResource(&resource)
+		if err != nil {
+			fmt.Println(err)
+			leftovers = append(leftovers, resource)
+			continue
+		}
+		err = forgetResource(resource.Type, resource.Id)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+	err := forgetCompletedSteps()
+	if err != nil {
+		fmt.Println(err)
+	}
+	return leftovers
+}
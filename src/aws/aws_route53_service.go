@@ -8,38 +8,125 @@ import (
 	elbTypes "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
 	"github.com/aws/aws-sdk-go-v2/service/route53"
 	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"net"
+	"slices"
 	"strings"
+	"time"
 )
 
-func initRoute53Client(region *string) (*route53.Client, error) {
-	config, err := initConfig(region)
+func initRoute53Client(region *string) (Route53API, error) {
+	return clients.Route53(region)
+}
+
+// findHostedZone returns the public hosted zone a name belongs to, the one of the longest matching name
+// when a subdomain is delegated to a zone of its own, or nil when there is none.
+func findHostedZone(region *string, domain *string) (*types.HostedZone, error) {
+	client, err := initRoute53Client(region)
 	if err != nil {
 		return nil, err
 	}
-	return route53.NewFromConfig(config), nil
+	name := normalizeDNSName(*domain)
+	var found *types.HostedZone
+	paginator := route53.NewListHostedZonesPaginator(client, &route53.ListHostedZonesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, zone := range page.HostedZones {
+			if zone.Config != nil && zone.Config.PrivateZone {
+				continue
+			}
+			zoneName := normalizeDNSName(*zone.Name)
+			if name != zoneName && !strings.HasSuffix(name, "."+zoneName) {
+				continue
+			}
+			if found == nil || len(zoneName) > len(normalizeDNSName(*found.Name)) {
+				found = &zone
+			}
+		}
+	}
+	return found, nil
 }
 
 func getHostedZoneId(region *string, domain *string) (*string, error) {
+	found, err := findHostedZone(region, domain)
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, errors.New(fmt.Sprintf("no hosted zone of %s or of a parent domain was found in route53, create it with -create-hosted-zone", *domain))
+	}
+	result := strings.Replace(*found.Id, "/hostedzone/", "", 1)
+	return &result, nil
+}
+
+// ensureHostedZone returns the hosted zone of domain or of a parent domain, creating one for domain when there is none.
+// the zone is not a stack resource, rollback and delete keep it as the registrar points at its name servers.
+func ensureHostedZone(region *string, domain *string) (*HostedZone, error) {
 	client, err := initRoute53Client(region)
 	if err != nil {
 		return nil, err
 	}
-	input := route53.ListHostedZonesInput{}
-	zones, err := client.ListHostedZones(ctx, &input)
+	found, err := findHostedZone(region, domain)
 	if err != nil {
 		return nil, err
 	}
-	for _, zone := range zones.HostedZones {
-		if *domain+"." == *zone.Name {
-			result := strings.Replace(*zone.Id, "/hostedzone/", "", 1)
-			return &result, nil
+	if found != nil {
+		output, err := client.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: found.Id})
+		if err != nil {
+			return nil, err
+		}
+		zone := &HostedZone{
+			Id:   strings.Replace(*found.Id, "/hostedzone/", "", 1),
+			Name: normalizeDNSName(*found.Name),
+		}
+		if output.DelegationSet != nil {
+			zone.NameServers = output.DelegationSet.NameServers
+		}
+		return zone, nil
+	}
+
+	output, err := client.CreateHostedZone(ctx, &route53.CreateHostedZoneInput{
+		Name:            domain,
+		CallerReference: aws.String(fmt.Sprintf("cloudGun-%s-%d", BaseUUIDTagValue, time.Now().UnixNano())),
+		HostedZoneConfig: &types.HostedZoneConfig{
+			Comment: aws.String("created by cloudGun"),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	zone := &HostedZone{
+		Id:      strings.Replace(*output.HostedZone.Id, "/hostedzone/", "", 1),
+		Name:    normalizeDNSName(*domain),
+		Created: true,
+	}
+	if output.DelegationSet != nil {
+		zone.NameServers = output.DelegationSet.NameServers
+	}
+	return zone, nil
+}
+
+// isDelegatedTo tells if the name servers a resolver answered are the ones of the zone.
+func isDelegatedTo(records []*net.NS, nameServers []string) bool {
+	if len(records) == 0 {
+		return false
+	}
+	expected := make([]string, 0, len(nameServers))
+	for _, nameServer := range nameServers {
+		expected = append(expected, normalizeDNSName(nameServer))
+	}
+	for _, record := range records {
+		if !slices.Contains(expected, normalizeDNSName(record.Host)) {
+			return false
 		}
 	}
-	return nil, errors.New(fmt.Sprintf("domain %s match not found in route53", *domain))
+	return true
 }
 
-func createCertificateRecord(region *string, domain *string, fullDomain *string, target *string) error {
-	routeZoneId, err := getHostedZoneId(region, domain)
+func createCertificateRecord(region *string, fullDomain *string, target *string) error {
+	routeZoneId, err := getHostedZoneId(region, fullDomain)
 	if err != nil {
 		return err
 	}
@@ -63,16 +150,19 @@ func createCertificateRecord(region *string, domain *string, fullDomain *string,
 			}},
 		},
 	}
-	_, err = client.ChangeResourceRecordSets(ctx, &input)
+	// the static site and the load balancer certificates share validation records and are validated at the same time
+	err = retryOn("createCertificateRecord", 2*time.Minute, func() error {
+		_, err := client.ChangeResourceRecordSets(ctx, &input)
+		return err
+	}, ErrorThrottling)
 	if err != nil {
 		return err
 	}
-	return nil
+	return recordRecordSet(routeZoneId, fullDomain, types.RRTypeCname, target, region)
 }
 
 func createCloudfrontRecord(region *string, fullDomain *string, target *string) error {
-	domain := strings.TrimPrefix(*fullDomain, "www.")
-	routeZoneId, err := getHostedZoneId(region, &domain)
+	routeZoneId, err := getHostedZoneId(region, fullDomain)
 	if err != nil {
 		return err
 	}
@@ -103,7 +193,7 @@ func createCloudfrontRecord(region *string, fullDomain *string, target *string)
 	if err != nil {
 		return err
 	}
-	return nil
+	return recordRecordSet(routeZoneId, fullDomain, types.RRTypeA, target, region)
 }
 
 func describeELB(region *string, elbArn *string) (*elbTypes.LoadBalancer, error) {
@@ -129,7 +219,7 @@ func createELBRecord(region *string, domain *string, targetDomain *string, elbAr
 	if strings.HasPrefix(*domain, "www.") {
 		return errors.New(fmt.Sprintf("parameter domain %s should not include www. ", *domain))
 	}
-	routeZoneId, err := getHostedZoneId(region, domain)
+	routeZoneId, err := getHostedZoneId(region, targetDomain)
 	if err != nil {
 		return err
 	}
@@ -163,10 +253,213 @@ func createELBRecord(region *string, domain *string, targetDomain *string, elbAr
 	}
 	_, err = client.ChangeResourceRecordSets(ctx, &input)
 	if err != nil {
-		if strings.Contains(err.Error(), "but it already exists") {
-			return nil
+		return err
+	}
+	return recordRecordSet(routeZoneId, targetDomain, types.RRTypeA, loadBalancer.DNSName, region)
+}
+
+// deleteRecordSet deletes the record set of name and type if it still points at value, alias records included.
+func deleteRecordSet(region *string, hostedZoneId *string, name *string, recordType types.RRType, value *string) error {
+	client, err := initRoute53Client(region)
+	if err != nil {
+		return err
+	}
+	records, err := client.ListResourceRecordSets(ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    hostedZoneId,
+		StartRecordName: name,
+		StartRecordType: recordType,
+		MaxItems:        aws.Int32(1),
+	})
+	if err != nil {
+		return err
+	}
+	if len(records.ResourceRecordSets) == 0 {
+		return nil
+	}
+	record := records.ResourceRecordSets[0]
+	if normalizeDNSName(*record.Name) != normalizeDNSName(*name) || record.Type != recordType || !isRecordSetOf(&record, *value) {
+		return nil
+	}
+	_, err = client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: hostedZoneId,
+		ChangeBatch: &types.ChangeBatch{
+			Changes: []types.Change{{
+				Action:            types.ChangeActionDelete,
+				ResourceRecordSet: &record,
+			}},
+		},
+	})
+	return err
+}
+
+func normalizeDNSName(name string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSuffix(name, ".")), "dualstack.")
+}
+
+// isRecordSetOf tells if a record set points at value, either as an alias or as a record value.
+func isRecordSetOf(record *types.ResourceRecordSet, value string) bool {
+	if record.AliasTarget != nil {
+		return normalizeDNSName(*record.AliasTarget.DNSName) == normalizeDNSName(value)
+	}
+	for _, resourceRecord := range record.ResourceRecords {
+		if normalizeDNSName(*resourceRecord.Value) == normalizeDNSName(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// zoneRecordSets are records of the stack found in a hosted zone.
+type zoneRecordSets struct {
+	hostedZoneId string
+	records      []types.ResourceRecordSet
+}
+
+// findStackRecordSets finds the records of the stack in the hosted zones.
+// records can not be tagged, so a record is the stack's only when it is in the state and still holds the value cloudGun wrote,
+// when it points at a distribution or load balancer of the stack, or when it validates a certificate of the stack.
+func findStackRecordSets(region *string, domain *string, resources []StackResource) ([]zoneRecordSets, error) {
+	hostedZoneIds := make([]string, 0)
+	stateRecords := make(map[string]StackResource)
+	aliasTargets := make(map[string]bool)
+	validationRecords := make(map[string]string)
+	for _, resource := range resources {
+		switch resource.Type {
+		case Route53RecordSet:
+			zoneId := resource.Attributes["hostedZoneId"]
+			if !slices.Contains(hostedZoneIds, zoneId) {
+				hostedZoneIds = append(hostedZoneIds, zoneId)
+			}
+			key := fmt.Sprintf("%s/%s/%s", zoneId, normalizeDNSName(resource.Attributes["name"]), resource.Attributes["type"])
+			stateRecords[key] = resource
+		case CloudFrontDistribution:
+			domainName, ok := resource.Attributes["domainName"]
+			if !ok {
+				found, err := getCloudfrontDomainName(&resource.Region, &resource.Id)
+				if err != nil {
+					return nil, err
+				} else if found == nil {
+					continue
+				}
+				domainName = *found
+			}
+			aliasTargets[normalizeDNSName(domainName)] = true
+		case ElasticLoadBalancingLoadBalancer:
+			dnsName, ok := resource.Attributes["dnsName"]
+			if !ok {
+				loadBalancer, err := describeELB(&resource.Region, &resource.Id)
+				if err != nil {
+					if isNotFound(err) {
+						continue
+					}
+					return nil, err
+				}
+				dnsName = *loadBalancer.DNSName
+			}
+			aliasTargets[normalizeDNSName(dnsName)] = true
+		case CertificateManagerCertificate:
+			records, err := getCertificateValidationRecords(&resource.Region, &resource.Id)
+			if err != nil {
+				return nil, err
+			}
+			for name, value := range records {
+				validationRecords[normalizeDNSName(name)] = value
+			}
+		}
+	}
+	domainZoneId, err := getHostedZoneId(region, domain)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(hostedZoneIds, *domainZoneId) {
+		hostedZoneIds = append(hostedZoneIds, *domainZoneId)
+	}
+
+	client, err := initRoute53Client(region)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]zoneRecordSets, 0, len(hostedZoneIds))
+	for _, zoneId := range hostedZoneIds {
+		found := zoneRecordSets{hostedZoneId: zoneId}
+		paginator := route53.NewListResourceRecordSetsPaginator(client, &route53.ListResourceRecordSetsInput{HostedZoneId: aws.String(zoneId)})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, record := range page.ResourceRecordSets {
+				name := normalizeDNSName(*record.Name)
+				stateRecord, inState := stateRecords[fmt.Sprintf("%s/%s/%s", zoneId, name, record.Type)]
+				isStackRecord := inState && isRecordSetOf(&record, stateRecord.Attributes["value"])
+				if !isStackRecord && record.AliasTarget != nil {
+					isStackRecord = aliasTargets[normalizeDNSName(*record.AliasTarget.DNSName)]
+				}
+				if !isStackRecord && record.Type == types.RRTypeCname {
+					value, ok := validationRecords[name]
+					isStackRecord = ok && isRecordSetOf(&record, value)
+				}
+				if isStackRecord {
+					found.records = append(found.records, record)
+				}
+			}
 		}
+		result = append(result, found)
+	}
+	return result, nil
+}
+
+// deleteStackRecordSets deletes the records of the stack from the hosted zones in a single batch per zone.
+// this has to run before the targets are deleted.
+func deleteStackRecordSets(region *string, domain *string, resources []StackResource) error {
+	zones, err := findStackRecordSets(region, domain, resources)
+	if err != nil {
+		return err
+	}
+	client, err := initRoute53Client(region)
+	if err != nil {
 		return err
 	}
+	for _, zone := range zones {
+		if len(zone.records) == 0 {
+			continue
+		}
+		changes := make([]types.Change, 0, len(zone.records))
+		for _, record := range zone.records {
+			fmt.Println(fmt.Sprintf("deleting route53 record %s %s", record.Type, *record.Name))
+			changes = append(changes, types.Change{Action: types.ChangeActionDelete, ResourceRecordSet: &record})
+		}
+		_, err = client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(zone.hostedZoneId),
+			ChangeBatch: &types.ChangeBatch{
+				Comment: aws.String(fmt.Sprintf("cloudGun delete %s", BaseUUIDTagValue)),
+				Changes: changes,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// a record changed by someone else after cloudGun wrote it is not ours anymore either
+	for _, resource := range resources {
+		if resource.Type != Route53RecordSet {
+			continue
+		}
+		err = forgetResource(resource.Type, resource.Id)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+func recordRecordSet(hostedZoneId *string, name *string, recordType types.RRType, value *string, region *string) error {
+	id := fmt.Sprintf("%s/%s/%s", *hostedZoneId, strings.TrimSuffix(*name, "."), recordType)
+	return recordResource(Route53RecordSet, &id, region, map[string]string{
+		"hostedZoneId": *hostedZoneId,
+		"name":         *name,
+		"type":         string(recordType),
+		"value":        *value,
+	})
+}
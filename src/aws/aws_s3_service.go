@@ -10,7 +10,7 @@ import (
 	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/gabriel-vasile/mimetype"
 	"io"
-	"log"
+	"slices"
 	"strings"
 )
 
@@ -20,24 +20,28 @@ var s3WebsitePolicy string
 //go:embed embed
 var embedded embed.FS
 
-func initS3Client(region *string) (*s3.Client, error) {
-	config, err := initConfig(region)
-	if err != nil {
-		return nil, err
-	}
-	return s3.NewFromConfig(config), nil
+func initS3Client(region *string) (S3API, error) {
+	return clients.S3(region)
 }
 
-func createBucket(bucket *string, region *string) error {
+func createBucket(progress io.Writer, bucket *string, region *string) error {
 	client, err := initS3Client(region)
 	if err != nil {
 		return err
 	}
-	input := s3.CreateBucketInput{
-		Bucket: bucket,
-		CreateBucketConfiguration: &s3Types.CreateBucketConfiguration{
+	isStackBucket, err := isStackBucket(bucket, region)
+	if err != nil {
+		return err
+	} else if isStackBucket {
+		fmt.Fprintln(progress, fmt.Sprintf("adopting existing bucket %s", *bucket))
+		return adoptResource(S3Bucket, aws.String("arn:aws:s3:::"+*bucket), region, nil)
+	}
+	input := s3.CreateBucketInput{Bucket: bucket}
+	// us-east-1 is the default location and rejects being given as a constraint
+	if *region != globalRegion {
+		input.CreateBucketConfiguration = &s3Types.CreateBucketConfiguration{
 			LocationConstraint: s3Types.BucketLocationConstraint(*region),
-		},
+		}
 	}
 	_, err = client.CreateBucket(ctx, &input)
 	if err != nil {
@@ -63,12 +67,36 @@ func createBucket(bucket *string, region *string) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return recordResource(S3Bucket, aws.String("arn:aws:s3:::"+*bucket), region, nil)
+}
+
+// isStackBucket reports if a bucket already exists and is tagged for this stack.
+func isStackBucket(bucket *string, region *string) (bool, error) {
+	client, err := initS3Client(region)
+	if err != nil {
+		return false, err
+	}
+	tagging, err := client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: bucket})
+	if err != nil {
+		if isNotFound(err) { // NoSuchBucket, NoSuchTagSet
+			return false, nil
+		}
+		return false, err
+	}
+	for _, tag := range tagging.TagSet {
+		if *tag.Key == baseUUIDTagName && *tag.Value == BaseUUIDTagValue {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 func deleteBucket(region *string, arn *string) error {
 	name := strings.TrimPrefix(*arn, "arn:aws:s3:::")
 	client, err := initS3Client(region)
+	if err != nil {
+		return err
+	}
 
 	deleteObject := func(bucket, key, versionId *string) error {
 		_, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{
@@ -86,7 +114,7 @@ func deleteBucket(region *string, arn *string) error {
 	for {
 		out, err := client.ListObjectsV2(ctx, in)
 		if err != nil {
-			log.Fatalf("Failed to list objects: %v", err)
+			return err
 		}
 
 		for _, item := range out.Contents {
@@ -96,7 +124,7 @@ func deleteBucket(region *string, arn *string) error {
 			}
 		}
 
-		if *out.IsTruncated {
+		if aws.ToBool(out.IsTruncated) {
 			in.ContinuationToken = out.ContinuationToken
 		} else {
 			break
@@ -107,7 +135,7 @@ func deleteBucket(region *string, arn *string) error {
 	for {
 		out, err := client.ListObjectVersions(ctx, inVer)
 		if err != nil {
-
+			return err
 		}
 
 		for _, item := range out.DeleteMarkers {
@@ -124,7 +152,7 @@ func deleteBucket(region *string, arn *string) error {
 			}
 		}
 
-		if *out.IsTruncated {
+		if aws.ToBool(out.IsTruncated) {
 			inVer.VersionIdMarker = out.NextVersionIdMarker
 			inVer.KeyMarker = out.NextKeyMarker
 		} else {
@@ -235,17 +263,17 @@ func uploadObject(bucket *string, key string, region *string, content *[]byte, r
 	return nil
 }
 
-func putBucketWebsite(bucket *string, region *string) error {
+// putBucketWebsite serves the bucket as a website, or redirects every request to redirectHost when it is given.
+func putBucketWebsite(bucket *string, region *string, redirectHost *string) error {
 	client, err := initS3Client(region)
 	if err != nil {
 		return err
 	}
 	var config s3Types.WebsiteConfiguration
-	if strings.HasPrefix(*bucket, "www.") {
-		redirectHost := strings.Replace(*bucket, "www.", "", 1)
+	if redirectHost != nil {
 		config = s3Types.WebsiteConfiguration{
 			RedirectAllRequestsTo: &s3Types.RedirectAllRequestsTo{
-				HostName: &redirectHost,
+				HostName: redirectHost,
 				Protocol: s3Types.ProtocolHttps,
 			},
 		}
@@ -266,6 +294,12 @@ func putBucketWebsite(bucket *string, region *string) error {
 	return nil
 }
 
+// the website endpoints of the older regions have a dash instead of a dot before the region
+var dashWebsiteRegions = []string{"us-east-1", "us-west-1", "us-west-2", "eu-west-1", "ap-southeast-1", "ap-southeast-2", "ap-northeast-1", "sa-east-1", "us-gov-west-1"}
+
 func getBucketWebsiteDomain(region *string, bucketName *string) string {
+	if slices.Contains(dashWebsiteRegions, *region) {
+		return fmt.Sprintf("%s.s3-website-%s.amazonaws.com", *bucketName, *region)
+	}
 	return fmt.Sprintf("%s.s3-website.%s.amazonaws.com", *bucketName, *region)
 }
@@ -4,20 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	uuid2 "fyc/uuid"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/config"
 	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	"io"
 	"os"
-	"os/user"
-	"path/filepath"
-	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 )
 
 var ctx context.Context
+var cancelCtx context.CancelFunc
 
 const baseTagName string = "CloudGun"
 const baseTagValue string = "CloudGun"
@@ -25,18 +26,61 @@ const baseUUIDTagName string = "CloudGunUUID"
 
 var BaseUUIDTagValue string
 
+// Progress is where the lines about the credential and the state go, stderr when stdout holds json.
+var Progress io.Writer = os.Stdout
+
+// Profile is the shared config profile used for every aws client. empty means the sdk default chain.
+var Profile string
+var credentialsProvider aws.CredentialsProvider
+
 func init() {
-	ctx, _ = context.WithTimeout(context.Background(), 720*time.Second)
+	ctx, cancelCtx = context.WithCancel(context.Background())
+}
+
+// SetContext makes every aws call run under parent, so cancelling parent stops the calls in flight.
+// long running operations are bounded by Timeouts, not by the context.
+func SetContext(parent context.Context) {
+	cancelCtx()
+	ctx, cancelCtx = context.WithCancel(parent)
 }
 
 func initConfig(region *string) (aws.Config, error) {
-	return config.LoadDefaultConfig(ctx, config.WithRegion(*region))
+	options := []func(*config.LoadOptions) error{
+		config.WithRegion(*region),
+		// throttled calls are retried by the sdk with exponential backoff and jitter
+		config.WithRetryer(func() aws.Retryer {
+			return retry.NewStandard(func(options *retry.StandardOptions) {
+				options.MaxAttempts = 8
+				options.MaxBackoff = 20 * time.Second
+			})
+		}),
+	}
+	if Profile != "" {
+		options = append(options, config.WithSharedConfigProfile(Profile))
+	}
+	if credentialsProvider != nil {
+		options = append(options, config.WithCredentialsProvider(credentialsProvider))
+	}
+	loaded, err := config.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return loaded, err
+	}
+	if credentialsProvider == nil {
+		credentialsProvider = loaded.Credentials
+	}
+	if EndpointURL != "" {
+		loaded.BaseEndpoint = aws.String(EndpointURL)
+	}
+	return loaded, nil
 }
 
 type DefaultCredentials struct {
 	Region          string
 	AccessKey       string
 	SecretAccessKey string
+	SessionToken    string
+	Source          string
+	CanExpire       bool
 }
 
 func CheckRoute53ForDomain(region *string, domain *string) error {
@@ -47,179 +91,161 @@ func CheckRoute53ForDomain(region *string, domain *string) error {
 	return nil
 }
 
-func GetUUID(region *string) (*string, error) {
-	currentUser, err := user.Current()
-	if err != nil {
-		return nil, errors.New("error getting current user")
-	}
-	uuidDir := filepath.Join(currentUser.HomeDir, fmt.Sprintf("cloudGun-%s.id", *region))
-	file, err := os.OpenFile(uuidDir, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+// CreateHostedZone makes sure domain has a public hosted zone, prints the name servers to set at the registrar
+// and waits until the public dns answers them, so that the certificates can be validated afterwards.
+func CreateHostedZone(region *string, domain *string) error {
+	fmt.Println("createHostedZone")
+	zone, err := ensureHostedZone(region, domain)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer file.Close()
-	buffer := make([]byte, 1024)
-	bytesRead, err := file.Read(buffer)
-	uuid := ""
-	if err != nil && err == io.EOF {
-		ptr, _ := uuid2.CreateUUID()
-		uuid = *ptr
-	} else if err != nil {
-		return nil, err
+	if zone.Created {
+		fmt.Println(fmt.Sprintf("created the hosted zone %s (%s)", zone.Name, zone.Id))
 	} else {
-		uuid = string(buffer[:bytesRead])
+		fmt.Println(fmt.Sprintf("using the hosted zone %s (%s)", zone.Name, zone.Id))
 	}
-	uuid = strings.ReplaceAll(uuid, "\n", "")
-	err = os.WriteFile(uuidDir, []byte(uuid), 0644)
-	if err != nil {
-		return nil, err
+	fmt.Println(fmt.Sprintf("set the name servers of %s at its registrar to", zone.Name))
+	for _, nameServer := range zone.NameServers {
+		fmt.Println("  " + nameServer)
 	}
-
-	return &uuid, nil
+	fmt.Println(fmt.Sprintf("waiting up to %s for the delegation to be public", Timeouts.NameServersDelegated))
+	return waitNameServerDelegation(zone)
 }
 
-func ReplaceUUID(region *string) (*string, error) {
-	currentUser, err := user.Current()
-	if err != nil {
-		return nil, errors.New("error getting current user")
-	}
-	uuidDir := filepath.Join(currentUser.HomeDir, fmt.Sprintf("cloudGun-%s.id", *region))
-	file, err := os.OpenFile(uuidDir, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+// GetCredentials resolves credentials once through the sdk credential chain
+// (env vars, AWS_PROFILE or -profile, sso, credential_process, assumed roles, ...).
+// every client created afterwards shares the same resolved credentials.
+func GetCredentials(region *string) (*DefaultCredentials, error) {
+	config, err := initConfig(region)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-	uuidStr, _ := uuid2.CreateUUID()
-	_, err = file.WriteString(*uuidStr)
+	credentials, err := config.Credentials.Retrieve(ctx)
 	if err != nil {
-		return nil, err
+		return nil, errors.New(fmt.Sprintf("no aws credential could be resolved for profile %s : %s", getProfileName(), err.Error()))
+	}
+	fmt.Fprintln(Progress, fmt.Sprintf("using aws credential %s of profile %s from %s", maskAccessKey(credentials.AccessKeyID), getProfileName(), credentials.Source))
+	if credentials.CanExpire {
+		fmt.Fprintln(Progress, fmt.Sprintf("aws credential is temporary and expires at %s", credentials.Expires.Format(time.RFC3339)))
 	}
-	return uuidStr, nil
+	return &DefaultCredentials{
+		Region:          *region,
+		AccessKey:       credentials.AccessKeyID,
+		SecretAccessKey: credentials.SecretAccessKey,
+		SessionToken:    credentials.SessionToken,
+		Source:          credentials.Source,
+		CanExpire:       credentials.CanExpire,
+	}, nil
 }
 
-func GetCredentials() (*DefaultCredentials, error) {
-	currentUser, err := user.Current()
-	if err != nil {
-		return nil, errors.New("error getting current user")
+func getProfileName() string {
+	if Profile != "" {
+		return Profile
+	} else if profile := os.Getenv("AWS_PROFILE"); profile != "" {
+		return profile
 	}
+	return "default"
+}
 
-	awsDir := filepath.Join(currentUser.HomeDir, ".aws/credentials")
-	credentials, err := os.ReadFile(awsDir)
-	if err != nil {
-		return nil, errors.New("no aws credential if found in .aws/credentials")
-	}
-	fmt.Println(string(credentials))
-	r, _ := regexp.Compile("\\[default\\][\\r\\n]([^[]+)\\[*")
-	regexResults := r.FindStringSubmatch(string(credentials))
-	if len(regexResults) == 0 {
-		return nil, errors.New("no [default] credential found in .aws/credentials")
+func maskAccessKey(accessKey string) string {
+	if len(accessKey) <= 8 {
+		return strings.Repeat("*", len(accessKey))
 	}
-	credentials = []byte(regexResults[1])
-
-	result := DefaultCredentials{}
-	//r, _ = regexp.Compile("region\\s*=\\s*([^\\n^\\s]+)\\n*")
-	//regexResults = r.FindStringSubmatch(string(credentials))
-	//if len(regexResults) == 0 {
-	//	return nil, errors.New("no region in [default] credential is found")
-	//}
-	//result.Region = regexResults[1]
-
-	r, _ = regexp.Compile("aws_access_key_id\\s*=\\s*([^\\n\\s\\r]+)[\\r\\n]*")
-	regexResults = r.FindStringSubmatch(string(credentials))
-	if len(regexResults) == 0 {
-		return nil, errors.New("no aws_access_key_id in [default] credential is found")
-	}
-	fmt.Println(regexResults[1])
-	result.AccessKey = regexResults[1]
-	r, _ = regexp.Compile("aws_secret_access_key\\s*=\\s*([^\\n\\s\\r]+)[\\r\\n]*")
-	regexResults = r.FindStringSubmatch(string(credentials))
-	if len(regexResults) == 0 {
-		return nil, errors.New("no aws_secret_access_key in [default] credential is found")
-	}
-	result.SecretAccessKey = regexResults[1]
-	fmt.Println(regexResults[1])
-	return &result, nil
+	return accessKey[:4] + strings.Repeat("*", len(accessKey)-8) + accessKey[len(accessKey)-4:]
 }
 
-func CreateResourceGroup(name *string, region *string) error {
-	err := createResourceGroup(name, region)
-	if err != nil {
-		return err
+// globalRegion is where cloudfront takes its certificates from. a stack elsewhere also has resources there.
+const globalRegion = "us-east-1"
+
+// stackRegions returns the regions a stack of region has resources in, region first.
+func stackRegions(region *string) []string {
+	if *region == globalRegion {
+		return []string{globalRegion}
 	}
-	err = createResourceGroup(name, aws.String("us-east-1"))
-	if err != nil {
-		return err
+	return []string{*region, globalRegion}
+}
+
+func CreateResourceGroup(progress io.Writer, name *string, region *string) error {
+	for _, groupRegion := range stackRegions(region) {
+		err := createResourceGroup(progress, name, &groupRegion)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func CreateS3Website(name *string, domain *string, region *string) (*string, error) {
-	fmt.Println("createBucket")
-	err := createBucket(name, region)
+// CreateS3Website creates the static site of domain. with www, www.<domain> redirects to it.
+func CreateS3Website(progress io.Writer, name *string, domain *string, region *string, www bool) (*string, error) {
+	fmt.Fprintln(progress, "createBucket")
+	err := createBucket(progress, name, region)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("requestCertificate")
-	domains := []string{*domain, "www." + *domain}
-	certArn, err := requestCertificate(domain, &domains, aws.String("us-east-1"), 120)
+	fmt.Fprintln(progress, "requestCertificate")
+	domains := websiteDomains(domain, www)
+	certArn, err := requestCertificate(progress, domain, &domains, aws.String(globalRegion))
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("deletePublicAccessBlock")
+	fmt.Fprintln(progress, "deletePublicAccessBlock")
 	err = deletePublicAccessBlock(name, region)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("putBucketPolicy")
+	fmt.Fprintln(progress, "putBucketPolicy")
 	err = putBucketPolicy(name, region)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("putBucketWebsite")
-	err = putBucketWebsite(name, region)
+	fmt.Fprintln(progress, "putBucketWebsite")
+	err = putBucketWebsite(name, region, nil)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("createCloudfront")
-	cloudEndpoint, distributionId, err := createCloudfront(region, name, domain, certArn)
+	fmt.Fprintln(progress, "createCloudfront")
+	cloudEndpoint, distributionId, err := createCloudfront(progress, region, name, domain, certArn)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("createCloudfrontRecord")
+	fmt.Fprintln(progress, "createCloudfrontRecord")
 	err = createCloudfrontRecord(region, domain, cloudEndpoint)
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Println("www")
+	if !www {
+		return distributionId, nil
+	}
+	fmt.Fprintln(progress, "www")
 	wwwName := "www." + *name
 	wwwDomain := "www." + *domain
-	fmt.Println("createBucket")
-	err = createBucket(&wwwName, region)
+	fmt.Fprintln(progress, "createBucket")
+	err = createBucket(progress, &wwwName, region)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("deletePublicAccessBlock")
+	fmt.Fprintln(progress, "deletePublicAccessBlock")
 	err = deletePublicAccessBlock(&wwwName, region)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("putBucketPolicy")
+	fmt.Fprintln(progress, "putBucketPolicy")
 	err = putBucketPolicy(&wwwName, region)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("putBucketWebsite")
-	err = putBucketWebsite(&wwwName, region)
+	fmt.Fprintln(progress, "putBucketWebsite")
+	err = putBucketWebsite(&wwwName, region, domain)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("createCloudfront")
-	cloudEndpoint, _, err = createCloudfront(region, &wwwName, &wwwDomain, certArn)
+	fmt.Fprintln(progress, "createCloudfront")
+	cloudEndpoint, _, err = createCloudfront(progress, region, &wwwName, &wwwDomain, certArn)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("createCloudfrontRecord")
+	fmt.Fprintln(progress, "createCloudfrontRecord")
 	err = createCloudfrontRecord(region, &wwwDomain, cloudEndpoint)
 	if err != nil {
 		return nil, err
@@ -228,66 +254,147 @@ func CreateS3Website(name *string, domain *string, region *string) (*string, err
 	return distributionId, nil
 }
 
-func CreateECSCluster(region *string, clusterName *string, taskFamilyName *string, containerName *string, min *int32, max *int32, desired *int32,
-	instanceType ec2Types.InstanceType, image Image) (*string, error) {
-	fmt.Println("createAutoScalingGroup")
-	asgArn, err := createAutoScalingGroup(region, clusterName, max, min, desired, instanceType, image)
+// websiteDomains are the names the static site answers to.
+func websiteDomains(domain *string, www bool) []string {
+	if www {
+		return []string{*domain, "www." + *domain}
+	}
+	return []string{*domain}
+}
+
+// CreateECSCluster creates the cluster and the task definition of the backend. an ec2 cluster runs on an auto scaling
+// group of its own, a fargate cluster has no instances to manage.
+func CreateECSCluster(progress io.Writer, region *string, clusterName *string, taskFamilyName *string, containerName *string,
+	containerImage *string, min *int32, max *int32, desired *int32, instanceType ec2Types.InstanceType, image Image, container *ContainerSpec,
+	launchType LaunchType, roles *ECSRoles) (*string, error) {
+	capacityProviderName := aws.String(fargateCapacityProvider)
+	if launchType != LaunchTypeFargate {
+		fmt.Fprintln(progress, "createAutoScalingGroup")
+		asgArn, err := createAutoScalingGroup(progress, region, clusterName, max, min, desired, instanceType, image,
+			aws.String(roles.InstanceProfile), &container.HostPort)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintln(progress, "createCapacityProvider")
+		capacityProviderName, err = createCapacityProvider(progress, region, clusterName, asgArn)
+		if err != nil {
+			return nil, err
+		}
+	}
+	fmt.Fprintln(progress, "createECSCluster")
+	arn, err := createECSCluster(progress, region, clusterName, capacityProviderName)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("deleteCapacityProvider")
-	_ = deleteCapacityProvider(region, clusterName)
-	fmt.Println("createCapacityProvider")
-	capacityProviderName, err := createCapacityProvider(region, clusterName, asgArn)
+	fmt.Fprintln(progress, "createECSTaskDefinition")
+	_, err = createECSTaskDefinition(progress, region, taskFamilyName, containerName, containerImage, &container.CPU, &container.MemoryMiB,
+		&container.ContainerPort, &container.HostPort, launchType, roles)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("createECSCluster")
-	arn, err := createECSCluster(region, clusterName, capacityProviderName)
+	return arn, nil
+}
+
+// CreateECSRoles creates the execution and task roles of the tasks of a cluster. ec2 instances use the ecsInstanceRole
+// of the account, or an instance profile of the cluster when the account has none.
+func CreateECSRoles(progress io.Writer, region *string, clusterName *string, launchType LaunchType) (*ECSRoles, error) {
+	roles := ECSRoles{}
+	if launchType != LaunchTypeFargate {
+		fmt.Fprintln(progress, "createInstanceProfile")
+		instanceProfile, err := ensureECSInstanceProfile(progress, region, clusterName)
+		if err != nil {
+			return nil, err
+		}
+		roles.InstanceProfile = *instanceProfile
+	}
+	fmt.Fprintln(progress, "createExecutionRole")
+	executionRoleName := ExecutionRoleName(*clusterName)
+	executionRoleArn, err := createIAMRole(progress, region, &executionRoleName, &ecsTasksTrustPolicy)
 	if err != nil {
 		return nil, err
 	}
-	// TODO : we need these parameters out of the function
-	var containerCPU int32 = 512
-	var containerMiB int32 = 102
-	var containerPort int32 = 80
-	var hostPort int32 = 80
-	fmt.Println("createECSTaskDefinition")
-	_, err = createECSTaskDefinition(region, taskFamilyName, containerName, &containerCPU, &containerMiB,
-		&containerPort, &hostPort)
+	err = attachRolePolicy(region, &executionRoleName, aws.String(ecsTaskExecutionPolicyArn))
 	if err != nil {
 		return nil, err
 	}
-	return arn, nil
+	err = putExecutionParametersPolicy(region, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	roles.ExecutionRoleArn = *executionRoleArn
+	// the task role has no policies, the application gets the ones it needs attached to it
+	fmt.Fprintln(progress, "createTaskRole")
+	taskRoleName := TaskRoleName(*clusterName)
+	taskRoleArn, err := createIAMRole(progress, region, &taskRoleName, &ecsTasksTrustPolicy)
+	if err != nil {
+		return nil, err
+	}
+	roles.TaskRoleArn = *taskRoleArn
+	for _, name := range []string{executionRoleName, taskRoleName} {
+		fmt.Fprintln(progress, fmt.Sprintf("waitRoleExists %s", name))
+		err = waitRoleExists(region, &name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &roles, nil
 }
 
-func CreateECR(region *string, name *string) error {
-	err := createECRRepository(region, name)
+// CreateECR creates the repository of the backend with a placeholder image in it, and returns the image the task
+// definition runs.
+func CreateECR(progress io.Writer, region *string, name *string) (*string, error) {
+	fmt.Fprintln(progress, "createECRRepository")
+	err := createECRRepository(progress, region, name)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	fmt.Fprintln(progress, "seedECRRepository")
+	err = seedECRRepository(progress, region, name)
+	if err != nil {
+		return nil, err
+	}
+	accountId, err := getAccountId(region)
+	if err != nil {
+		return nil, err
+	}
+	image := ECRImageURI(*accountId, *region, *name)
+	return &image, nil
+}
+
+// CreateLogGroup creates the log group the containers of the stack write to.
+func CreateLogGroup(progress io.Writer, region *string, name *string, retentionDays *int32) error {
+	fmt.Fprintln(progress, "createLogGroup")
+	return createLogGroup(progress, region, name, retentionDays)
 }
 
-func CreateELB(region *string, domain *string, targetDomain *string, albName *string, targetGroupName *string) error {
-	fmt.Println("requestCertificate")
-	requestDomains := []string{*domain, "www." + *domain, *targetDomain}
-	certificateArn, err := requestCertificate(domain, &requestDomains, region, 120)
+// CreateELB creates the https load balancer of targetDomain. it shares the security group of an ec2 cluster and has one
+// of its own with fargate.
+func CreateELB(progress io.Writer, region *string, domain *string, targetDomain *string, albName *string, targetGroupName *string,
+	www bool, launchType LaunchType) error {
+	fmt.Fprintln(progress, "requestCertificate")
+	requestDomains := append(websiteDomains(domain, www), *targetDomain)
+	certificateArn, err := requestCertificate(progress, domain, &requestDomains, region)
 	if err != nil {
 		return err
 	}
-	fmt.Println("getSecurityGroupId")
-	securityGroupId, err := getSecurityGroupId(region)
+	var securityGroupId *string
+	if launchType == LaunchTypeFargate {
+		fmt.Fprintln(progress, "createSecurityGroup")
+		securityGroupId, err = ensureSecurityGroup(progress, region, albName, loadBalancerIngress())
+	} else {
+		fmt.Fprintln(progress, "getSecurityGroupId")
+		securityGroupId, err = getSecurityGroupId(region)
+	}
 	if err != nil {
 		return err
 	}
-	fmt.Println("createALB")
-	elbArn, err := createALB(region, albName, securityGroupId)
+	fmt.Fprintln(progress, "createALB")
+	elbArn, err := createALB(progress, region, albName, securityGroupId)
 	if err != nil {
 		return err
 	}
-	fmt.Println("createTargetGroup")
-	targetGroupArn, err := createTargetGroup(region, targetGroupName)
+	fmt.Fprintln(progress, "createTargetGroup")
+	targetGroupArn, err := createTargetGroup(progress, region, targetGroupName, launchType)
 	if err != nil {
 		return err
 	}
@@ -296,17 +403,17 @@ func CreateELB(region *string, domain *string, targetDomain *string, albName *st
 	//if err != nil {
 	//	return err
 	//}
-	fmt.Println("waitCertificateIssued")
-	err = waitCertificateIssued(region, certificateArn, 360)
+	fmt.Fprintln(progress, "waitCertificateIssued")
+	err = waitCertificateIssued(progress, region, certificateArn)
 	if err != nil {
 		return err
 	}
-	fmt.Println("addELBListener")
-	err = addELBListener(region, elbArn, targetGroupArn, certificateArn)
+	fmt.Fprintln(progress, "addELBListener")
+	err = addELBListener(progress, region, elbArn, targetGroupArn, certificateArn)
 	if err != nil {
 		return err
 	}
-	fmt.Println("createELBRecord")
+	fmt.Fprintln(progress, "createELBRecord")
 	err = createELBRecord(region, domain, targetDomain, elbArn)
 	if err != nil {
 		return err
@@ -314,14 +421,149 @@ func CreateELB(region *string, domain *string, targetDomain *string, albName *st
 	return nil
 }
 
-func ConnectECSServiceToALB(region *string, serviceName *string, ecsArn *string, taskFamilyName *string,
-	albName *string, containerName *string, targetGroupArn *string) error {
-	fmt.Println("createECSService")
-	err := createECSService(region, serviceName, ecsArn, taskFamilyName, albName, containerName, targetGroupArn)
+// ConnectECSServiceToALB runs the task definition as a service behind the load balancer. fargate tasks get a security
+// group that only admits the load balancer.
+func ConnectECSServiceToALB(progress io.Writer, region *string, serviceName *string, ecsArn *string, taskFamilyName *string,
+	albName *string, containerName *string, containerPort *int32, targetGroupArn *string, launchType LaunchType) error {
+	var network *ecsTypes.NetworkConfiguration
+	if launchType == LaunchTypeFargate {
+		fmt.Fprintln(progress, "createTaskSecurityGroup")
+		loadBalancerGroups, err := findStackSecurityGroups(region, albName)
+		if err != nil {
+			return err
+		}
+		if len(loadBalancerGroups) == 0 {
+			return errors.New(fmt.Sprintf("no security group of the load balancer %s was found", *albName))
+		}
+		taskGroupName := *serviceName + "-task"
+		taskGroupId, err := ensureSecurityGroup(progress, region, &taskGroupName, taskIngress(loadBalancerGroups[0].GroupId, containerPort))
+		if err != nil {
+			return err
+		}
+		subnetIds, err := describeSubnetIds(region)
+		if err != nil {
+			return err
+		}
+		network = &ecsTypes.NetworkConfiguration{AwsvpcConfiguration: &ecsTypes.AwsVpcConfiguration{
+			Subnets:        subnetIds,
+			SecurityGroups: []string{*taskGroupId},
+			// the default vpc has no nat gateway, a public ip is how the task pulls its image
+			AssignPublicIp: ecsTypes.AssignPublicIpEnabled,
+		}}
+	}
+	fmt.Fprintln(progress, "createECSService")
+	err := createECSService(progress, region, serviceName, ecsArn, taskFamilyName, albName, containerName, containerPort, targetGroupArn,
+		launchType, network)
 	if err != nil {
 		return err
 	}
-	return nil
+	fmt.Fprintln(progress, "waitECSServiceStable")
+	return waitECSServiceStable(region, ecsArn, serviceName)
+}
+
+// DeployECSService starts new tasks of the current task definition of the service, pulling its image again,
+// and waits until the service is stable.
+func DeployECSService(region *string, clusterName *string, serviceName *string) error {
+	fmt.Println("redeployECSService")
+	err := redeployECSService(region, clusterName, serviceName)
+	if err != nil {
+		return err
+	}
+	fmt.Println("waitECSServiceStable")
+	return waitECSServiceStable(region, clusterName, serviceName)
+}
+
+// ListEnv lists the environment variables and the secrets of the backend containers of a cluster.
+func ListEnv(region *string, clusterName *string) ([]EnvVar, error) {
+	return listEnv(region, aws.String(EnvPath(*clusterName)))
+}
+
+// SetEnv stores values in the parameter store, as secrets when secret is true, and rolls the service to a task
+// definition with them. a variable set as a plain value becomes a secret and the other way around.
+func SetEnv(region *string, clusterName *string, taskFamilyName *string, serviceName *string, values map[string]string,
+	secret bool) error {
+	path := EnvPath(*clusterName)
+	existing, err := listEnv(region, &path)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		err = ValidateEnvName(name)
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println("putParameter")
+	for _, name := range names {
+		// ssm does not turn a String into a SecureString, the parameter is created again
+		index := slices.IndexFunc(existing, func(envVar EnvVar) bool { return envVar.Name == name })
+		if index != -1 && existing[index].Secret != secret {
+			err = deleteParameter(region, &existing[index].Arn)
+			if err != nil {
+				return err
+			}
+		}
+		value := values[name]
+		err = putParameter(region, aws.String(path+name), &value, secret)
+		if err != nil {
+			return err
+		}
+	}
+	return applyEnv(region, clusterName, taskFamilyName, serviceName)
+}
+
+// UnsetEnv removes environment variables or secrets of the backend containers and rolls the service without them.
+func UnsetEnv(region *string, clusterName *string, taskFamilyName *string, serviceName *string, names []string) error {
+	existing, err := listEnv(region, aws.String(EnvPath(*clusterName)))
+	if err != nil {
+		return err
+	}
+	arns := make([]string, 0, len(names))
+	for _, name := range names {
+		index := slices.IndexFunc(existing, func(envVar EnvVar) bool { return envVar.Name == name })
+		if index == -1 {
+			return errors.New(fmt.Sprintf("%s is not set", name))
+		}
+		arns = append(arns, existing[index].Arn)
+	}
+	fmt.Println("deleteParameter")
+	for _, arn := range arns {
+		err = deleteParameter(region, &arn)
+		if err != nil {
+			return err
+		}
+	}
+	return applyEnv(region, clusterName, taskFamilyName, serviceName)
+}
+
+// applyEnv registers a task definition with the environment in the parameter store and waits for the service to run it.
+func applyEnv(region *string, clusterName *string, taskFamilyName *string, serviceName *string) error {
+	// stacks created before the environment was kept in the parameter store have a role without the policy
+	fmt.Println("putExecutionParametersPolicy")
+	err := putExecutionParametersPolicy(region, clusterName)
+	if err != nil {
+		return err
+	}
+	vars, err := listEnv(region, aws.String(EnvPath(*clusterName)))
+	if err != nil {
+		return err
+	}
+	environment, secrets := containerEnvironment(vars)
+	fmt.Println("registerTaskDefinition")
+	taskDefinitionArn, err := registerEnvironmentRevision(region, taskFamilyName, environment, secrets)
+	if err != nil {
+		return err
+	}
+	fmt.Println("rollECSService")
+	err = rollECSService(region, clusterName, serviceName, taskDefinitionArn)
+	if err != nil {
+		return err
+	}
+	fmt.Println("waitECSServiceStable")
+	return waitECSServiceStable(region, clusterName, serviceName)
 }
 
 func CreateRDS(region *string, name *string, username *string, storage *int32) error {
@@ -332,18 +574,89 @@ func CreateRDS(region *string, name *string, username *string, storage *int32) e
 	return nil
 }
 
-func DeleteResources(region *string, name *string) error {
-	err := deleteResourcesInGroup(name, region)
+// CreateDeployUser creates a stack owned iam user for github actions.
+// the user can only sync the stack bucket, invalidate the stack distribution, push to the stack ecr and update the stack service.
+func CreateDeployUser(progress io.Writer, region *string, name *string, target *DeployTarget) (*DefaultCredentials, error) {
+	fmt.Fprintln(progress, "getAccountId")
+	accountId, err := getAccountId(region)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	fmt.Fprintln(progress, "createIAMUser")
+	err = createIAMUser(progress, region, name)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(progress, "putUserPolicy")
+	policy := getDeployPolicy(region, accountId, target)
+	err = putUserPolicy(region, name, &policy)
+	if err != nil {
+		return nil, err
 	}
-	err = deleteResourcesInGroup(name, aws.String("us-east-1"))
+	fmt.Fprintln(progress, "createAccessKey")
+	key, err := createAccessKey(progress, region, name)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(progress, "waitAccessKeyActive")
+	err = waitAccessKeyActive(region, key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// CreateDeployRole creates a stack owned iam role that github actions of the given subjects can assume through oidc.
+// subjects are in the form of repo:<owner>/<repository>:ref:refs/heads/<branch>
+func CreateDeployRole(progress io.Writer, region *string, name *string, subjects *[]string, target *DeployTarget) (*string, error) {
+	fmt.Fprintln(progress, "getAccountId")
+	accountId, err := getAccountId(region)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(progress, "getGithubOIDCProvider")
+	providerArn, err := getGithubOIDCProvider(region)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(progress, "createIAMRole")
+	trustPolicy, err := getGithubOIDCTrustPolicy(providerArn, subjects)
+	if err != nil {
+		return nil, err
+	}
+	roleArn, err := createIAMRole(progress, region, name, &trustPolicy)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(progress, "putRolePolicy")
+	policy := getDeployPolicy(region, accountId, target)
+	err = putRolePolicy(region, name, aws.String(deployPolicyName), &policy)
+	if err != nil {
+		return nil, err
+	}
+	return roleArn, nil
+}
+
+// DeleteResources deletes every resource of the stack, independent resources concurrently.
+func DeleteResources(region *string, name *string, domain *string) error {
+	resources, err := collectStackResources(region, name)
 	if err != nil {
 		return err
 	}
-	err = deleteLaunchTemplate(region, name) // resource group 안에 없음
-	if err != nil && !strings.Contains(err.Error(), "InvalidLaunchTemplateName.NotFoundException") {
+	// records are found by what they point at, so they go first
+	err = deleteStackRecordSets(region, domain, resources)
+	if err != nil {
 		return err
 	}
+	others := make([]StackResource, 0, len(resources))
+	for _, resource := range resources {
+		if resource.Type != Route53RecordSet {
+			others = append(others, resource)
+		}
+	}
+	leftovers := deleteGraph(others)
+	if len(leftovers) != 0 {
+		return errors.New(fmt.Sprintf("%d resources could not be deleted", len(leftovers)))
+	}
 	return nil
 }
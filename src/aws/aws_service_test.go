@@ -0,0 +1,1821 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	acmTypes "github.com/aws/aws-sdk-go-v2/service/acm/types"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	elbTypes "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	route53Types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"golang.org/x/net/dns/dnsmessage"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testRegion = "ap-northeast-2"
+const testDomain = "example.com"
+
+var testContainer = ContainerSpec{CPU: 512, MemoryMiB: 102, ContainerPort: 80, HostPort: 80}
+
+// newTestCloud points the package at a new fake cloud with a hosted zone for testDomain and a new stack state.
+// it returns the cloud and the id of the hosted zone.
+func newTestCloud(t *testing.T) (*fakeCloud, string) {
+	t.Helper()
+	cloud := newFakeCloud()
+	zoneId := cloud.addHostedZone(testDomain)
+	SetClientProvider(cloud)
+	serveTestRegistry(t)
+
+	stackState, err := newStackState(aws.String(testRegion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state = stackState
+	statePath = filepath.Join(t.TempDir(), "stack-"+testRegion+".json")
+	BaseUUIDTagValue = state.UUID
+	createdResources = nil
+	completedSteps = nil
+
+	// nothing in the fake takes time, a wait that does not end right away is a bug
+	timeouts := Timeouts
+	Timeouts = OperationTimeouts{
+		CertificateRecords:   5 * time.Second,
+		CertificateValidated: 5 * time.Second,
+		DistributionDeployed: 5 * time.Second,
+		InstancesRunning:     5 * time.Second,
+		ServicesStable:       5 * time.Second,
+		AccessKeyActive:      5 * time.Second,
+		RolesPropagated:      5 * time.Second,
+		ResourceDeleted:      5 * time.Second,
+
+		NameServersDelegated: 5 * time.Second,
+	}
+
+	t.Cleanup(func() {
+		SetClientProvider(sdkClientProvider{})
+		Timeouts = timeouts
+		state = nil
+		statePath = ""
+		BaseUUIDTagValue = ""
+		createdResources = nil
+		completedSteps = nil
+	})
+	return cloud, zoneId
+}
+
+func findZoneRecord(cloud *fakeCloud, zoneId string, name string, recordType route53Types.RRType) *route53Types.ResourceRecordSet {
+	records := cloud.records(zoneId)
+	index := slices.IndexFunc(records, func(record route53Types.ResourceRecordSet) bool {
+		return *record.Name == fqdn(name) && record.Type == recordType
+	})
+	if index == -1 {
+		return nil
+	}
+	return &records[index]
+}
+
+func stackNames() (bucketName string, name string) {
+	return testDomain + "-" + BaseUUIDTagValue, "cloudGun-" + BaseUUIDTagValue
+}
+
+func testECRName() string {
+	return "cloud-gun-main-api-" + BaseUUIDTagValue
+}
+
+// testRegistry is a public registry with a placeholder image for linux/amd64 and arm64, behind anonymous bearer tokens.
+type testRegistry struct {
+	*httptest.Server
+	mutex sync.Mutex
+	// manifests are the manifests by tag and digest, blobs the config and layers by digest
+	manifests map[string]string
+	blobs     map[string][]byte
+	// pulled are the digests of the blobs downloaded so far
+	pulled []string
+}
+
+// serveTestRegistry serves a testRegistry as the registry of the placeholder image for the test.
+func serveTestRegistry(t *testing.T) *testRegistry {
+	t.Helper()
+	registry := &testRegistry{manifests: map[string]string{}, blobs: map[string][]byte{}}
+	blob := func(mediaType string, content []byte) registryDescriptor {
+		digest := fakeDigest(content)
+		registry.blobs[digest] = content
+		return registryDescriptor{MediaType: mediaType, Digest: digest, Size: int64(len(content))}
+	}
+	platforms := make([]registryDescriptor, 0)
+	for _, architecture := range []string{"arm64", "amd64"} {
+		manifest, _ := json.Marshal(registryManifest{
+			MediaType: "application/vnd.oci.image.manifest.v1+json",
+			Config:    blob("application/vnd.oci.image.config.v1+json", []byte(fmt.Sprintf("{\"architecture\":\"%s\",\"os\":\"linux\"}", architecture))),
+			Layers: []registryDescriptor{
+				blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte(strings.Repeat("base layer of "+architecture, 3))),
+				blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("nginx "+architecture)),
+			},
+		})
+		digest := fakeDigest(manifest)
+		registry.manifests[digest] = string(manifest)
+		platforms = append(platforms, registryDescriptor{
+			MediaType: "application/vnd.oci.image.manifest.v1+json",
+			Digest:    digest,
+			Size:      int64(len(manifest)),
+			Platform:  &registryPlatform{Architecture: architecture, OS: "linux"},
+		})
+	}
+	index, _ := json.Marshal(registryManifest{MediaType: "application/vnd.oci.image.index.v1+json", Manifests: platforms})
+	registry.manifests[placeholderTag] = string(index)
+
+	registry.Server = httptest.NewServer(http.HandlerFunc(registry.serve))
+	previous := placeholderRegistry
+	placeholderRegistry = registry.URL
+	t.Cleanup(func() {
+		registry.Close()
+		placeholderRegistry = previous
+	})
+	return registry
+}
+
+func (registry *testRegistry) serve(writer http.ResponseWriter, request *http.Request) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if request.URL.Path == "/token" {
+		if request.URL.Query().Get("scope") != "repository:"+placeholderRepository+":pull" || request.URL.Query().Get("service") != "test-registry" {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(writer, "{\"token\":\"test-token\"}")
+		return
+	}
+	if request.Header.Get("Authorization") != "Bearer test-token" {
+		writer.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=\"%s/token\",service=\"test-registry\"", registry.URL))
+		writer.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	path, found := strings.CutPrefix(request.URL.Path, "/v2/"+placeholderRepository+"/")
+	if reference, ok := strings.CutPrefix(path, "manifests/"); found && ok {
+		if manifest, ok := registry.manifests[reference]; ok {
+			var mediaType struct {
+				MediaType string `json:"mediaType"`
+			}
+			_ = json.Unmarshal([]byte(manifest), &mediaType)
+			writer.Header().Set("Content-Type", mediaType.MediaType)
+			fmt.Fprint(writer, manifest)
+			return
+		}
+	}
+	if digest, ok := strings.CutPrefix(path, "blobs/"); found && ok {
+		if content, ok := registry.blobs[digest]; ok {
+			registry.pulled = append(registry.pulled, digest)
+			_, _ = writer.Write(content)
+			return
+		}
+	}
+	writer.WriteHeader(http.StatusNotFound)
+}
+
+// image returns the manifest of an architecture of the placeholder.
+func (registry *testRegistry) image(architecture string) (string, registryManifest) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	var index registryManifest
+	_ = json.Unmarshal([]byte(registry.manifests[placeholderTag]), &index)
+	for _, platform := range index.Manifests {
+		if platform.Platform.Architecture == architecture {
+			var manifest registryManifest
+			_ = json.Unmarshal([]byte(registry.manifests[platform.Digest]), &manifest)
+			return registry.manifests[platform.Digest], manifest
+		}
+	}
+	return "", registryManifest{}
+}
+
+// createTestECSCluster creates the roles and the cluster the way createAll does, every ecs resource named name.
+func createTestECSCluster(name string, image Image) (*string, error) {
+	var min int32 = 1
+	var max int32 = 3
+	var desired int32 = 1
+	roles, err := CreateECSRoles(io.Discard, aws.String(testRegion), &name, LaunchTypeEC2)
+	if err != nil {
+		return nil, err
+	}
+	return CreateECSCluster(io.Discard, aws.String(testRegion), &name, &name, &name, aws.String(ECRImageURI(fakeAccountId, testRegion, name)),
+		&min, &max, &desired, ec2Types.InstanceTypeT2Micro, image, &testContainer, LaunchTypeEC2, roles)
+}
+
+func TestCreateS3Website(t *testing.T) {
+	// the zone of app.example.com when a test delegates it
+	var delegatedZoneId string
+	tests := []struct {
+		name   string
+		domain string
+		noWWW  bool
+		setup  func(cloud *fakeCloud)
+		check  func(t *testing.T, cloud *fakeCloud, zoneId string, distributionId *string, err error)
+	}{
+		{
+			name:   "creates the site",
+			domain: testDomain,
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, distributionId *string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				bucketName, _ := stackNames()
+				for _, name := range []string{bucketName, "www." + bucketName} {
+					bucket := cloud.buckets[name]
+					if bucket == nil {
+						t.Fatalf("bucket %s was not created", name)
+					}
+					if bucket.publicBlocked || bucket.policy == "" || bucket.website == nil || cloud.stackTags["arn:aws:s3:::"+name] != BaseUUIDTagValue {
+						t.Errorf("bucket %s is not a public website of the stack", name)
+					}
+				}
+				redirect := cloud.buckets["www."+bucketName].website.RedirectAllRequestsTo
+				if redirect == nil || *redirect.HostName != testDomain {
+					t.Errorf("www bucket does not redirect to %s", testDomain)
+				}
+				if len(cloud.distributions) != 2 {
+					t.Fatalf("got %d distributions, want 2", len(cloud.distributions))
+				}
+				distribution := cloud.distributions[*distributionId]
+				if distribution == nil || distribution.distribution.DistributionConfig.Aliases.Items[0] != testDomain {
+					t.Errorf("distribution %s is not the one of %s", *distributionId, testDomain)
+				}
+				for _, domain := range []string{testDomain, "www." + testDomain} {
+					record := findZoneRecord(cloud, zoneId, domain, route53Types.RRTypeA)
+					if record == nil || record.AliasTarget == nil || !strings.HasSuffix(*record.AliasTarget.DNSName, ".cloudfront.net") {
+						t.Errorf("no cloudfront alias record for %s", domain)
+					}
+				}
+				if len(cloud.certificates) != 1 {
+					t.Fatalf("got %d certificates, want 1", len(cloud.certificates))
+				}
+				for _, certificate := range cloud.certificates {
+					if certificate.region != "us-east-1" || certificate.certificate.Status != acmTypes.CertificateStatusIssued {
+						t.Errorf("certificate is %s in %s, want ISSUED in us-east-1", certificate.certificate.Status, certificate.region)
+					}
+				}
+				if len(GetStateResources(S3Bucket)) != 2 || len(GetStateResources(CloudFrontDistribution)) != 2 {
+					t.Errorf("buckets and distributions are not in the state")
+				}
+			},
+		},
+		{
+			name:   "subdomain in the zone of its parent",
+			domain: "app." + testDomain,
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, distributionId *string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, domain := range []string{"app." + testDomain, "www.app." + testDomain} {
+					if findZoneRecord(cloud, zoneId, domain, route53Types.RRTypeA) == nil {
+						t.Errorf("no alias record for %s in the zone of %s", domain, testDomain)
+					}
+				}
+				bucketName, _ := stackNames()
+				redirect := cloud.buckets["www."+bucketName].website.RedirectAllRequestsTo
+				if redirect == nil || *redirect.HostName != "app."+testDomain {
+					t.Errorf("www bucket does not redirect to app.%s", testDomain)
+				}
+			},
+		},
+		{
+			name:   "subdomain delegated to a zone of its own",
+			domain: "app." + testDomain,
+			setup: func(cloud *fakeCloud) {
+				delegatedZoneId = cloud.addHostedZone("app." + testDomain)
+			},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, distributionId *string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if findZoneRecord(cloud, delegatedZoneId, "app."+testDomain, route53Types.RRTypeA) == nil {
+					t.Errorf("no alias record in the zone of app.%s", testDomain)
+				}
+				if records := cloud.records(zoneId); len(records) != 0 {
+					t.Errorf("expected nothing in the zone of %s, got %d records", testDomain, len(records))
+				}
+			},
+		},
+		{
+			name:   "multi-label tld",
+			domain: "example.co.uk",
+			setup: func(cloud *fakeCloud) {
+				delegatedZoneId = cloud.addHostedZone("example.co.uk")
+			},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, distributionId *string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if findZoneRecord(cloud, delegatedZoneId, "www.example.co.uk", route53Types.RRTypeA) == nil {
+					t.Errorf("no alias record for www.example.co.uk")
+				}
+			},
+		},
+		{
+			name:   "without www",
+			domain: testDomain,
+			noWWW:  true,
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, distributionId *string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(cloud.buckets) != 1 || len(cloud.distributions) != 1 {
+					t.Errorf("got %d buckets and %d distributions, want 1 of each", len(cloud.buckets), len(cloud.distributions))
+				}
+				if findZoneRecord(cloud, zoneId, "www."+testDomain, route53Types.RRTypeA) != nil {
+					t.Errorf("a www record was created")
+				}
+				for _, certificate := range cloud.certificates {
+					if names := certificate.certificate.SubjectAlternativeNames; !slices.Equal(names, []string{testDomain, "*." + testDomain}) {
+						t.Errorf("expected a wildcard certificate of %s, got %v", testDomain, names)
+					}
+				}
+			},
+		},
+		{
+			name:   "adopts a bucket of the stack",
+			domain: testDomain,
+			setup: func(cloud *fakeCloud) {
+				bucketName, _ := stackNames()
+				cloud.addBucket(bucketName, testRegion, BaseUUIDTagValue)
+			},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, distributionId *string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if count := cloud.callCount("S3.CreateBucket"); count != 1 {
+					t.Errorf("S3.CreateBucket was called %d times, want 1", count)
+				}
+				if len(GetStateResources(S3Bucket)) != 2 {
+					t.Errorf("the adopted bucket is not in the state")
+				}
+			},
+		},
+		{
+			name:   "fails on a bucket of another stack",
+			domain: testDomain,
+			setup: func(cloud *fakeCloud) {
+				bucketName, _ := stackNames()
+				cloud.addBucket(bucketName, testRegion, "other-stack")
+			},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, distributionId *string, err error) {
+				if ClassifyError(err) != ErrorAlreadyExists {
+					t.Fatalf("got %v, want an already exists error", err)
+				}
+				if cloud.stackTags["arn:aws:s3:::"+testDomain+"-"+BaseUUIDTagValue] != "other-stack" {
+					t.Errorf("the bucket of the other stack was changed")
+				}
+			},
+		},
+		{
+			name:   "fails without a hosted zone",
+			domain: "example.org",
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, distributionId *string, err error) {
+				if err == nil || !strings.Contains(err.Error(), "example.org") {
+					t.Fatalf("got %v, want a missing hosted zone error", err)
+				}
+				if len(cloud.distributions) != 0 {
+					t.Errorf("a distribution was created without a certificate")
+				}
+			},
+		},
+		{
+			name:   "fails when cloudfront denies access",
+			domain: testDomain,
+			setup: func(cloud *fakeCloud) {
+				cloud.fail("CloudFront.CreateDistributionWithTags", fakeError("AccessDenied", "User is not authorized to perform: cloudfront:CreateDistribution"))
+			},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, distributionId *string, err error) {
+				if ClassifyError(err) != ErrorAccessDenied {
+					t.Fatalf("got %v, want an access denied error", err)
+				}
+				if findZoneRecord(cloud, zoneId, testDomain, route53Types.RRTypeA) != nil {
+					t.Errorf("an alias record was created without a distribution")
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cloud, zoneId := newTestCloud(t)
+			if test.setup != nil {
+				test.setup(cloud)
+			}
+			bucketName, _ := stackNames()
+			distributionId, err := CreateS3Website(io.Discard, &bucketName, aws.String(test.domain), aws.String(testRegion), !test.noWWW)
+			test.check(t, cloud, zoneId, distributionId, err)
+		})
+	}
+}
+
+func TestCreateECSCluster(t *testing.T) {
+	tests := []struct {
+		name  string
+		runs  int
+		image Image
+		setup func(cloud *fakeCloud)
+		check func(t *testing.T, cloud *fakeCloud, arn *string, err error)
+	}{
+		{
+			name:  "creates the cluster",
+			runs:  1,
+			image: AmazonLinux2,
+			check: func(t *testing.T, cloud *fakeCloud, arn *string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, name := stackNames()
+				cluster := cloud.clusters[*arn]
+				if cluster == nil || *cluster.value.Status != "ACTIVE" || !slices.Contains(cluster.value.CapacityProviders, name) {
+					t.Fatalf("cluster %s is not active with capacity provider %s", *arn, name)
+				}
+				if cloud.autoScalingGroups[testRegion+"/"+name] == nil || cloud.launchTemplates[testRegion+"/"+name] == nil {
+					t.Errorf("auto scaling group or launch template %s was not created", name)
+				}
+				if len(cloud.securityGroups) != 1 || len(cloud.taskDefinitions) != 1 {
+					t.Errorf("got %d security groups and %d task definitions, want 1 and 1", len(cloud.securityGroups), len(cloud.taskDefinitions))
+				}
+				// the new roles and the instance profile are read back before they are used, after the profile of the account
+				// is looked up and the one of the stack is checked for
+				if cloud.callCount("IAM.GetRole") != 2 || cloud.callCount("IAM.GetInstanceProfile") != 3 {
+					t.Errorf("expected the roles and the instance profile to be waited for, got %d and %d reads",
+						cloud.callCount("IAM.GetRole"), cloud.callCount("IAM.GetInstanceProfile"))
+				}
+				for _, definition := range cloud.taskDefinitions {
+					logs := definition.value.ContainerDefinitions[0].LogConfiguration
+					if logs == nil || logs.LogDriver != ecsTypes.LogDriverAwslogs || logs.Options["awslogs-group"] != LogGroupName(name) ||
+						logs.Options["awslogs-region"] != testRegion {
+						t.Errorf("expected the container to log to %s in %s, got %+v", LogGroupName(name), testRegion, logs)
+					}
+				}
+				for _, definition := range cloud.taskDefinitions {
+					container := definition.value.ContainerDefinitions[0]
+					if container.Cpu != testContainer.CPU || aws.ToInt32(container.PortMappings[0].HostPort) != testContainer.HostPort {
+						t.Errorf("expected %d cpu units and host port %d, got %d and %d", testContainer.CPU, testContainer.HostPort,
+							container.Cpu, aws.ToInt32(container.PortMappings[0].HostPort))
+					}
+				}
+				for _, definition := range cloud.taskDefinitions {
+					if aws.ToString(definition.value.ExecutionRoleArn) != *cloud.roles[ExecutionRoleName(name)].role.Arn ||
+						aws.ToString(definition.value.TaskRoleArn) != *cloud.roles[TaskRoleName(name)].role.Arn {
+						t.Errorf("expected the execution and task roles of the stack, got %s and %s",
+							aws.ToString(definition.value.ExecutionRoleArn), aws.ToString(definition.value.TaskRoleArn))
+					}
+				}
+				instanceRole := InstanceRoleName(name)
+				if profile := cloud.launchTemplates[testRegion+"/"+name].data.IamInstanceProfile; aws.ToString(profile.Name) != instanceRole {
+					t.Errorf("expected the instance profile %s, got %s", instanceRole, aws.ToString(profile.Name))
+				}
+				profile := cloud.instanceProfiles[instanceRole]
+				if profile == nil || len(profile.Roles) != 1 || *profile.Roles[0].RoleName != instanceRole {
+					t.Errorf("instance profile %s does not have the role %s", instanceRole, instanceRole)
+				}
+				for role, policy := range map[string]string{instanceRole: ecsInstancePolicyArn, ExecutionRoleName(name): ecsTaskExecutionPolicyArn} {
+					attached := cloud.roles[role].attached
+					if len(attached) != 1 || *attached[0].PolicyArn != policy {
+						t.Errorf("expected %s to have %s attached, got %v", role, policy, attached)
+					}
+				}
+				if attached := cloud.roles[TaskRoleName(name)].attached; len(attached) != 0 {
+					t.Errorf("expected the task role to have no policies, got %v", attached)
+				}
+				for _, identifier := range []ResourceIdentifier{AutoScalingGroup, EC2LaunchTemplate, EC2SecurityGroup, ECSCapacityProvider, ECSCluster, ECSTaskDefinition} {
+					if len(GetStateResources(identifier)) != 1 {
+						t.Errorf("%s is not in the state", identifier)
+					}
+				}
+				if len(GetStateResources(IAMRole)) != 3 {
+					t.Errorf("got %d roles in the state, want 3", len(GetStateResources(IAMRole)))
+				}
+			},
+		},
+		{
+			name:  "adopts everything on a rerun",
+			runs:  2,
+			image: AmazonLinux2,
+			check: func(t *testing.T, cloud *fakeCloud, arn *string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, operation := range []string{"EC2.CreateSecurityGroup", "EC2.CreateLaunchTemplate", "AutoScaling.CreateAutoScalingGroup",
+					"ECS.CreateCapacityProvider", "ECS.CreateCluster", "ECS.RegisterTaskDefinition", "IAM.CreateInstanceProfile",
+					"IAM.AddRoleToInstanceProfile"} {
+					if count := cloud.callCount(operation); count != 1 {
+						t.Errorf("%s was called %d times, want 1", operation, count)
+					}
+				}
+				if len(GetStateResources("")) != 9 {
+					t.Errorf("got %d resources in the state, want 9", len(GetStateResources("")))
+				}
+			},
+		},
+		{
+			name:  "uses the ecsInstanceRole of the account",
+			runs:  1,
+			image: AmazonLinux2,
+			setup: func(cloud *fakeCloud) {
+				cloud.addInstanceProfile(ecsInstanceProfileName, ecsInstanceProfileName)
+			},
+			check: func(t *testing.T, cloud *fakeCloud, arn *string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, name := stackNames()
+				if profile := cloud.launchTemplates[testRegion+"/"+name].data.IamInstanceProfile; aws.ToString(profile.Name) != ecsInstanceProfileName {
+					t.Errorf("expected the instance profile %s, got %s", ecsInstanceProfileName, aws.ToString(profile.Name))
+				}
+				if cloud.roles[InstanceRoleName(name)] != nil || len(cloud.instanceProfiles) != 1 {
+					t.Errorf("an instance profile of the stack was created next to %s", ecsInstanceProfileName)
+				}
+			},
+		},
+		{
+			name:  "fails without the image",
+			runs:  1,
+			image: Image{name: "amzn2-ami-ecs-hvm-missing"},
+			check: func(t *testing.T, cloud *fakeCloud, arn *string, err error) {
+				if err == nil || !strings.Contains(err.Error(), "no images found") {
+					t.Fatalf("got %v, want a missing image error", err)
+				}
+				if len(cloud.autoScalingGroups) != 0 {
+					t.Errorf("an auto scaling group was created without a launch template")
+				}
+			},
+		},
+		{
+			name:  "fails when the capacity provider can not be created",
+			runs:  1,
+			image: AmazonLinux2,
+			setup: func(cloud *fakeCloud) {
+				cloud.fail("ECS.CreateCapacityProvider", fakeError("ClientException", "The specified Auto Scaling group ARN is not valid."))
+			},
+			check: func(t *testing.T, cloud *fakeCloud, arn *string, err error) {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				if len(cloud.clusters) != 0 {
+					t.Errorf("a cluster was created without a capacity provider")
+				}
+				if len(GetStateResources(AutoScalingGroup)) != 1 {
+					t.Errorf("the auto scaling group created before the failure is not in the state")
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cloud, _ := newTestCloud(t)
+			if test.setup != nil {
+				test.setup(cloud)
+			}
+			_, name := stackNames()
+			var arn *string
+			var err error
+			for i := 0; i < test.runs && err == nil; i++ {
+				arn, err = createTestECSCluster(name, test.image)
+			}
+			test.check(t, cloud, arn, err)
+		})
+	}
+}
+
+func TestCreateELB(t *testing.T) {
+	apiDomain := "main-api." + testDomain
+	// the certificate a test adds before the run
+	var reusedArn string
+	tests := []struct {
+		name          string
+		runs          int
+		securityGroup bool
+		setup         func(cloud *fakeCloud)
+		check         func(t *testing.T, cloud *fakeCloud, zoneId string, err error)
+	}{
+		{
+			name:          "creates the load balancer",
+			runs:          1,
+			securityGroup: true,
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(cloud.loadBalancers) != 1 || len(cloud.targetGroups) != 1 || len(cloud.listeners) != 1 {
+					t.Fatalf("got %d load balancers, %d target groups and %d listeners, want 1 each",
+						len(cloud.loadBalancers), len(cloud.targetGroups), len(cloud.listeners))
+				}
+				var loadBalancer *fakeRegional[elbTypes.LoadBalancer]
+				for _, found := range cloud.loadBalancers {
+					loadBalancer = found
+				}
+				for _, listener := range cloud.listeners {
+					if *listener.value.Port != 443 || *listener.value.LoadBalancerArn != *loadBalancer.value.LoadBalancerArn {
+						t.Errorf("listener %s is not the https listener of the load balancer", *listener.value.ListenerArn)
+					}
+					certificate := cloud.certificates[*listener.value.Certificates[0].CertificateArn]
+					if certificate == nil || certificate.region != testRegion || certificate.certificate.Status != acmTypes.CertificateStatusIssued {
+						t.Errorf("listener does not use an issued certificate of %s", testRegion)
+					} else if !coversDomains(certificate.certificate.SubjectAlternativeNames, []string{testDomain, "www." + testDomain, apiDomain}) {
+						t.Errorf("certificate does not cover %s", apiDomain)
+					}
+				}
+				record := findZoneRecord(cloud, zoneId, apiDomain, route53Types.RRTypeA)
+				if record == nil || record.AliasTarget == nil || *record.AliasTarget.DNSName != *loadBalancer.value.DNSName {
+					t.Errorf("no load balancer alias record for %s", apiDomain)
+				}
+			},
+		},
+		{
+			name:          "adopts everything on a rerun",
+			runs:          2,
+			securityGroup: true,
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, operation := range []string{"ELB.CreateLoadBalancer", "ELB.CreateTargetGroup", "ELB.CreateListener", "ACM.RequestCertificate"} {
+					if count := cloud.callCount(operation); count != 1 {
+						t.Errorf("%s was called %d times, want 1", operation, count)
+					}
+				}
+			},
+		},
+		{
+			name:          "reuses an issued wildcard certificate",
+			runs:          1,
+			securityGroup: true,
+			setup: func(cloud *fakeCloud) {
+				reusedArn = cloud.addCertificate(testRegion, []string{"*." + testDomain, testDomain}, "")
+			},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if count := cloud.callCount("ACM.RequestCertificate"); count != 0 {
+					t.Errorf("ACM.RequestCertificate was called %d times, want 0", count)
+				}
+				for _, listener := range cloud.listeners {
+					if *listener.value.Certificates[0].CertificateArn != reusedArn {
+						t.Errorf("listener uses %s, want %s", *listener.value.Certificates[0].CertificateArn, reusedArn)
+					}
+				}
+				if len(GetStateResources(CertificateManagerCertificate)) != 0 {
+					t.Errorf("the reused certificate is a resource of the stack")
+				}
+				_, name := stackNames()
+				err = DeleteResources(aws.String(testRegion), &name, aws.String(testDomain))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cloud.certificates[reusedArn] == nil {
+					t.Errorf("delete deleted the reused certificate")
+				}
+			},
+		},
+		{
+			name:          "requests a certificate when none covers every name",
+			runs:          1,
+			securityGroup: true,
+			setup: func(cloud *fakeCloud) {
+				cloud.addCertificate(testRegion, []string{testDomain, "www." + testDomain}, "")
+				cloud.addCertificate(testRegion, []string{"*.example.org", "example.org"}, "")
+				cloud.addCertificate("us-east-1", []string{"*." + testDomain, testDomain}, "")
+			},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if count := cloud.callCount("ACM.RequestCertificate"); count != 1 {
+					t.Errorf("ACM.RequestCertificate was called %d times, want 1", count)
+				}
+			},
+		},
+		{
+			name:          "skips the certificate of another stack",
+			runs:          1,
+			securityGroup: true,
+			setup: func(cloud *fakeCloud) {
+				reusedArn = cloud.addCertificate(testRegion, []string{"*." + testDomain, testDomain}, "0ther000-0000")
+			},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, listener := range cloud.listeners {
+					if *listener.value.Certificates[0].CertificateArn == reusedArn {
+						t.Errorf("listener uses the certificate of another stack")
+					}
+				}
+			},
+		},
+		{
+			name:          "fails without the security group of the cluster",
+			runs:          1,
+			securityGroup: false,
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, err error) {
+				if err == nil || !strings.Contains(err.Error(), "no security group") {
+					t.Fatalf("got %v, want a missing security group error", err)
+				}
+				if len(cloud.loadBalancers) != 0 {
+					t.Errorf("a load balancer was created without a security group")
+				}
+			},
+		},
+		{
+			name:          "fails when route53 fails",
+			runs:          1,
+			securityGroup: true,
+			setup: func(cloud *fakeCloud) {
+				cloud.fail("Route53.ChangeResourceRecordSets", fakeError("InvalidChangeBatch", "Invalid request"))
+			},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, err error) {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				if len(cloud.listeners) != 0 {
+					t.Errorf("a listener was created without a validated certificate")
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cloud, zoneId := newTestCloud(t)
+			_, name := stackNames()
+			if test.securityGroup {
+				_, err := createSecurityGroup(aws.String(testRegion), &name, clusterIngress(aws.Int32(0)))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.setup != nil {
+				test.setup(cloud)
+			}
+			var err error
+			for i := 0; i < test.runs && err == nil; i++ {
+				err = CreateELB(io.Discard, aws.String(testRegion), aws.String(testDomain), &apiDomain, &name, &name, true, LaunchTypeEC2)
+			}
+			test.check(t, cloud, zoneId, err)
+		})
+	}
+}
+
+// createTestStack creates the resources createAll creates in aws, github aside.
+func createTestStack(t *testing.T) {
+	t.Helper()
+	createTestStackIn(t, testRegion, LaunchTypeEC2)
+}
+
+func createTestStackIn(t *testing.T, region string, launchType LaunchType) {
+	t.Helper()
+	bucketName, name := stackNames()
+	apiDomain := "main-api." + testDomain
+	err := CreateResourceGroup(io.Discard, &name, &region)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = CreateS3Website(io.Discard, &bucketName, aws.String(testDomain), &region, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageURI, err := CreateECR(io.Discard, &region, aws.String(testECRName()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var retentionDays int32 = 14
+	err = CreateLogGroup(io.Discard, &region, aws.String(LogGroupName(name)), &retentionDays)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles, err := CreateECSRoles(io.Discard, &region, &name, launchType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var min, max, desired int32 = 1, 3, 1
+	ecsArn, err := CreateECSCluster(io.Discard, &region, &name, &name, &name, imageURI, &min, &max, &desired, ec2Types.InstanceTypeT2Micro,
+		AmazonLinux2, &testContainer, launchType, roles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CreateELB(io.Discard, &region, aws.String(testDomain), &apiDomain, &name, &name, true, launchType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ConnectECSServiceToALB(io.Discard, &region, &name, ecsArn, &name, &name, &name, &testContainer.ContainerPort, &name, launchType)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStackInGlobalRegion(t *testing.T) {
+	cloud, zoneId := newTestCloud(t)
+	createTestStackIn(t, globalRegion, LaunchTypeEC2)
+	if groups := GetStateResources(ResourceGroupsGroup); len(groups) != 1 || groups[0].Region != globalRegion {
+		t.Errorf("expected a single resource group in us-east-1, got %v", groups)
+	}
+	bucketName, _ := stackNames()
+	if bucket := cloud.buckets[bucketName]; bucket == nil || bucket.region != globalRegion {
+		t.Fatalf("expected the bucket in us-east-1, got %v", bucket)
+	}
+	if record := findZoneRecord(cloud, zoneId, testDomain, route53Types.RRTypeA); record == nil {
+		t.Errorf("expected the record of the distribution")
+	}
+	if len(cloud.certificates) != 1 {
+		t.Errorf("expected the distribution and the load balancer to share a certificate, got %d", len(cloud.certificates))
+	}
+
+	err := DeleteResources(aws.String(globalRegion), aws.String("cloudGun-"+BaseUUIDTagValue), aws.String(testDomain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := cloud.liveResources(); count != 0 {
+		t.Errorf("%d resources are left in aws", count)
+	}
+}
+
+func TestFargateStack(t *testing.T) {
+	cloud, _ := newTestCloud(t)
+	createTestStackIn(t, testRegion, LaunchTypeFargate)
+	if len(cloud.autoScalingGroups) != 0 || len(cloud.launchTemplates) != 0 || len(cloud.capacityProviders) != 0 {
+		t.Errorf("expected no instances for fargate, got %d groups, %d templates and %d capacity providers",
+			len(cloud.autoScalingGroups), len(cloud.launchTemplates), len(cloud.capacityProviders))
+	}
+	if len(cloud.instanceProfiles) != 0 || len(cloud.roles) != 2 {
+		t.Errorf("expected the execution and task roles only, got %d roles and %d instance profiles", len(cloud.roles), len(cloud.instanceProfiles))
+	}
+	for _, definition := range cloud.taskDefinitions {
+		if aws.ToString(definition.value.ExecutionRoleArn) == "" {
+			t.Errorf("expected an execution role, fargate needs it to pull the image and to write the logs")
+		}
+		if definition.value.NetworkMode != ecsTypes.NetworkModeAwsvpc || aws.ToString(definition.value.Cpu) != "512" || aws.ToString(definition.value.Memory) != "1024" {
+			t.Errorf("expected an awsvpc task of 512 cpu and 1024 MiB, got %s %s %s",
+				definition.value.NetworkMode, aws.ToString(definition.value.Cpu), aws.ToString(definition.value.Memory))
+		}
+		if image := aws.ToString(definition.value.ContainerDefinitions[0].Image); image != ECRImageURI(fakeAccountId, testRegion, testECRName()) {
+			t.Errorf("expected the image of the ecr repository, got %s", image)
+		}
+	}
+	for _, group := range cloud.targetGroups {
+		if group.value.TargetType != elbTypes.TargetTypeEnumIp {
+			t.Errorf("expected an ip target group, got %s", group.value.TargetType)
+		}
+	}
+	var loadBalancerGroups []string
+	for _, loadBalancer := range cloud.loadBalancers {
+		loadBalancerGroups = loadBalancer.value.SecurityGroups
+	}
+	if len(loadBalancerGroups) != 1 {
+		t.Fatalf("expected a security group of the load balancer, got %v", loadBalancerGroups)
+	}
+	for _, service := range cloud.services {
+		if service.value.LaunchType != ecsTypes.LaunchTypeFargate || service.value.NetworkConfiguration == nil {
+			t.Fatalf("expected a fargate service in the vpc, got %s", service.value.LaunchType)
+		}
+		taskGroups := service.value.NetworkConfiguration.AwsvpcConfiguration.SecurityGroups
+		if len(taskGroups) != 1 || taskGroups[0] == loadBalancerGroups[0] {
+			t.Fatalf("expected a security group of the tasks, got %v", taskGroups)
+		}
+		for _, permission := range cloud.securityGroups[taskGroups[0]].group.IpPermissions {
+			if len(permission.IpRanges) != 0 || len(permission.UserIdGroupPairs) != 1 || *permission.UserIdGroupPairs[0].GroupId != loadBalancerGroups[0] {
+				t.Errorf("expected the tasks to only admit the load balancer, got %+v", permission)
+			}
+			if *permission.FromPort != testContainer.ContainerPort {
+				t.Errorf("expected the container port, got %d", *permission.FromPort)
+			}
+		}
+	}
+
+	err := DeleteResources(aws.String(testRegion), aws.String("cloudGun-"+BaseUUIDTagValue), aws.String(testDomain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := cloud.liveResources(); count != 0 {
+		t.Errorf("%d resources are left in aws", count)
+	}
+}
+
+func TestGetHostedZoneId(t *testing.T) {
+	tests := []struct {
+		name     string
+		zones    []string
+		domain   string
+		wantZone string
+	}{
+		{name: "apex", zones: []string{"example.com"}, domain: "example.com", wantZone: "example.com"},
+		{name: "subdomain", zones: []string{"example.com"}, domain: "app.example.com", wantZone: "example.com"},
+		{name: "longest match", zones: []string{"example.com", "app.example.com"}, domain: "www.app.example.com", wantZone: "app.example.com"},
+		{name: "multi-label tld", zones: []string{"co.uk", "example.co.uk"}, domain: "example.co.uk", wantZone: "example.co.uk"},
+		{name: "match on a later page", zones: []string{"a.com", "b.com", "c.com", "example.com", "d.com"}, domain: "api.example.com", wantZone: "example.com"},
+		{name: "only a suffix", zones: []string{"ample.com"}, domain: "example.com"},
+		{name: "no zone", zones: []string{"example.org"}, domain: "example.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cloud := newFakeCloud()
+			SetClientProvider(cloud)
+			t.Cleanup(func() { SetClientProvider(sdkClientProvider{}) })
+			cloud.hostedZonePageSize = 2
+			zoneIds := make(map[string]string)
+			for _, zone := range test.zones {
+				zoneIds[cloud.addHostedZone(zone)] = zone
+			}
+
+			zoneId, err := getHostedZoneId(aws.String(testRegion), &test.domain)
+			if test.wantZone == "" {
+				if err == nil {
+					t.Fatalf("expected no zone, got %s", zoneIds[*zoneId])
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if zoneIds[*zoneId] != test.wantZone {
+				t.Errorf("expected the zone of %s, got %s", test.wantZone, zoneIds[*zoneId])
+			}
+		})
+	}
+}
+
+// serveTestDNS answers the NS queries of SetResolver with the name servers answer gives for a name,
+// or with NXDOMAIN when it gives none, like a public resolver before and after a delegation.
+func serveTestDNS(t *testing.T, answer func(name string) []string) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buffer := make([]byte, 1232)
+		for {
+			n, address, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			var parser dnsmessage.Parser
+			header, err := parser.Start(buffer[:n])
+			if err != nil {
+				continue
+			}
+			question, err := parser.Question()
+			if err != nil {
+				continue
+			}
+			nameServers := answer(question.Name.String())
+			response := dnsmessage.Header{ID: header.ID, Response: true, Authoritative: true, RecursionDesired: header.RecursionDesired}
+			if len(nameServers) == 0 {
+				response.RCode = dnsmessage.RCodeNameError
+			}
+			builder := dnsmessage.NewBuilder(nil, response)
+			_ = builder.StartQuestions()
+			_ = builder.Question(question)
+			_ = builder.StartAnswers()
+			for _, nameServer := range nameServers {
+				_ = builder.NSResource(
+					dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeNS, Class: dnsmessage.ClassINET, TTL: 60},
+					dnsmessage.NSResource{NS: dnsmessage.MustNewName(fqdn(nameServer))},
+				)
+			}
+			message, err := builder.Finish()
+			if err != nil {
+				continue
+			}
+			_, _ = conn.WriteTo(message, address)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestCreateHostedZone(t *testing.T) {
+	tests := []struct {
+		name        string
+		zones       []string
+		domain      string
+		delegation  string // zone, other or none
+		lookups     int    // NXDOMAIN answers before the delegation shows
+		wantZone    string
+		wantCreated bool
+		wantErr     string
+	}{
+		{name: "new zone", domain: "example.com", delegation: "zone", lookups: 1, wantZone: "example.com", wantCreated: true},
+		{name: "existing zone", zones: []string{"example.com"}, domain: "example.com", delegation: "zone", wantZone: "example.com"},
+		{name: "zone of the parent domain", zones: []string{"example.com"}, domain: "app.example.com", delegation: "zone", wantZone: "example.com"},
+		{name: "name servers of another zone", zones: []string{"example.com"}, domain: "example.com", delegation: "other", wantErr: "did not finish"},
+		{name: "not delegated", domain: "example.com", delegation: "none", wantErr: "did not finish"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cloud := newFakeCloud()
+			SetClientProvider(cloud)
+			timeouts := Timeouts
+			Timeouts.NameServersDelegated = 3 * time.Second
+			t.Cleanup(func() {
+				SetClientProvider(sdkClientProvider{})
+				Timeouts = timeouts
+				Resolver = net.DefaultResolver
+			})
+			for _, zone := range test.zones {
+				cloud.addHostedZone(zone)
+			}
+
+			lookups := 0
+			SetResolver(serveTestDNS(t, func(name string) []string {
+				cloud.mutex.Lock()
+				defer cloud.mutex.Unlock()
+				lookups++
+				if test.delegation == "none" || lookups <= test.lookups {
+					return nil
+				} else if test.delegation == "other" {
+					return []string{"ns1.registrar-parking.com", "ns2.registrar-parking.com"}
+				}
+				for _, zone := range cloud.hostedZones {
+					if *zone.zone.Name == fqdn(name) {
+						return zone.nameServers
+					}
+				}
+				return nil
+			}))
+
+			err := CreateHostedZone(aws.String(testRegion), &test.domain)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected an error with %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created := slices.Contains(cloud.calls, "Route53.CreateHostedZone"); created != test.wantCreated {
+				t.Errorf("expected a new zone %t, got %t", test.wantCreated, created)
+			}
+			zoneId, err := getHostedZoneId(aws.String(testRegion), &test.domain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name := *cloud.hostedZones[*zoneId].zone.Name; name != fqdn(test.wantZone) {
+				t.Errorf("expected the zone of %s, got %s", test.wantZone, name)
+			}
+		})
+	}
+}
+
+func TestFargateTaskSize(t *testing.T) {
+	tests := []struct {
+		cpu, memory         int32
+		wantCPU, wantMemory int32
+		wantErr             bool
+	}{
+		{cpu: 256, memory: 128, wantCPU: 256, wantMemory: 512},
+		{cpu: 256, memory: 700, wantCPU: 256, wantMemory: 1024},
+		{cpu: 256, memory: 3000, wantCPU: 512, wantMemory: 3072},
+		{cpu: 512, memory: 102, wantCPU: 512, wantMemory: 1024},
+		{cpu: 1000, memory: 512, wantCPU: 1024, wantMemory: 2048},
+		{cpu: 4096, memory: 30720, wantCPU: 4096, wantMemory: 30720},
+		{cpu: 8192, memory: 512, wantErr: true},
+		{cpu: 256, memory: 40000, wantErr: true},
+	}
+	for _, test := range tests {
+		cpu, memory, err := FargateTaskSize(&ContainerSpec{CPU: test.cpu, MemoryMiB: test.memory})
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("expected an error for %d cpu and %d MiB, got %d and %d", test.cpu, test.memory, cpu, memory)
+			}
+			continue
+		}
+		if err != nil || cpu != test.wantCPU || memory != test.wantMemory {
+			t.Errorf("expected %d cpu and %d MiB for %d and %d, got %d and %d %v", test.wantCPU, test.wantMemory, test.cpu, test.memory, cpu, memory, err)
+		}
+	}
+}
+
+func TestGetBucketWebsiteDomain(t *testing.T) {
+	tests := []struct {
+		region string
+		want   string
+	}{
+		{region: "us-east-1", want: "bucket.s3-website-us-east-1.amazonaws.com"},
+		{region: "ap-northeast-1", want: "bucket.s3-website-ap-northeast-1.amazonaws.com"},
+		{region: "ap-northeast-2", want: "bucket.s3-website.ap-northeast-2.amazonaws.com"},
+	}
+	for _, test := range tests {
+		if got := getBucketWebsiteDomain(&test.region, aws.String("bucket")); got != test.want {
+			t.Errorf("expected %s in %s, got %s", test.want, test.region, got)
+		}
+	}
+}
+
+func TestCreateECR(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, cloud *fakeCloud, registry *testRegistry)
+		check   func(t *testing.T, cloud *fakeCloud, registry *testRegistry, repository *fakeRepository)
+		wantErr string
+	}{
+		{
+			name: "seeds the placeholder of linux/amd64",
+			check: func(t *testing.T, cloud *fakeCloud, registry *testRegistry, repository *fakeRepository) {
+				manifest, image := registry.image("amd64")
+				if repository.images[applicationTag] != manifest {
+					t.Errorf("expected the amd64 manifest as %s, got %s", applicationTag, repository.images[applicationTag])
+				}
+				for _, blob := range append([]registryDescriptor{image.Config}, image.Layers...) {
+					if string(repository.layers[blob.Digest]) != string(registry.blobs[blob.Digest]) {
+						t.Errorf("expected the blob %s in the repository", blob.Digest)
+					}
+				}
+				if len(repository.layers) != 3 {
+					t.Errorf("expected the config and 2 layers, got %d blobs", len(repository.layers))
+				}
+			},
+		},
+		{
+			name: "keeps the image of the application",
+			setup: func(t *testing.T, cloud *fakeCloud, registry *testRegistry) {
+				err := createECRRepository(io.Discard, aws.String(testRegion), aws.String(testECRName()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				cloud.ecrRepository(testRegion, testECRName()).images[applicationTag] = "{}"
+			},
+			check: func(t *testing.T, cloud *fakeCloud, registry *testRegistry, repository *fakeRepository) {
+				if repository.images[applicationTag] != "{}" || len(registry.pulled) != 0 {
+					t.Errorf("expected the image to be kept, got %s after pulling %v", repository.images[applicationTag], registry.pulled)
+				}
+			},
+		},
+		{
+			name: "uploads the missing layers",
+			setup: func(t *testing.T, cloud *fakeCloud, registry *testRegistry) {
+				err := createECRRepository(io.Discard, aws.String(testRegion), aws.String(testECRName()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, image := registry.image("amd64")
+				base := image.Layers[0].Digest
+				cloud.ecrRepository(testRegion, testECRName()).layers[base] = registry.blobs[base]
+			},
+			check: func(t *testing.T, cloud *fakeCloud, registry *testRegistry, repository *fakeRepository) {
+				_, image := registry.image("amd64")
+				if slices.Contains(registry.pulled, image.Layers[0].Digest) || len(registry.pulled) != 2 {
+					t.Errorf("expected only the config and the missing layer to be pulled, got %v", registry.pulled)
+				}
+				if repository.images[applicationTag] == "" {
+					t.Errorf("expected the placeholder as %s", applicationTag)
+				}
+			},
+		},
+		{
+			name: "blob not matching its digest",
+			setup: func(t *testing.T, cloud *fakeCloud, registry *testRegistry) {
+				_, image := registry.image("amd64")
+				registry.blobs[image.Layers[1].Digest] = []byte("tampered")
+			},
+			wantErr: "does not match its digest",
+		},
+		{
+			name: "no placeholder in the registry",
+			setup: func(t *testing.T, cloud *fakeCloud, registry *testRegistry) {
+				delete(registry.manifests, placeholderTag)
+			},
+			wantErr: "404 Not Found",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cloud, _ := newTestCloud(t)
+			registry := serveTestRegistry(t)
+			if test.setup != nil {
+				test.setup(t, cloud, registry)
+			}
+			imageURI, err := CreateECR(io.Discard, aws.String(testRegion), aws.String(testECRName()))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected an error with %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s:latest", fakeAccountId, testRegion, testECRName())
+			if *imageURI != want {
+				t.Errorf("expected the image %s, got %s", want, *imageURI)
+			}
+			test.check(t, cloud, registry, cloud.ecrRepository(testRegion, testECRName()))
+		})
+	}
+}
+
+func TestCreateLogGroup(t *testing.T) {
+	tests := []struct {
+		name          string
+		retentionDays int32
+		setup         func(t *testing.T, cloud *fakeCloud)
+		check         func(t *testing.T, cloud *fakeCloud, group *fakeLogGroup)
+		wantErr       string
+	}{
+		{
+			name:          "creates the group",
+			retentionDays: 14,
+			check: func(t *testing.T, cloud *fakeCloud, group *fakeLogGroup) {
+				if aws.ToInt32(group.group.RetentionInDays) != 14 {
+					t.Errorf("expected a retention of 14 days, got %v", group.group.RetentionInDays)
+				}
+				if cloud.stackTags[*group.group.LogGroupArn] != BaseUUIDTagValue {
+					t.Errorf("expected the group to be tagged for the stack")
+				}
+				resources := GetStateResources(LogsLogGroup)
+				if len(resources) != 1 || resources[0].Id != *group.group.LogGroupArn {
+					t.Errorf("expected the group in the state, got %v", resources)
+				}
+			},
+		},
+		{
+			name:          "adopts the group and changes its retention",
+			retentionDays: 30,
+			setup: func(t *testing.T, cloud *fakeCloud) {
+				var retentionDays int32 = 7
+				err := CreateLogGroup(io.Discard, aws.String(testRegion), aws.String(testLogGroupName()), &retentionDays)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			check: func(t *testing.T, cloud *fakeCloud, group *fakeLogGroup) {
+				if count := cloud.callCount("Logs.CreateLogGroup"); count != 1 {
+					t.Errorf("expected one Logs.CreateLogGroup, got %d", count)
+				}
+				if aws.ToInt32(group.group.RetentionInDays) != 30 {
+					t.Errorf("expected a retention of 30 days, got %v", group.group.RetentionInDays)
+				}
+			},
+		},
+		{
+			name:          "a group of a longer name is another group",
+			retentionDays: 14,
+			setup: func(t *testing.T, cloud *fakeCloud) {
+				var retentionDays int32 = 14
+				err := CreateLogGroup(io.Discard, aws.String(testRegion), aws.String(testLogGroupName()+"-old"), &retentionDays)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			check: func(t *testing.T, cloud *fakeCloud, group *fakeLogGroup) {
+				if count := cloud.callCount("Logs.CreateLogGroup"); count != 2 || len(cloud.logGroups) != 2 {
+					t.Errorf("expected a second group, got %d groups", len(cloud.logGroups))
+				}
+			},
+		},
+		{name: "retention aws does not take", retentionDays: 10, wantErr: "retentionInDays"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cloud, _ := newTestCloud(t)
+			if test.setup != nil {
+				test.setup(t, cloud)
+			}
+			err := CreateLogGroup(io.Discard, aws.String(testRegion), aws.String(testLogGroupName()), &test.retentionDays)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected an error with %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			group := cloud.logGroups[(&fakeRegion{cloud, testRegion}).arn("logs", "log-group:"+testLogGroupName())]
+			if group == nil {
+				t.Fatalf("log group %s was not created", testLogGroupName())
+			}
+			test.check(t, cloud, group)
+		})
+	}
+}
+
+func testLogGroupName() string {
+	_, name := stackNames()
+	return LogGroupName(name)
+}
+
+// syncBuffer is written by FollowLogs while the test reads it.
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) lines() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return strings.Split(strings.TrimSpace(b.buffer.String()), "\n")
+}
+
+func TestFollowLogs(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		filter LogFilter
+		want   []string // the messages printed before the new event, then with it
+	}{
+		{name: "every event since", filter: LogFilter{Since: now.Add(-time.Hour)}, want: []string{"started", "GET /", "ERROR timed out", "GET /health", "ERROR new"}},
+		{name: "since", filter: LogFilter{Since: now.Add(-10 * time.Minute)}, want: []string{"GET /", "ERROR timed out", "GET /health", "ERROR new"}},
+		{name: "grep", filter: LogFilter{Since: now.Add(-time.Hour), Pattern: "ERROR"}, want: []string{"ERROR timed out", "ERROR new"}},
+		{name: "grep a phrase", filter: LogFilter{Since: now.Add(-time.Hour), Pattern: "\"timed out\""}, want: []string{"ERROR timed out"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cloud, _ := newTestCloud(t)
+			name := testLogGroupName()
+			var retentionDays int32 = 14
+			err := CreateLogGroup(io.Discard, aws.String(testRegion), &name, &retentionDays)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stream := "ecs/cloudGun/1"
+			cloud.addLogEvent(testRegion, name, stream, now.Add(-30*time.Minute), "started")
+			cloud.addLogEvent(testRegion, name, stream, now.Add(-5*time.Minute), "GET /")
+			cloud.addLogEvent(testRegion, name, stream, now.Add(-4*time.Minute), "ERROR timed out")
+			cloud.addLogEvent(testRegion, name, stream, now.Add(-4*time.Minute), "GET /health")
+
+			interval := logPollInterval
+			logPollInterval = 10 * time.Millisecond
+			following, cancel := context.WithCancel(context.Background())
+			SetContext(following)
+			t.Cleanup(func() {
+				logPollInterval = interval
+				SetContext(context.Background())
+			})
+			out := &syncBuffer{}
+			done := make(chan error)
+			go func() {
+				done <- FollowLogs(out, aws.String(testRegion), &name, test.filter)
+			}()
+
+			// the events of the last millisecond come again with every poll
+			for cloud.callCount("Logs.FilterLogEvents") < 6 {
+				time.Sleep(time.Millisecond)
+			}
+			cloud.addLogEvent(testRegion, name, stream, now.Add(-4*time.Minute), "ERROR new")
+			calls := cloud.callCount("Logs.FilterLogEvents")
+			for cloud.callCount("Logs.FilterLogEvents") < calls+6 {
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+			err = <-done
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			messages := make([]string, 0)
+			for _, line := range out.lines() {
+				if line != "" {
+					messages = append(messages, strings.SplitN(line, " ", 3)[2])
+				}
+			}
+			if !slices.Equal(messages, test.want) {
+				t.Errorf("expected %q, got %q", test.want, messages)
+			}
+		})
+	}
+}
+
+func TestDeployECSService(t *testing.T) {
+	cloud, _ := newTestCloud(t)
+	createTestStack(t)
+	_, name := stackNames()
+	err := DeployECSService(aws.String(testRegion), &name, &name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := cloud.callCount("ECS.UpdateService"); count != 1 {
+		t.Errorf("expected one ECS.UpdateService, got %d", count)
+	}
+
+	missing := "cloudGun-missing"
+	err = DeployECSService(aws.String(testRegion), &name, &missing)
+	if err == nil || !isNotFound(err) {
+		t.Errorf("expected the service to be not found, got %v", err)
+	}
+}
+
+// latestTaskDefinition is the last revision of the task definition of family.
+func latestTaskDefinition(cloud *fakeCloud, family string) *ecsTypes.TaskDefinition {
+	var latest *ecsTypes.TaskDefinition
+	for _, definition := range cloud.taskDefinitions {
+		if *definition.value.Family == family && (latest == nil || definition.value.Revision > latest.Revision) {
+			latest = &definition.value
+		}
+	}
+	return latest
+}
+
+func TestSetEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		run   func(name *string) error
+		check func(t *testing.T, cloud *fakeCloud, err error)
+	}{
+		{
+			name: "sets variables and secrets",
+			run: func(name *string) error {
+				err := SetEnv(aws.String(testRegion), name, name, name, map[string]string{"PORT": "8080", "NODE_ENV": "production"}, false)
+				if err != nil {
+					return err
+				}
+				return SetEnv(aws.String(testRegion), name, name, name, map[string]string{"DATABASE_PASSWORD": "s3cret"}, true)
+			},
+			check: func(t *testing.T, cloud *fakeCloud, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, name := stackNames()
+				definition := latestTaskDefinition(cloud, name)
+				container := definition.ContainerDefinitions[0]
+				if len(container.Environment) != 2 || *container.Environment[0].Name != "NODE_ENV" || *container.Environment[1].Value != "8080" {
+					t.Errorf("expected NODE_ENV and PORT in the environment, got %+v", container.Environment)
+				}
+				arn := fmt.Sprintf("arn:aws:ssm:%s:%s:parameter%sDATABASE_PASSWORD", testRegion, fakeAccountId, EnvPath(name))
+				if len(container.Secrets) != 1 || *container.Secrets[0].Name != "DATABASE_PASSWORD" || *container.Secrets[0].ValueFrom != arn {
+					t.Errorf("expected DATABASE_PASSWORD from %s, got %+v", arn, container.Secrets)
+				}
+				if aws.ToString(container.Image) != ECRImageURI(fakeAccountId, testRegion, testECRName()) || definition.ExecutionRoleArn == nil {
+					t.Errorf("expected the revision to keep the image and the roles, got %s", aws.ToString(container.Image))
+				}
+				for _, service := range cloud.services {
+					if *service.value.TaskDefinition != *definition.TaskDefinitionArn {
+						t.Errorf("expected the service to run %s, got %s", *definition.TaskDefinitionArn, *service.value.TaskDefinition)
+					}
+				}
+				if policy := cloud.roles[ExecutionRoleName(name)].policies[executionParametersPolicyName]; !strings.Contains(policy, "parameter"+EnvPath(name)+"*") {
+					t.Errorf("expected the execution role to read the parameters of the stack, got %s", policy)
+				}
+				vars, err := ListEnv(aws.String(testRegion), &name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := []EnvVar{
+					{Name: "DATABASE_PASSWORD", Secret: true, Arn: arn},
+					{Name: "NODE_ENV", Value: "production"},
+					{Name: "PORT", Value: "8080"},
+				}
+				if len(vars) != 3 || len(GetStateResources(SSMParameter)) != 3 {
+					t.Fatalf("got %d variables and %d parameters in the state, want 3", len(vars), len(GetStateResources(SSMParameter)))
+				}
+				for i := range vars {
+					if vars[i].Secret != want[i].Secret || vars[i].Name != want[i].Name || vars[i].Value != want[i].Value ||
+						(want[i].Arn != "" && vars[i].Arn != want[i].Arn) {
+						t.Errorf("got %+v, want %+v", vars[i], want[i])
+					}
+				}
+			},
+		},
+		{
+			name: "overwrites a variable",
+			run: func(name *string) error {
+				err := SetEnv(aws.String(testRegion), name, name, name, map[string]string{"PORT": "8080"}, false)
+				if err != nil {
+					return err
+				}
+				return SetEnv(aws.String(testRegion), name, name, name, map[string]string{"PORT": "3000"}, false)
+			},
+			check: func(t *testing.T, cloud *fakeCloud, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, name := stackNames()
+				environment := latestTaskDefinition(cloud, name).ContainerDefinitions[0].Environment
+				if len(environment) != 1 || *environment[0].Value != "3000" {
+					t.Errorf("expected PORT=3000, got %+v", environment)
+				}
+				if len(cloud.parameters) != 1 || len(GetStateResources(SSMParameter)) != 1 {
+					t.Errorf("got %d parameters, want 1", len(cloud.parameters))
+				}
+			},
+		},
+		{
+			name: "turns a variable into a secret",
+			run: func(name *string) error {
+				err := SetEnv(aws.String(testRegion), name, name, name, map[string]string{"API_KEY": "public"}, false)
+				if err != nil {
+					return err
+				}
+				return SetEnv(aws.String(testRegion), name, name, name, map[string]string{"API_KEY": "private"}, true)
+			},
+			check: func(t *testing.T, cloud *fakeCloud, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, name := stackNames()
+				container := latestTaskDefinition(cloud, name).ContainerDefinitions[0]
+				if len(container.Environment) != 0 || len(container.Secrets) != 1 {
+					t.Errorf("expected API_KEY in the secrets only, got %+v and %+v", container.Environment, container.Secrets)
+				}
+				if len(cloud.parameters) != 1 {
+					t.Errorf("got %d parameters, want 1", len(cloud.parameters))
+				}
+			},
+		},
+		{
+			name: "unsets a variable",
+			run: func(name *string) error {
+				err := SetEnv(aws.String(testRegion), name, name, name, map[string]string{"PORT": "8080", "DEBUG": "1"}, false)
+				if err != nil {
+					return err
+				}
+				return UnsetEnv(aws.String(testRegion), name, name, name, []string{"DEBUG"})
+			},
+			check: func(t *testing.T, cloud *fakeCloud, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, name := stackNames()
+				environment := latestTaskDefinition(cloud, name).ContainerDefinitions[0].Environment
+				if len(environment) != 1 || *environment[0].Name != "PORT" {
+					t.Errorf("expected PORT only, got %+v", environment)
+				}
+				if len(cloud.parameters) != 1 || len(GetStateResources(SSMParameter)) != 1 {
+					t.Errorf("got %d parameters and %d in the state, want 1", len(cloud.parameters), len(GetStateResources(SSMParameter)))
+				}
+			},
+		},
+		{
+			name: "fails to unset a variable that is not set",
+			run: func(name *string) error {
+				return UnsetEnv(aws.String(testRegion), name, name, name, []string{"MISSING"})
+			},
+			check: func(t *testing.T, cloud *fakeCloud, err error) {
+				if err == nil || err.Error() != "MISSING is not set" {
+					t.Fatalf("got %v, want MISSING is not set", err)
+				}
+				if count := cloud.callCount("ECS.RegisterTaskDefinition"); count != 1 {
+					t.Errorf("a task definition was registered for nothing")
+				}
+			},
+		},
+		{
+			name: "refuses a name that is not an environment variable",
+			run: func(name *string) error {
+				return SetEnv(aws.String(testRegion), name, name, name, map[string]string{"1-PORT": "8080"}, false)
+			},
+			check: func(t *testing.T, cloud *fakeCloud, err error) {
+				if err == nil || !strings.Contains(err.Error(), "not a valid environment variable name") {
+					t.Fatalf("got %v, want an invalid name error", err)
+				}
+				if len(cloud.parameters) != 0 {
+					t.Errorf("got %d parameters, want 0", len(cloud.parameters))
+				}
+			},
+		},
+		{
+			name: "deletes the parameters with the stack",
+			run: func(name *string) error {
+				err := SetEnv(aws.String(testRegion), name, name, name, map[string]string{"TOKEN": "s3cret"}, true)
+				if err != nil {
+					return err
+				}
+				return DeleteResources(aws.String(testRegion), name, aws.String(testDomain))
+			},
+			check: func(t *testing.T, cloud *fakeCloud, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if count := cloud.liveResources(); count != 0 {
+					t.Errorf("%d resources are left in aws", count)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cloud, _ := newTestCloud(t)
+			createTestStack(t)
+			_, name := stackNames()
+			err := test.run(&name)
+			test.check(t, cloud, err)
+		})
+	}
+}
+
+func TestDeleteResources(t *testing.T) {
+	otherBucket := "blog.example.com-other-stack"
+	otherRecord := route53Types.ResourceRecordSet{
+		Name:            aws.String("blog." + testDomain),
+		Type:            route53Types.RRTypeCname,
+		TTL:             aws.Int64(300),
+		ResourceRecords: []route53Types.ResourceRecord{{Value: aws.String("blog.example.net")}},
+	}
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, cloud *fakeCloud, zoneId string)
+		check func(t *testing.T, cloud *fakeCloud, zoneId string, err error)
+	}{
+		{
+			name: "deletes the whole stack",
+			setup: func(t *testing.T, cloud *fakeCloud, zoneId string) {
+				createTestStack(t)
+			},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if count := cloud.liveResources(); count != 0 {
+					t.Errorf("%d resources are left in aws", count)
+				}
+				if records := cloud.records(zoneId); len(records) != 0 {
+					t.Errorf("%d records are left in the hosted zone", len(records))
+				}
+				if resources := GetStateResources(""); len(resources) != 0 {
+					t.Errorf("%d resources are left in the state", len(resources))
+				}
+			},
+		},
+		{
+			name: "deletes resources only in the state",
+			setup: func(t *testing.T, cloud *fakeCloud, zoneId string) {
+				bucketName, _ := stackNames()
+				err := createBucket(io.Discard, &bucketName, aws.String(testRegion))
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(cloud.buckets) != 0 || len(GetStateResources("")) != 0 {
+					t.Errorf("the bucket of the state was not deleted")
+				}
+			},
+		},
+		{
+			name: "keeps the resources of other stacks",
+			setup: func(t *testing.T, cloud *fakeCloud, zoneId string) {
+				cloud.addBucket(otherBucket, testRegion, "other-stack")
+				cloud.addRecord(zoneId, otherRecord)
+				cloud.addInstanceProfile(ecsInstanceProfileName, ecsInstanceProfileName)
+				createTestStack(t)
+			},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cloud.buckets[otherBucket] == nil {
+					t.Errorf("the bucket of the other stack was deleted")
+				}
+				if findZoneRecord(cloud, zoneId, *otherRecord.Name, otherRecord.Type) == nil {
+					t.Errorf("the record of the other stack was deleted")
+				}
+				if profile := cloud.instanceProfiles[ecsInstanceProfileName]; profile == nil || len(profile.Roles) != 1 {
+					t.Errorf("the %s of the account was deleted or emptied", ecsInstanceProfileName)
+				}
+				if count := cloud.liveResources(); count != 2 {
+					t.Errorf("%d resources are left in aws, want 2", count)
+				}
+			},
+		},
+		{
+			name: "reports what could not be deleted",
+			setup: func(t *testing.T, cloud *fakeCloud, zoneId string) {
+				createTestStack(t)
+				cloud.fail("ECS.DeleteCluster", fakeError("ServerException", "Service Unavailable"))
+			},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, err error) {
+				if err == nil || !strings.Contains(err.Error(), "resources could not be deleted") {
+					t.Fatalf("got %v, want leftovers", err)
+				}
+				_, name := stackNames()
+				if len(GetStateResources(ECSCluster)) != 1 || len(GetStateResources(ECSCapacityProvider)) != 1 {
+					t.Errorf("the cluster and its capacity provider are not in the state anymore")
+				}
+				if cloud.autoScalingGroups[testRegion+"/"+name] == nil {
+					t.Errorf("the auto scaling group of the cluster was deleted")
+				}
+				if len(cloud.buckets) != 0 || len(cloud.distributions) != 0 || len(cloud.loadBalancers) != 0 {
+					t.Errorf("resources independent of the cluster were not deleted")
+				}
+			},
+		},
+		{
+			name: "terminates the instances after their auto scaling group",
+			setup: func(t *testing.T, cloud *fakeCloud, zoneId string) {
+				createTestStack(t)
+				// found in the resource group like the instances the group launched
+				instanceArn := fmt.Sprintf("arn:aws:ec2:%s:%s:instance/i-0123456789abcdef0", testRegion, fakeAccountId)
+				err := adoptResource(EC2Instance, &instanceArn, aws.String(testRegion), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				cloud.mutex.Lock()
+				defer cloud.mutex.Unlock()
+				deleted := slices.Index(cloud.calls, "AutoScaling.DeleteAutoScalingGroup")
+				terminated := slices.Index(cloud.calls, "EC2.TerminateInstances")
+				if deleted < 0 || terminated < deleted {
+					t.Errorf("expected the instance to be terminated after the auto scaling group is deleted, got %v", cloud.calls)
+				}
+			},
+		},
+		{
+			name: "deletes again without errors",
+			setup: func(t *testing.T, cloud *fakeCloud, zoneId string) {
+				createTestStack(t)
+				_, name := stackNames()
+				err := DeleteResources(aws.String(testRegion), &name, aws.String(testDomain))
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			check: func(t *testing.T, cloud *fakeCloud, zoneId string, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if count := cloud.liveResources(); count != 0 {
+					t.Errorf("%d resources are left in aws", count)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cloud, zoneId := newTestCloud(t)
+			test.setup(t, cloud, zoneId)
+			_, name := stackNames()
+			err := DeleteResources(aws.String(testRegion), &name, aws.String(testDomain))
+			test.check(t, cloud, zoneId, err)
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	tests := []struct {
+		name   string
+		deploy func(region *string, name *string, target *DeployTarget) error
+	}{
+		{
+			name: "access key",
+			deploy: func(region *string, name *string, target *DeployTarget) error {
+				_, err := CreateDeployUser(io.Discard, region, name, target)
+				return err
+			},
+		},
+		{
+			name: "oidc",
+			deploy: func(region *string, name *string, target *DeployTarget) error {
+				subjects := []string{"repo:cloudgun-test/cloudgun-test-frontend:ref:refs/heads/main"}
+				_, err := CreateDeployRole(io.Discard, region, name, &subjects, target)
+				return err
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cloud, zoneId := newTestCloud(t)
+			createTestStack(t)
+			bucketName, name := stackNames()
+			target := DeployTarget{BucketName: bucketName, ECRName: testECRName(), ClusterName: name, ServiceName: name}
+			err := test.deploy(aws.String(testRegion), aws.String(name+"-deploy"), &target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			leftovers := Rollback(5 * time.Second)
+			if len(leftovers) != 0 {
+				t.Errorf("expected a clean rollback, got %v", leftovers)
+			}
+			if count := cloud.liveResources(); count != 0 {
+				t.Errorf("%d resources are left in aws", count)
+			}
+			if records := cloud.records(zoneId); len(records) != 0 {
+				t.Errorf("%d records are left in the hosted zone", len(records))
+			}
+			// only the shared oidc provider stays, the next stacks use it
+			for _, resource := range GetStateResources("") {
+				if resource.Type != IAMOIDCProvider {
+					t.Errorf("expected %s to be forgotten", resource.Id)
+				}
+			}
+			if len(cloud.oidcProviders) > 1 {
+				t.Errorf("expected at most the shared oidc provider, got %v", cloud.oidcProviders)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package aws
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmTypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//go:embed embed/execution_parameters_policy
+var executionParametersPolicy string
+
+// the inline policy of the execution role reading the parameters of the environment
+const executionParametersPolicyName = "parameters"
+
+// envName is a name the shell of the container takes as an environment variable.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// EnvVar is a variable of the environment of the backend containers. the value of a secret is never read back.
+type EnvVar struct {
+	Name   string
+	Value  string
+	Secret bool
+	Arn    string
+}
+
+func initSSMClient(region *string) (SSMAPI, error) {
+	return clients.SSM(region)
+}
+
+// EnvPath is the parameter store path the environment of the containers of a cluster is kept under.
+func EnvPath(clusterName string) string {
+	return "/" + clusterName + "/env/"
+}
+
+// ValidateEnvName checks name can be an environment variable.
+func ValidateEnvName(name string) error {
+	if !envName.MatchString(name) {
+		return errors.New(fmt.Sprintf("%s is not a valid environment variable name, use letters, digits and _ like DATABASE_URL", name))
+	}
+	return nil
+}
+
+// putParameter creates or overwrites the parameter of name. a secret is a SecureString encrypted with the aws/ssm key.
+func putParameter(region *string, name *string, value *string, secret bool) error {
+	client, err := initSSMClient(region)
+	if err != nil {
+		return err
+	}
+	parameterType := ssmTypes.ParameterTypeString
+	if secret {
+		parameterType = ssmTypes.ParameterTypeSecureString
+	}
+	_, err = client.PutParameter(ctx, &ssm.PutParameterInput{
+		Name:  name,
+		Value: value,
+		Type:  parameterType,
+		Tags: []ssmTypes.Tag{
+			{
+				Key:   aws.String(baseTagName),
+				Value: aws.String(baseTagValue),
+			},
+			{
+				Key:   aws.String(baseUUIDTagName),
+				Value: aws.String(BaseUUIDTagValue),
+			},
+		},
+	})
+	if err != nil && isAlreadyExists(err) {
+		// ssm does not take tags with overwrite, the parameter keeps the ones it was created with
+		_, err = client.PutParameter(ctx, &ssm.PutParameterInput{Name: name, Value: value, Type: parameterType, Overwrite: aws.Bool(true)})
+		return err
+	} else if err != nil {
+		return err
+	}
+	parameter, err := client.GetParameter(ctx, &ssm.GetParameterInput{Name: name})
+	if err != nil {
+		return err
+	}
+	return recordResource(SSMParameter, parameter.Parameter.ARN, region, map[string]string{"name": *name})
+}
+
+// listEnv lists the variables under path, sorted by name.
+func listEnv(region *string, path *string) ([]EnvVar, error) {
+	client, err := initSSMClient(region)
+	if err != nil {
+		return nil, err
+	}
+	vars := make([]EnvVar, 0)
+	paginator := ssm.NewGetParametersByPathPaginator(client, &ssm.GetParametersByPathInput{Path: path})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, parameter := range page.Parameters {
+			envVar := EnvVar{
+				Name:   strings.TrimPrefix(*parameter.Name, *path),
+				Secret: parameter.Type == ssmTypes.ParameterTypeSecureString,
+				Arn:    *parameter.ARN,
+			}
+			if !envVar.Secret {
+				envVar.Value = aws.ToString(parameter.Value)
+			}
+			vars = append(vars, envVar)
+		}
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	return vars, nil
+}
+
+// parameterNameOf is the name of a parameter arn. the names cloudGun gives start with /.
+func parameterNameOf(arn *string) (*string, error) {
+	arnSplit := strings.SplitN(*arn, ":parameter", 2)
+	if len(arnSplit) != 2 || !strings.HasPrefix(arnSplit[1], "/") {
+		return nil, errors.New(fmt.Sprintf("arn %s could not be split with string :parameter. arn is not valid", *arn))
+	}
+	return &arnSplit[1], nil
+}
+
+func deleteParameter(region *string, arn *string) error {
+	name, err := parameterNameOf(arn)
+	if err != nil {
+		return err
+	}
+	client, err := initSSMClient(region)
+	if err != nil {
+		return err
+	}
+	_, err = client.DeleteParameter(ctx, &ssm.DeleteParameterInput{Name: name})
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	return forgetResource(SSMParameter, *arn)
+}
+
+// containerEnvironment is how the container gets vars. a secret is resolved by ecs when a task starts, so its value
+// is not in the task definition.
+func containerEnvironment(vars []EnvVar) ([]ecsTypes.KeyValuePair, []ecsTypes.Secret) {
+	environment := make([]ecsTypes.KeyValuePair, 0)
+	secrets := make([]ecsTypes.Secret, 0)
+	for _, envVar := range vars {
+		if envVar.Secret {
+			secrets = append(secrets, ecsTypes.Secret{Name: aws.String(envVar.Name), ValueFrom: aws.String(envVar.Arn)})
+		} else {
+			environment = append(environment, ecsTypes.KeyValuePair{Name: aws.String(envVar.Name), Value: aws.String(envVar.Value)})
+		}
+	}
+	return environment, secrets
+}
+
+// putExecutionParametersPolicy lets the execution role of a cluster read the parameters of its environment.
+func putExecutionParametersPolicy(region *string, clusterName *string) error {
+	accountId, err := getAccountId(region)
+	if err != nil {
+		return err
+	}
+	policy := strings.NewReplacer(
+		"$REGION", *region,
+		"$ACCOUNT_ID", *accountId,
+		"$PARAMETER_PATH", EnvPath(*clusterName),
+	).Replace(executionParametersPolicy)
+	return putRolePolicy(region, aws.String(ExecutionRoleName(*clusterName)), aws.String(executionParametersPolicyName), &policy)
+}
@@ -0,0 +1,449 @@
+package aws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	uuid2 "fyc/uuid"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const stateVersion int = 1
+
+// StackState is everything cloudGun knows about a stack. it is saved to ~/.cloudGun/stack-<region>.json after every change.
+type StackState struct {
+	Version      int               `json:"version"`
+	UUID         string            `json:"uuid"`
+	Region       string            `json:"region"`
+	RepoUUID     string            `json:"repoUUID"`
+	Inputs       StackInputs       `json:"inputs"`
+	Resources    []StackResource   `json:"resources"`
+	Repositories []StackRepository `json:"repositories"`
+	Steps        []StackStep       `json:"steps"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	UpdatedAt    time.Time         `json:"updatedAt"`
+}
+
+type StackInputs struct {
+	Domain  string `json:"domain,omitempty"`
+	Profile string `json:"profile,omitempty"`
+	OIDC    bool   `json:"oidc,omitempty"`
+}
+
+type StackResource struct {
+	Type       ResourceIdentifier `json:"type"`
+	Id         string             `json:"id"`
+	Region     string             `json:"region"`
+	Attributes map[string]string  `json:"attributes,omitempty"`
+	CreatedAt  time.Time          `json:"createdAt"`
+}
+
+type StackRepository struct {
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner"`
+	Template  string    `json:"template"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type StackStep struct {
+	Name        string    `json:"name"`
+	CompletedAt time.Time `json:"completedAt"`
+}
+
+var state *StackState
+var statePath string
+var stateMutex sync.Mutex
+
+// createdResources and completedSteps only hold what this process did, which is what a rollback undoes.
+var createdResources []StackResource
+var completedSteps []string
+
+// getHomeDir returns the home directory holding the states, a temporary directory in tests.
+var getHomeDir = func() (string, error) {
+	currentUser, err := user.Current()
+	if err != nil {
+		return "", errors.New("error getting current user")
+	}
+	return currentUser.HomeDir, nil
+}
+
+func getStateDir() (string, error) {
+	homeDir, err := getHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".cloudGun"), nil
+}
+
+// getLegacyUUIDPath is where cloudGun saved only the stack uuid before the state file existed.
+func getLegacyUUIDPath(region *string) (string, error) {
+	homeDir, err := getHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, fmt.Sprintf("cloudGun-%s.id", *region)), nil
+}
+
+func newStackState(region *string) (*StackState, error) {
+	stackUUID, err := uuid2.CreateUUID()
+	if err != nil {
+		return nil, err
+	}
+	repoUUID, err := uuid2.CreateUUID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	return &StackState{
+		Version:      stateVersion,
+		UUID:         *stackUUID,
+		Region:       *region,
+		RepoUUID:     *repoUUID,
+		Resources:    make([]StackResource, 0),
+		Repositories: make([]StackRepository, 0),
+		Steps:        make([]StackStep, 0),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}, nil
+}
+
+// LoadState reads the state of the stack in region, creating a new one when there is none.
+// a uuid left by older versions in ~/cloudGun-<region>.id is migrated into the state file.
+func LoadState(region *string) (*StackState, error) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	dir, err := getStateDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("stack-%s.json", *region))
+	loaded, err := readState(region, path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	state = loaded
+	statePath = path
+	err = saveState()
+	if err != nil {
+		return nil, err
+	}
+	legacyPath, err := getLegacyUUIDPath(region)
+	if err == nil {
+		_ = os.Remove(legacyPath)
+	}
+	return state, nil
+}
+
+// ReadState reads the state of the stack in region like LoadState but writes nothing, so a plan creates no state file
+// and keeps ~/cloudGun-<region>.id.
+func ReadState(region *string) (*StackState, error) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	dir, err := getStateDir()
+	if err != nil {
+		return nil, err
+	}
+	loaded, err := readState(region, filepath.Join(dir, fmt.Sprintf("stack-%s.json", *region)), false)
+	if err != nil {
+		return nil, err
+	}
+	state = loaded
+	statePath = ""
+	return state, nil
+}
+
+// readState reads the state file at path, or a new state with the legacy uuid of region when there is none.
+func readState(region *string, path string, migrating bool) (*StackState, error) {
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var loaded *StackState
+	if err == nil {
+		loaded = &StackState{}
+		err = json.Unmarshal(content, loaded)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("state file %s is not valid : %s", path, err.Error()))
+		}
+		if loaded.Version > stateVersion {
+			return nil, errors.New(fmt.Sprintf("state file %s is of version %d, please update cloudGun", path, loaded.Version))
+		}
+		loaded.Version = stateVersion
+		for i, resource := range loaded.Resources {
+			// security groups were saved with a wrong type before
+			if resource.Type == "AWS::ECS::SecurityGroup" {
+				loaded.Resources[i].Type = EC2SecurityGroup
+			}
+		}
+	} else {
+		loaded, err = newStackState(region)
+		if err != nil {
+			return nil, err
+		}
+		legacyPath, err := getLegacyUUIDPath(region)
+		if err != nil {
+			return nil, err
+		}
+		legacyUUID, err := os.ReadFile(legacyPath)
+		if err == nil && strings.TrimSpace(string(legacyUUID)) != "" {
+			if migrating {
+				fmt.Fprintln(Progress, fmt.Sprintf("migrating %s into %s", legacyPath, path))
+			}
+			loaded.UUID = strings.TrimSpace(string(legacyUUID))
+		}
+	}
+	return loaded, nil
+}
+
+// ListStates reads the state of every stack in ~/.cloudGun without loading or changing any of them.
+func ListStates() ([]StackState, error) {
+	dir, err := getStateDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "stack-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	states := make([]StackState, 0, len(paths))
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var listed StackState
+		err = json.Unmarshal(content, &listed)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("state file %s is not valid : %s", path, err.Error()))
+		}
+		states = append(states, listed)
+	}
+	slices.SortFunc(states, func(a StackState, b StackState) int {
+		return strings.Compare(a.Region, b.Region)
+	})
+	return states, nil
+}
+
+// ResetState replaces the state of the stack in region with a new stack of a new uuid.
+func ResetState(region *string) (*StackState, error) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	if statePath == "" {
+		return nil, errors.New("state is not loaded")
+	}
+	reset, err := newStackState(region)
+	if err != nil {
+		return nil, err
+	}
+	state = reset
+	err = saveState()
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// saveState writes the state to a temporary file and renames it, so a crash never leaves a half written state.
+// callers must hold stateMutex.
+func saveState() error {
+	// a state read by ReadState has no path and is never written
+	if state == nil || statePath == "" {
+		return nil
+	}
+	state.UpdatedAt = time.Now().UTC()
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(statePath), 0700)
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(statePath), filepath.Base(statePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(content)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	err = file.Sync()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), statePath)
+}
+
+func SetStateInputs(inputs StackInputs) error {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	if state == nil {
+		return nil
+	}
+	state.Inputs = inputs
+	return saveState()
+}
+
+// recordResource saves a resource created by cloudGun. id is an arn when the resource has one.
+func recordResource(identifier ResourceIdentifier, id *string, region *string, attributes map[string]string) error {
+	return saveResource(identifier, id, region, attributes, true)
+}
+
+// adoptResource saves a resource that already existed. a rollback never deletes it.
+func adoptResource(identifier ResourceIdentifier, id *string, region *string, attributes map[string]string) error {
+	return saveResource(identifier, id, region, attributes, false)
+}
+
+func saveResource(identifier ResourceIdentifier, id *string, region *string, attributes map[string]string, created bool) error {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	if created {
+		createdResources = append(createdResources, StackResource{
+			Type:       identifier,
+			Id:         *id,
+			Region:     *region,
+			Attributes: attributes,
+			CreatedAt:  time.Now().UTC(),
+		})
+	}
+	if state == nil {
+		return nil
+	}
+	for i, resource := range state.Resources {
+		if resource.Type == identifier && resource.Id == *id {
+			state.Resources[i].Attributes = attributes
+			return saveState()
+		}
+	}
+	state.Resources = append(state.Resources, StackResource{
+		Type:       identifier,
+		Id:         *id,
+		Region:     *region,
+		Attributes: attributes,
+		CreatedAt:  time.Now().UTC(),
+	})
+	return saveState()
+}
+
+// forgetResource removes a deleted resource from the state.
+func forgetResource(identifier ResourceIdentifier, id string) error {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	for i, resource := range createdResources {
+		if resource.Type == identifier && resource.Id == id {
+			createdResources = append(createdResources[:i], createdResources[i+1:]...)
+			break
+		}
+	}
+	if state == nil {
+		return nil
+	}
+	for i, resource := range state.Resources {
+		if resource.Type == identifier && resource.Id == id {
+			state.Resources = append(state.Resources[:i], state.Resources[i+1:]...)
+			return saveState()
+		}
+	}
+	return nil
+}
+
+func RecordRepository(owner *string, name *string, template *string) error {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	if state == nil {
+		return nil
+	}
+	for _, repository := range state.Repositories {
+		if repository.Owner == *owner && repository.Name == *name {
+			return nil
+		}
+	}
+	state.Repositories = append(state.Repositories, StackRepository{
+		Name:      *name,
+		Owner:     *owner,
+		Template:  *template,
+		CreatedAt: time.Now().UTC(),
+	})
+	return saveState()
+}
+
+func CompleteStep(name string) error {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	if state == nil {
+		return nil
+	}
+	for _, step := range state.Steps {
+		if step.Name == name {
+			return nil
+		}
+	}
+	state.Steps = append(state.Steps, StackStep{Name: name, CompletedAt: time.Now().UTC()})
+	completedSteps = append(completedSteps, name)
+	return saveState()
+}
+
+// forgetCompletedSteps removes the steps completed by this process from the state.
+func forgetCompletedSteps() error {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	if state == nil {
+		return nil
+	}
+	steps := make([]StackStep, 0)
+	for _, step := range state.Steps {
+		if !slices.Contains(completedSteps, step.Name) {
+			steps = append(steps, step)
+		}
+	}
+	state.Steps = steps
+	completedSteps = nil
+	return saveState()
+}
+
+func IsStepCompleted(name string) bool {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	if state == nil {
+		return false
+	}
+	for _, step := range state.Steps {
+		if step.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GetStateResources returns the recorded resources of a type. every type is returned when identifier is empty.
+func GetStateResources(identifier ResourceIdentifier) []StackResource {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	result := make([]StackResource, 0)
+	if state == nil {
+		return result
+	}
+	for _, resource := range state.Resources {
+		if identifier == "" || resource.Type == identifier {
+			result = append(result, resource)
+		}
+	}
+	return result
+}
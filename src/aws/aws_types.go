@@ -1,5 +1,7 @@
 package aws
 
+import "time"
+
 type Image struct {
 	name        string
 	description string
@@ -9,11 +11,45 @@ var (
 	AmazonLinux2 = Image{name: "amzn2-ami-ecs-hvm-2.0.20240424-x86_64-ebs", description: "Amazon Linux AMI 2.0.20240424 x86_64 ECS HVM GP2"}
 )
 
+// Images are the images of the ecs instances, by the name used in cloudgun.yaml.
+var Images = map[string]Image{
+	"amazon-linux-2": AmazonLinux2,
+}
+
+// ContainerSpec sizes the container of the task definition.
+type ContainerSpec struct {
+	CPU           int32
+	MemoryMiB     int32
+	ContainerPort int32
+	HostPort      int32
+}
+
+// LaunchType is where the tasks of the backend service run.
+type LaunchType string
+
+const (
+	LaunchTypeEC2     LaunchType = "ec2"     // instances of an auto scaling group, bridge networking with dynamic host ports
+	LaunchTypeFargate LaunchType = "fargate" // fargate, each task has a network interface of its own
+)
+
+// LaunchTypes are the launch types by the name used in cloudgun.yaml.
+var LaunchTypes = map[string]LaunchType{
+	"ec2":     LaunchTypeEC2,
+	"fargate": LaunchTypeFargate,
+}
+
+// ECSRoles are the iam roles of the tasks and the container instances of a cluster.
+type ECSRoles struct {
+	InstanceProfile  string // the instance profile of the container instances, empty on fargate
+	ExecutionRoleArn string // ecs pulls the image and writes the logs with it
+	TaskRoleArn      string // the application calls aws with it
+}
+
 type ResourceIdentifier string
 
 var (
 	EC2Instance      ResourceIdentifier = "AWS::EC2::Instance"
-	EC2SecurityGroup ResourceIdentifier = "AWS::ECS::SecurityGroup"
+	EC2SecurityGroup ResourceIdentifier = "AWS::EC2::SecurityGroup"
 
 	ECSService          ResourceIdentifier = "AWS::ECS::Service"
 	ECSTaskDefinition   ResourceIdentifier = "AWS::ECS::TaskDefinition"
@@ -22,6 +58,10 @@ var (
 
 	ECRRepository ResourceIdentifier = "AWS::ECR::Repository"
 
+	LogsLogGroup ResourceIdentifier = "AWS::Logs::LogGroup"
+
+	SSMParameter ResourceIdentifier = "AWS::SSM::Parameter"
+
 	S3Bucket ResourceIdentifier = "AWS::S3::Bucket"
 
 	CertificateManagerCertificate ResourceIdentifier = "AWS::CertificateManager::Certificate"
@@ -31,4 +71,67 @@ var (
 	ElasticLoadBalancingListener     ResourceIdentifier = "AWS::ElasticLoadBalancingV2::Listener"
 	ElasticLoadBalancingLoadBalancer ResourceIdentifier = "AWS::ElasticLoadBalancingV2::LoadBalancer"
 	ElasticLoadBalancingTargetGroup  ResourceIdentifier = "AWS::ElasticLoadBalancingV2::TargetGroup"
+
+	// not listed by resource groups, only kept in the state file
+	ResourceGroupsGroup ResourceIdentifier = "AWS::ResourceGroups::Group"
+	AutoScalingGroup    ResourceIdentifier = "AWS::AutoScaling::AutoScalingGroup"
+	EC2LaunchTemplate   ResourceIdentifier = "AWS::EC2::LaunchTemplate"
+	IAMUser             ResourceIdentifier = "AWS::IAM::User"
+	IAMAccessKey        ResourceIdentifier = "AWS::IAM::AccessKey"
+	IAMRole             ResourceIdentifier = "AWS::IAM::Role"
+	IAMOIDCProvider     ResourceIdentifier = "AWS::IAM::OIDCProvider"
+	Route53RecordSet    ResourceIdentifier = "AWS::Route53::RecordSet"
+	RDSDBInstance       ResourceIdentifier = "AWS::RDS::DBInstance"
+
+	// github resources only show up in plans
+	GithubRepository ResourceIdentifier = "GitHub::Repository"
+	GithubSecret     ResourceIdentifier = "GitHub::Secret"
 )
+
+type PlanAction string
+
+const (
+	PlanCreate PlanAction = "create"
+	PlanKeep   PlanAction = "keep" // created by an earlier run, create resumes after it
+	PlanDelete PlanAction = "delete"
+)
+
+// PlannedResource is a resource a command would create, keep or delete.
+type PlannedResource struct {
+	Action  PlanAction         `json:"action"`
+	Type    ResourceIdentifier `json:"type"`
+	Name    string             `json:"name"`
+	Region  string             `json:"region,omitempty"`
+	Step    string             `json:"step,omitempty"`
+	Details map[string]string  `json:"details,omitempty"`
+}
+
+type DeployTarget struct {
+	BucketName     string
+	DistributionId string
+	ECRName        string
+	ClusterName    string
+	ServiceName    string
+}
+
+type OperationTimeouts struct {
+	CertificateRecords   time.Duration
+	CertificateValidated time.Duration
+	DistributionDeployed time.Duration
+	InstancesRunning     time.Duration
+	ServicesStable       time.Duration
+	AccessKeyActive      time.Duration
+	RolesPropagated      time.Duration
+	ResourceDeleted      time.Duration
+
+	// the registrar of a new hosted zone can take hours to publish its name servers
+	NameServersDelegated time.Duration
+}
+
+// HostedZone is a public hosted zone and the name servers the registrar of its domain has to point at.
+type HostedZone struct {
+	Id          string
+	Name        string
+	NameServers []string
+	Created     bool // false when an existing zone was found
+}
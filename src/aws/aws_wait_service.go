@@ -0,0 +1,115 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"slices"
+	"time"
+)
+
+// Timeouts bounds each long running operation on its own. there is no deadline for the whole run.
+var Timeouts = OperationTimeouts{
+	CertificateRecords:   2 * time.Minute,
+	CertificateValidated: 45 * time.Minute,
+	DistributionDeployed: 30 * time.Minute,
+	InstancesRunning:     10 * time.Minute,
+	ServicesStable:       15 * time.Minute,
+	AccessKeyActive:      2 * time.Minute,
+	RolesPropagated:      2 * time.Minute,
+	ResourceDeleted:      20 * time.Minute,
+
+	NameServersDelegated: time.Hour,
+}
+
+// Resolver looks up the name server delegation of a new hosted zone. it is the system resolver unless
+// SetResolver points it at another dns server.
+var Resolver = net.DefaultResolver
+
+// SetResolver sends every lookup of Resolver to the dns server at address, a host:port.
+func SetResolver(address string) {
+	Resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, address)
+		},
+	}
+}
+
+const initialBackoff = time.Second
+const maxBackoff = 30 * time.Second
+
+// backoffDelay is the delay before the attempt after attempt. it doubles up to maxBackoff, and the upper half is random
+// so parallel branches polling the same api do not stay in lockstep.
+func backoffDelay(attempt int) time.Duration {
+	delay := initialBackoff << min(attempt, 10)
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// waitUntil calls check with exponential backoff until it reports done or returns an error, or timeout passes.
+// throttling errors are never returned, they only slow the polling down.
+func waitUntil(operation string, timeout time.Duration, check func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		done, err := check()
+		if err != nil && !isThrottling(err) {
+			return err
+		} else if err == nil && done {
+			return nil
+		}
+		lastErr = err
+
+		delay := backoffDelay(attempt)
+		if time.Now().Add(delay).After(deadline) {
+			if lastErr != nil {
+				return errors.New(fmt.Sprintf("%s did not finish in %s : %s", operation, timeout, lastErr.Error()))
+			}
+			return errors.New(fmt.Sprintf("%s did not finish in %s", operation, timeout))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryOn calls f until it stops failing with an error of one of kinds, with exponential backoff, or timeout passes.
+func retryOn(operation string, timeout time.Duration, f func() error, kinds ...ErrorKind) error {
+	var lastErr error
+	err := waitUntil(operation, timeout, func() (bool, error) {
+		lastErr = f()
+		if lastErr != nil && slices.Contains(kinds, ClassifyError(lastErr)) {
+			return false, nil
+		}
+		return true, lastErr
+	})
+	if err != nil && lastErr != nil && slices.Contains(kinds, ClassifyError(lastErr)) {
+		return errors.New(fmt.Sprintf("%s : %s", err.Error(), lastErr.Error()))
+	}
+	return err
+}
+
+// waitNameServerDelegation waits until the public dns answers the name servers of zone for its domain.
+// a domain that is not delegated yet fails to resolve, that is not an error while waiting.
+func waitNameServerDelegation(zone *HostedZone) error {
+	return waitUntil("name server delegation of "+zone.Name, Timeouts.NameServersDelegated, func() (bool, error) {
+		// a fully qualified name skips the search domains of the resolver
+		records, err := Resolver.LookupNS(ctx, zone.Name+".")
+		if err != nil {
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) {
+				return false, nil
+			}
+			return false, err
+		}
+		return isDelegatedTo(records, zone.NameServers), nil
+	})
+}
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"fyc/aws"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+type arguments struct {
+	GithubToken      *string
+	GithubTokenStdin bool
+	AWSRegion        *string
+	Domain           *string
+	Command          *string
+	Profile          *string
+	OIDC             bool
+	NoRollback       bool
+	Destroy          bool    // plan lists what delete would remove
+	Output           *string // text or json, for plan, status and list
+	CreateHostedZone bool
+	DNSResolver      *string           // host:port of the dns server checking the delegation of the hosted zone
+	Since            time.Time         // logs prints the events from then
+	Grep             *string           // cloudwatch filter pattern of logs
+	Action           *string           // set, unset or list of env and secret
+	Env              map[string]string // the variables of env set and secret set
+	EnvNames         []string          // the variables of env unset
+	// local emulators, for running a whole create and delete in ci
+	EndpointURL         *string
+	ServiceEndpointURLs map[string]string
+	GithubAPIURL        *string
+	// -config=cloudgun.yaml, and the flags overriding it
+	ConfigPath   *string
+	InstanceType *string
+	LaunchType   *string
+	Branch       *string
+	NoWWW        bool
+	Config       *stackConfig
+}
+
+// applyTo overrides the values of the config file with the flags given.
+func (input *arguments) applyTo(config *stackConfig) {
+	if input.AWSRegion != nil {
+		config.Region = *input.AWSRegion
+	}
+	if input.Domain != nil {
+		config.Domain = *input.Domain
+	}
+	if input.Profile != nil {
+		config.Profile = *input.Profile
+	}
+	if input.OIDC {
+		config.OIDC = true
+	}
+	if input.InstanceType != nil {
+		config.Cluster.InstanceType = *input.InstanceType
+	}
+	if input.LaunchType != nil {
+		config.Cluster.LaunchType = *input.LaunchType
+	}
+	if input.Branch != nil {
+		config.Github.Branch = *input.Branch
+	}
+	if input.NoWWW {
+		config.WWW = false
+	}
+}
+
+// parseEndpointURL checks an endpoint override is an absolute http url.
+func parseEndpointURL(flag string, value string) (*string, error) {
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, errors.New(fmt.Sprintf("value of %s=http://localhost:4566 is not valid", flag))
+	}
+	return &value, nil
+}
+
+// command is a subcommand of cloudgun, like cloudgun create.
+type command struct {
+	name        string
+	description string
+	github      bool     // needs a github token, but for plan -destroy
+	domain      bool     // needs -domain
+	actions     []string // the first argument, like set of cloudgun env set
+	operands    string   // what comes after the flags, for the usage
+	flags       func(flags *flag.FlagSet, input *arguments)
+}
+
+var commands = []command{
+	{
+		name:        "create",
+		description: "creates the stack of the domain, or resumes the last create that failed",
+		github:      true,
+		domain:      true,
+		flags: func(flags *flag.FlagSet, input *arguments) {
+			stackFlags(flags, input)
+			createFlags(flags, input)
+			flags.BoolVar(&input.NoRollback, "no-rollback", false, "keeps what was created when create fails, to resume it later")
+			hostedZoneFlags(flags, input)
+		},
+	},
+	{
+		name:        "delete",
+		description: "deletes every resource of the stack",
+		domain:      true,
+		flags:       stackFlags,
+	},
+	{
+		name:        "plan",
+		description: "lists what create would create, or what delete would delete with -destroy",
+		github:      true,
+		domain:      true,
+		flags: func(flags *flag.FlagSet, input *arguments) {
+			stackFlags(flags, input)
+			createFlags(flags, input)
+			flags.BoolVar(&input.Destroy, "destroy", false, "plans delete instead of create")
+			outputFlag(flags, input)
+		},
+	},
+	{
+		name:        "status",
+		description: "shows the steps and resources of the stack in the region, from its state file",
+		flags: func(flags *flag.FlagSet, input *arguments) {
+			regionFlags(flags, input)
+			outputFlag(flags, input)
+		},
+	},
+	{
+		name:        "list",
+		description: "lists the stacks of every region",
+		flags:       outputFlag,
+	},
+	{
+		name:        "deploy",
+		description: "restarts the tasks of the ecs service of the stack on their current task definition",
+		flags:       stackFlags,
+	},
+	{
+		name:        "logs",
+		description: "follows the logs of the backend containers of the stack until ctrl-c",
+		flags: func(flags *flag.FlagSet, input *arguments) {
+			stackFlags(flags, input)
+			flags.Func("since", "prints the events from a `duration` ago like 1h, or from an RFC3339 time (default 10m)", func(value string) error {
+				since, err := parseSince(value, time.Now())
+				input.Since = since
+				return err
+			})
+			stringFlag(flags, &input.Grep, "grep", "prints the events matching a cloudwatch filter `pattern` only, like ERROR or \"timed out\"")
+		},
+	},
+	{
+		name:        "env",
+		description: "sets, unsets or lists the environment variables and secrets of the backend containers. set and unset roll the service",
+		actions:     []string{"set", "unset", "list"},
+		operands:    "[NAME=value... | NAME...]",
+		flags:       stackFlags,
+	},
+	{
+		name:        "secret",
+		description: "sets a secret environment variable of the backend containers to the value of stdin and rolls the service",
+		actions:     []string{"set"},
+		operands:    "NAME",
+		flags:       stackFlags,
+	},
+}
+
+// parseOperands reads the variables env and secret take after the flags.
+func parseOperands(input *arguments, operands []string) error {
+	if input.Action == nil {
+		return errors.New(fmt.Sprintf("an action is missing, like cloudgun %s set", *input.Command))
+	}
+	names := make([]string, 0, len(operands))
+	values := make(map[string]string)
+	for _, operand := range operands {
+		name, value, found := strings.Cut(operand, "=")
+		if found != (*input.Command == "env" && *input.Action == "set") {
+			if found {
+				return errors.New(fmt.Sprintf("%s should be a name without a value, like DATABASE_URL", operand))
+			}
+			return errors.New(fmt.Sprintf("%s should be NAME=value, like NODE_ENV=production", operand))
+		}
+		err := aws.ValidateEnvName(name)
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+		values[name] = value
+	}
+	switch *input.Command + " " + *input.Action {
+	case "env list":
+		if len(operands) != 0 {
+			return errors.New(fmt.Sprintf("unexpected argument %s", operands[0]))
+		}
+	case "env set":
+		if len(operands) == 0 {
+			return errors.New("the variables to set are missing, like cloudgun env set NODE_ENV=production")
+		}
+		input.Env = values
+	case "env unset":
+		if len(operands) == 0 {
+			return errors.New("the variables to unset are missing, like cloudgun env unset DEBUG")
+		}
+		input.EnvNames = names
+	case "secret set":
+		if len(operands) != 1 {
+			return errors.New("give the name of one secret, like cloudgun secret set DATABASE_PASSWORD")
+		}
+		input.Env = values // the value comes from stdin, it is not kept in the shell history
+	}
+	return nil
+}
+
+// readSecretValue reads the value of cloudgun secret set from stdin. a value of several lines, like a key, is kept whole.
+func readSecretValue(name string) (string, error) {
+	value, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", err
+	}
+	trimmed := strings.TrimSuffix(strings.TrimSuffix(string(value), "\n"), "\r")
+	if trimmed == "" {
+		return "", errors.New(fmt.Sprintf("no value of %s was given on stdin, like printf %%s \"$VALUE\" | cloudgun secret set %s", name, name))
+	}
+	return trimmed, nil
+}
+
+// defaultLogsSince is how far back cloudgun logs starts without -since
+const defaultLogsSince = 10 * time.Minute
+
+// parseSince reads -since, a duration before now or a time.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if duration, err := time.ParseDuration(value); err == nil && duration >= 0 {
+		return now.Add(-duration), nil
+	}
+	if since, err := time.Parse(time.RFC3339, value); err == nil {
+		return since, nil
+	}
+	return time.Time{}, errors.New("value of -since should be a duration like 1h or a time like 2024-01-02T15:04:05Z")
+}
+
+// cliOutput gets the help text and the flag errors.
+var cliOutput io.Writer = os.Stderr
+
+// stdin and ghAuthToken are where the github token is read from when it is not given otherwise.
+var stdin io.Reader = os.Stdin
+var ghAuthToken = func() (string, error) {
+	if _, err := exec.LookPath("gh"); err != nil {
+		return "", err
+	}
+	output, err := exec.Command("gh", "auth", "token").Output()
+	return strings.TrimSpace(string(output)), err
+}
+
+// usageError is an error the flag package already printed with the usage.
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+func stringFlag(flags *flag.FlagSet, target **string, name string, usage string) {
+	flags.Func(name, usage, func(value string) error {
+		*target = &value
+		return nil
+	})
+}
+
+func regionFlags(flags *flag.FlagSet, input *arguments) {
+	stringFlag(flags, &input.AWSRegion, "awsregion", "aws `region` of the stack, AWS_REGION when not given")
+	stringFlag(flags, &input.ConfigPath, "config", "stack config `file` (default "+defaultConfigPath+" when it exists)")
+}
+
+func stackFlags(flags *flag.FlagSet, input *arguments) {
+	regionFlags(flags, input)
+	flags.Func("domain", "`domain` of the stack, like example.com", func(value string) error {
+		err := validateDomain(value)
+		if err != nil {
+			return err
+		}
+		input.Domain = &value
+		return nil
+	})
+	flags.Func("profile", "aws `profile` of the credentials", func(value string) error {
+		if value == "" {
+			return errors.New("profile should not be empty")
+		}
+		input.Profile = &value
+		return nil
+	})
+	// local emulators, for running a whole create and delete in ci
+	flags.Func("endpoint-url", "`url` of every aws service, like http://localhost:4566", func(value string) error {
+		endpointURL, err := parseEndpointURL("-endpoint-url", value)
+		input.EndpointURL = endpointURL
+		return err
+	})
+	for _, service := range aws.EndpointServices {
+		flags.Func("endpoint-url-"+service, "`url` of "+service+" only", func(value string) error {
+			endpointURL, err := parseEndpointURL("-endpoint-url-"+service, value)
+			if err != nil {
+				return err
+			}
+			if input.ServiceEndpointURLs == nil {
+				input.ServiceEndpointURLs = map[string]string{}
+			}
+			input.ServiceEndpointURLs[service] = *endpointURL
+			return nil
+		})
+	}
+}
+
+func createFlags(flags *flag.FlagSet, input *arguments) {
+	stringFlag(flags, &input.GithubToken, "githubtoken", "github `token`, prefer CLOUDGUN_GITHUB_TOKEN as flags end up in the shell history")
+	flags.BoolVar(&input.GithubTokenStdin, "githubtoken-stdin", false, "reads the github token from stdin")
+	flags.Func("github-api-url", "`url` of the github api of a github enterprise server or an emulator", func(value string) error {
+		githubAPIURL, err := parseEndpointURL("-github-api-url", value)
+		input.GithubAPIURL = githubAPIURL
+		return err
+	})
+	flags.BoolVar(&input.OIDC, "oidc", false, "github actions assume an iam role instead of using an access key")
+	stringFlag(flags, &input.LaunchType, "launch-type", "`ec2` or fargate, where the backend runs, overrides cluster.launchType")
+	stringFlag(flags, &input.InstanceType, "instance-type", "ec2 instance `type` of the cluster, overrides cluster.instanceType")
+	stringFlag(flags, &input.Branch, "branch", "`branch` of the repositories, overrides github.branch")
+	flags.BoolVar(&input.NoWWW, "no-www", false, "no www.<domain> redirecting to the site, overrides www")
+}
+
+func hostedZoneFlags(flags *flag.FlagSet, input *arguments) {
+	flags.BoolVar(&input.CreateHostedZone, "create-hosted-zone", false, "creates the route53 hosted zone of the domain when there is none and waits for the registrar to delegate it")
+	flags.Func("dns-resolver", "`host:port` of the dns server checking the delegation, instead of the system resolver", func(value string) error {
+		_, _, err := net.SplitHostPort(value)
+		if err != nil {
+			return errors.New("value of -dns-resolver should be host:port")
+		}
+		input.DNSResolver = &value
+		return nil
+	})
+}
+
+func outputFlag(flags *flag.FlagSet, input *arguments) {
+	flags.Func("output", "`format` of the output, text or json", func(value string) error {
+		if value != "text" && value != "json" {
+			return errors.New("output should be text or json")
+		}
+		input.Output = &value
+		return nil
+	})
+}
+
+func printUsage() {
+	fmt.Fprintln(cliOutput, "usage: cloudgun <command> [flags]\n\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintln(cliOutput, fmt.Sprintf("  %-8s %s", c.name, c.description))
+	}
+	fmt.Fprintln(cliOutput, "\nrun cloudgun <command> -help for the flags of a command")
+}
+
+func findCommand(name string) (*command, error) {
+	index := slices.IndexFunc(commands, func(c command) bool { return c.name == name })
+	if index == -1 {
+		printUsage()
+		return nil, usageError{errors.New(fmt.Sprintf("unknown command %s", name))}
+	}
+	return &commands[index], nil
+}
+
+// parseArgs reads the command and its flags from args, the arguments without the program name.
+// the config file comes under the flags, the environment under both.
+func parseArgs(args []string) (*arguments, error) {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" || args[0] == "help" {
+		if len(args) == 2 && args[0] == "help" {
+			args = []string{args[1], "-help"}
+		} else {
+			printUsage()
+			return nil, flag.ErrHelp
+		}
+	}
+	name := args[0]
+	args = args[1:]
+	legacy := strings.HasPrefix(name, "-")
+	if legacy {
+		// cloudgun -command=create ... of older versions
+		args = append([]string{name}, args...)
+		index := slices.IndexFunc(args, func(arg string) bool {
+			return strings.HasPrefix(arg, "-command=") || strings.HasPrefix(arg, "--command=")
+		})
+		if index == -1 {
+			printUsage()
+			return nil, usageError{errors.New("a command is missing, like cloudgun create")}
+		}
+		_, name, _ = strings.Cut(args[index], "=")
+		args = slices.Delete(args, index, index+1)
+		fmt.Fprintln(cliOutput, fmt.Sprintf("-command= is deprecated, run cloudgun %s instead", name))
+	}
+	c, err := findCommand(name)
+	if err != nil {
+		return nil, err
+	}
+	if legacy && !c.github {
+		// older versions took the token for every command
+		args = slices.DeleteFunc(args, func(arg string) bool { return strings.HasPrefix(arg, "-githubtoken=") })
+	}
+
+	input := arguments{Command: &c.name}
+	flags := flag.NewFlagSet("cloudgun "+c.name, flag.ContinueOnError)
+	flags.SetOutput(cliOutput)
+	flags.Usage = func() {
+		usage := c.name + " [flags]"
+		if len(c.actions) != 0 {
+			usage = fmt.Sprintf("%s <%s> [flags] %s", c.name, strings.Join(c.actions, "|"), c.operands)
+		}
+		fmt.Fprintln(cliOutput, fmt.Sprintf("usage: cloudgun %s\n\n%s\n\nflags:", usage, c.description))
+		flags.PrintDefaults()
+	}
+	if len(c.actions) != 0 && len(args) != 0 && slices.Contains(c.actions, args[0]) {
+		action := args[0]
+		input.Action = &action
+		args = args[1:]
+	}
+	c.flags(flags, &input)
+	err = flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil, err
+	} else if err != nil {
+		return nil, usageError{err}
+	}
+	if len(c.actions) != 0 {
+		err = parseOperands(&input, flags.Args())
+		if err != nil {
+			// printed like the flag package prints its errors, main does not print usage errors again
+			fmt.Fprintln(cliOutput, err.Error())
+			flags.Usage()
+			return nil, usageError{err}
+		}
+	} else if flags.NArg() != 0 {
+		flags.Usage()
+		return nil, usageError{errors.New(fmt.Sprintf("unexpected argument %s", flags.Arg(0)))}
+	}
+	if input.Output == nil {
+		output := "text"
+		input.Output = &output
+	}
+	if c.name == "logs" && input.Since.IsZero() {
+		input.Since = time.Now().Add(-defaultLogsSince)
+	}
+	if c.name == "list" {
+		return &input, nil
+	}
+
+	// the flags override cloudgun.yaml
+	configPath, required := defaultConfigPath, false
+	if input.ConfigPath != nil {
+		configPath, required = *input.ConfigPath, true
+	}
+	config, err := loadConfig(configPath, required)
+	if err != nil {
+		return nil, err
+	}
+	input.applyTo(config)
+	if config.Region == "" {
+		config.Region = os.Getenv("AWS_REGION")
+	}
+	err = config.validate()
+	if err != nil {
+		return nil, err
+	}
+	input.Config = config
+
+	if config.Region == "" {
+		return nil, errors.New("the aws region is missing, give -awsregion=XXX... or set AWS_REGION")
+	}
+	input.AWSRegion = &config.Region
+	if c.domain {
+		if config.Domain == "" {
+			return nil, errors.New("value of -domain=example.com is not valid")
+		}
+		input.Domain = &config.Domain
+	}
+	if config.Profile != "" {
+		input.Profile = &config.Profile
+	}
+	input.OIDC = config.OIDC
+
+	if c.name == "secret" {
+		for name := range input.Env {
+			input.Env[name], err = readSecretValue(name)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	// plan -destroy only reads aws, so it runs without a github token
+	if c.github && !input.Destroy {
+		token, err := getGithubToken(&input)
+		if err != nil {
+			return nil, err
+		}
+		input.GithubToken = &token
+	} else {
+		// a token given anyway is not checked
+		input.GithubToken = nil
+	}
+	return &input, nil
+}
+
+// getGithubToken takes the token of -githubtoken, stdin, the environment or the gh cli, in that order.
+func getGithubToken(input *arguments) (string, error) {
+	if input.GithubToken != nil {
+		return *input.GithubToken, nil
+	}
+	if input.GithubTokenStdin {
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		if strings.TrimSpace(line) == "" {
+			return "", errors.New("no github token was given on stdin")
+		}
+		return strings.TrimSpace(line), nil
+	}
+	for _, name := range []string{"CLOUDGUN_GITHUB_TOKEN", "GITHUB_TOKEN"} {
+		if token := os.Getenv(name); token != "" {
+			return token, nil
+		}
+	}
+	token, err := ghAuthToken()
+	if err == nil && token != "" {
+		return token, nil
+	}
+	return "", errors.New("the github token is missing, set CLOUDGUN_GITHUB_TOKEN, give -githubtoken-stdin or log in with gh auth login")
+}
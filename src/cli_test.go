@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		stdin   string
+		gh      string
+		wantErr string
+		check   func(t *testing.T, input *arguments)
+	}{
+		{
+			name: "create",
+			args: []string{"create", "-githubtoken=ghp_flag", "-awsregion=ap-northeast-2", "-domain=example.com", "-oidc"},
+			check: func(t *testing.T, input *arguments) {
+				if *input.Command != "create" || *input.GithubToken != "ghp_flag" || *input.AWSRegion != "ap-northeast-2" ||
+					*input.Domain != "example.com" || !input.OIDC {
+					t.Errorf("unexpected arguments %+v", input)
+				}
+			},
+		},
+		{
+			name: "hosted zone",
+			args: []string{"create", "-githubtoken=ghp_flag", "-awsregion=ap-northeast-2", "-domain=example.com", "-create-hosted-zone", "-dns-resolver=127.0.0.1:5353"},
+			check: func(t *testing.T, input *arguments) {
+				if !input.CreateHostedZone || *input.DNSResolver != "127.0.0.1:5353" {
+					t.Errorf("unexpected arguments %+v", input)
+				}
+			},
+		},
+		{
+			name: "launch type",
+			args: []string{"create", "-githubtoken=ghp_flag", "-awsregion=ap-northeast-2", "-domain=example.com", "-launch-type=fargate"},
+			check: func(t *testing.T, input *arguments) {
+				if *input.LaunchType != "fargate" {
+					t.Errorf("unexpected arguments %+v", input)
+				}
+			},
+		},
+		{
+			name: "double dash flags",
+			args: []string{"plan", "--awsregion", "ap-northeast-2", "--domain", "example.com", "--output=json", "--destroy"},
+			env:  map[string]string{"GITHUB_TOKEN": "ghp_env"},
+			check: func(t *testing.T, input *arguments) {
+				if *input.Output != "json" || !input.Destroy || input.GithubToken != nil {
+					t.Errorf("unexpected arguments %+v", input)
+				}
+			},
+		},
+		{
+			name: "command of older versions",
+			args: []string{"-githubtoken=ghp_flag", "-awsregion=ap-northeast-2", "-domain=example.com", "-command=delete"},
+			check: func(t *testing.T, input *arguments) {
+				if *input.Command != "delete" {
+					t.Errorf("expected delete, got %s", *input.Command)
+				}
+			},
+		},
+		{
+			name: "region of the environment",
+			args: []string{"status"},
+			env:  map[string]string{"AWS_REGION": "eu-west-1"},
+			check: func(t *testing.T, input *arguments) {
+				if *input.AWSRegion != "eu-west-1" {
+					t.Errorf("expected eu-west-1, got %s", *input.AWSRegion)
+				}
+			},
+		},
+		{
+			name: "region flag over the environment",
+			args: []string{"deploy", "-awsregion=ap-northeast-2"},
+			env:  map[string]string{"AWS_REGION": "eu-west-1"},
+			check: func(t *testing.T, input *arguments) {
+				if *input.AWSRegion != "ap-northeast-2" || input.GithubToken != nil {
+					t.Errorf("expected ap-northeast-2 without a token, got %+v", input)
+				}
+			},
+		},
+		{
+			name: "logs",
+			args: []string{"logs", "-awsregion=ap-northeast-2", "-since=2024-01-02T15:04:05Z", "-grep=ERROR"},
+			check: func(t *testing.T, input *arguments) {
+				if input.Since.Format(time.RFC3339) != "2024-01-02T15:04:05Z" || *input.Grep != "ERROR" || input.GithubToken != nil {
+					t.Errorf("unexpected arguments %+v", input)
+				}
+			},
+		},
+		{
+			name: "logs of the last minutes",
+			args: []string{"logs", "-awsregion=ap-northeast-2"},
+			check: func(t *testing.T, input *arguments) {
+				if since := time.Since(input.Since); since < defaultLogsSince || since > defaultLogsSince+time.Minute || input.Grep != nil {
+					t.Errorf("expected the logs of the last %s, got %+v", defaultLogsSince, input)
+				}
+			},
+		},
+		{
+			name:  "token of stdin",
+			args:  []string{"create", "-githubtoken-stdin", "-awsregion=ap-northeast-2", "-domain=example.com"},
+			env:   map[string]string{"CLOUDGUN_GITHUB_TOKEN": "ghp_env"},
+			stdin: "ghp_stdin\n",
+			check: func(t *testing.T, input *arguments) {
+				if *input.GithubToken != "ghp_stdin" {
+					t.Errorf("expected the token of stdin, got %s", *input.GithubToken)
+				}
+			},
+		},
+		{
+			name: "cloudgun token over github token",
+			args: []string{"create", "-awsregion=ap-northeast-2", "-domain=example.com"},
+			env:  map[string]string{"CLOUDGUN_GITHUB_TOKEN": "ghp_cloudgun", "GITHUB_TOKEN": "ghp_github"},
+			check: func(t *testing.T, input *arguments) {
+				if *input.GithubToken != "ghp_cloudgun" {
+					t.Errorf("expected CLOUDGUN_GITHUB_TOKEN, got %s", *input.GithubToken)
+				}
+			},
+		},
+		{
+			name: "token of gh",
+			args: []string{"create", "-awsregion=ap-northeast-2", "-domain=example.com"},
+			gh:   "gho_cli",
+			check: func(t *testing.T, input *arguments) {
+				if *input.GithubToken != "gho_cli" {
+					t.Errorf("expected the token of gh, got %s", *input.GithubToken)
+				}
+			},
+		},
+		{
+			name: "env set",
+			args: []string{"env", "set", "-awsregion=ap-northeast-2", "NODE_ENV=production", "DATABASE_URL=postgres://db/app?ssl=true"},
+			check: func(t *testing.T, input *arguments) {
+				if *input.Action != "set" || len(input.Env) != 2 || input.Env["NODE_ENV"] != "production" ||
+					input.Env["DATABASE_URL"] != "postgres://db/app?ssl=true" || input.GithubToken != nil {
+					t.Errorf("unexpected arguments %+v", input)
+				}
+			},
+		},
+		{
+			name: "env unset",
+			args: []string{"env", "unset", "-awsregion=ap-northeast-2", "DEBUG", "TRACE"},
+			check: func(t *testing.T, input *arguments) {
+				if *input.Action != "unset" || len(input.EnvNames) != 2 || input.EnvNames[1] != "TRACE" {
+					t.Errorf("unexpected arguments %+v", input)
+				}
+			},
+		},
+		{
+			name:  "secret of stdin",
+			args:  []string{"secret", "set", "-awsregion=ap-northeast-2", "PRIVATE_KEY"},
+			stdin: "-----BEGIN KEY-----\nabc\n-----END KEY-----\n",
+			check: func(t *testing.T, input *arguments) {
+				if input.Env["PRIVATE_KEY"] != "-----BEGIN KEY-----\nabc\n-----END KEY-----" {
+					t.Errorf("expected the whole key of stdin, got %q", input.Env["PRIVATE_KEY"])
+				}
+			},
+		},
+		{name: "no token", args: []string{"create", "-awsregion=ap-northeast-2", "-domain=example.com"}, wantErr: "github token is missing"},
+		{name: "plan without a token", args: []string{"plan", "-awsregion=ap-northeast-2", "-domain=example.com"}, wantErr: "github token is missing"},
+		{name: "empty stdin", args: []string{"create", "-githubtoken-stdin", "-awsregion=ap-northeast-2", "-domain=example.com"}, wantErr: "no github token"},
+		{name: "no region", args: []string{"delete", "-domain=example.com"}, wantErr: "aws region is missing"},
+		{name: "no domain", args: []string{"delete", "-awsregion=ap-northeast-2"}, wantErr: "-domain=example.com"},
+		{name: "www domain", args: []string{"delete", "-domain=www.example.com"}, wantErr: "should not start with www."},
+		{name: "unknown command", args: []string{"destroy"}, wantErr: "unknown command destroy"},
+		{name: "unknown flag", args: []string{"delete", "-domian=example.com"}, wantErr: "flag provided but not defined: -domian"},
+		{name: "flag of another command", args: []string{"delete", "-destroy"}, wantErr: "flag provided but not defined: -destroy"},
+		{name: "extra argument", args: []string{"list", "all"}, wantErr: "unexpected argument all"},
+		{name: "dns resolver without a port", args: []string{"create", "-dns-resolver=127.0.0.1"}, wantErr: "should be host:port"},
+		{name: "since", args: []string{"logs", "-awsregion=ap-northeast-2", "-since=yesterday"}, wantErr: "value of -since"},
+		{name: "no command", args: []string{"-awsregion=ap-northeast-2"}, wantErr: "a command is missing"},
+		{name: "env without action", args: []string{"env", "-awsregion=ap-northeast-2"}, wantErr: "an action is missing"},
+		{name: "env set without a value", args: []string{"env", "set", "-awsregion=ap-northeast-2", "PORT"}, wantErr: "should be NAME=value"},
+		{name: "env unset with a value", args: []string{"env", "unset", "-awsregion=ap-northeast-2", "PORT=80"}, wantErr: "without a value"},
+		{name: "env name", args: []string{"env", "set", "-awsregion=ap-northeast-2", "node-env=production"}, wantErr: "not a valid environment variable name"},
+		{name: "env list argument", args: []string{"env", "list", "-awsregion=ap-northeast-2", "PORT"}, wantErr: "unexpected argument PORT"},
+		{name: "secret without stdin", args: []string{"secret", "set", "-awsregion=ap-northeast-2", "TOKEN"}, wantErr: "no value of TOKEN"},
+		{name: "secret unset", args: []string{"secret", "unset", "-awsregion=ap-northeast-2", "TOKEN"}, wantErr: "an action is missing"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range []string{"CLOUDGUN_GITHUB_TOKEN", "GITHUB_TOKEN", "AWS_REGION"} {
+				t.Setenv(name, test.env[name])
+			}
+			cliOutput = io.Discard
+			stdin = strings.NewReader(test.stdin)
+			ghAuthToken = func() (string, error) {
+				if test.gh == "" {
+					return "", errors.New("gh is not installed")
+				}
+				return test.gh, nil
+			}
+
+			input, err := parseArgs(test.args)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected an error with %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.check(t, input)
+		})
+	}
+}
+
+func TestParseArgsHelp(t *testing.T) {
+	for _, args := range [][]string{{}, {"-help"}, {"help"}, {"create", "-help"}, {"help", "plan"}, {"status", "--help"}} {
+		cliOutput = io.Discard
+		_, err := parseArgs(args)
+		if !errors.Is(err, flag.ErrHelp) {
+			t.Errorf("expected help for %v, got %v", args, err)
+		}
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	cliOutput = io.Discard
+	_, err := parseArgs([]string{"create", "-nope"})
+	if !errors.As(err, &usageError{}) {
+		t.Errorf("expected a usage error, got %v", err)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "1h", want: now.Add(-time.Hour)},
+		{value: "90s", want: now.Add(-90 * time.Second)},
+		{value: "2024-01-01T00:00:00Z", want: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{value: "-1h", wantErr: true},
+		{value: "2024-01-01", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			since, err := parseSince(test.value, now)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("expected %s to be refused, got %s", test.value, since)
+				}
+				return
+			}
+			if err != nil || !since.Equal(test.want) {
+				t.Errorf("expected %s, got %s %v", test.want, since, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"fyc/aws"
+	"fyc/githubSdk"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// defaultConfigPath is read when there is no -config=, so a stack committed next to the code is picked up.
+const defaultConfigPath = "cloudgun.yaml"
+
+const configVersion = 1
+
+// stackConfig is the stack definition of cloudgun.yaml. json works too, it is yaml as well.
+// values left out get the defaults of defaultConfig, the command line flags override the file.
+type stackConfig struct {
+	Version   int             `yaml:"version"`
+	Domain    string          `yaml:"domain"`
+	Region    string          `yaml:"region"`
+	Profile   string          `yaml:"profile"`
+	OIDC      bool            `yaml:"oidc"`
+	WWW       bool            `yaml:"www"` // www.<domain> redirecting to the site
+	Cluster   clusterConfig   `yaml:"cluster"`
+	Container containerConfig `yaml:"container"`
+	Api       apiConfig       `yaml:"api"`
+	Logs      logsConfig      `yaml:"logs"`
+	Github    githubConfig    `yaml:"github"`
+}
+
+type clusterConfig struct {
+	LaunchType   string `yaml:"launchType"` // ec2 or fargate, fargate has no instances and ignores the rest
+	InstanceType string `yaml:"instanceType"`
+	Image        string `yaml:"image"`
+	Min          int32  `yaml:"min"`
+	Max          int32  `yaml:"max"`
+	Desired      int32  `yaml:"desired"`
+}
+
+type containerConfig struct {
+	CPU       int32 `yaml:"cpu"`
+	MemoryMiB int32 `yaml:"memoryMiB"`
+	Port      int32 `yaml:"port"`
+	HostPort  int32 `yaml:"hostPort"` // of ec2 instances, 0 lets a rolling deploy start a task next to the old one
+}
+
+type apiConfig struct {
+	Subdomain string `yaml:"subdomain"`
+}
+
+type logsConfig struct {
+	RetentionDays int32 `yaml:"retentionDays"`
+}
+
+type githubConfig struct {
+	Branch           string `yaml:"branch"`
+	CommitMessage    string `yaml:"commitMessage"`
+	FrontendTemplate string `yaml:"frontendTemplate"`
+	BackendTemplate  string `yaml:"backendTemplate"`
+}
+
+func defaultConfig() *stackConfig {
+	return &stackConfig{
+		WWW: true,
+		Cluster: clusterConfig{
+			LaunchType:   "ec2",
+			InstanceType: string(ec2Types.InstanceTypeT2Micro),
+			Image:        "amazon-linux-2",
+			Min:          1,
+			Max:          3,
+			Desired:      1,
+		},
+		Container: containerConfig{CPU: 512, MemoryMiB: 102, Port: 80, HostPort: 0},
+		Api:       apiConfig{Subdomain: "main-api"},
+		Logs:      logsConfig{RetentionDays: 14},
+		Github: githubConfig{
+			Branch:           "main",
+			CommitMessage:    "good first commit from cloudGun",
+			FrontendTemplate: githubSdk.Vue3.GetName(),
+			BackendTemplate:  githubSdk.NodeExpressMainApi.GetName(),
+		},
+	}
+}
+
+// loadConfig reads the config file of path over the defaults. a missing default file is not an error,
+// a file without version is, so a file of the next version is never read as this one.
+func loadConfig(path string, required bool) (*stackConfig, error) {
+	config := defaultConfig()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			config.Version = configVersion
+			return config, nil
+		}
+		return nil, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	err = decoder.Decode(config)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, errors.New(fmt.Sprintf("config %s is not valid : %s", path, err.Error()))
+	}
+	if config.Version != configVersion {
+		return nil, errors.New(fmt.Sprintf("config %s is of version %d, only version %d is supported", path, config.Version, configVersion))
+	}
+	return config, nil
+}
+
+// a domain is two labels or more, like example.com, app.example.com or example.co.uk
+var domainRegex = regexp.MustCompile("^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\\.)+[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$")
+var subdomainRegex = regexp.MustCompile("^[a-z0-9]([a-z0-9-]*[a-z0-9])?$")
+
+// maxDomainLength keeps www.<domain>-<stack uuid> within the 63 characters of a bucket name.
+const maxDomainLength = 63 - len("www.") - len("-xxxxxxxx-xxxx")
+
+func validateDomain(domain string) error {
+	if strings.HasPrefix(domain, "www.") {
+		return errors.New("domain example.com should not start with www.")
+	} else if !domainRegex.MatchString(domain) {
+		return errors.New(fmt.Sprintf("domain %s is not valid, expected a domain like example.com or app.example.com", domain))
+	} else if len(domain) > maxDomainLength {
+		return errors.New(fmt.Sprintf("domain %s is longer than %d characters, the bucket names of the stack would not fit", domain, maxDomainLength))
+	}
+	return nil
+}
+
+// validate checks the config once the flags are applied, telling every problem at once.
+func (config *stackConfig) validate() error {
+	problems := make([]string, 0)
+	if config.Domain != "" {
+		if err := validateDomain(config.Domain); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if _, ok := aws.LaunchTypes[config.Cluster.LaunchType]; !ok {
+		problems = append(problems, fmt.Sprintf("cluster.launchType %s is not one of %s", config.Cluster.LaunchType, strings.Join(mapKeys(aws.LaunchTypes), ", ")))
+	} else if config.launchType() == aws.LaunchTypeFargate {
+		if _, _, err := aws.FargateTaskSize(config.containerSpec()); err != nil {
+			problems = append(problems, fmt.Sprintf("container.cpu and container.memoryMiB: %s", err.Error()))
+		}
+	}
+	if !slices.Contains(ec2Types.InstanceType("").Values(), ec2Types.InstanceType(config.Cluster.InstanceType)) {
+		problems = append(problems, fmt.Sprintf("cluster.instanceType %s is not an ec2 instance type", config.Cluster.InstanceType))
+	}
+	if _, ok := aws.Images[config.Cluster.Image]; !ok {
+		problems = append(problems, fmt.Sprintf("cluster.image %s is not one of %s", config.Cluster.Image, strings.Join(mapKeys(aws.Images), ", ")))
+	}
+	if config.Cluster.Min < 0 || config.Cluster.Max < 1 || config.Cluster.Min > config.Cluster.Max {
+		problems = append(problems, fmt.Sprintf("cluster.min %d and cluster.max %d should be 0 <= min <= max and max >= 1", config.Cluster.Min, config.Cluster.Max))
+	} else if config.Cluster.Desired < config.Cluster.Min || config.Cluster.Desired > config.Cluster.Max {
+		problems = append(problems, fmt.Sprintf("cluster.desired %d should be between min %d and max %d", config.Cluster.Desired, config.Cluster.Min, config.Cluster.Max))
+	}
+	// 128 cpu units and 6 MiB are the least ecs takes
+	if config.Container.CPU < 128 {
+		problems = append(problems, fmt.Sprintf("container.cpu %d should be 128 or more", config.Container.CPU))
+	}
+	if config.Container.MemoryMiB < 6 {
+		problems = append(problems, fmt.Sprintf("container.memoryMiB %d should be 6 or more", config.Container.MemoryMiB))
+	}
+	if config.Container.Port < 1 || config.Container.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("container.port %d is not a port", config.Container.Port))
+	}
+	if config.Container.HostPort < 0 || config.Container.HostPort > 65535 {
+		problems = append(problems, fmt.Sprintf("container.hostPort %d is not a port, 0 maps a dynamic port", config.Container.HostPort))
+	}
+	if !subdomainRegex.MatchString(config.Api.Subdomain) || config.Api.Subdomain == "www" {
+		problems = append(problems, fmt.Sprintf("api.subdomain %s is not a valid subdomain", config.Api.Subdomain))
+	}
+	if !slices.Contains(aws.LogRetentionDays, config.Logs.RetentionDays) {
+		days := make([]string, 0, len(aws.LogRetentionDays))
+		for _, day := range aws.LogRetentionDays {
+			days = append(days, fmt.Sprint(day))
+		}
+		problems = append(problems, fmt.Sprintf("logs.retentionDays %d is not one of %s", config.Logs.RetentionDays, strings.Join(days, ", ")))
+	}
+	if config.Github.Branch == "" || strings.ContainsAny(config.Github.Branch, " ~^:?*[\\") {
+		problems = append(problems, fmt.Sprintf("github.branch %s is not a valid branch name", config.Github.Branch))
+	}
+	if strings.TrimSpace(config.Github.CommitMessage) == "" {
+		problems = append(problems, "github.commitMessage should not be empty")
+	}
+	if _, ok := githubSdk.FrontendTemplates[config.Github.FrontendTemplate]; !ok {
+		problems = append(problems, fmt.Sprintf("github.frontendTemplate %s is not one of %s", config.Github.FrontendTemplate,
+			strings.Join(mapKeys(githubSdk.FrontendTemplates), ", ")))
+	}
+	if _, ok := githubSdk.BackendTemplates[config.Github.BackendTemplate]; !ok {
+		problems = append(problems, fmt.Sprintf("github.backendTemplate %s is not one of %s", config.Github.BackendTemplate,
+			strings.Join(mapKeys(githubSdk.BackendTemplates), ", ")))
+	}
+	if len(problems) != 0 {
+		return errors.New("config is not valid :\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func (config *stackConfig) image() aws.Image {
+	return aws.Images[config.Cluster.Image]
+}
+
+func (config *stackConfig) launchType() aws.LaunchType {
+	return aws.LaunchTypes[config.Cluster.LaunchType]
+}
+
+func (config *stackConfig) containerSpec() *aws.ContainerSpec {
+	return &aws.ContainerSpec{
+		CPU:           config.Container.CPU,
+		MemoryMiB:     config.Container.MemoryMiB,
+		ContainerPort: config.Container.Port,
+		HostPort:      config.Container.HostPort,
+	}
+}
+
+func mapKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
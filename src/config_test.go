@@ -0,0 +1,200 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "cloudgun.yaml")
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+		check   func(t *testing.T, config *stackConfig)
+	}{
+		{
+			name:    "defaults",
+			content: "version: 1\n",
+			check: func(t *testing.T, config *stackConfig) {
+				if config.Cluster.Min != 1 || config.Cluster.Max != 3 || config.Cluster.Desired != 1 {
+					t.Errorf("expected a cluster of 1 to 3, got %+v", config.Cluster)
+				}
+				if config.Cluster.InstanceType != "t2.micro" || config.Cluster.Image != "amazon-linux-2" {
+					t.Errorf("expected t2.micro and amazon-linux-2, got %+v", config.Cluster)
+				}
+				if config.Api.Subdomain != "main-api" || config.Github.Branch != "main" {
+					t.Errorf("expected main-api and main, got %s and %s", config.Api.Subdomain, config.Github.Branch)
+				}
+				if config.Logs.RetentionDays != 14 {
+					t.Errorf("expected logs kept 14 days, got %d", config.Logs.RetentionDays)
+				}
+			},
+		},
+		{
+			name: "values of the file",
+			content: strings.Join([]string{
+				"version: 1",
+				"domain: example.com",
+				"region: ap-northeast-2",
+				"cluster:",
+				"  instanceType: t3.small",
+				"  max: 5",
+				"  desired: 2",
+				"container:",
+				"  memoryMiB: 512",
+				"  port: 3000",
+				"api:",
+				"  subdomain: api",
+				"github:",
+				"  branch: develop",
+				"  commitMessage: initial commit",
+			}, "\n"),
+			check: func(t *testing.T, config *stackConfig) {
+				if config.Domain != "example.com" || config.Region != "ap-northeast-2" {
+					t.Errorf("expected example.com in ap-northeast-2, got %s in %s", config.Domain, config.Region)
+				}
+				if config.Cluster.InstanceType != "t3.small" || config.Cluster.Min != 1 || config.Cluster.Max != 5 || config.Cluster.Desired != 2 {
+					t.Errorf("expected t3.small of 1 to 5, got %+v", config.Cluster)
+				}
+				if config.Container.MemoryMiB != 512 || config.Container.Port != 3000 || config.Container.CPU != 512 {
+					t.Errorf("expected 512 MiB on port 3000, got %+v", config.Container)
+				}
+				if config.Github.Branch != "develop" || config.Github.CommitMessage != "initial commit" || config.Github.BackendTemplate != "nodeExpressMainApi" {
+					t.Errorf("expected develop and the default templates, got %+v", config.Github)
+				}
+			},
+		},
+		{
+			name:    "json",
+			content: "{\"version\": 1, \"cluster\": {\"instanceType\": \"t3.micro\"}}",
+			check: func(t *testing.T, config *stackConfig) {
+				if config.Cluster.InstanceType != "t3.micro" {
+					t.Errorf("expected t3.micro, got %s", config.Cluster.InstanceType)
+				}
+			},
+		},
+		{name: "unknown field", content: "version: 1\ncluster:\n  size: 3\n", wantErr: "field size not found"},
+		{name: "no version", content: "domain: example.com\n", wantErr: "version 0"},
+		{name: "next version", content: "version: 2\n", wantErr: "version 2"},
+		{name: "empty file", content: "", wantErr: "version 0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := loadConfig(writeConfig(t, test.content), true)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected an error with %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := config.validate(); err != nil {
+				t.Fatal(err)
+			}
+			test.check(t, config)
+		})
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cloudgun.yaml")
+	config, err := loadConfig(path, false)
+	if err != nil || config.Cluster.Max != 3 {
+		t.Errorf("expected the defaults without a file, got %+v %v", config, err)
+	}
+	_, err = loadConfig(path, true)
+	if err == nil {
+		t.Error("expected an error for a missing -config file")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(config *stackConfig)
+		wantErr string
+	}{
+		{name: "valid", change: func(config *stackConfig) {}},
+		{name: "www domain", change: func(config *stackConfig) { config.Domain = "www.example.com" }, wantErr: "should not start with www."},
+		{name: "subdomain", change: func(config *stackConfig) { config.Domain = "app.example.com" }},
+		{name: "multi-label tld", change: func(config *stackConfig) { config.Domain = "shop.example.co.uk" }},
+		{name: "label with a leading hyphen", change: func(config *stackConfig) { config.Domain = "-app.example.com" }, wantErr: "is not valid"},
+		{name: "single label", change: func(config *stackConfig) { config.Domain = "localhost" }, wantErr: "is not valid"},
+		{name: "too long for a bucket", change: func(config *stackConfig) { config.Domain = strings.Repeat("a", 40) + ".example.com" }, wantErr: "longer than 45"},
+		{name: "instance type", change: func(config *stackConfig) { config.Cluster.InstanceType = "t2.huge" }, wantErr: "cluster.instanceType"},
+		{name: "image", change: func(config *stackConfig) { config.Cluster.Image = "ubuntu" }, wantErr: "cluster.image ubuntu is not one of amazon-linux-2"},
+		{name: "fargate", change: func(config *stackConfig) { config.Cluster.LaunchType = "fargate" }},
+		{name: "launch type", change: func(config *stackConfig) { config.Cluster.LaunchType = "lambda" }, wantErr: "cluster.launchType lambda is not one of"},
+		{
+			name: "container larger than fargate",
+			change: func(config *stackConfig) {
+				config.Cluster.LaunchType = "fargate"
+				config.Container.MemoryMiB = 65536
+			},
+			wantErr: "container.cpu and container.memoryMiB",
+		},
+		{name: "min above max", change: func(config *stackConfig) { config.Cluster.Min = 4 }, wantErr: "cluster.min"},
+		{name: "desired above max", change: func(config *stackConfig) { config.Cluster.Desired = 4 }, wantErr: "cluster.desired"},
+		{name: "no memory", change: func(config *stackConfig) { config.Container.MemoryMiB = 0 }, wantErr: "container.memoryMiB"},
+		{name: "port", change: func(config *stackConfig) { config.Container.Port = 70000 }, wantErr: "container.port"},
+		{name: "api subdomain", change: func(config *stackConfig) { config.Api.Subdomain = "main.api" }, wantErr: "api.subdomain"},
+		{name: "log retention", change: func(config *stackConfig) { config.Logs.RetentionDays = 10 }, wantErr: "logs.retentionDays 10 is not one of 1, 3, 5"},
+		{name: "branch", change: func(config *stackConfig) { config.Github.Branch = "" }, wantErr: "github.branch"},
+		{name: "template", change: func(config *stackConfig) { config.Github.FrontendTemplate = "react" }, wantErr: "github.frontendTemplate react is not one of vue3"},
+		{
+			name: "every problem at once",
+			change: func(config *stackConfig) {
+				config.Cluster.Image = "ubuntu"
+				config.Github.Branch = ""
+			},
+			wantErr: "cluster.image ubuntu is not one of amazon-linux-2\n  github.branch",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Domain = "example.com"
+			test.change(config)
+			err := config.validate()
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("expected an error with %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFlagsOverrideConfig(t *testing.T) {
+	config := defaultConfig()
+	config.Region = "ap-northeast-2"
+	config.Domain = "example.com"
+	config.Github.Branch = "develop"
+	region := "eu-west-1"
+	instanceType := "t3.small"
+	input := arguments{AWSRegion: &region, InstanceType: &instanceType, OIDC: true}
+	input.applyTo(config)
+	if config.Region != "eu-west-1" || config.Cluster.InstanceType != "t3.small" || !config.OIDC {
+		t.Errorf("expected the flags to override the file, got %+v", config)
+	}
+	if config.Domain != "example.com" || config.Github.Branch != "develop" {
+		t.Errorf("expected the values of the file without a flag, got %+v", config)
+	}
+}
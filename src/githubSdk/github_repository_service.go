@@ -3,14 +3,28 @@ package githubSdk
 import (
 	"embed"
 	"encoding/base64"
+	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/google/go-github/v61/github"
+	"io"
 	"strings"
 )
 
-func (client *Client) createRepository(organization string, repoName string) error {
+func (client *Client) createRepository(progress io.Writer, organization string, repoName string) error {
 	repo := github.Repository{Name: &repoName}
-	_, _, err := client.Repositories.Create(ctx, organization, &repo)
+	_, r, err := client.Repositories.Create(ctx, organization, &repo)
+	if err == nil {
+		createdRepositoriesMutex.Lock()
+		createdRepositories = append(createdRepositories, repoName)
+		createdRepositoriesMutex.Unlock()
+	} else if r != nil && r.StatusCode == 422 {
+		// created by a previous run that did not finish
+		_, _, getErr := client.Repositories.Get(ctx, *user.Login, repoName)
+		if getErr == nil {
+			fmt.Fprintln(progress, fmt.Sprintf("adopting existing repository %s", repoName))
+			return nil
+		}
+	}
 	return err
 }
 
@@ -20,11 +34,17 @@ func (client *Client) createReadme(repoName *string, content string, message *st
 		Content: []byte(content),
 		Branch:  branch,
 	}
-	_, _, err := client.Repositories.CreateFile(ctx, *user.Login, *repoName, "README.md", &options)
+	_, r, err := client.Repositories.CreateFile(ctx, *user.Login, *repoName, "README.md", &options)
+	if err != nil && r != nil && r.StatusCode == 422 {
+		// README.md was already committed by a previous run
+		return nil
+	}
 	return err
 }
 
-func (client *Client) createFolder(embedded embed.FS, repoName string, blobs *[]*github.TreeEntry, path string, removePath string, gitIgnore *[]string) error {
+// createFolder uploads an embedded folder as blobs, with the workflows changed by replacements.
+func (client *Client) createFolder(embedded embed.FS, repoName string, blobs *[]*github.TreeEntry, path string, removePath string, gitIgnore *[]string,
+	replacements *workflowReplacements) error {
 	open, err := embedded.Open(path)
 	if err != nil {
 		return err
@@ -44,16 +64,24 @@ func (client *Client) createFolder(embedded embed.FS, repoName string, blobs *[]
 			return err
 		}
 		for _, entry := range dir {
-			err := client.createFolder(embedded, repoName, blobs, path+"/"+entry.Name(), removePath, gitIgnore)
+			err := client.createFolder(embedded, repoName, blobs, path+"/"+entry.Name(), removePath, gitIgnore, replacements)
 			if err != nil {
 				return err
 			}
 		}
 	} else {
-		content, err := embedded.ReadFile(path)
+		source := path
+		gitPath := strings.TrimPrefix(strings.Replace(path, removePath, "", 1), "/")
+		if replacement, found := replacements.files[gitPath]; found {
+			source = replacement
+		}
+		content, err := embedded.ReadFile(source)
 		if err != nil {
 			return err
 		}
+		if strings.HasPrefix(gitPath, ".github/workflows/") {
+			content = setWorkflowBranch(content, replacements.branch)
+		}
 		err = client.createFileBlob(repoName, content, blobs, path, removePath)
 		if err != nil {
 			return err
@@ -124,9 +152,9 @@ func (client *Client) createCommit(repoName *string, message *string, blobTree *
 	return commit, nil
 }
 
-func (client *Client) updateRef(repoName *string, createdCommit *github.Commit) error {
+func (client *Client) updateRef(repoName *string, branch *string, createdCommit *github.Commit) error {
 	ref := github.Reference{
-		Ref:    aws.String("refs/heads/main"),
+		Ref:    aws.String("refs/heads/" + *branch),
 		Object: &github.GitObject{SHA: createdCommit.SHA},
 	}
 	_, _, err := client.Git.UpdateRef(ctx, *user.Login, *repoName, &ref, false)
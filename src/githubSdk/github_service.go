@@ -1,12 +1,17 @@
 package githubSdk
 
 import (
+	"bytes"
 	"context"
 	"embed"
 	"errors"
 	"fmt"
 	"github.com/google/go-github/v61/github"
+	"io"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,14 +20,58 @@ type Client github.Client
 //go:embed all:embed
 var embedded embed.FS
 var ctx context.Context
+var cancelCtx context.CancelFunc
 var client *Client
 var user *github.User
 
+// createdRepositories are the repositories created by this process, which is what a rollback deletes.
+var createdRepositories []string
+var createdRepositoriesMutex sync.Mutex
+
 func init() {
-	ctx, _ = context.WithTimeout(context.Background(), 720*time.Second)
+	ctx, cancelCtx = context.WithCancel(context.Background())
+}
+
+// SetContext makes every github call run under parent, so cancelling parent stops the calls in flight.
+func SetContext(parent context.Context) {
+	cancelCtx()
+	ctx, cancelCtx = context.WithCancel(parent)
 }
+
+// DeleteCreatedRepositories deletes the repositories created by this process and returns the ones it could not delete.
+// deleting needs the delete_repo scope on the token.
+func DeleteCreatedRepositories(timeout time.Duration) []string {
+	cancelCtx()
+	ctx, cancelCtx = context.WithTimeout(context.Background(), timeout)
+	createdRepositoriesMutex.Lock()
+	defer createdRepositoriesMutex.Unlock()
+	leftovers := make([]string, 0)
+	for i := len(createdRepositories) - 1; i >= 0; i-- {
+		repoName := createdRepositories[i]
+		fmt.Println(fmt.Sprintf("rollback github repository %s/%s", *user.Login, repoName))
+		_, err := client.Repositories.Delete(ctx, *user.Login, repoName)
+		if err != nil {
+			fmt.Println(err)
+			leftovers = append(leftovers, repoName)
+		}
+	}
+	createdRepositories = nil
+	return leftovers
+}
+
+// APIURL is the github rest api cloudGun talks to, like a local server in tests. empty means api.github.com.
+var APIURL string
+
 func InitClient(accessToken *string) error {
-	client = (*Client)(github.NewClient(nil).WithAuthToken(*accessToken))
+	githubClient := github.NewClient(nil).WithAuthToken(*accessToken)
+	if APIURL != "" {
+		baseURL, err := url.Parse(strings.TrimSuffix(APIURL, "/") + "/")
+		if err != nil {
+			return err
+		}
+		githubClient.BaseURL = baseURL
+	}
+	client = (*Client)(githubClient)
 	result, resp, err := client.Users.Get(ctx, "")
 	if err != nil {
 		return err
@@ -37,148 +86,194 @@ func InitClient(accessToken *string) error {
 	return nil
 }
 
-func CreateS3WebsiteRepository(region *string, repoName *string, bucketName *string, awsAccessKey *string,
-	awsSecretAccessKey *string, cloudFrontDistributionId *string, template FrontendTemplate, commitMessage *string, branch *string) error {
-	fmt.Println("createRepository")
-	err := client.createRepository("", *repoName)
+func CreateS3WebsiteRepository(progress io.Writer, region *string, repoName *string, bucketName *string, auth *AWSAuth,
+	cloudFrontDistributionId *string, template FrontendTemplate, commitMessage *string, branch *string) error {
+	err := client.createRepository(progress, "", *repoName)
 	if err != nil { // 404 라면 권한이 없는 것일 수도 있다.
 		return err
 	}
-	fmt.Println("createReadme")
 	err = client.createReadme(repoName, "", commitMessage, branch)
 	if err != nil {
 		return err
 	}
-	fmt.Println("saveSecret")
-	err = client.saveSecret(*repoName, "AWS_ACCESS_KEY_ID", *awsAccessKey)
-	if err != nil {
-		return err
-	}
-	fmt.Println("saveSecret")
-	err = client.saveSecret(*repoName, "AWS_SECRET_ACCESS_KEY", *awsSecretAccessKey)
-	if err != nil {
-		return err
-	}
-	fmt.Println("saveSecret")
-	err = client.saveSecret(*repoName, "AWS_CLOUDFRONT_DISTRIBUTION_ID", *cloudFrontDistributionId) // E265G1FI21SHCH
-	if err != nil {
-		return err
-	}
-	fmt.Println("saveSecret")
-	err = client.saveSecret(*repoName, "AWS_REGION", *region)
+	err = client.saveAWSAuth(*repoName, auth)
 	if err != nil {
 		return err
 	}
-	fmt.Println("saveSecret")
-	err = client.saveSecret(*repoName, "AWS_BUCKET_NAME", *bucketName)
-	if err != nil {
-		return err
+	for _, secret := range getS3WebsiteSecrets(region, bucketName, cloudFrontDistributionId) {
+		err = client.saveSecret(*repoName, secret.name, secret.value)
+		if err != nil {
+			return err
+		}
 	}
-	fmt.Println("createFolder")
 	entries := make([]*github.TreeEntry, 0)
-	err = client.createFolder(embedded, *repoName, &entries, template.path, template.removePath, &template.gitIgnore)
+	err = client.createFolder(embedded, *repoName, &entries, template.path, template.removePath, &template.gitIgnore,
+		getWorkflowReplacements(auth, template.workflow, template.oidcWorkflow, branch))
 	if err != nil {
 		return err
 	}
-	fmt.Println("getBranch")
 	repoCommit, baseTree, err := client.getBranch(repoName, branch)
 	if err != nil {
 		return err
 	}
-	fmt.Println("createBlobTree")
 	createdTree, err := client.createBlobTree(repoName, baseTree, &entries)
 	if err != nil { // 404 라면 workflow 권한이 없을 수도 있다.
 		return err
 	}
-	fmt.Println("createCommit")
 	createdCommit, err := client.createCommit(repoName, commitMessage, createdTree, &github.Commit{SHA: repoCommit.SHA})
 	if err != nil {
 		return err
 	}
-	fmt.Println("updateRef")
-	err = client.updateRef(repoName, createdCommit)
+	err = client.updateRef(repoName, branch, createdCommit)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func CreateCodeRepository(region *string, awsAccessKey *string, awsSecretAccessKey *string, ecrName *string,
+func CreateCodeRepository(progress io.Writer, region *string, auth *AWSAuth, ecrName *string,
 	clusterName *string, serviceName *string, taskFamilyName *string, containerName *string, repoName *string,
-	branch *string, template BackendTemplate) error {
-	commitMessage := "good first commit from codeTemplate"
-	fmt.Println("createRepository")
-	err := client.createRepository("", *repoName)
-	fmt.Println("createReadme")
-	err = client.createReadme(repoName, "", &commitMessage, branch)
+	branch *string, template BackendTemplate, commitMessage *string) error {
+	err := client.createRepository(progress, "", *repoName)
 	if err != nil {
 		return err
 	}
-	fmt.Println("saveSecret")
-	err = client.saveSecret(*repoName, "AWS_ACCESS_KEY_ID", *awsAccessKey)
+	err = client.createReadme(repoName, "", commitMessage, branch)
 	if err != nil {
 		return err
 	}
-	fmt.Println("saveSecret")
-	err = client.saveSecret(*repoName, "AWS_SECRET_ACCESS_KEY", *awsSecretAccessKey)
+	err = client.saveAWSAuth(*repoName, auth)
 	if err != nil {
 		return err
 	}
-	fmt.Println("saveSecret")
-	err = client.saveSecret(*repoName, "AWS_REGION", *region)
-	if err != nil {
-		return err
+	for _, secret := range getCodeRepositorySecrets(region, ecrName, clusterName, serviceName, taskFamilyName, containerName) {
+		err = client.saveSecret(*repoName, secret.name, secret.value)
+		if err != nil {
+			return err
+		}
 	}
-	fmt.Println("saveSecret")
-	err = client.saveSecret(*repoName, "AWS_ECR_REPOSITORY", *ecrName)
+	entries := make([]*github.TreeEntry, 0)
+	err = client.createFolder(embedded, *repoName, &entries, template.path, template.removePath, &template.gitIgnore,
+		getWorkflowReplacements(auth, template.workflow, template.oidcWorkflow, branch))
 	if err != nil {
 		return err
 	}
-	fmt.Println("saveSecret")
-	err = client.saveSecret(*repoName, "AWS_ECS_CLUSTER", *clusterName)
+	repoCommit, baseTree, err := client.getBranch(repoName, branch)
 	if err != nil {
 		return err
 	}
-	fmt.Println("saveSecret")
-	err = client.saveSecret(*repoName, "AWS_ECS_SERVICE", *serviceName)
+	createdTree, err := client.createBlobTree(repoName, baseTree, &entries)
 	if err != nil {
 		return err
 	}
-	fmt.Println("saveSecret")
-	err = client.saveSecret(*repoName, "AWS_ECS_TASK_DEFINITION", *taskFamilyName)
+	createdCommit, err := client.createCommit(repoName, commitMessage, createdTree, &github.Commit{SHA: repoCommit.SHA})
 	if err != nil {
 		return err
 	}
-	fmt.Println("saveSecret")
-	err = client.saveSecret(*repoName, "AWS_ECS_TASK_CONTAINER_NAME", *containerName)
+	err = client.updateRef(repoName, branch, createdCommit)
 	if err != nil {
 		return err
 	}
-	fmt.Println("createFolder")
-	entries := make([]*github.TreeEntry, 0)
-	err = client.createFolder(embedded, *repoName, &entries, template.path, template.removePath, &template.gitIgnore)
-	if err != nil {
-		return err
+	return nil
+}
+
+// GetLogin returns the login of the user owning the github token.
+func GetLogin() *string {
+	return user.Login
+}
+
+// GetOIDCSubject returns the oidc token subject github actions use when running on the branch of a repository.
+func GetOIDCSubject(repoName *string, branch *string) string {
+	return fmt.Sprintf("repo:%s/%s:ref:refs/heads/%s", *user.Login, *repoName, *branch)
+}
+
+// SaveAWSAuth replaces the aws credential secrets of a repository created before, like after the deploy key is rotated.
+func SaveAWSAuth(repoName *string, auth *AWSAuth) error {
+	return client.saveAWSAuth(*repoName, auth)
+}
+
+func (client *Client) saveAWSAuth(repoName string, auth *AWSAuth) error {
+	for _, secret := range getAWSAuthSecrets(auth) {
+		err := client.saveSecret(repoName, secret.name, secret.value)
+		if err != nil {
+			return err
+		}
 	}
-	fmt.Println("getBranch")
-	repoCommit, baseTree, err := client.getBranch(repoName, branch)
-	if err != nil {
-		return err
+	return nil
+}
+
+func getAWSAuthSecrets(auth *AWSAuth) []repositorySecret {
+	if auth.isOIDC() {
+		return []repositorySecret{{name: "AWS_ROLE_ARN", value: auth.RoleArn}}
 	}
-	fmt.Println("createBlobTree")
-	createdTree, err := client.createBlobTree(repoName, baseTree, &entries)
-	if err != nil {
-		return err
+	secrets := []repositorySecret{
+		{name: "AWS_ACCESS_KEY_ID", value: auth.AccessKey},
+		{name: "AWS_SECRET_ACCESS_KEY", value: auth.SecretAccessKey},
 	}
-	fmt.Println("createCommit")
-	createdCommit, err := client.createCommit(repoName, &commitMessage, createdTree, &github.Commit{SHA: repoCommit.SHA})
-	if err != nil {
-		return err
+	if auth.SessionToken != "" {
+		secrets = append(secrets, repositorySecret{name: "AWS_SESSION_TOKEN", value: auth.SessionToken})
 	}
-	fmt.Println("updateRef")
-	err = client.updateRef(repoName, createdCommit)
-	if err != nil {
-		return err
+	return secrets
+}
+
+func getS3WebsiteSecrets(region *string, bucketName *string, cloudFrontDistributionId *string) []repositorySecret {
+	return []repositorySecret{
+		{name: "AWS_CLOUDFRONT_DISTRIBUTION_ID", value: *cloudFrontDistributionId}, // E265G1FI21SHCH
+		{name: "AWS_REGION", value: *region},
+		{name: "AWS_BUCKET_NAME", value: *bucketName},
 	}
-	return nil
+}
+
+func getCodeRepositorySecrets(region *string, ecrName *string, clusterName *string, serviceName *string,
+	taskFamilyName *string, containerName *string) []repositorySecret {
+	return []repositorySecret{
+		{name: "AWS_REGION", value: *region},
+		{name: "AWS_ECR_REPOSITORY", value: *ecrName},
+		{name: "AWS_ECS_CLUSTER", value: *clusterName},
+		{name: "AWS_ECS_SERVICE", value: *serviceName},
+		{name: "AWS_ECS_TASK_DEFINITION", value: *taskFamilyName},
+		{name: "AWS_ECS_TASK_CONTAINER_NAME", value: *containerName},
+	}
+}
+
+// GetS3WebsiteSecretNames returns the names of the secrets CreateS3WebsiteRepository saves.
+func GetS3WebsiteSecretNames(oidc bool) []string {
+	empty := ""
+	return getSecretNames(oidc, getS3WebsiteSecrets(&empty, &empty, &empty))
+}
+
+// GetCodeRepositorySecretNames returns the names of the secrets CreateCodeRepository saves.
+func GetCodeRepositorySecretNames(oidc bool) []string {
+	empty := ""
+	return getSecretNames(oidc, getCodeRepositorySecrets(&empty, &empty, &empty, &empty, &empty, &empty))
+}
+
+func getSecretNames(oidc bool, secrets []repositorySecret) []string {
+	auth := AWSAuth{}
+	if oidc {
+		auth.RoleArn = "arn"
+	}
+	names := make([]string, 0)
+	for _, secret := range append(getAWSAuthSecrets(&auth), secrets...) {
+		names = append(names, secret.name)
+	}
+	return names
+}
+
+// getWorkflowReplacements swaps the access key workflow of a template with its oidc version, and deploys the workflows
+// on pushes to branch.
+func getWorkflowReplacements(auth *AWSAuth, workflow string, oidcWorkflow string, branch *string) *workflowReplacements {
+	replacements := workflowReplacements{files: map[string]string{}, branch: *branch}
+	if auth.isOIDC() {
+		replacements.files[workflow] = oidcWorkflow
+	}
+	return &replacements
+}
+
+// the push trigger of every workflow of the templates
+const workflowBranches = "branches: [ \"main\" ]"
+
+// setWorkflowBranch makes a workflow of a template run on pushes to branch instead of main.
+func setWorkflowBranch(content []byte, branch string) []byte {
+	return bytes.Replace(content, []byte(workflowBranches), []byte(fmt.Sprintf("branches: [ %s ]", strconv.Quote(branch))), 1)
 }
@@ -0,0 +1,327 @@
+package githubSdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInitClientAPIURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  string
+		wantErr bool
+	}{
+		{name: "repo and workflow", scopes: "repo, workflow"},
+		{name: "no workflow", scopes: "repo", wantErr: true},
+		{name: "no scopes", scopes: "", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			calls := make([]string, 0)
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				mutex.Lock()
+				calls = append(calls, fmt.Sprintf("%s %s %s", request.Method, request.URL.Path, request.Header.Get("Authorization")))
+				mutex.Unlock()
+				writer.Header().Set("X-Oauth-Scopes", test.scopes)
+				writer.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(writer, "{\"login\":\"cloudgun-test\"}")
+			}))
+			defer server.Close()
+			APIURL = server.URL + "/api/v3"
+			defer func() {
+				APIURL = ""
+				client = nil
+				user = nil
+			}()
+
+			token := "ghp_test"
+			err := InitClient(&token)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("expected error %v, got %v", test.wantErr, err)
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			if len(calls) != 1 || calls[0] != "GET /api/v3/user Bearer ghp_test" {
+				t.Errorf("expected GET /api/v3/user with the token, got %v", calls)
+			}
+			if !test.wantErr && *GetLogin() != "cloudgun-test" {
+				t.Errorf("expected login cloudgun-test, got %s", *GetLogin())
+			}
+		})
+	}
+}
+
+// githubEmulator is a local github api keeping the repositories, secrets and branch heads cloudGun creates.
+type githubEmulator struct {
+	mutex        sync.Mutex
+	repositories map[string]bool
+	secrets      map[string][]string          // by repository
+	blobs        map[string]string            // content by blob sha
+	trees        map[string]map[string]string // blob sha by path of the tree entries by tree sha
+	heads        map[string]string            // head commit by repository/branch
+	commitTrees  map[string]string            // tree of a commit
+	lastSha      int
+	unanswered   []string
+	// refused makes creating a repository fail like with a token without access to it
+	refused bool
+}
+
+func newGithubEmulator(t *testing.T) *githubEmulator {
+	t.Helper()
+	emulator := &githubEmulator{repositories: map[string]bool{}, secrets: map[string][]string{}, blobs: map[string]string{},
+		trees: map[string]map[string]string{}, heads: map[string]string{}, commitTrees: map[string]string{}}
+	server := httptest.NewServer(http.HandlerFunc(emulator.serve))
+	APIURL = server.URL + "/api/v3"
+	t.Cleanup(func() {
+		server.Close()
+		APIURL = ""
+		client = nil
+		user = nil
+		createdRepositories = nil
+	})
+	return emulator
+}
+
+func (emulator *githubEmulator) sha() string {
+	emulator.lastSha++
+	return fmt.Sprintf("%040d", emulator.lastSha)
+}
+
+func (emulator *githubEmulator) serve(writer http.ResponseWriter, request *http.Request) {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+	body := map[string]interface{}{}
+	_ = json.NewDecoder(request.Body).Decode(&body)
+	reply := func(status int, response string) {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(status)
+		fmt.Fprint(writer, response)
+	}
+	path := strings.TrimPrefix(request.URL.Path, "/api/v3/")
+	if path == "user" {
+		writer.Header().Set("X-Oauth-Scopes", "repo, workflow, delete_repo")
+		reply(http.StatusOK, "{\"login\":\"cloudgun-test\"}")
+		return
+	}
+	if request.Method == http.MethodPost && path == "user/repos" {
+		if emulator.refused {
+			reply(http.StatusForbidden, "{\"message\":\"Resource not accessible by personal access token\"}")
+			return
+		}
+		name, _ := body["name"].(string)
+		if emulator.repositories[name] {
+			reply(http.StatusUnprocessableEntity, "{\"message\":\"name already exists on this account\"}")
+			return
+		}
+		// a new repository is empty, its first file creates the branch
+		emulator.repositories[name] = true
+		reply(http.StatusCreated, fmt.Sprintf("{\"name\":\"%s\"}", name))
+		return
+	}
+
+	// repos/cloudgun-test/{repo}/...
+	parts := strings.SplitN(path, "/", 4)
+	if len(parts) < 3 || parts[0] != "repos" || parts[1] != "cloudgun-test" || !emulator.repositories[parts[2]] {
+		reply(http.StatusNotFound, "{\"message\":\"Not Found\"}")
+		return
+	}
+	repoName := parts[2]
+	rest := ""
+	if len(parts) == 4 {
+		rest = parts[3]
+	}
+	switch {
+	case request.Method == http.MethodGet && rest == "":
+		reply(http.StatusOK, fmt.Sprintf("{\"name\":\"%s\"}", repoName))
+	case request.Method == http.MethodDelete && rest == "":
+		delete(emulator.repositories, repoName)
+		writer.WriteHeader(http.StatusNoContent)
+	case request.Method == http.MethodPut && rest == "contents/README.md":
+		branch, _ := body["branch"].(string)
+		if branch == "" {
+			branch = "main"
+		}
+		head := emulator.sha()
+		emulator.commitTrees[head] = emulator.sha()
+		emulator.heads[repoName+"/"+branch] = head
+		reply(http.StatusCreated, fmt.Sprintf("{\"content\":{\"path\":\"README.md\"},\"commit\":{\"sha\":\"%s\"}}", head))
+	case request.Method == http.MethodGet && rest == "actions/secrets/public-key":
+		reply(http.StatusOK, "{\"key_id\":\"1\",\"key\":\"AQIDBAUGBwgJCgsMDQ4PEBESExQVFhcYGRobHB0eHyA=\"}")
+	case request.Method == http.MethodPut && strings.HasPrefix(rest, "actions/secrets/"):
+		emulator.secrets[repoName] = append(emulator.secrets[repoName], strings.TrimPrefix(rest, "actions/secrets/"))
+		writer.WriteHeader(http.StatusCreated)
+	case request.Method == http.MethodPost && rest == "git/blobs":
+		sha := emulator.sha()
+		emulator.blobs[sha], _ = body["content"].(string)
+		reply(http.StatusCreated, fmt.Sprintf("{\"sha\":\"%s\"}", sha))
+	case request.Method == http.MethodGet && strings.HasPrefix(rest, "branches/"):
+		head, found := emulator.heads[repoName+"/"+strings.TrimPrefix(rest, "branches/")]
+		if !found {
+			reply(http.StatusNotFound, "{\"message\":\"Branch not found\"}")
+			return
+		}
+		reply(http.StatusOK, fmt.Sprintf("{\"name\":\"%s\",\"commit\":{\"sha\":\"%s\",\"commit\":{\"tree\":{\"sha\":\"%s\"}}}}",
+			strings.TrimPrefix(rest, "branches/"), head, emulator.commitTrees[head]))
+	case request.Method == http.MethodPost && rest == "git/trees":
+		sha := emulator.sha()
+		emulator.trees[sha] = map[string]string{}
+		entries, _ := body["tree"].([]interface{})
+		for _, entry := range entries {
+			path, _ := entry.(map[string]interface{})["path"].(string)
+			emulator.trees[sha][path], _ = entry.(map[string]interface{})["sha"].(string)
+		}
+		reply(http.StatusCreated, fmt.Sprintf("{\"sha\":\"%s\"}", sha))
+	case request.Method == http.MethodPost && rest == "git/commits":
+		sha := emulator.sha()
+		tree, _ := body["tree"].(string)
+		emulator.commitTrees[sha] = tree
+		reply(http.StatusCreated, fmt.Sprintf("{\"sha\":\"%s\"}", sha))
+	case request.Method == http.MethodPatch && strings.HasPrefix(rest, "git/refs/heads/"):
+		branch := strings.TrimPrefix(rest, "git/refs/heads/")
+		if _, found := emulator.heads[repoName+"/"+branch]; !found {
+			reply(http.StatusUnprocessableEntity, "{\"message\":\"Reference does not exist\"}")
+			return
+		}
+		sha, _ := body["sha"].(string)
+		emulator.heads[repoName+"/"+branch] = sha
+		reply(http.StatusOK, fmt.Sprintf("{\"ref\":\"refs/heads/%s\",\"object\":{\"sha\":\"%s\"}}", branch, sha))
+	default:
+		emulator.unanswered = append(emulator.unanswered, request.Method+" "+path)
+		reply(http.StatusNotFound, "{\"message\":\"Not Found\"}")
+	}
+}
+
+func TestCreateDeleteRepositories(t *testing.T) {
+	tests := []struct {
+		name   string
+		branch string
+	}{
+		{name: "main", branch: "main"},
+		{name: "configured branch", branch: "release"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			emulator := newGithubEmulator(t)
+			token := "ghp_test"
+			err := InitClient(&token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			region, bucketName, distributionId, ecrName, name := "ap-northeast-2", "example.com-test", "E1TEST", "cloud-gun-main-api-test", "cloudGun-test"
+			frontend, backend, branch, message := "cloudgun-test-frontend", "cloudgun-test-backend", test.branch, "init"
+			auth := AWSAuth{RoleArn: "arn:aws:iam::123456789012:role/cloudGun/cloudGun-test-deploy"}
+
+			err = CreateS3WebsiteRepository(io.Discard, &region, &frontend, &bucketName, &auth, &distributionId, Vue3, &message, &branch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = CreateCodeRepository(io.Discard, &region, &auth, &ecrName, &name, &name, &name, &name, &backend, &branch, NodeExpressMainApi, &message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			emulator.mutex.Lock()
+			for repoName, workflow := range map[string]string{frontend: Vue3.workflow, backend: NodeExpressMainApi.workflow} {
+				if !emulator.repositories[repoName] {
+					t.Fatalf("expected repository %s to be created", repoName)
+				}
+				// the branch points at the commit of the template, with the workflow deploying on pushes to the branch
+				blob, found := emulator.trees[emulator.commitTrees[emulator.heads[repoName+"/"+branch]]][workflow]
+				if !found {
+					t.Errorf("expected %s on %s of %s", workflow, branch, repoName)
+				} else if trigger := fmt.Sprintf("branches: [ \"%s\" ]", branch); !strings.Contains(emulator.blobs[blob], trigger) {
+					t.Errorf("expected %s of %s to run on %s, got %s", workflow, repoName, trigger, emulator.blobs[blob])
+				}
+			}
+			if len(emulator.unanswered) != 0 {
+				t.Errorf("expected every call to be answered, got %v", emulator.unanswered)
+			}
+			emulator.mutex.Unlock()
+
+			leftovers := DeleteCreatedRepositories(5 * time.Second)
+			if len(leftovers) != 0 {
+				t.Errorf("expected every repository to be deleted, got %v", leftovers)
+			}
+			emulator.mutex.Lock()
+			defer emulator.mutex.Unlock()
+			if len(emulator.repositories) != 0 {
+				t.Errorf("expected no repository left, got %v", emulator.repositories)
+			}
+		})
+	}
+}
+
+func TestTemplateWorkflowBranches(t *testing.T) {
+	tests := []struct {
+		name     string
+		workflow string
+	}{
+		{name: "vue3", workflow: Vue3.path + "/" + Vue3.workflow},
+		{name: "vue3 oidc", workflow: Vue3.oidcWorkflow},
+		{name: "node express", workflow: NodeExpressMainApi.path + "/" + NodeExpressMainApi.workflow},
+		{name: "node express oidc", workflow: NodeExpressMainApi.oidcWorkflow},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content, err := embedded.ReadFile(test.workflow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// setWorkflowBranch only finds the push trigger written this way
+			if !strings.Contains(string(content), workflowBranches) {
+				t.Errorf("expected %s to run on %s", test.workflow, workflowBranches)
+			}
+			branch := "release"
+			if !strings.Contains(string(setWorkflowBranch(content, branch)), "branches: [ \"release\" ]") {
+				t.Errorf("expected %s to run on %s", test.workflow, branch)
+			}
+		})
+	}
+}
+
+func TestCreateRepositoryRefused(t *testing.T) {
+	region, bucketName, distributionId, ecrName, name := "ap-northeast-2", "example.com-test", "E1TEST", "cloud-gun-main-api-test", "cloudGun-test"
+	repoName, branch, message := "cloudgun-test-repository", "main", "init"
+	auth := AWSAuth{RoleArn: "arn:aws:iam::123456789012:role/cloudGun/cloudGun-test-deploy"}
+	tests := []struct {
+		name   string
+		create func() error
+	}{
+		{
+			name: "s3 website",
+			create: func() error {
+				return CreateS3WebsiteRepository(io.Discard, &region, &repoName, &bucketName, &auth, &distributionId, Vue3, &message, &branch)
+			},
+		},
+		{
+			name: "code",
+			create: func() error {
+				return CreateCodeRepository(io.Discard, &region, &auth, &ecrName, &name, &name, &name, &name, &repoName, &branch,
+					NodeExpressMainApi, &message)
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			emulator := newGithubEmulator(t)
+			emulator.refused = true
+			token := "ghp_test"
+			err := InitClient(&token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the error of creating the repository, not of the first call on a repository that is not there
+			err = test.create()
+			if err == nil || !strings.Contains(err.Error(), "Resource not accessible") {
+				t.Errorf("expected the repository to be refused, got %v", err)
+			}
+		})
+	}
+}
@@ -1,37 +1,88 @@
 package githubSdk
 
 type FrontendTemplate struct {
-	name        string
-	description string
-	path        string
-	removePath  string
-	gitIgnore   []string
+	name         string
+	description  string
+	path         string
+	removePath   string
+	gitIgnore    []string
+	workflow     string
+	oidcWorkflow string
 }
 
 var (
 	Vue3 = FrontendTemplate{
-		name:        "vue3",
-		description: "",
-		path:        "embed/vue3-frontend",
-		removePath:  "embed/vue3-frontend",
-		gitIgnore:   []string{"node_modules"},
+		name:         "vue3",
+		description:  "",
+		path:         "embed/vue3-frontend",
+		removePath:   "embed/vue3-frontend",
+		gitIgnore:    []string{"node_modules"},
+		workflow:     ".github/workflows/cloudfront.yml",
+		oidcWorkflow: "embed/workflows/oidc/cloudfront.yml",
 	}
 )
 
+func (template FrontendTemplate) GetName() string {
+	return template.name
+}
+
+// FrontendTemplates are the frontend templates by name.
+var FrontendTemplates = map[string]FrontendTemplate{
+	Vue3.name: Vue3,
+}
+
 type BackendTemplate struct {
-	name        string
-	description string
-	path        string
-	removePath  string
-	gitIgnore   []string
+	name         string
+	description  string
+	path         string
+	removePath   string
+	gitIgnore    []string
+	workflow     string
+	oidcWorkflow string
 }
 
 var (
 	NodeExpressMainApi = BackendTemplate{
-		name:        "nodeExpressMainApi",
-		description: "",
-		path:        "embed/node-express-main-api",
-		removePath:  "embed/node-express-main-api",
-		gitIgnore:   []string{"node_modules"},
+		name:         "nodeExpressMainApi",
+		description:  "",
+		path:         "embed/node-express-main-api",
+		removePath:   "embed/node-express-main-api",
+		gitIgnore:    []string{"node_modules"},
+		workflow:     ".github/workflows/ecs.yml",
+		oidcWorkflow: "embed/workflows/oidc/ecs.yml",
 	}
 )
+
+func (template BackendTemplate) GetName() string {
+	return template.name
+}
+
+// BackendTemplates are the backend templates by name.
+var BackendTemplates = map[string]BackendTemplate{
+	NodeExpressMainApi.name: NodeExpressMainApi,
+}
+
+// AWSAuth is what github actions use to reach aws.
+// either a RoleArn assumed through github oidc or an access key of a stack owned iam user.
+type AWSAuth struct {
+	AccessKey       string
+	SecretAccessKey string
+	SessionToken    string
+	RoleArn         string
+}
+
+func (auth *AWSAuth) isOIDC() bool {
+	return auth.RoleArn != ""
+}
+
+// workflowReplacements changes the workflows of a template on their way to the repository.
+type workflowReplacements struct {
+	files  map[string]string // git path to another embedded file to upload instead
+	branch string            // the workflows deploy on pushes to it
+}
+
+// repositorySecret is a github actions secret saved on a repository.
+type repositorySecret struct {
+	name  string
+	value string
+}
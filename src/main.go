@@ -1,84 +1,37 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"fyc/aws"
 	"fyc/datadogSdk"
 	"fyc/githubSdk"
-	"fyc/uuid"
 	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"io"
 	"os"
-	"regexp"
-	"strings"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
-type arguments struct {
-	GithubToken *string
-	AWSRegion   *string
-	Domain      *string
-	Command     *string
-}
-
 func getArgs() (*arguments, error) {
-	var input = arguments{}
-
-	args := os.Args
-	for _, arg := range args {
-		if strings.HasPrefix(arg, "-githubtoken=") {
-			res, found := strings.CutPrefix(arg, "-githubtoken=")
-			if !found {
-				return nil, errors.New("value of -githubtoken=XXX... is not valid")
-			}
-			input.GithubToken = &res
-		} else if strings.HasPrefix(arg, "-awsregion=") {
-			res, found := strings.CutPrefix(arg, "-awsregion=")
-			if !found {
-				return nil, errors.New("value of -awsregion=XXX... is not valid")
-			}
-			input.AWSRegion = &res
-		} else if strings.HasPrefix(arg, "-domain=") {
-			res, found := strings.CutPrefix(arg, "-domain=")
-			if !found {
-				return nil, errors.New("value of -domain=example.com is not valid")
-			} else if strings.HasPrefix(res, "www.") {
-				return nil, errors.New("value of -domain=example.com should not start with www.")
-			}
-			r, _ := regexp.Compile("([a-z0-9-]+\\.[a-z0-9-]+)")
-			regexResult := r.FindStringSubmatch(res)
-			if len(regexResult) != 2 || res != regexResult[1] || regexResult[0] != regexResult[1] {
-				return nil, errors.New("value of -domain=example.com is not valid")
-			}
-			input.Domain = &res
-		} else if strings.HasPrefix(arg, "-command=") {
-			res, found := strings.CutPrefix(arg, "-command=")
-			if !found {
-				return nil, errors.New("value of -command=XXX... is not valid")
-			} else if res != "create" && res != "delete" {
-				return nil, errors.New("value of -command=XXX... should be -command=create or -command=delete")
-			}
-			input.Command = &res
-		}
+	input, err := parseArgs(os.Args[1:])
+	if err != nil {
+		return nil, err
 	}
-
 	if input.GithubToken == nil {
-		return nil, errors.New("value of -githubtoken=XXX... is not valid")
-	}
-	if input.AWSRegion == nil {
-		return nil, errors.New("value of -awsregion=XXX... is not valid")
+		return input, nil
 	}
-	if input.Domain == nil {
-		return nil, errors.New("value of -domain=example.com is not valid")
+	if input.GithubAPIURL != nil {
+		githubSdk.APIURL = *input.GithubAPIURL
 	}
-	if input.Command == nil {
-		return nil, errors.New("value of -command=XXX... is not valid")
-	}
-
-	err := githubSdk.InitClient(input.GithubToken)
+	err = githubSdk.InitClient(input.GithubToken)
 	if err != nil {
 		return nil, errors.New("github token provided is not valid!")
 	}
-	return &input, nil
+	return input, nil
 }
 
 func main() {
@@ -89,167 +42,549 @@ func main() {
 	// 시간을 기다리면 된다.
 
 	input, err := getArgs()
-	if err != nil {
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if errors.As(err, &usageError{}) {
+		// the flag package already printed it with the usage
+		os.Exit(2)
+	} else if err != nil {
 		fmt.Println("an error has occurred")
 		datadogSdk.Error(err.Error())
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	if *input.Command == "list" {
+		err = listStacks(os.Stdout, *input.Output)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	} else if *input.Command == "status" {
+		err = printStatus(os.Stdout, *input.Output, *input.AWSRegion)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	// with -output=json the progress lines go to stderr, so stdout only holds the plan
+	var progress io.Writer = os.Stdout
+	if *input.Command == "plan" && *input.Output == "json" {
+		progress = os.Stderr
+	}
+	aws.Progress = progress
 	region := input.AWSRegion
 	githubToken := input.GithubToken
 	domain := input.Domain
-	if *region == "us-east-1" {
-		datadogSdk.Error("us-east-1 is not yet supported. You would have to wait for the actual launch of our product!")
-		fmt.Println("us-east-1 is not yet supported. You would have to wait for the actual launch of our product!")
-		os.Exit(1)
+	// ~/.cloudGun/stack-<region>.json, a plan only reads it
+	loadState := aws.LoadState
+	if *input.Command == "plan" {
+		loadState = aws.ReadState
 	}
-	createUUID, err := aws.GetUUID(region) // local 파일에 저장하는 방식으로 변경
+	state, err := loadState(region)
 	if err != nil {
-		fmt.Println("an error has occurred")
+		fmt.Fprintln(progress, "an error has occurred")
 		datadogSdk.Error(err.Error())
-		fmt.Println(err)
+		fmt.Fprintln(progress, err)
 		os.Exit(1)
 	}
-	aws.BaseUUIDTagValue = *createUUID
+	aws.BaseUUIDTagValue = state.UUID
+
+	// ctrl-c cancels the aws and github calls in flight
+	runCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	aws.SetContext(runCtx)
+	githubSdk.SetContext(runCtx)
+	if input.Profile != nil {
+		aws.Profile = *input.Profile
+	}
+	if input.EndpointURL != nil {
+		aws.EndpointURL = *input.EndpointURL
+	}
+	for service, endpointURL := range input.ServiceEndpointURLs {
+		err := aws.SetServiceEndpointURL(service, endpointURL)
+		if err != nil {
+			fmt.Fprintln(progress, err)
+			os.Exit(1)
+		}
+	}
 
-	// credential 이 정확한지 확인 TODO : 해당 내용 2번 호출된다.
-	_, err = aws.GetCredentials()
+	// credential 이 정확한지 확인
+	_, err = aws.GetCredentials(region)
 	if err != nil {
-		fmt.Println("an error has occurred")
+		fmt.Fprintln(progress, "an error has occurred")
 		datadogSdk.Error(err.Error())
-		fmt.Println(err)
+		fmt.Fprintln(progress, aws.DescribeError(err))
 		os.Exit(1)
 	}
+	// 도메인이 아직 route53 에 없으면 hosted zone 을 만들고 registrar 의 delegation 을 기다린다
+	if input.DNSResolver != nil {
+		aws.SetResolver(*input.DNSResolver)
+	}
+	if input.CreateHostedZone {
+		err = aws.CreateHostedZone(region, domain)
+		if err != nil {
+			fmt.Fprintln(progress, "an error has occurred")
+			datadogSdk.Error(err.Error())
+			fmt.Fprintln(progress, aws.DescribeError(err))
+			os.Exit(1)
+		}
+	}
 	// route53 안에 진짜 도메인이 있는지 확인이 필요
-	err = aws.CheckRoute53ForDomain(region, domain)
-	if err != nil {
-		fmt.Println("an error has occurred")
-		datadogSdk.Error(err.Error())
-		fmt.Println(err)
-		os.Exit(1)
+	if domain != nil {
+		err = aws.CheckRoute53ForDomain(region, domain)
+		if err != nil {
+			fmt.Fprintln(progress, "an error has occurred")
+			datadogSdk.Error(err.Error())
+			fmt.Fprintln(progress, err)
+			os.Exit(1)
+		}
 	}
 
-	if *input.Command == "create" {
-		err := createAll(*githubToken, *region, *domain)
+	if *input.Command == "logs" {
+		err := followLogs(input, state.RepoUUID)
+		if err != nil {
+			fmt.Println("an error has occurred")
+			datadogSdk.Error(err.Error())
+			fmt.Println(aws.DescribeError(err))
+			os.Exit(1)
+		}
+	} else if *input.Command == "env" || *input.Command == "secret" {
+		err := runEnv(input, state.RepoUUID)
+		if err != nil {
+			fmt.Println("an error has occurred")
+			datadogSdk.Error(err.Error())
+			fmt.Println(aws.DescribeError(err))
+			os.Exit(1)
+		}
+		if *input.Action != "list" {
+			fmt.Println(fmt.Sprintf("%s %s success", *input.Command, *input.Action))
+		}
+	} else if *input.Command == "deploy" {
+		err := deploy(input.Config, state.RepoUUID)
+		if err != nil {
+			fmt.Println("an error has occurred")
+			datadogSdk.Error(err.Error())
+			fmt.Println(aws.DescribeError(err))
+			os.Exit(1)
+		}
+		fmt.Println("deploy success")
+	} else if *input.Command == "plan" {
+		output := planOutput{Command: "create", Region: *region, Domain: *domain, StackUUID: aws.BaseUUIDTagValue}
+		if input.Destroy {
+			output.Command = "delete"
+			resourceGroupName := getResourceGroupName()
+			output.Resources, err = aws.PlanDeleteResources(region, &resourceGroupName, domain)
+			if err != nil {
+				fmt.Fprintln(progress, "an error has occurred")
+				datadogSdk.Error(err.Error())
+				fmt.Fprintln(progress, aws.DescribeError(err))
+				os.Exit(1)
+			}
+		} else {
+			output.Resources = planCreate(input.Config, state.RepoUUID)
+		}
+		err = printPlan(os.Stdout, *input.Output, output)
+		if err != nil {
+			fmt.Fprintln(progress, err)
+			os.Exit(1)
+		}
+	} else if *input.Command == "create" {
+		err := aws.SetStateInputs(aws.StackInputs{Domain: *domain, Profile: aws.Profile, OIDC: input.OIDC})
 		if err != nil {
 			fmt.Println("an error has occurred")
 			datadogSdk.Error(err.Error())
 			fmt.Println(err)
-			fmt.Println("\nplease delete leftover resources by changing the command -command=delete")
+			os.Exit(1)
+		}
+		err = createAll(runCtx, *githubToken, input.Config, state.RepoUUID)
+		if err != nil {
+			// a second ctrl-c during the rollback kills cloudGun right away
+			stop()
+			if runCtx.Err() != nil {
+				fmt.Println("\ninterrupted")
+			} else {
+				fmt.Println("an error has occurred")
+			}
+			datadogSdk.Error(err.Error())
+			fmt.Println(aws.DescribeError(err))
+			if input.NoRollback {
+				fmt.Println("\nresources were kept because of -no-rollback")
+				fmt.Println("run cloudgun create again to resume from where it stopped, or delete leftover resources with cloudgun delete")
+				os.Exit(1)
+			}
+			rollback()
 			os.Exit(1)
 		}
 		datadogSdk.Info("creation success")
 		fmt.Println("creation success")
 	} else if *input.Command == "delete" {
-		err := deleteAll(*region, aws.BaseUUIDTagValue)
+		err := deleteAll(*region, *domain, aws.BaseUUIDTagValue)
 		if err != nil {
 			fmt.Println("an error has occurred")
 			datadogSdk.Error(err.Error())
-			fmt.Println(err)
+			fmt.Println(aws.DescribeError(err))
 			os.Exit(1)
 		}
 		datadogSdk.Info("deletion success")
 		fmt.Println("cloudGun deletion success")
-		_, err = aws.ReplaceUUID(region)
-		os.Exit(1)
+		_, err = aws.ResetState(region)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	}
 }
 
-func createAll(githubToken string, region string, domain string) error {
-	credentials, err := aws.GetCredentials()
-	if err != nil {
-		return err
+// rollback deletes what this run created and reports what is left behind.
+func rollback() {
+	fmt.Println("\nrolling back resources created in this run. press ctrl-c again to stop")
+	leftovers := aws.Rollback(30 * time.Minute)
+	repoLeftovers := githubSdk.DeleteCreatedRepositories(2 * time.Minute)
+	if len(leftovers) == 0 && len(repoLeftovers) == 0 {
+		datadogSdk.Info("rollback success")
+		fmt.Println("rollback success")
+		return
+	}
+	datadogSdk.Error(fmt.Sprintf("rollback left %d resources", len(leftovers)+len(repoLeftovers)))
+	fmt.Println("\ncould not remove the following resources")
+	for _, resource := range leftovers {
+		fmt.Println(fmt.Sprintf("  %s %s (%s)", resource.Type, resource.Id, resource.Region))
 	}
+	for _, repoName := range repoLeftovers {
+		fmt.Println(fmt.Sprintf("  github repository %s (delete it on github)", repoName))
+	}
+	fmt.Println("please delete the aws resources with cloudgun delete")
+}
+
+// stackNames are the names createAll gives to what it creates.
+type stackNames struct {
+	branch         string
+	bucket         string
+	cluster        string
+	service        string
+	taskFamily     string
+	container      string
+	alb            string
+	targetGroup    string
+	resourceGroup  string
+	ecr            string
+	logGroup       string
+	deployIdentity string
+	frontendRepo   string
+	backendRepo    string
+	mainApiDomain  string
+}
 
-	awsAccessKey := credentials.AccessKey
-	awsSecretAccessKey := credentials.SecretAccessKey
-	commitMessage := "good first commit from cloudGun"
-	branchName := "main"
+func getStackNames(config *stackConfig, repoUUID string) stackNames {
+	domain := config.Domain
 	resourceName := "cloudGun"
-	bucketName := domain + "-" + aws.BaseUUIDTagValue
-	clusterName := resourceName + "-" + aws.BaseUUIDTagValue
-	serviceName := resourceName + "-" + aws.BaseUUIDTagValue
-	taskFamilyName := resourceName + "-" + aws.BaseUUIDTagValue
-	containerName := resourceName + "-" + aws.BaseUUIDTagValue
-	albName := resourceName + "-" + aws.BaseUUIDTagValue
-	targetGroupName := resourceName + "-" + aws.BaseUUIDTagValue
-	resourceGroupName := resourceName + "-" + aws.BaseUUIDTagValue
-	ecrName := "cloud-gun-main-api-" + aws.BaseUUIDTagValue
+	return stackNames{
+		branch:         config.Github.Branch,
+		bucket:         domain + "-" + aws.BaseUUIDTagValue,
+		cluster:        resourceName + "-" + aws.BaseUUIDTagValue,
+		service:        resourceName + "-" + aws.BaseUUIDTagValue,
+		taskFamily:     resourceName + "-" + aws.BaseUUIDTagValue,
+		container:      resourceName + "-" + aws.BaseUUIDTagValue,
+		alb:            resourceName + "-" + aws.BaseUUIDTagValue,
+		targetGroup:    resourceName + "-" + aws.BaseUUIDTagValue,
+		resourceGroup:  resourceName + "-" + aws.BaseUUIDTagValue,
+		ecr:            "cloud-gun-main-api-" + aws.BaseUUIDTagValue,
+		logGroup:       aws.LogGroupName(resourceName + "-" + aws.BaseUUIDTagValue),
+		deployIdentity: resourceName + "-" + aws.BaseUUIDTagValue + "-deploy",
+		frontendRepo:   "cloud-gun-frontend-" + repoUUID,
+		backendRepo:    "cloud-gun-main-api-" + repoUUID,
+		mainApiDomain:  config.Api.Subdomain + "." + domain,
+	}
+}
 
-	fmt.Println("InitClient")
-	err = githubSdk.InitClient(&githubToken)
-	if err != nil {
-		return err
+// getResourceGroupName returns the resource group of the stack, the one in the state when it was created with another name.
+func getResourceGroupName() string {
+	resourceGroupName := "cloudGun-" + aws.BaseUUIDTagValue
+	for _, group := range aws.GetStateResources(aws.ResourceGroupsGroup) {
+		resourceGroupName = group.Attributes["name"]
 	}
+	return resourceGroupName
+}
 
-	err = aws.CreateResourceGroup(&resourceGroupName, &region)
+func createAll(ctx context.Context, githubToken string, config *stackConfig, repoUUID string) error {
+	region := config.Region
+	domain := config.Domain
+	oidc := config.OIDC
+	commitMessage := config.Github.CommitMessage
+	frontendTemplate := githubSdk.FrontendTemplates[config.Github.FrontendTemplate]
+	backendTemplate := githubSdk.BackendTemplates[config.Github.BackendTemplate]
+	names := getStackNames(config, repoUUID)
+	branchName := names.branch
+	bucketName := names.bucket
+	clusterName := names.cluster
+	serviceName := names.service
+	taskFamilyName := names.taskFamily
+	containerName := names.container
+	albName := names.alb
+	targetGroupName := names.targetGroup
+	resourceGroupName := names.resourceGroup
+	ecrName := names.ecr
+	deployIdentityName := names.deployIdentity
+	frontendRepoName := names.frontendRepo
+	backendRepoName := names.backendRepo
+
+	fmt.Println("InitClient")
+	err := githubSdk.InitClient(&githubToken)
 	if err != nil {
 		return err
 	}
 
-	// creating aws s3, cloudfront
-	distributionId, err := aws.CreateS3Website(&bucketName, &domain, &region)
-	if err != nil {
-		return err
+	// the first failing task cancels the calls in flight of every other branch
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	aws.SetContext(ctx)
+	githubSdk.SetContext(ctx)
+
+	// values handed from a task to the tasks depending on it
+	var distributionId *string
+	var imageURI *string
+	var ecsArn *string
+	var ecsRoles *aws.ECSRoles
+	var auth githubSdk.AWSAuth
+	frontendDone := aws.IsStepCompleted("createFrontendRepository")
+	backendDone := aws.IsStepCompleted("createBackendRepository")
+
+	tasks := []*task{
+		{
+			name:   "createResourceGroup",
+			branch: "aws",
+			run: func(progress io.Writer) error {
+				return aws.CreateResourceGroup(progress, &resourceGroupName, &region)
+			},
+		},
+		{
+			// creating aws s3, cloudfront
+			name:      "createS3Website",
+			branch:    "static-site",
+			dependsOn: []string{"createResourceGroup"},
+			run: func(progress io.Writer) error {
+				var err error
+				distributionId, err = aws.CreateS3Website(progress, &bucketName, &domain, &region, config.WWW)
+				return err
+			},
+		},
+		{
+			// the task definition runs the image of the repository, so it is there before the cluster
+			name:      "createECR",
+			branch:    "ecs",
+			dependsOn: []string{"createResourceGroup"},
+			run: func(progress io.Writer) error {
+				var err error
+				imageURI, err = aws.CreateECR(progress, &region, &ecrName)
+				return err
+			},
+		},
+		{
+			// the awslogs driver of the task definition writes to it
+			name:      "createLogGroup",
+			branch:    "ecs",
+			dependsOn: []string{"createResourceGroup"},
+			run: func(progress io.Writer) error {
+				return aws.CreateLogGroup(progress, &region, &names.logGroup, &config.Logs.RetentionDays)
+			},
+		},
+		{
+			// the instances and the tasks of the cluster run with them
+			name:      "createECSRoles",
+			branch:    "ecs",
+			dependsOn: []string{"createResourceGroup"},
+			run: func(progress io.Writer) error {
+				var err error
+				ecsRoles, err = aws.CreateECSRoles(progress, &region, &clusterName, config.launchType())
+				return err
+			},
+		},
+		{
+			name:      "createECSCluster",
+			branch:    "ecs",
+			dependsOn: []string{"createECR", "createLogGroup", "createECSRoles"},
+			run: func(progress io.Writer) error {
+				var err error
+				ecsArn, err = aws.CreateECSCluster(progress, &region, &clusterName, &taskFamilyName, &containerName, imageURI,
+					&config.Cluster.Min, &config.Cluster.Max, &config.Cluster.Desired, ec2Types.InstanceType(config.Cluster.InstanceType),
+					config.image(), config.containerSpec(), config.launchType(), ecsRoles)
+				return err
+			},
+		},
+		{
+			// the load balancer uses the security group of an ec2 cluster
+			name:      "createELB",
+			branch:    "ecs",
+			dependsOn: []string{"createECSCluster"},
+			run: func(progress io.Writer) error {
+				return aws.CreateELB(progress, &region, &domain, &names.mainApiDomain, &albName, &targetGroupName, config.WWW, config.launchType())
+			},
+		},
+		{
+			name:      "connectECSServiceToALB",
+			branch:    "ecs",
+			dependsOn: []string{"createECSCluster", "createELB"},
+			run: func(progress io.Writer) error {
+				return aws.ConnectECSServiceToALB(progress, &region, &serviceName, ecsArn, &taskFamilyName, &albName, &containerName,
+					&config.Container.Port, &targetGroupName, config.launchType())
+			},
+		},
+		{
+			// github actions only get a stack scoped iam identity, never the operator credentials
+			name:      "createDeployIdentity",
+			branch:    "github",
+			dependsOn: []string{"createS3Website"},
+			run: func(progress io.Writer) error {
+				if frontendDone && backendDone {
+					fmt.Fprintln(progress, "github repositories are already created, skipping deploy identity")
+					return nil
+				}
+				deployTarget := aws.DeployTarget{
+					BucketName:     bucketName,
+					DistributionId: *distributionId,
+					ECRName:        ecrName,
+					ClusterName:    clusterName,
+					ServiceName:    serviceName,
+				}
+				if oidc {
+					subjects := []string{
+						githubSdk.GetOIDCSubject(&frontendRepoName, &branchName),
+						githubSdk.GetOIDCSubject(&backendRepoName, &branchName),
+					}
+					roleArn, err := aws.CreateDeployRole(progress, &region, &deployIdentityName, &subjects, &deployTarget)
+					if err != nil {
+						return err
+					}
+					auth = githubSdk.AWSAuth{RoleArn: *roleArn}
+					return nil
+				}
+				deployCredentials, err := aws.CreateDeployUser(progress, &region, &deployIdentityName, &deployTarget)
+				if err != nil {
+					return err
+				}
+				auth = githubSdk.AWSAuth{
+					AccessKey:       deployCredentials.AccessKey,
+					SecretAccessKey: deployCredentials.SecretAccessKey,
+					SessionToken:    deployCredentials.SessionToken,
+				}
+				// the previous key is deleted, so a repository created by a resumed run has to get the new one
+				for repoName, done := range map[string]bool{frontendRepoName: frontendDone, backendRepoName: backendDone} {
+					if !done {
+						continue
+					}
+					fmt.Fprintln(progress, fmt.Sprintf("saveAWSAuth %s", repoName))
+					err = githubSdk.SaveAWSAuth(&repoName, &auth)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			// creating s3 website repo
+			name:      "createFrontendRepository",
+			branch:    "frontend-repo",
+			dependsOn: []string{"createS3Website", "createDeployIdentity"},
+			run: func(progress io.Writer) error {
+				if frontendDone {
+					fmt.Fprintln(progress, fmt.Sprintf("repository %s is already created", frontendRepoName))
+					return nil
+				}
+				err := githubSdk.CreateS3WebsiteRepository(progress, &region, &frontendRepoName, &bucketName, &auth, distributionId,
+					frontendTemplate, &commitMessage, &branchName)
+				if err != nil {
+					return err
+				}
+				frontendTemplateName := frontendTemplate.GetName()
+				return aws.RecordRepository(githubSdk.GetLogin(), &frontendRepoName, &frontendTemplateName)
+			},
+		},
+		{
+			// creating main-api repo. its first push deploys to the service, so everything has to be there
+			name:      "createBackendRepository",
+			branch:    "backend-repo",
+			dependsOn: []string{"createDeployIdentity", "createECR", "connectECSServiceToALB"},
+			run: func(progress io.Writer) error {
+				if backendDone {
+					fmt.Fprintln(progress, fmt.Sprintf("repository %s is already created", backendRepoName))
+					return nil
+				}
+				err := githubSdk.CreateCodeRepository(progress, &region, &auth, &ecrName, &clusterName,
+					&serviceName, &taskFamilyName, &containerName, &backendRepoName, &branchName, backendTemplate, &commitMessage)
+				if err != nil {
+					return err
+				}
+				backendTemplateName := backendTemplate.GetName()
+				return aws.RecordRepository(githubSdk.GetLogin(), &backendRepoName, &backendTemplateName)
+			},
+		},
 	}
-	repoUUID, _ := uuid.CreateUUID()
-	// creating s3 website repo
-	frontendRepoName := "cloud-gun-frontend-" + *repoUUID
-	err = githubSdk.CreateS3WebsiteRepository(&region, &frontendRepoName, &bucketName, &awsAccessKey, &awsSecretAccessKey,
-		distributionId, githubSdk.Vue3, &commitMessage, &branchName)
-	if err != nil {
-		return err
+	for _, t := range tasks {
+		run := t.run
+		name := t.name
+		t.run = func(progress io.Writer) error {
+			err := run(progress)
+			if err != nil {
+				return err
+			}
+			return aws.CompleteStep(name)
+		}
 	}
+	return runTasks(ctx, cancel, aws.Progress, tasks)
+}
 
-	//// creating ecs
-	var min int32 = 1
-	var max int32 = 3
-	var desired int32 = 1
-	ecsArn, err := aws.CreateECSCluster(&region, &clusterName, &taskFamilyName, &containerName, &min, &max, &desired,
-		ec2Types.InstanceTypeT2Micro, aws.AmazonLinux2)
-	if err != nil {
-		return err
+// deploy restarts the tasks of the stack on their current task definition. a push to the main-api repository
+// registers a new revision itself.
+func deploy(config *stackConfig, repoUUID string) error {
+	if !aws.IsStepCompleted("connectECSServiceToALB") {
+		return errors.New(fmt.Sprintf("the stack in %s has no ecs service yet, run cloudgun create first", config.Region))
 	}
+	names := getStackNames(config, repoUUID)
+	return aws.DeployECSService(&config.Region, &names.cluster, &names.service)
+}
 
-	// create alb
-	mainApiDomain := "main-api." + domain
-	err = aws.CreateELB(&region, &domain, &mainApiDomain, &albName, &targetGroupName)
-	if err != nil {
-		return err
+// followLogs prints the logs of the backend containers until ctrl-c.
+func followLogs(input *arguments, repoUUID string) error {
+	if !aws.IsStepCompleted("createLogGroup") {
+		return errors.New(fmt.Sprintf("the stack in %s has no log group yet, run cloudgun create first", input.Config.Region))
 	}
-
-	// connect ecs with alb
-	err = aws.ConnectECSServiceToALB(&region, &serviceName, ecsArn, &taskFamilyName, &albName, &containerName, &targetGroupName)
-	if err != nil {
-		return err
+	names := getStackNames(input.Config, repoUUID)
+	filter := aws.LogFilter{Since: input.Since}
+	if input.Grep != nil {
+		filter.Pattern = *input.Grep
 	}
+	fmt.Println(fmt.Sprintf("following %s since %s, ctrl-c to stop", names.logGroup, input.Since.Format(time.RFC3339)))
+	return aws.FollowLogs(os.Stdout, &input.Config.Region, &names.logGroup, filter)
+}
 
-	// create ecr
-	err = aws.CreateECR(&region, &ecrName) // TODO : 지정된 생성된 자동 삭제 기능 추가
-	if err != nil && !strings.Contains(err.Error(), "already exists in the registry with id") {
-		return err
+// runEnv lists or changes the environment of the backend containers. a change rolls the service.
+func runEnv(input *arguments, repoUUID string) error {
+	if !aws.IsStepCompleted("connectECSServiceToALB") {
+		return errors.New(fmt.Sprintf("the stack in %s has no ecs service yet, run cloudgun create first", input.Config.Region))
 	}
-
-	// creating main-api repo
-	backendRepoName := "cloud-gun-main-api-" + *repoUUID
-	err = githubSdk.CreateCodeRepository(&region, &awsAccessKey, &awsSecretAccessKey, &ecrName, &clusterName,
-		&serviceName, &taskFamilyName, &containerName, &backendRepoName, &branchName, githubSdk.NodeExpressMainApi)
-	if err != nil {
-		return err
+	names := getStackNames(input.Config, repoUUID)
+	region := &input.Config.Region
+	switch *input.Action {
+	case "list":
+		vars, err := aws.ListEnv(region, &names.cluster)
+		if err != nil {
+			return err
+		}
+		return printEnv(os.Stdout, vars)
+	case "unset":
+		return aws.UnsetEnv(region, &names.cluster, &names.taskFamily, &names.service, input.EnvNames)
 	}
-	return nil
+	return aws.SetEnv(region, &names.cluster, &names.taskFamily, &names.service, input.Env, *input.Command == "secret")
 }
 
-func deleteAll(region string, uuid string) error {
-	// TODO : CreateS3Website 의 createCertificateRecord() 는 삭제되지 않는다. 해당 내용 삭제 필요
-	// TODO : CreateELB 의 createCertificateRecord() 또한 삭제되지 않는다. 해당 내용 삭제 필요
-	// TODO : Cloudfront 가 너무너무너너너무 느리다.
-	// TODO : certificate 가 내부의 ELB 로 인해 삭제가 되지 않는 이슈가 있다.
-	resourceName := "cloudGun"
+func deleteAll(region string, domain string, uuid string) error {
 	aws.BaseUUIDTagValue = uuid
-	resourceGroupName := resourceName + "-" + aws.BaseUUIDTagValue
-	err := aws.DeleteResources(&region, &resourceGroupName)
-	if err != nil && !strings.Contains(err.Error(), "NotFoundException: Cannot find group") {
+	resourceGroupName := getResourceGroupName()
+	err := aws.DeleteResources(&region, &resourceGroupName, &domain)
+	if err != nil {
 		return err
 	}
 	fmt.Println(fmt.Sprintf("All previous resources are deleted. check out https://%s.console.aws.amazon.com/resource-groups/home?region=%s", region, region))
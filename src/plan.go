@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"fyc/aws"
+	"fyc/githubSdk"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"io"
+	"slices"
+	"strings"
+)
+
+// planOutput is what cloudgun plan -output=json prints.
+type planOutput struct {
+	Command   string                `json:"command"`
+	Region    string                `json:"region"`
+	Domain    string                `json:"domain"`
+	StackUUID string                `json:"stackUUID"`
+	Resources []aws.PlannedResource `json:"resources"`
+}
+
+// planCreate lists what createAll would create, step by step. what a step completed by an earlier run created is kept.
+func planCreate(config *stackConfig, repoUUID string) []aws.PlannedResource {
+	region := config.Region
+	domain := config.Domain
+	oidc := config.OIDC
+	names := getStackNames(config, repoUUID)
+	steps := []struct {
+		name string
+		plan []aws.PlannedResource
+	}{
+		{"createResourceGroup", aws.PlanResourceGroup(&names.resourceGroup, &region)},
+		{"createS3Website", aws.PlanS3Website(&names.bucket, &domain, &region, config.WWW)},
+		{"createECR", aws.PlanECR(&region, &names.ecr)},
+		{"createLogGroup", aws.PlanLogGroup(&region, &names.logGroup, &config.Logs.RetentionDays)},
+		{"createECSRoles", aws.PlanECSRoles(&region, &names.cluster, config.launchType())},
+		{"createECSCluster", aws.PlanECSCluster(&region, &names.cluster, &names.taskFamily, &names.container, &names.ecr,
+			&config.Cluster.Min, &config.Cluster.Max, &config.Cluster.Desired, ec2Types.InstanceType(config.Cluster.InstanceType),
+			config.image(), config.containerSpec(), config.launchType())},
+		{"createELB", aws.PlanELB(&region, &domain, &names.mainApiDomain, &names.alb, &names.targetGroup, config.WWW, config.launchType())},
+		{"connectECSServiceToALB", aws.PlanECSService(&region, &names.service, &names.cluster, &names.taskFamily, &names.targetGroup,
+			&names.alb, &config.Container.Port, config.launchType())},
+		{"createDeployIdentity", aws.PlanDeployIdentity(&region, &names.deployIdentity, oidc)},
+		{"createFrontendRepository", planRepository(names.frontendRepo, config.Github.FrontendTemplate, names.branch,
+			githubSdk.GetS3WebsiteSecretNames(oidc))},
+		{"createBackendRepository", planRepository(names.backendRepo, config.Github.BackendTemplate, names.branch,
+			githubSdk.GetCodeRepositorySecretNames(oidc))},
+	}
+
+	plan := make([]aws.PlannedResource, 0)
+	seen := make(map[string]bool)
+	for _, step := range steps {
+		completed := aws.IsStepCompleted(step.name)
+		for _, resource := range step.plan {
+			// certificates of the same domains share their validation records
+			key := fmt.Sprintf("%s/%s/%s", resource.Type, resource.Region, resource.Name)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			resource.Step = step.name
+			if completed {
+				resource.Action = aws.PlanKeep
+			}
+			plan = append(plan, resource)
+		}
+	}
+	return plan
+}
+
+func planRepository(name string, template string, branch string, secrets []string) []aws.PlannedResource {
+	fullName := *githubSdk.GetLogin() + "/" + name
+	plan := []aws.PlannedResource{{
+		Action:  aws.PlanCreate,
+		Type:    aws.GithubRepository,
+		Name:    fullName,
+		Details: map[string]string{"template": template, "branch": branch},
+	}}
+	for _, secret := range secrets {
+		plan = append(plan, aws.PlannedResource{
+			Action:  aws.PlanCreate,
+			Type:    aws.GithubSecret,
+			Name:    secret,
+			Details: map[string]string{"repository": fullName},
+		})
+	}
+	return plan
+}
+
+// printPlan prints a plan like terraform does, or as json.
+func printPlan(out io.Writer, output string, plan planOutput) error {
+	if output == "json" {
+		return writeJSON(out, plan)
+	}
+
+	fmt.Fprintln(out, fmt.Sprintf("\ncloudGun %s plan of %s in %s (stack %s)", plan.Command, plan.Domain, plan.Region, plan.StackUUID))
+	counts := make(map[aws.PlanAction]int)
+	step := ""
+	for _, resource := range plan.Resources {
+		counts[resource.Action]++
+		if resource.Step != step {
+			step = resource.Step
+			fmt.Fprintln(out, fmt.Sprintf("\n%s", step))
+		}
+		symbol := map[aws.PlanAction]string{aws.PlanCreate: "+", aws.PlanKeep: "=", aws.PlanDelete: "-"}[resource.Action]
+		line := fmt.Sprintf("  %s %s %s", symbol, resource.Type, resource.Name)
+		if resource.Region != "" {
+			line += fmt.Sprintf(" (%s)", resource.Region)
+		}
+		fmt.Fprintln(out, line)
+		keys := make([]string, 0, len(resource.Details))
+		for key := range resource.Details {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			fmt.Fprintln(out, fmt.Sprintf("      %s: %s", key, resource.Details[key]))
+		}
+	}
+	if len(plan.Resources) == 0 {
+		fmt.Fprintln(out, "\nnothing to do")
+	}
+	summary := []string{
+		fmt.Sprintf("%d to create", counts[aws.PlanCreate]),
+		fmt.Sprintf("%d to keep", counts[aws.PlanKeep]),
+		fmt.Sprintf("%d to delete", counts[aws.PlanDelete]),
+	}
+	fmt.Fprintln(out, fmt.Sprintf("\nPlan: %s.", strings.Join(summary, ", ")))
+	return nil
+}
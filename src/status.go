@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"fyc/aws"
+	"io"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// stackSummary is a line of cloudgun list.
+type stackSummary struct {
+	Region       string    `json:"region"`
+	UUID         string    `json:"uuid"`
+	Domain       string    `json:"domain"`
+	Resources    int       `json:"resources"`
+	Repositories int       `json:"repositories"`
+	Steps        int       `json:"steps"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+func listStacks(out io.Writer, output string) error {
+	states, err := aws.ListStates()
+	if err != nil {
+		return err
+	}
+	summaries := make([]stackSummary, 0, len(states))
+	for _, state := range states {
+		summaries = append(summaries, stackSummary{
+			Region:       state.Region,
+			UUID:         state.UUID,
+			Domain:       state.Inputs.Domain,
+			Resources:    len(state.Resources),
+			Repositories: len(state.Repositories),
+			Steps:        len(state.Steps),
+			UpdatedAt:    state.UpdatedAt,
+		})
+	}
+	if output == "json" {
+		return writeJSON(out, summaries)
+	}
+
+	if len(summaries) == 0 {
+		fmt.Fprintln(out, "no stacks yet, create one with cloudgun create")
+		return nil
+	}
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "REGION\tDOMAIN\tSTACK\tRESOURCES\tREPOSITORIES\tUPDATED")
+	for _, summary := range summaries {
+		domain := summary.Domain
+		if domain == "" {
+			domain = "-"
+		}
+		fmt.Fprintln(writer, fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%s", summary.Region, domain, summary.UUID,
+			summary.Resources, summary.Repositories, summary.UpdatedAt.Local().Format(time.DateTime)))
+	}
+	return writer.Flush()
+}
+
+// printStatus prints the state of the stack in region as cloudGun last saved it, without calling aws.
+func printStatus(out io.Writer, output string, region string) error {
+	states, err := aws.ListStates()
+	if err != nil {
+		return err
+	}
+	index := slices.IndexFunc(states, func(state aws.StackState) bool { return state.Region == region })
+	if index == -1 {
+		return errors.New(fmt.Sprintf("there is no stack in %s", region))
+	}
+	state := states[index]
+	if output == "json" {
+		return writeJSON(out, state)
+	}
+
+	fmt.Fprintln(out, fmt.Sprintf("stack %s in %s", state.UUID, state.Region))
+	if state.Inputs.Domain != "" {
+		fmt.Fprintln(out, fmt.Sprintf("  domain: %s", state.Inputs.Domain))
+	}
+	fmt.Fprintln(out, fmt.Sprintf("  created: %s", state.CreatedAt.Local().Format(time.DateTime)))
+	fmt.Fprintln(out, fmt.Sprintf("  updated: %s", state.UpdatedAt.Local().Format(time.DateTime)))
+
+	fmt.Fprintln(out, "\ncompleted steps")
+	for _, step := range state.Steps {
+		fmt.Fprintln(out, fmt.Sprintf("  %s (%s)", step.Name, step.CompletedAt.Local().Format(time.DateTime)))
+	}
+	if len(state.Steps) == 0 {
+		fmt.Fprintln(out, "  none")
+	}
+
+	fmt.Fprintln(out, "\nresources")
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, resource := range state.Resources {
+		fmt.Fprintln(writer, fmt.Sprintf("  %s\t%s\t%s", resource.Type, resource.Id, resource.Region))
+	}
+	err = writer.Flush()
+	if err != nil {
+		return err
+	}
+	if len(state.Resources) == 0 {
+		fmt.Fprintln(out, "  none")
+	}
+
+	if len(state.Repositories) != 0 {
+		fmt.Fprintln(out, "\nrepositories")
+		for _, repository := range state.Repositories {
+			fmt.Fprintln(out, fmt.Sprintf("  %s/%s (%s)", repository.Owner, repository.Name, repository.Template))
+		}
+	}
+	return nil
+}
+
+// printEnv prints the environment of the backend containers. the values of secrets are never read back.
+func printEnv(out io.Writer, vars []aws.EnvVar) error {
+	if len(vars) == 0 {
+		fmt.Fprintln(out, "no environment variables yet, set one with cloudgun env set NAME=value")
+		return nil
+	}
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAME\tVALUE")
+	for _, envVar := range vars {
+		value := envVar.Value
+		if envVar.Secret {
+			value = "(secret)"
+		}
+		fmt.Fprintln(writer, fmt.Sprintf("%s\t%s", envVar.Name, value))
+	}
+	return writer.Flush()
+}
+
+func writeJSON(out io.Writer, value any) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// task is a step of createAll. branch is only used to tell the interleaved progress of parallel branches apart,
+// run writes its progress to a writer putting the branch in front of every line.
+type task struct {
+	name      string
+	branch    string
+	dependsOn []string
+	run       func(progress io.Writer) error
+
+	done chan struct{}
+	err  error
+}
+
+// branchWriter writes whole lines to out with the branch of a task in front. the writers of runTasks share mutex,
+// so the lines of parallel branches never mix.
+type branchWriter struct {
+	out    io.Writer
+	mutex  *sync.Mutex
+	branch string
+	line   []byte // written but not ended by a newline yet
+}
+
+func (writer *branchWriter) Write(p []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	writer.line = append(writer.line, p...)
+	for {
+		end := bytes.IndexByte(writer.line, '\n')
+		if end == -1 {
+			return len(p), nil
+		}
+		_, err := fmt.Fprintf(writer.out, "[%s] %s", writer.branch, writer.line[:end+1])
+		writer.line = writer.line[end+1:]
+		if err != nil {
+			return len(p), err
+		}
+	}
+}
+
+// flush writes the last line of a task that did not end it.
+func (writer *branchWriter) flush() {
+	if len(writer.line) > 0 {
+		_, _ = writer.Write([]byte("\n"))
+	}
+}
+
+// runTasks runs every task as soon as the tasks it depends on are done, independent tasks in parallel.
+// the first failure cancels ctx so the calls in flight of the other branches stop too.
+// the progress of every task goes to out, each line with the branch of its task in front.
+func runTasks(ctx context.Context, cancel context.CancelFunc, out io.Writer, tasks []*task) error {
+	byName := make(map[string]*task)
+	for _, t := range tasks {
+		t.done = make(chan struct{})
+		byName[t.name] = t
+	}
+	for _, t := range tasks {
+		for _, dependency := range t.dependsOn {
+			if _, ok := byName[dependency]; !ok {
+				return errors.New(fmt.Sprintf("task %s depends on unknown task %s", t.name, dependency))
+			}
+		}
+	}
+
+	var firstErr error
+	var errMutex sync.Mutex
+	// fail reports whether t is the first task to fail. the other failures are just the cancellation
+	fail := func(t *task, err error) bool {
+		errMutex.Lock()
+		defer errMutex.Unlock()
+		t.err = err
+		if firstErr != nil {
+			return false
+		}
+		firstErr = fmt.Errorf("%s failed : %w", t.name, err) // keeps the aws error for DescribeError
+		cancel()
+		return true
+	}
+
+	var outMutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, t := range tasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(t.done)
+			progress := &branchWriter{out: out, mutex: &outMutex, branch: t.branch}
+			for _, dependency := range t.dependsOn {
+				select {
+				case <-byName[dependency].done:
+				case <-ctx.Done():
+				}
+				if ctx.Err() != nil {
+					t.err = ctx.Err()
+					return
+				}
+			}
+			fmt.Fprintln(progress, fmt.Sprintf("%s started", t.name))
+			start := time.Now()
+			err := t.run(progress)
+			progress.flush()
+			if err != nil {
+				if fail(t, err) {
+					fmt.Fprintln(progress, fmt.Sprintf("%s failed : %s", t.name, err.Error()))
+				} else {
+					fmt.Fprintln(progress, fmt.Sprintf("%s cancelled", t.name))
+				}
+				return
+			}
+			fmt.Fprintln(progress, fmt.Sprintf("%s done in %s", t.name, time.Since(start).Round(time.Second)))
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
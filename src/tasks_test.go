@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRunTasksProgress(t *testing.T) {
+	tests := []struct {
+		name      string
+		tasks     func() []*task
+		wantErr   bool
+		wantLines []string
+	}{
+		{
+			name: "parallel branches",
+			tasks: func() []*task {
+				return []*task{
+					{name: "createResourceGroup", branch: "aws", run: func(progress io.Writer) error {
+						fmt.Fprintln(progress, "createResourceGroup")
+						return nil
+					}},
+					{name: "createS3Website", branch: "static-site", dependsOn: []string{"createResourceGroup"}, run: func(progress io.Writer) error {
+						fmt.Fprintln(progress, "createBucket")
+						fmt.Fprint(progress, "waiting for acm ")
+						fmt.Fprint(progress, "certificate\nputBucketPolicy\nunfinished")
+						return nil
+					}},
+					{name: "createECR", branch: "ecs", dependsOn: []string{"createResourceGroup"}, run: func(progress io.Writer) error {
+						fmt.Fprintln(progress, "createECRRepository")
+						return nil
+					}},
+				}
+			},
+			wantLines: []string{
+				"[aws] createResourceGroup started", "[aws] createResourceGroup", "[static-site] createS3Website started",
+				"[static-site] createBucket", "[static-site] waiting for acm certificate", "[static-site] putBucketPolicy",
+				"[static-site] unfinished", "[ecs] createECR started", "[ecs] createECRRepository",
+			},
+		},
+		{
+			name: "failure",
+			tasks: func() []*task {
+				return []*task{
+					{name: "createECR", branch: "ecs", run: func(progress io.Writer) error {
+						fmt.Fprintln(progress, "createECRRepository")
+						return errors.New("RepositoryPolicyNotFoundException")
+					}},
+				}
+			},
+			wantErr:   true,
+			wantLines: []string{"[ecs] createECR started", "[ecs] createECRRepository", "[ecs] createECR failed : RepositoryPolicyNotFoundException"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			err := runTasks(ctx, cancel, &out, test.tasks())
+			if (err != nil) != test.wantErr {
+				t.Fatalf("expected error %v, got %v", test.wantErr, err)
+			}
+			lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			for _, line := range lines {
+				if !strings.HasPrefix(line, "[") {
+					t.Errorf("expected every line to start with its branch, got %q", line)
+				}
+			}
+			for _, want := range test.wantLines {
+				if !slices.Contains(lines, want) {
+					t.Errorf("expected %q in %q", want, lines)
+				}
+			}
+		})
+	}
+}